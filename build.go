@@ -6,9 +6,47 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"time"
 )
 
-var ErrBuildFailed = errors.New("build failed") //nolint:revive
+var (
+	ErrBuildFailed = errors.New("build failed") //nolint:revive
+	// ErrArtifactUnchanged signals the build request resolves to the artifact the client already has.
+	// See BuildOpts.CurrentArtifact
+	ErrArtifactUnchanged = errors.New("artifact unchanged")
+	// ErrBuildQueueFull signals the build service is not accepting more builds because too many
+	// are waiting to start. See QueueFullError
+	ErrBuildQueueFull = errors.New("build queue full")
+	// ErrInsufficientSpace signals the build service doesn't have enough free space for building
+	ErrInsufficientSpace = errors.New("insufficient space for building")
+	// ErrProxyAuth signals the go module proxy rejected the build service's credentials
+	ErrProxyAuth = errors.New("module proxy authentication failed")
+	// ErrArtifactNotFound signals the artifact is not available in the build service's store
+	ErrArtifactNotFound = errors.New("artifact not found")
+)
+
+// QueueFullError is returned when a build is rejected because the build queue is full.
+// It matches ErrBuildQueueFull.
+type QueueFullError struct {
+	// Position the build would have had in the queue (1 for the first)
+	Position int
+	// EstimatedWait for the build to start in that position. Zero if unknown.
+	EstimatedWait time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	msg := fmt.Sprintf("%s (queue position %d", ErrBuildQueueFull, e.Position)
+	if e.EstimatedWait > 0 {
+		msg += fmt.Sprintf(", estimated wait %s", e.EstimatedWait)
+	}
+	return msg + ")"
+}
+
+// Is returns true if the target is ErrBuildQueueFull
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrBuildQueueFull //nolint:errorlint
+}
 
 // Dependency defines a dependency and its semantic version constrains
 type Dependency struct {
@@ -16,6 +54,9 @@ type Dependency struct {
 	Name string `json:"name,omitempty"`
 	// Constraints specifies the semantic version constraints. E.g. >v0.2.0
 	Constraints string `json:"constraints,omitempty"`
+	// Channel specifies the release channel used for resolving the constraints. E.g. beta
+	// Defaults to the stable channel.
+	Channel string `json:"channel,omitempty"`
 }
 
 // Module defines the mapping of a Dependency to a go module that satisfies it
@@ -37,8 +78,22 @@ type Artifact struct {
 	Dependencies map[string]string `json:"dependencies,omitempty"`
 	// platform
 	Platform string `json:"platform,omitempty"`
-	// binary checksum (sha256)
+	// binary checksum. sha256 unless prefixed with the algorithm (e.g. sha512:<checksum>)
 	Checksum string `json:"checksum,omitempty"`
+	// GoVersion of the toolchain that compiled the binary (e.g. go1.22.2), as recorded in its build info.
+	// Empty if unknown (e.g. the artifact was served from the store)
+	GoVersion string `json:"go_version,omitempty"`
+	// ModuleSums maps the modules compiled into the binary (path@version) to their hash as in go.sum
+	// (e.g. h1:<hash>), as recorded in its build info, for verifying the binary's contents.
+	// Empty if unknown (e.g. the artifact was served from the store)
+	ModuleSums map[string]string `json:"module_sums,omitempty"`
+	// Fallbacks maps the dependencies built with a lower version than the one resolved,
+	// because the resolved version failed to build, to the version that failed.
+	// Dependencies has the version actually built. See BuildOpts.Fallback
+	Fallbacks map[string]string `json:"fallbacks,omitempty"`
+	// Signature of the artifact's ID and Checksum by the build service, encoded in base64.
+	// Empty if the build service doesn't sign the artifacts. See the signature package
+	Signature string `json:"signature,omitempty"`
 }
 
 // String returns a text serialization of the Artifact
@@ -67,14 +122,82 @@ func (a Artifact) toString(details bool, sep string) string {
 		buffer.WriteString(fmt.Sprintf("%s:%q%s", dep, version, sep))
 	}
 	buffer.WriteString(fmt.Sprintf("checksum: %s%s", a.Checksum, sep))
+	if a.GoVersion != "" {
+		buffer.WriteString(fmt.Sprintf("go: %s%s", a.GoVersion, sep))
+	}
+	for dep, version := range a.Fallbacks {
+		buffer.WriteString(fmt.Sprintf("fallback: %s %s failed%s", dep, version, sep))
+	}
 	if details {
 		buffer.WriteString(fmt.Sprintf("url: %s%s", a.URL, sep))
+		for mod, sum := range a.ModuleSums {
+			buffer.WriteString(fmt.Sprintf("module: %s %s%s", mod, sum, sep))
+		}
 	}
 	return buffer.String()
 }
 
+// BuildOpts defines options for a build request
+type BuildOpts struct {
+	// NoCache forces building the artifact even if it is available in the store
+	NoCache bool
+	// NoStore prevents the artifact built from being written to the store.
+	// Artifacts that are not stored cannot be downloaded (their URL is empty)
+	NoStore bool
+	// CurrentArtifact is the ID of the artifact the client already has. If the dependencies
+	// resolve to the same artifact, it is not built (or fetched from the store) and
+	// ErrArtifactUnchanged is returned
+	CurrentArtifact string
+	// Fallback retries the build with lower versions of the dependencies that satisfy their
+	// constraints if the resolved versions fail to build. See Artifact.Fallbacks
+	Fallback bool
+	// Replacements pin modules (by module path) to an exact version or pseudo-version after the
+	// dependencies are resolved. A replacement takes precedence over the version resolved for the
+	// module, and the artifact's dependencies report the pinned versions. Pinned modules are not
+	// changed by the Fallback option.
+	Replacements map[string]string
+	// K6Repo is an alternative module (e.g. a fork) with version used for building k6 instead of
+	// go.k6.io/k6 (e.g. github.com/org/k6@v0.50.1). The artifact's dependencies report it as the
+	// version of k6. Build services may not allow it.
+	K6Repo string
+	// Output receives the output of the build process (e.g. the compiler's messages) as it is
+	// produced, for showing the progress of the build. Nothing is written if the artifact is
+	// served from the store. The build's result is not affected by errors writing the output.
+	Output io.Writer
+}
+
+type buildOptsKey struct{}
+
+// WithBuildOpts returns a context that passes the build options to the BuildService
+func WithBuildOpts(ctx context.Context, opts BuildOpts) context.Context {
+	return context.WithValue(ctx, buildOptsKey{}, opts)
+}
+
+// BuildOptsFromContext returns the build options in the context, if any
+func BuildOptsFromContext(ctx context.Context) BuildOpts {
+	opts, _ := ctx.Value(buildOptsKey{}).(BuildOpts)
+	return opts
+}
+
 // BuildService defines the interface for building custom k6 binaries
 type BuildService interface {
 	// Build returns a k6 Artifact that satisfies a set dependencies and version constrains.
+	// The build can be configured using BuildOpts passed in the context (see WithBuildOpts).
 	Build(ctx context.Context, platform string, k6Constrains string, deps []Dependency) (Artifact, error)
 }
+
+// ArtifactResolver is implemented by build services that can resolve the artifact that satisfies
+// a set of dependencies and version constrains without building it
+type ArtifactResolver interface {
+	// ResolveArtifact returns the ID, platform and resolved dependencies of the Artifact the build
+	// would return. Its binary is neither built nor stored, so it has no URL nor checksum.
+	ResolveArtifact(ctx context.Context, platform string, k6Constrains string, deps []Dependency) (Artifact, error)
+}
+
+// ArtifactInvalidator is implemented by build services that can invalidate the artifacts they keep,
+// so they are built again on the next request
+type ArtifactInvalidator interface {
+	// InvalidateArtifact removes the artifact with the given ID. Returns ErrArtifactNotFound if the
+	// artifact is not available.
+	InvalidateArtifact(ctx context.Context, id string) error
+}
@@ -138,5 +138,25 @@ func New() *cobra.Command { //nolint:funlen
 		false,
 		"allow building versions with build metadata (e.g v0.0.0+build).",
 	)
+	cmd.Flags().StringVar(
+		&config.Opts.K6Repo,
+		"k6-repo",
+		"",
+		"alternative k6 repository (e.g. a fork) used instead of go.k6.io/k6."+
+			"\nEither a module with version (e.g. github.com/org/k6@v0.50.1) or a local directory."+
+			"\nBinaries built from a local directory are always rebuilt",
+	)
+	cmd.Flags().BoolVar(
+		&config.Opts.NoCache,
+		"no-cache",
+		false,
+		"build the binary even if it is available in the store. The store is updated with the new binary.",
+	)
+	cmd.Flags().BoolVar(
+		&config.Opts.Fallback,
+		"fallback",
+		false,
+		"if the binary fails to build, retry with lower versions of the dependencies that satisfy the constraints",
+	)
 	return cmd
 }
@@ -2,11 +2,18 @@
 package remote
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
 	"github.com/grafana/k6build/pkg/client"
+	"github.com/grafana/k6build/pkg/signature"
 	"github.com/grafana/k6build/pkg/util"
 
 	"github.com/spf13/cobra"
@@ -46,18 +53,44 @@ build/k6 version
 k6 v0.51.0 (go1.22.2, linux/amd64)
 Extensions:
   github.com/grafana/xk6-output-kafka v0.7.0, xk6-kafka [output]
+
+# rebuild and download only if the floating constraints resolve to a different artifact
+k6build remote -s http://localhost:8000 \
+    -p linux/amd64  \
+    -k '>v0.50.0' -d k6/x/output-kafka:'*' \
+    --current-artifact 62d08b13fdef171435e2c6874eaad0bb35f2f9c7 \
+    -o build/k6
+
+artifact 62d08b13fdef171435e2c6874eaad0bb35f2f9c7 unchanged
+
+# print the id of the artifact the dependencies resolve to, without building it
+k6build remote -s http://localhost:8000 \
+    -k v0.51.0 -d k6/x/output-kafka:v0.7.0 \
+    --resolve-only -q
+
+62d08b13fdef171435e2c6874eaad0bb35f2f9c7
+
+# balance the requests among two build servers, failing over if one is not available
+k6build remote -s http://build-1:8000 -s http://build-2:8000 \
+    -k v0.51.0 -d k6/x/output-kafka:v0.7.0
 `
 )
 
 // New creates new cobra command for build client command.
 func New() *cobra.Command {
 	var (
-		config   client.BuildServiceClientConfig
-		deps     []string
-		k6       string
-		output   string
-		platform string
-		quiet    bool
+		config      client.BuildServiceClientConfig
+		servers     []string
+		deps        []string
+		k6          string
+		output      string
+		platform    string
+		quiet       bool
+		resolveOnly bool
+		retries     int
+		buildOpts   k6build.BuildOpts
+		tlsOptions  tlsOpts
+		publicKey   string
 	)
 
 	cmd := &cobra.Command{
@@ -70,6 +103,31 @@ func New() *cobra.Command {
 		// this is needed to prevent cobra to print errors reported by subcommands in the stderr
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if buildOpts.NoStore && output != "" {
+				return fmt.Errorf("--no-store cannot be used with --output")
+			}
+
+			if resolveOnly && output != "" {
+				return fmt.Errorf("--resolve-only cannot be used with --output")
+			}
+
+			if len(servers) > 0 {
+				config.URL, config.URLs = servers[0], servers[1:]
+			}
+
+			tlsConfig, err := tlsOptions.tlsConfig()
+			if err != nil {
+				return fmt.Errorf("configuring tls %w", err)
+			}
+			config.TLSConfig = tlsConfig
+
+			if publicKey != "" {
+				config.PublicKey, err = signature.LoadPublicKey(publicKey)
+				if err != nil {
+					return fmt.Errorf("loading public key %w", err)
+				}
+			}
+
 			client, err := client.NewBuildServiceClient(config)
 			if err != nil {
 				return fmt.Errorf("configuring the client %w", err)
@@ -84,7 +142,24 @@ func New() *cobra.Command {
 				buildDeps = append(buildDeps, k6build.Dependency{Name: name, Constraints: constrains})
 			}
 
-			artifact, err := client.Build(cmd.Context(), platform, k6, buildDeps)
+			if resolveOnly {
+				artifact, err := client.ResolveArtifact(cmd.Context(), platform, k6, buildDeps)
+				if err != nil {
+					return fmt.Errorf("resolving %w", err)
+				}
+
+				printResolved(artifact, quiet)
+				return nil
+			}
+
+			ctx := k6build.WithBuildOpts(cmd.Context(), buildOpts)
+			artifact, err := client.Build(ctx, platform, k6, buildDeps)
+			if errors.Is(err, k6build.ErrArtifactUnchanged) {
+				if !quiet {
+					fmt.Printf("artifact %s unchanged\n", buildOpts.CurrentArtifact)
+				}
+				return nil
+			}
 			if err != nil {
 				return fmt.Errorf("building %w", err)
 			}
@@ -94,7 +169,18 @@ func New() *cobra.Command {
 			}
 
 			if output != "" {
-				err = util.Download(cmd.Context(), artifact.URL, output)
+				err = util.DownloadWithOpts(
+					cmd.Context(),
+					artifact.URL,
+					output,
+					util.DownloadOpts{
+						Checksum:        artifact.Checksum,
+						ChecksumRetries: retries,
+						PublicKey:       config.PublicKey,
+						ArtifactID:      artifact.ID,
+						Signature:       artifact.Signature,
+					},
+				)
 				if err != nil {
 					return fmt.Errorf("downloading artifact %w", err)
 				}
@@ -104,13 +190,133 @@ func New() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&config.URL, "server", "s", "http://localhost:8000", "url for build server")
+	cmd.Flags().StringSliceVarP(
+		&servers,
+		"server",
+		"s",
+		[]string{"http://localhost:8000"},
+		"url for build server. Repeat it for balancing the requests among multiple build servers",
+	)
 	cmd.Flags().StringArrayVarP(&deps, "dependency", "d", nil, "list of dependencies in form package:constrains")
 	cmd.Flags().StringVarP(&k6, "k6", "k", "*", "k6 version constrains")
-	cmd.Flags().StringVarP(&platform, "platform", "p", "", "target platform (default GOOS/GOARCH)")
+	cmd.Flags().StringVarP(
+		&platform,
+		"platform",
+		"p",
+		api.PlatformNative,
+		"target platform (e.g. linux/amd64). Use native (or host) for the platform the command runs on",
+	)
 	cmd.Flags().StringVarP(&output, "output", "o", "", "path to download the custom binary as an executable."+
 		"\nIf not specified, the artifact is not downloaded.")
 	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "don't print artifact's details")
+	cmd.Flags().IntVar(&retries, "download-retries", 2, "times to retry the download if the binary's checksum doesn't match")
+	cmd.Flags().StringVar(
+		&buildOpts.CurrentArtifact,
+		"current-artifact",
+		"",
+		"id of the artifact already available. If the dependencies resolve to the same artifact,"+
+			"\nit is not built nor downloaded",
+	)
+	cmd.Flags().BoolVar(&buildOpts.NoCache, "no-cache", false, "build the binary even if it is available in the store")
+	cmd.Flags().BoolVar(
+		&buildOpts.NoStore,
+		"no-store",
+		false,
+		"don't store the binary built. The binary cannot be downloaded.",
+	)
+	cmd.Flags().BoolVar(
+		&buildOpts.Fallback,
+		"fallback",
+		false,
+		"if the binary fails to build, retry with lower versions of the dependencies that satisfy the constraints",
+	)
+	cmd.Flags().StringToStringVar(
+		&buildOpts.Replacements,
+		"replace",
+		nil,
+		"pin a dependency to an exact version or pseudo-version (e.g. k6/x/kubernetes=v0.8.1-0.20240101000000-abcdef123456)."+
+			"\nTakes precedence over the version the constraints resolve to",
+	)
+	cmd.Flags().StringVar(
+		&buildOpts.K6Repo,
+		"k6-repo",
+		"",
+		"alternative k6 module (e.g. a fork) with version used instead of go.k6.io/k6 (e.g. github.com/org/k6@v0.50.1)."+
+			"\nThe build server must allow forks",
+	)
+	cmd.Flags().BoolVar(
+		&resolveOnly,
+		"resolve-only",
+		false,
+		"print the id of the artifact and the versions the dependencies resolve to, without building it."+
+			"\nWith --quiet, only the id is printed",
+	)
+	cmd.Flags().BoolVar(&config.Compress, "compress", false, "compress the build request using gzip")
+	cmd.Flags().StringVar(&tlsOptions.cert, "tls-cert", "", "client certificate file for mTLS (requires --tls-key)")
+	cmd.Flags().StringVar(&tlsOptions.key, "tls-key", "", "client certificate key file for mTLS")
+	cmd.Flags().StringVar(&tlsOptions.ca, "tls-ca", "", "CA certificate file for validating the server's certificate")
+	cmd.Flags().StringVar(
+		&publicKey,
+		"public-key",
+		"",
+		"file with the ed25519 public key (PEM) of the build server. If specified, artifacts without"+
+			"\na valid signature are rejected",
+	)
 
 	return cmd
 }
+
+// printResolved prints the id of the resolved artifact and, unless quiet, its dependencies
+func printResolved(artifact k6build.Artifact, quiet bool) {
+	fmt.Println(artifact.ID)
+	if quiet {
+		return
+	}
+
+	deps := make([]string, 0, len(artifact.Dependencies))
+	for dep := range artifact.Dependencies {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	for _, dep := range deps {
+		fmt.Printf("%s: %s\n", dep, artifact.Dependencies[dep])
+	}
+}
+
+// tlsOpts defines the files used for configuring the TLS connection to the build server
+type tlsOpts struct {
+	cert string
+	key  string
+	ca   string
+}
+
+// tlsConfig returns the TLS configuration. Returns nil if no option is specified.
+func (o tlsOpts) tlsConfig() (*tls.Config, error) {
+	if o.cert == "" && o.key == "" && o.ca == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.cert != "" || o.key != "" {
+		cert, err := tls.LoadX509KeyPair(o.cert, o.key)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if o.ca != "" {
+		caCert, err := os.ReadFile(o.ca)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("invalid CA certificate %s", o.ca)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6build/pkg/lock"
+)
+
+// defaultRedisPort is the port of the redis server if not specified in the lock's location
+const defaultRedisPort = "6379"
+
+var errUnsupportedLock = errors.New("unsupported build lock")
+
+// lockOpts defines the options for creating the build lock
+type lockOpts struct {
+	// lock location as an url
+	location string
+	// kind of lock: memory, redis or dynamodb
+	kind      string
+	redisAddr string
+	// file with the password of the redis server, if required
+	redisPasswordFile string
+	// dynamodb table, endpoint and region
+	dynamoTable    string
+	dynamoEndpoint string
+	dynamoRegion   string
+}
+
+// getLock returns the lock used for preventing concurrent builds of the same artifact.
+// If a location is specified, the lock is selected by its scheme:
+//
+//	memory://
+//	redis://host[:port][?lease=<duration>&backoff=<duration>]
+//	dynamodb://table[?endpoint=<endpoint>&region=<region>&lease=<duration>&backoff=<duration>&grace=<duration>]
+//
+// The dynamodb lock also accepts the max-lease duration (see lock.DynamoConfig).
+// Otherwise, the lock is selected by its kind and the individual redis and dynamodb options.
+// The password of the redis server, if required, is always read from the redis password file.
+func getLock(opts lockOpts) (lock.Lock, error) {
+	if opts.location != "" {
+		return getLockFromLocation(opts)
+	}
+
+	switch opts.kind {
+	case "", "memory":
+		return lock.NewMemoryLock(), nil
+	case "redis":
+		password, err := readPassword(opts.redisPasswordFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return lock.NewRedisLock(lock.RedisConfig{
+			Addr:     opts.redisAddr,
+			Password: password,
+		})
+	case "dynamodb":
+		return lock.NewDynamoLock(lock.DynamoConfig{
+			Table:    opts.dynamoTable,
+			Endpoint: opts.dynamoEndpoint,
+			Region:   opts.dynamoRegion,
+		})
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedLock, opts.kind)
+	}
+}
+
+// getLockFromLocation returns the lock selected by the scheme of the lock's location
+func getLockFromLocation(opts lockOpts) (lock.Lock, error) {
+	location, err := url.Parse(opts.location)
+	if err != nil {
+		return nil, fmt.Errorf("parsing lock location %w", err)
+	}
+
+	durations, err := parseDurations(location.Query(), "lease", "backoff", "grace", "max-lease")
+	if err != nil {
+		return nil, fmt.Errorf("parsing lock location %w", err)
+	}
+
+	switch location.Scheme {
+	case "memory":
+		return lock.NewMemoryLock(), nil
+	case "redis":
+		password, err := readPassword(opts.redisPasswordFile)
+		if err != nil {
+			return nil, err
+		}
+
+		addr := location.Host
+		if location.Port() == "" {
+			addr = net.JoinHostPort(location.Hostname(), defaultRedisPort)
+		}
+
+		return lock.NewRedisLock(lock.RedisConfig{
+			Addr:     addr,
+			Password: password,
+			Lease:    durations["lease"],
+			Backoff:  durations["backoff"],
+		})
+	case "dynamodb":
+		query := location.Query()
+		return lock.NewDynamoLock(lock.DynamoConfig{
+			Table:    location.Host,
+			Endpoint: query.Get("endpoint"),
+			Region:   query.Get("region"),
+			Lease:    durations["lease"],
+			Backoff:  durations["backoff"],
+			Grace:    durations["grace"],
+			MaxLease: durations["max-lease"],
+		})
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedLock, location.Scheme)
+	}
+}
+
+// parseDurations returns the durations of the given query parameters. Missing parameters are 0
+func parseDurations(query url.Values, names ...string) (map[string]time.Duration, error) {
+	durations := map[string]time.Duration{}
+	for _, name := range names {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		durations[name] = duration
+	}
+
+	return durations, nil
+}
+
+// readPassword reads the redis password from a file. Returns an empty password if no file is given
+func readPassword(passwordFile string) (string, error) {
+	if passwordFile == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(passwordFile) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("reading redis password %w", err)
+	}
+
+	// files with secrets usually end with a newline
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
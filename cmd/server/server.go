@@ -2,18 +2,29 @@
 package server
 
 import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
 	"github.com/grafana/k6build/pkg/builder"
 	"github.com/grafana/k6build/pkg/catalog"
 	"github.com/grafana/k6build/pkg/server"
+	"github.com/grafana/k6build/pkg/signature"
 	"github.com/grafana/k6build/pkg/store"
-	"github.com/grafana/k6build/pkg/store/client"
 	"github.com/grafana/k6build/pkg/store/s3"
+	"github.com/grafana/k6build/pkg/util"
+	"github.com/grafana/k6foundry"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -57,6 +68,199 @@ For example
 	  }
 	}
 
+If the object store is not reachable by the clients, the --proxy-downloads option makes the
+build server return download URLs pointing to itself (/artifacts/{id}/download) and proxy
+the artifacts' content from the store. The proxied artifacts can also be downloaded as a
+archive with the binary and a manifest using the format query parameter (format=tar.gz or format=zip).
+If --store-key-prefix is specified, the proxy resolves the artifacts' keys from their id by listing
+the objects in the store. A http store must resolve them itself (see the --key-prefix store option).
+
+Artifacts can be pushed to an OCI registry (--store oci://<registry>/<repository>) as OCI
+artifacts tagged with their id. Their URL in the store is the artifact's reference
+(oci://<registry>/<repository>@<digest>), which can be pulled using OCI tooling (e.g. oras pull
+<registry>/<repository>@<digest>). As the clients cannot download these URLs, an OCI store
+(also as --fallback-store) requires --proxy-downloads: the proxy reads the artifacts from the registry.
+
+The download URLs of artifacts in a s3 store are presigned and expire after --store-url-expiration
+(24h by default, up to 168h). Longer expirations tolerate clients that download the artifacts long
+after building them, but a leaked URL gives access to the artifact for longer. A new URL for the
+artifact can be obtained by repeating the build request, which is served from the store. Download
+URLs of proxied artifacts (--proxy-downloads) don't expire.
+
+Artifacts can be stored in a Google Cloud Storage bucket (--gcs-bucket or --store gcs://<bucket>).
+The bucket is accessed using the application default credentials (e.g. the service account key file
+in the GOOGLE_APPLICATION_CREDENTIALS environment variable or the instance's service account), which
+are also used for signing the download URLs (using the IAM signBlob API if they have no private key).
+They expire after --store-url-expiration, as in a s3 store. The server fails to start without
+credentials, unless an emulator is used (--gcs-endpoint): then the bucket is accessed anonymously
+and the download URLs are not signed.
+
+Artifacts can be stored in an Azure Blob Storage container (--azure-container or
+--store azblob://<account>/<container>). The storage account's name is read from the
+AZURE_STORAGE_ACCOUNT environment variable (--azure-account overrides it). If the AZURE_STORAGE_KEY
+environment variable has the account's access key, it is used for accessing the container and
+signing the download URLs. Otherwise, the default Azure credentials are used (e.g. the AZURE_CLIENT_ID,
+AZURE_TENANT_ID and AZURE_CLIENT_SECRET environment variables, workload identity or the managed
+identity), and the download URLs are signed with a user delegation key. The download URLs have a shared
+access signature (SAS) that expires after --store-url-expiration (up to 168h without an account key).
+
+Concurrent requests for the same artifact are built once, while the others wait for the build.
+By default the lock is held in memory, so servers sharing a store may build the same artifact
+concurrently. With --build-lock redis, the servers using the same redis server (--redis-addr) share
+the locks. The redis server's password, if required, is read from --redis-password-file. With
+--build-lock dynamodb, the servers using the same dynamodb table (--dynamodb-table) share the locks.
+The locks are renewed while held and expire if the server holding them fails.
+
+The lock can also be given as an url with --lock, selecting the lock by its scheme (memory://,
+redis://<host>:<port> or dynamodb://<table>). The lease and backoff of the locks, and the grace and
+max-lease of the dynamodb locks, can be given as query parameters (e.g. redis://redis:6379?lease=30s).
+
+If --signing-key is specified, the artifacts include a signature of their id and checksum
+("signature"), made with the given ed25519 private key (PEM encoded, as generated by
+'openssl genpkey -algorithm ed25519'). Clients with the public key can verify the artifacts were
+built by this server and, verifying the checksum, that the downloaded binary was not tampered with
+(e.g. by a compromised store).
+
+If the store is reachable by the clients through a different host (e.g. behind an ingress),
+the --external-store-url option rewrites the artifacts' http(s) URLs to the given base URL,
+replacing their scheme and host and prefixing their path with the base URL's path
+(e.g. http://store.internal:9000/store/{id}/download becomes https://example.com/k6/store/{id}/download
+with --external-store-url https://example.com/k6).
+
+Build requests only ensure the artifact exists, building it into the store if needed, and
+return its metadata. The binary is not returned in the response but downloaded later using
+the artifact's URL. Clients can make this explicit using the ensure=true query parameter
+(POST /build?ensure=true).
+
+Clients that cannot reach the store can instead receive the binary in the build response by
+accepting only application/octet-stream (Accept: application/octet-stream). The response has
+the artifact's id as ETag. Failed builds are returned as usual, but with a non-2xx status.
+
+	curl -fo k6 -H "Accept: application/octet-stream" http://localhost:8000/build \
+	  -d '{"platform": "linux/amd64", "k6": "v0.50.0"}'
+
+The /download endpoint builds the artifact for the constraints given as query parameters
+and redirects (302) to its download URL, giving a stable URL for fetching a binary. Dependencies
+are given as name[:constraints] using the dep parameter, once per dependency. The constraints
+default to '*'. Redirects are not cached if any constraint is floating. For example:
+
+	curl -fLo k6 "http://localhost:8000/download?platform=linux/amd64&k6=v0.50.0&dep=k6/x/kubernetes:>v0.8.0"
+
+Clients can pass the id of the artifact they already have in the "current_artifact" field of
+the request. If the request resolves to the same artifact, it is not built and the server
+responds with 304 (Not Modified).
+
+The id of the artifact a build request resolves to can be obtained without building it by
+posting the request to the /artifacts/id endpoint. The response has the artifact's "id",
+"platform" and resolved "dependencies". The id can be used for checking the store or building
+the artifact's URL.
+
+The request can also be given as query parameters, as in /download requests, so the responses
+can be cached by proxies. The responses have the artifact's id as ETag and are not cached if
+any constraint is floating. For example:
+
+	curl "http://localhost:8000/artifacts/id?platform=linux/amd64&k6=v0.50.0&dep=k6/x/kubernetes:v0.9.0"
+
+An artifact can be invalidated, forcing it to be built again on the next request (e.g. when a
+dependency's tag was re-pushed under the same version), by sending a DELETE request to the
+/build/{id} endpoint. The server responds with 204 (No Content) if the artifact was removed from
+the store or 404 (Not Found) if it was not available. Invalidations are counted in the
+k6build_builds_invalidated_total metric. If --store-key-prefix is specified, the artifact's key is
+resolved listing the store (a http store must be started with --key-prefix).
+
+	curl -X DELETE http://localhost:8000/build/5a241ba6ff643075caadbd06d5a326e5e74f6f10
+
+Failed requests include a stable error code (INVALID_REQUEST, BUILD_FAILED, CANNOT_SATISFY,
+TIMEOUT, QUEUE_FULL, INSUFFICIENT_STORAGE or PROXY_AUTH_FAILED) in the "code" field of the
+response, besides the error message.
+If --allowed-extensions or --denied-extensions are specified, builds with extensions that are
+not allowed are rejected, even if they can be resolved, and counted as invalid builds.
+
+If --min-k6-version is specified, requests whose k6 constraints resolve to a lower version
+(e.g. '*' resolving to an old version in the catalog) are rejected and counted as invalid builds.
+
+Requests with invalid fields (e.g. a missing platform or an empty dependency constraint) are
+rejected with 400 (Bad Request), listing each "field" and its problem ("message") in the
+"validation_errors" field of the response.
+
+Multiple builds can be requested in one call by posting a JSON array of build requests to the
+/build/batch endpoint. The response is an array with the response of each request, in the same
+order, each one with its own error if it failed. Up to --batch-concurrency requests of a batch
+are processed concurrently. For example:
+
+	curl http://localhost:8000/build/batch -d '[
+	  {"platform": "linux/amd64", "k6": "v0.50.0"},
+	  {"platform": "darwin/arm64", "k6": "v0.50.0"}
+	]'
+
+If --max-queued-builds is specified, requests that would wait for a build slot (see
+--max-concurrent-builds) when the queue is full are rejected with 503 (Service Unavailable).
+The response includes the Retry-After and X-Queue-Position headers and, if it can be estimated
+from the duration of the recent builds, the X-Estimated-Wait header (e.g. 1m30s).
+
+If --min-free-space is specified, builds are not started if the temporary directory or the go
+caches (see --go-cache and --go-mod-cache) have less free space, and the requests are rejected
+with 507 (Insufficient Storage) instead of failing with compiler errors. Only checked in linux
+and darwin.
+
+Builds that fail because the go module proxy (GOPROXY) rejects the credentials (401 or 403) are
+rejected with 502 (Bad Gateway) and the PROXY_AUTH_FAILED code. They are not retried and are
+counted in the k6build_proxy_auth_failures_total metric, for alerting on expired credentials.
+
+If the request uses floating constraints (e.g. '*' or '>v0.8.0'), the response includes
+warnings (also returned as Warning headers) naming the versions they resolved to, as subsequent
+requests may resolve them to newer versions.
+
+The server's configuration (supported platforms, CGO, catalog, maximum artifact age and
+build profiles) can be queried using the /capabilities endpoint.
+
+Operators can define build profiles (--profiles), named sets of dependencies that requests
+can reference using the "profile" field. The profile's dependencies are merged with the
+dependencies in the request, which take precedence.
+
+If a webhook is configured (--webhook-url), the server posts an event to it when each build
+completes, either successfully (build.succeeded) or not (build.failed). The event includes the
+request and the response. Failed deliveries are retried. If --webhook-secret is specified, the
+payload is signed with HMAC-SHA256 in the X-K6build-Signature header (sha256=<signature>).
+
+The versions of a dependency known by the catalog can be listed (newest first) using the
+/versions/{dependency} endpoint, optionally filtered by constraints. For example:
+
+	curl "http://localhost:8000/versions/k6/x/kubernetes?constraints=>v0.8.0"
+
+Builds that fail compiling can be retried with lower versions of the dependencies that satisfy
+their constraints, either for all the requests (--fallback) or for the requests that set the
+"fallback" field. Each attempt lowers the version of one dependency, up to --max-fallbacks
+attempts. The response's artifact has the versions actually built in "dependencies" and the
+versions that failed in "fallbacks".
+
+If --build-retries is specified, builds that fail for transient reasons are retried, waiting
+--build-retry-delay (doubled on each retry). A failure is transient if the error or the build
+output matches any of the --transient-errors patterns, by default common network errors (e.g.
+"i/o timeout" or "502 Bad Gateway") downloading the modules. Failures compiling the binary are
+never retried, nor retried with lower versions (see --fallback) if the retries are exhausted.
+Retries are counted in the k6build_build_retries_total metric.
+
+The first builds after a restart are slow if the go build cache is empty. The cache can be kept
+in a persistent volume using --go-cache (and the module cache using --go-mod-cache), and warmed
+up on startup by compiling a baseline k6 using --warmup (e.g. --warmup v0.50.0) for the
+--warmup-platforms. The server accepts requests while warming up the cache.
+
+If --serve-last-successful is specified, requests with floating constraints (e.g. '*') whose
+resolved versions fail compiling are served the last artifact successfully built for the same
+request, if any. The compile failure is logged. The artifacts are remembered only while the
+server runs.
+
+All the versions of a dependency, including pre-releases (flagged as such), are listed
+(newest first) by the /catalog/{dependency}/versions endpoint. For example:
+
+	curl http://localhost:8000/catalog/k6/x/kubernetes/versions
+
+The dependencies in the catalog and their versions are listed by the /catalog endpoint,
+optionally filtered by name. For example:
+
+	curl http://localhost:8000/catalog?name=kafka
+
 Note: The build server disables CGO by default but enables it when a dependency requires it.
       use --enable-cgo=true to enable CGO support by default.
 `
@@ -73,6 +277,27 @@ k6build server -e GOPROXY=http://localhost:80
 export AWS_ACCESS_KEY_ID="test"
 export AWS_SECRET_ACCESS_KEY="test"
 k6build server --s3-endpoint http://localhost:4566 --store-bucket k6build
+
+# same as above, using a store url
+k6build server --store "s3://k6build?endpoint=http://localhost:4566"
+
+# start the build server using a local directory as store
+k6build server --store file:///tmp/k6build/store
+
+# start the build server with a GCS storage backend
+export GOOGLE_APPLICATION_CREDENTIALS=/path/to/service-account.json
+k6build server --gcs-bucket k6build
+
+# start the build server with an Azure Blob Storage backend
+export AZURE_STORAGE_ACCOUNT=k6build
+export AZURE_STORAGE_KEY=<account key>
+k6build server --azure-container binaries
+
+# start the build server with an Azure Blob Storage backend using the instance's managed identity
+k6build server --store azblob://k6build/binaries
+
+# migrate from a local directory to s3, serving the artifacts not yet in s3 from the directory
+k6build server --store s3://k6build --fallback-store file:///tmp/k6build/store
 `
 )
 
@@ -80,16 +305,65 @@ k6build server --s3-endpoint http://localhost:4566 --store-bucket k6build
 func New() *cobra.Command { //nolint:funlen
 	var (
 		allowBuildSemvers bool
+		allowK6Fork       bool
+		allowedExts       []string
+		deniedExts        []string
+		checksumAlgorithm string
+		storeMaxSize      int64
+		urlExpiration     time.Duration
 		catalogURL        string
 		copyGoEnv         bool
+		envAllowlist      []string
+		downloadURL       string
+		externalStoreURL  string
 		enableCgo         bool
 		goEnv             map[string]string
+		k6Repo            string
 		logLevel          string
+		maxArtifactAge    time.Duration
 		port              int
+		profilesFile      string
+		proxyDownloads    bool
 		s3Bucket          string
 		s3Endpoint        string
 		s3Region          string
+		gcsBucket         string
+		gcsEndpoint       string
+		azureContainer    string
+		azureAccount      string
+		azureEndpoint     string
+		slowBuild         time.Duration
+		keyPrefix         bool
+		maxBuilds         int
+		maxQueued         int
+		batchConcurrency  int
+		fallback          bool
+		maxFallbacks      int
+		serveLast         bool
+		buildTimeout      time.Duration
+		extTimeouts       map[string]string
+		buildRetries      int
+		retryDelay        time.Duration
+		transientErrors   []string
+		minK6Version      string
+		goCache           string
+		signingKey        string
+		buildLock         string
+		lockLocation      string
+		redisAddr         string
+		redisPasswordFile string
+		dynamoTable       string
+		dynamoEndpoint    string
+		goModCache        string
+		minFreeSpace      int64
+		warmupK6          string
+		warmupPlatforms   []string
+		webhook           server.WebhookConfig
+		storeLocation     string
+		fallbackStore     string
 		storeURL          string
+		unixSocket        string
+		httpOpts          util.HTTPServerOpts
 		verbose           bool
 	)
 
@@ -118,29 +392,42 @@ func New() *cobra.Command { //nolint:funlen
 				),
 			)
 
+			// the content of a local directory is not part of the artifacts' ids, so they would be
+			// rebuilt on every request
+			if strings.HasPrefix(k6Repo, ".") || filepath.IsAbs(k6Repo) {
+				return fmt.Errorf("--k6-repo must be a module with version (e.g. github.com/org/k6@v0.50.1)")
+			}
+
 			catalog, err := catalog.NewCatalog(cmd.Context(), catalogURL)
 			if err != nil {
 				return fmt.Errorf("creating catalog %w", err)
 			}
 
-			var store store.ObjectStore
+			if !proxyDownloads && (isOCIStore(storeLocation) || isOCIStore(fallbackStore)) {
+				return fmt.Errorf("an oci store requires --proxy-downloads")
+			}
 
-			if s3Bucket != "" {
-				store, err = s3.New(s3.Config{
-					Bucket:   s3Bucket,
-					Endpoint: s3Endpoint,
-					Region:   s3Region,
-				})
-				if err != nil {
-					return fmt.Errorf("creating s3 store %w", err)
-				}
-			} else {
-				store, err = client.NewStoreClient(client.StoreClientConfig{
-					Server: storeURL,
-				})
-				if err != nil {
-					return fmt.Errorf("creating store %w", err)
-				}
+			store, err := getStore(storeOpts{
+				location:   storeLocation,
+				storeURL:   storeURL,
+				s3Bucket:   s3Bucket,
+				s3Endpoint: s3Endpoint,
+				s3Region:   s3Region,
+
+				gcsBucket:   gcsBucket,
+				gcsEndpoint: gcsEndpoint,
+
+				azureContainer: azureContainer,
+				azureAccount:   azureAccount,
+				azureEndpoint:  azureEndpoint,
+
+				checksumAlgorithm: checksumAlgorithm,
+				maxSize:           storeMaxSize,
+				urlExpiration:     urlExpiration,
+				fallback:          fallbackStore,
+			})
+			if err != nil {
+				return fmt.Errorf("creating store %w", err)
 			}
 
 			// TODO: check this logic
@@ -153,39 +440,134 @@ func New() *cobra.Command { //nolint:funlen
 				goEnv["CGO_ENABLED"] = "0"
 			}
 
+			extBuildTimeouts, err := parseTimeouts(extTimeouts)
+			if err != nil {
+				return fmt.Errorf("parsing extension build timeouts %w", err)
+			}
+
+			var privateKey ed25519.PrivateKey
+			if signingKey != "" {
+				privateKey, err = signature.LoadPrivateKey(signingKey)
+				if err != nil {
+					return fmt.Errorf("loading signing key %w", err)
+				}
+			}
+
+			artifactLock, err := getLock(lockOpts{
+				location:          lockLocation,
+				kind:              buildLock,
+				redisAddr:         redisAddr,
+				redisPasswordFile: redisPasswordFile,
+				dynamoTable:       dynamoTable,
+				dynamoEndpoint:    dynamoEndpoint,
+				dynamoRegion:      s3Region,
+			})
+			if err != nil {
+				return fmt.Errorf("creating build lock %w", err)
+			}
+
 			config := builder.Config{
 				Opts: builder.Opts{
 					GoOpts: builder.GoOpts{
 						Env:       goEnv,
 						CopyGoEnv: copyGoEnv,
 					},
-					Verbose:           verbose,
-					AllowBuildSemvers: allowBuildSemvers,
+					EnvAllowlist:           envAllowlist,
+					Verbose:                verbose,
+					AllowBuildSemvers:      allowBuildSemvers,
+					MaxArtifactAge:         maxArtifactAge,
+					K6Repo:                 k6Repo,
+					AllowK6Fork:            allowK6Fork,
+					SlowBuildThreshold:     slowBuild,
+					KeyPrefix:              keyPrefix,
+					MaxConcurrentBuilds:    maxBuilds,
+					MaxQueuedBuilds:        maxQueued,
+					Fallback:               fallback,
+					MaxFallbacks:           maxFallbacks,
+					ServeLastSuccessful:    serveLast,
+					BuildTimeout:           buildTimeout,
+					ExtensionBuildTimeouts: extBuildTimeouts,
+					AllowedExtensions:      allowedExts,
+					DeniedExtensions:       deniedExts,
+					BuildRetries:           buildRetries,
+					BuildRetryDelay:        retryDelay,
+					TransientErrors:        transientErrors,
+					MinK6Version:           minK6Version,
+					GoCache:                goCache,
+					GoModCache:             goModCache,
+					MinFreeSpace:           minFreeSpace,
 				},
 				Catalog:    catalog,
 				Store:      store,
 				Registerer: prometheus.DefaultRegisterer,
+				Log:        log,
+				SigningKey: privateKey,
+				Lock:       artifactLock,
 			}
 			buildSrv, err := builder.New(cmd.Context(), config)
 			if err != nil {
 				return fmt.Errorf("creating local build service  %w", err)
 			}
 
+			// warm up the build cache while serving requests. Errors are logged by the builder
+			if warmupK6 != "" {
+				go func() {
+					_ = buildSrv.Warmup(cmd.Context(), warmupK6, warmupPlatforms...)
+				}()
+			}
+
+			profiles, err := loadProfiles(profilesFile)
+			if err != nil {
+				return fmt.Errorf("loading profiles %w", err)
+			}
+
 			apiConfig := server.APIServerConfig{
-				BuildService: buildSrv,
-				Log:          log,
+				BuildService:     buildSrv,
+				Log:              log,
+				ProxyDownloads:   proxyDownloads,
+				DownloadURL:      downloadURL,
+				ExternalStoreURL: externalStoreURL,
+				Capabilities:     capabilities(enableCgo, catalogURL, maxArtifactAge),
+				Catalog:          catalog,
+				Profiles:         profiles,
+				Webhook:          webhook,
+				BatchConcurrency: batchConcurrency,
+				Store:            store,
+			}
+			buildAPI, err := server.NewAPIServer(apiConfig)
+			if err != nil {
+				return fmt.Errorf("creating api server %w", err)
 			}
-			buildAPI := server.NewAPIServer(apiConfig)
 
 			srv := http.NewServeMux()
-			srv.Handle("POST /build", http.StripPrefix("/build", buildAPI))
+			srv.Handle("/", buildAPI)
+
+			if proxyDownloads {
+				proxyStore, err := downloadProxyStore(store, keyPrefix)
+				if err != nil {
+					return err
+				}
+
+				downloadProxy := server.NewDownloadProxy(server.DownloadProxyConfig{
+					Store: proxyStore,
+					Log:   log,
+				})
+				srv.Handle("GET /artifacts/{id}/download", downloadProxy)
+			}
 
-			// serve metrics
-			srv.Handle("/metrics", promhttp.Handler())
+			// serve metrics. OpenMetrics format is enabled to expose exemplars
+			srv.Handle("/metrics", promhttp.InstrumentMetricHandler(
+				prometheus.DefaultRegisterer,
+				promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+			))
 
-			listerAddr := fmt.Sprintf("0.0.0.0:%d", port)
-			log.Info("starting server", "address", listerAddr)
-			err = http.ListenAndServe(listerAddr, srv) //nolint:gosec
+			if unixSocket != "" {
+				err = serveUnixSocket(unixSocket, util.NewHTTPServer("", srv, httpOpts), log)
+			} else {
+				listerAddr := fmt.Sprintf("0.0.0.0:%d", port)
+				log.Info("starting server", "address", listerAddr)
+				err = util.NewHTTPServer(listerAddr, srv, httpOpts).ListenAndServe()
+			}
 			if err != nil {
 				log.Info("server ended", "error", err.Error())
 			}
@@ -203,22 +585,414 @@ func New() *cobra.Command { //nolint:funlen
 		"dependencies catalog. Can be path to a local file or an URL."+
 			"\n",
 	)
+	cmd.Flags().StringVar(
+		&storeLocation,
+		"store",
+		"",
+		"store location as an url. The store backend is selected by the url scheme:"+
+			"\n  s3://<bucket>?endpoint=<endpoint>&region=<region>"+
+			"\n  gcs://<bucket>[?endpoint=<endpoint>] (or gs://<bucket>)"+
+			"\n  azblob://<account>/<container>[?endpoint=<endpoint>]"+
+			"\n  file:///path/to/store"+
+			"\n  http(s)://<store server>"+
+			"\n  oci://[<user>:<password>@]<registry>/<repository>[?plain-http=true]"+
+			"\nIf specified, takes precedence over --store-url, --store-bucket, --s3-endpoint, --s3-region,"+
+			"\n--gcs-bucket, --gcs-endpoint and the --azure options",
+	)
+	cmd.Flags().StringVar(
+		&fallbackStore,
+		"fallback-store",
+		"",
+		"location of a store (as in --store) used for reading the artifacts not found in the store."+
+			"\nNew artifacts are only written to the store. Useful when migrating between stores.",
+	)
+	cmd.Flags().StringVar(
+		&checksumAlgorithm,
+		"checksum-algorithm",
+		store.ChecksumSHA256,
+		"checksum algorithm for artifacts stored in s3, gcs, azure or file stores (sha256, sha512)."+
+			"\nChecksums other than sha256 are prefixed with the algorithm (e.g. sha512:<checksum>)",
+	)
+	cmd.Flags().Int64Var(
+		&storeMaxSize,
+		"store-max-size",
+		0,
+		"maximum size in bytes of a file store (--store file://...). When exceeded, the least recently"+
+			"\nused artifacts are evicted. If 0, the size is not limited",
+	)
+	cmd.Flags().DurationVar(
+		&urlExpiration,
+		"store-url-expiration",
+		s3.DefaultURLExpiration,
+		"expiration of the presigned download urls of a s3, gcs or azure store"+
+			"\n(up to 168h for s3, gcs and azure without an account key)",
+	)
 	cmd.Flags().StringVar(&storeURL, "store-url", "http://localhost:9000", "store server url")
 	cmd.Flags().StringVar(&s3Bucket, "store-bucket", "", "s3 bucket for storing binaries")
 	cmd.Flags().StringVar(&s3Endpoint, "s3-endpoint", "", "s3 endpoint")
 	cmd.Flags().StringVar(&s3Region, "s3-region", "", "aws region")
+	cmd.Flags().StringVar(&gcsBucket, "gcs-bucket", "", "google cloud storage bucket for storing binaries")
+	cmd.Flags().StringVar(&gcsEndpoint, "gcs-endpoint", "", "google cloud storage endpoint (e.g. an emulator)")
+	cmd.Flags().StringVar(&azureContainer, "azure-container", "", "azure blob storage container for storing binaries")
+	cmd.Flags().StringVar(
+		&azureAccount,
+		"azure-account",
+		"",
+		"azure storage account. Defaults to the AZURE_STORAGE_ACCOUNT environment variable",
+	)
+	cmd.Flags().StringVar(&azureEndpoint, "azure-endpoint", "", "azure blob service endpoint (e.g. an emulator)")
 	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print build process output")
 	cmd.Flags().BoolVarP(&copyGoEnv, "copy-go-env", "g", true, "copy go environment")
+	cmd.Flags().StringSliceVar(
+		&envAllowlist,
+		"env-allowlist",
+		nil,
+		"build environment variables whose values can be exposed in errors and build output."+
+			"\nThe values of other variables, and credentials in urls, are redacted."+
+			"\nIf not specified, common go variables that are not sensitive (e.g. GOOS, GOFLAGS, GOPATH) are allowed",
+	)
 	cmd.Flags().StringToStringVarP(&goEnv, "env", "e", nil, "build environment variables")
+	cmd.Flags().StringVar(
+		&goCache,
+		"go-cache",
+		"",
+		"directory of the go build cache (GOCACHE), e.g. in a persistent volume. Overrides --env and the go environment",
+	)
+	cmd.Flags().StringVar(
+		&goModCache,
+		"go-mod-cache",
+		"",
+		"directory of the go module cache (GOMODCACHE). Overrides --env and the go environment",
+	)
+	cmd.Flags().StringVar(
+		&signingKey,
+		"signing-key",
+		"",
+		"file with the ed25519 private key (PEM) used for signing the artifacts. If not specified, artifacts are not signed",
+	)
+	cmd.Flags().StringVar(
+		&buildLock,
+		"build-lock",
+		"memory",
+		"lock used for preventing concurrent builds of the same artifact (memory, redis, dynamodb)."+
+			"\nA redis or dynamodb lock is shared by the servers using the same redis server (see --redis-addr)"+
+			"\nor dynamodb table (see --dynamodb-table)",
+	)
+	cmd.Flags().StringVar(
+		&lockLocation,
+		"lock",
+		"",
+		"build lock location as an url. The lock is selected by the url scheme:"+
+			"\n  memory://"+
+			"\n  redis://<host>[:<port>][?lease=<duration>&backoff=<duration>]"+
+			"\n  dynamodb://<table>[?endpoint=<endpoint>&region=<region>&lease=<duration>&backoff=<duration>"+
+			"\n    &grace=<duration>&max-lease=<duration>]"+
+			"\nThe redis password is read from --redis-password-file. If specified, takes precedence over"+
+			"\n--build-lock, --redis-addr, --dynamodb-table, --dynamodb-endpoint and --s3-region",
+	)
+	cmd.Flags().StringVar(
+		&redisAddr,
+		"redis-addr",
+		"localhost:6379",
+		"address of the redis server used by the redis build lock",
+	)
+	cmd.Flags().StringVar(
+		&redisPasswordFile,
+		"redis-password-file",
+		"",
+		"file with the password of the redis server used by the redis build lock, if required",
+	)
+	cmd.Flags().StringVar(
+		&dynamoTable,
+		"dynamodb-table",
+		"",
+		"dynamodb table used by the dynamodb build lock. Its partition key must be a string named 'id'."+
+			"\nThe 'expires' attribute can be used as the table's TTL attribute. The region is given by --s3-region",
+	)
+	cmd.Flags().StringVar(&dynamoEndpoint, "dynamodb-endpoint", "", "dynamodb endpoint")
+	cmd.Flags().Int64Var(
+		&minFreeSpace,
+		"min-free-space",
+		0,
+		"minimum free space in bytes required in the temporary directory and go caches for starting a build."+
+			"\nIf 0, the free space is not checked",
+	)
+	cmd.Flags().StringVar(
+		&warmupK6,
+		"warmup",
+		"",
+		"k6 version constraints (e.g. v0.50.0) of a baseline k6 compiled on startup to warm up the build cache."+
+			"\nThe binary is not stored. If not specified, the cache is not warmed up",
+	)
+	cmd.Flags().StringSliceVar(
+		&warmupPlatforms,
+		"warmup-platforms",
+		[]string{runtime.GOOS + "/" + runtime.GOARCH},
+		"platforms the baseline k6 is compiled for when warming up the build cache (see --warmup)",
+	)
 	cmd.Flags().IntVarP(&port, "port", "p", 8000, "port server will listen")
+	cmd.Flags().StringVar(
+		&unixSocket,
+		"unix-socket",
+		"",
+		"path to a unix domain socket the server will listen instead of the port."+
+			"\nClients can connect using the url unix:///path/to/socket",
+	)
+	cmd.Flags().BoolVar(
+		&httpOpts.H2C,
+		"h2c",
+		false,
+		"serve HTTP/2 over cleartext connections (h2c) besides HTTP/1.1. Intended for internal use",
+	)
+	cmd.Flags().DurationVar(
+		&httpOpts.KeepAliveTimeout,
+		"keep-alive-timeout",
+		util.DefaultKeepAliveTimeout,
+		"time an idle connection is kept open waiting for the next request. If 0, keep-alives are disabled",
+	)
 	cmd.Flags().StringVarP(&logLevel, "log-level", "l", "INFO", "log level")
 	cmd.Flags().BoolVar(&enableCgo, "enable-cgo", false, "enable CGO for building binaries.")
+	cmd.Flags().DurationVar(
+		&maxArtifactAge,
+		"max-artifact-age",
+		0,
+		"maximum age of artifacts built from floating constraints (e.g. '*', '>v0.1.0') served from the store."+
+			"\nOlder artifacts are rebuilt and replaced once the build succeeds. If the build fails, they are served."+
+			"\nArtifacts built from exact versions are always served from the store. If 0, artifacts never expire",
+	)
+	cmd.Flags().DurationVar(
+		&slowBuild,
+		"slow-build-threshold",
+		0,
+		"builds taking longer than this duration (e.g. 5m) are logged as a warning and counted in the"+
+			"\nk6build_slow_builds_total metric. If 0, slow builds are not reported.",
+	)
+	cmd.Flags().IntVar(
+		&maxBuilds,
+		"max-concurrent-builds",
+		0,
+		"maximum number of binaries built concurrently. Requests served from the store are not limited."+
+			"\nIf 0, it is the number of CPUs available to the server: GOMAXPROCS limited by the"+
+			"\ncontainer's CPU quota (cgroup), if any",
+	)
+	cmd.Flags().IntVar(
+		&maxQueued,
+		"max-queued-builds",
+		0,
+		"maximum number of builds waiting for a build slot. Further requests are rejected with 503."+
+			"\nIf 0, the builds waiting are not limited",
+	)
+	cmd.Flags().IntVar(
+		&batchConcurrency,
+		"batch-concurrency",
+		server.DefaultBatchConcurrency,
+		"number of builds of a batch request processed concurrently",
+	)
+	cmd.Flags().BoolVar(
+		&fallback,
+		"fallback",
+		false,
+		"retry the builds that fail compiling with lower versions of the dependencies."+
+			"\nRequests can enable it individually using the \"fallback\" field",
+	)
+	cmd.Flags().IntVar(
+		&maxFallbacks,
+		"max-fallbacks",
+		builder.DefaultMaxFallbacks,
+		"maximum number of builds attempted with lower versions when a build fails compiling",
+	)
+	cmd.Flags().DurationVar(
+		&buildTimeout,
+		"build-timeout",
+		0,
+		"maximum duration of the compilation of an artifact. If 0, it is not limited",
+	)
+	cmd.Flags().StringToStringVar(
+		&extTimeouts,
+		"extension-build-timeout",
+		nil,
+		"build timeout for the builds with an extension, given by its name or module path prefix"+
+			"\n(e.g. k6/x/sql=20m). If several match, the longest is used. Overrides --build-timeout",
+	)
+	cmd.Flags().IntVar(
+		&buildRetries,
+		"build-retries",
+		0,
+		"maximum number of times a build that fails for a transient reason (e.g. a network error"+
+			"\ndownloading the modules) is retried. Failures compiling the binary are not retried",
+	)
+	cmd.Flags().DurationVar(
+		&retryDelay,
+		"build-retry-delay",
+		builder.DefaultBuildRetryDelay,
+		"delay before retrying a build, doubled on each retry",
+	)
+	cmd.Flags().StringSliceVar(
+		&transientErrors,
+		"transient-errors",
+		nil,
+		"regular expressions matching the errors or output of the builds that failed for transient reasons."+
+			"\nDefaults to common network errors",
+	)
+	cmd.Flags().BoolVar(
+		&serveLast,
+		"serve-last-successful",
+		false,
+		"serve the last artifact built for a request with floating constraints if the resolved versions fail compiling",
+	)
+	cmd.Flags().BoolVar(
+		&keyPrefix,
+		"store-key-prefix",
+		false,
+		"store the artifacts under a human-readable prefix (e.g. k6-linux-amd64-v0.50.0/<id>)."+
+			"\nRequires a store that supports '/' in the keys (file, s3, gcs, azure and http stores)."+
+			"\nWith --proxy-downloads and for invalidating artifacts, the artifacts' keys are resolved by listing"+
+			"\nthe store (a http store must be started with --key-prefix)",
+	)
+	cmd.Flags().StringVar(
+		&profilesFile,
+		"profiles",
+		"",
+		"json file with the build profiles that requests can reference by name. Maps each profile to its dependencies."+
+			"\nE.g. {\"minimal\": [{\"name\": \"k6/x/kubernetes\", \"constraints\": \"*\"}]}",
+	)
+	cmd.Flags().StringVar(&webhook.URL, "webhook-url", "", "url the build completion events are posted to")
+	cmd.Flags().StringVar(&webhook.Secret, "webhook-secret", "", "secret for signing the webhook events")
+	cmd.Flags().IntVar(
+		&webhook.Retries,
+		"webhook-retries",
+		server.DefaultWebhookRetries,
+		"number of retries for delivering a webhook event. Use a negative value for disabling retries",
+	)
+	cmd.Flags().BoolVar(
+		&proxyDownloads,
+		"proxy-downloads",
+		false,
+		"serve the artifacts from the build server, proxying the downloads from the store."+
+			"\nUseful when the store is not reachable by the clients.",
+	)
+	cmd.Flags().StringVar(
+		&downloadURL,
+		"download-url",
+		"",
+		"base url used for downloading artifacts when --proxy-downloads is enabled."+
+			"\nIf not specified, the url is derived from the build request",
+	)
+	cmd.Flags().StringVar(
+		&externalStoreURL,
+		"external-store-url",
+		"",
+		"base url used by the clients for reaching the store (e.g. https://store.example.com), when the"+
+			"\nartifact urls reference a host they cannot reach. Ignored if --proxy-downloads is enabled",
+	)
 	cmd.Flags().BoolVar(
 		&allowBuildSemvers,
 		"allow-build-semvers",
 		false,
 		"allow building versions with build metadata (e.g v0.0.0+build).",
 	)
+	cmd.Flags().StringVar(
+		&minK6Version,
+		"min-k6-version",
+		"",
+		"lowest k6 version (e.g. v0.50.0) that can be built. Requests resolving to lower versions are rejected",
+	)
+	cmd.Flags().StringSliceVar(
+		&allowedExts,
+		"allowed-extensions",
+		nil,
+		"only extensions that can be built (e.g. k6/x/kubernetes), even if others are in the catalog."+
+			"\nIf not specified, all extensions are allowed",
+	)
+	cmd.Flags().StringSliceVar(
+		&deniedExts,
+		"denied-extensions",
+		nil,
+		"extensions that cannot be built, even if allowed by --allowed-extensions",
+	)
+	cmd.Flags().StringVar(
+		&k6Repo,
+		"k6-repo",
+		"",
+		"alternative k6 module (e.g. a fork) with version used instead of go.k6.io/k6"+
+			"\n(e.g. github.com/org/k6@v0.50.1)",
+	)
+	cmd.Flags().BoolVar(
+		&allowK6Fork,
+		"allow-k6-fork",
+		false,
+		"allow build requests to specify an alternative k6 module (e.g. a fork) with version used instead of go.k6.io/k6",
+	)
 
 	return cmd
 }
+
+// capabilities returns the capabilities of the build service from its configuration
+func capabilities(enableCgo bool, catalogURL string, maxArtifactAge time.Duration) api.Capabilities {
+	platforms := []string{}
+	for _, p := range k6foundry.SupportedPlatforms() {
+		platforms = append(platforms, p.String())
+	}
+
+	capabilities := api.Capabilities{
+		Platforms:  platforms,
+		CgoEnabled: enableCgo,
+		Catalog:    catalogURL,
+	}
+
+	if maxArtifactAge > 0 {
+		capabilities.MaxArtifactAge = maxArtifactAge.String()
+	}
+
+	return capabilities
+}
+
+// loadProfiles loads the build profiles from a json file that maps the name of each profile
+// to its dependencies. Returns no profiles if the file is not specified.
+func loadProfiles(path string) (map[string][]k6build.Dependency, error) {
+	if path == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	content, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := map[string][]k6build.Dependency{}
+	if err = json.Unmarshal(content, &profiles); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// serveUnixSocket serves the requests listening on a unix domain socket.
+// A stale socket file left by a previous execution is removed.
+func serveUnixSocket(socket string, srv *http.Server, log *slog.Logger) error {
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing socket %w", err)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("listening on socket %w", err)
+	}
+
+	log.Info("starting server", "socket", socket)
+	return srv.Serve(listener)
+}
+
+// parseTimeouts parses the timeouts of the extensions
+func parseTimeouts(timeouts map[string]string) (map[string]time.Duration, error) {
+	parsed := map[string]time.Duration{}
+	for extension, timeout := range timeouts {
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", extension, err)
+		}
+		parsed[extension] = duration
+	}
+
+	return parsed, nil
+}
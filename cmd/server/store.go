@@ -0,0 +1,205 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/azblob"
+	"github.com/grafana/k6build/pkg/store/client"
+	"github.com/grafana/k6build/pkg/store/fallback"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6build/pkg/store/gcs"
+	"github.com/grafana/k6build/pkg/store/keyprefix"
+	"github.com/grafana/k6build/pkg/store/oci"
+	"github.com/grafana/k6build/pkg/store/s3"
+	"github.com/grafana/k6build/pkg/util"
+)
+
+var errUnsupportedStore = errors.New("unsupported store")
+
+// storeOpts defines the options for creating the object store
+type storeOpts struct {
+	// store location as an url
+	location   string
+	storeURL   string
+	s3Bucket   string
+	s3Endpoint string
+	s3Region   string
+	// google cloud storage bucket and endpoint
+	gcsBucket   string
+	gcsEndpoint string
+	// azure blob storage container, account and endpoint
+	azureContainer string
+	azureAccount   string
+	azureEndpoint  string
+	// checksum algorithm used by the s3, gcs, azure and file stores
+	checksumAlgorithm string
+	// maximum size of the file store
+	maxSize int64
+	// expiration of the download urls of the s3, gcs and azure stores
+	urlExpiration time.Duration
+	// location of the store used for reading the objects not found in the store
+	fallback string
+}
+
+// getStore returns the object store for the given options.
+// If a location is specified, the store is selected by its scheme:
+//
+//	s3://bucket?endpoint=<endpoint>&region=<region>
+//	gcs://bucket?endpoint=<endpoint> (gs:// is accepted as an alias)
+//	azblob://account/container?endpoint=<endpoint>
+//	file:///path/to/store
+//	http(s)://host/store
+//	oci://[user:password@]registry/repository[?plain-http=true]
+//
+// Otherwise, the store is selected by the individual s3, gcs, azure and store url options.
+//
+// If a fallback location is specified, objects not found in the store are read from the
+// fallback store.
+func getStore(opts storeOpts) (store.ObjectStore, error) {
+	if opts.fallback != "" {
+		primaryOpts := opts
+		primaryOpts.fallback = ""
+		primary, err := getStore(primaryOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		secondary, err := getStore(storeOpts{
+			location:          opts.fallback,
+			checksumAlgorithm: opts.checksumAlgorithm,
+			urlExpiration:     opts.urlExpiration,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fallback store %w", err)
+		}
+
+		return fallback.New(fallback.Config{Primary: primary, Secondary: secondary})
+	}
+
+	if opts.location == "" {
+		if opts.s3Bucket != "" {
+			return s3.New(s3.Config{
+				Bucket:            opts.s3Bucket,
+				Endpoint:          opts.s3Endpoint,
+				Region:            opts.s3Region,
+				URLExpiration:     opts.urlExpiration,
+				ChecksumAlgorithm: opts.checksumAlgorithm,
+			})
+		}
+
+		if opts.gcsBucket != "" {
+			return gcs.New(gcs.Config{
+				Bucket:            opts.gcsBucket,
+				Endpoint:          opts.gcsEndpoint,
+				URLExpiration:     opts.urlExpiration,
+				ChecksumAlgorithm: opts.checksumAlgorithm,
+			})
+		}
+
+		if opts.azureContainer != "" {
+			return azblob.New(azblob.Config{
+				Container:         opts.azureContainer,
+				AccountName:       opts.azureAccount,
+				Endpoint:          opts.azureEndpoint,
+				URLExpiration:     opts.urlExpiration,
+				ChecksumAlgorithm: opts.checksumAlgorithm,
+			})
+		}
+
+		return client.NewStoreClient(client.StoreClientConfig{
+			Server: opts.storeURL,
+		})
+	}
+
+	location, err := url.Parse(opts.location)
+	if err != nil {
+		return nil, fmt.Errorf("parsing store location %w", err)
+	}
+
+	switch location.Scheme {
+	case "s3":
+		query := location.Query()
+		return s3.New(s3.Config{
+			Bucket:            location.Host,
+			Endpoint:          query.Get("endpoint"),
+			Region:            query.Get("region"),
+			URLExpiration:     opts.urlExpiration,
+			ChecksumAlgorithm: opts.checksumAlgorithm,
+		})
+	case "gcs", "gs":
+		return gcs.New(gcs.Config{
+			Bucket:            location.Host,
+			Endpoint:          location.Query().Get("endpoint"),
+			URLExpiration:     opts.urlExpiration,
+			ChecksumAlgorithm: opts.checksumAlgorithm,
+		})
+	case "azblob":
+		return azblob.New(azblob.Config{
+			Container:         strings.TrimPrefix(location.Path, "/"),
+			AccountName:       location.Host,
+			Endpoint:          location.Query().Get("endpoint"),
+			URLExpiration:     opts.urlExpiration,
+			ChecksumAlgorithm: opts.checksumAlgorithm,
+		})
+	case "file":
+		path, err := util.URLToFilePath(location)
+		if err != nil {
+			return nil, fmt.Errorf("parsing store location %w", err)
+		}
+		return file.New(file.Config{Dir: path, ChecksumAlgorithm: opts.checksumAlgorithm, MaxSize: opts.maxSize})
+	case "http", "https":
+		return client.NewStoreClient(client.StoreClientConfig{
+			Server: location.String(),
+		})
+	case "oci":
+		plainHTTP := false
+		if value := location.Query().Get("plain-http"); value != "" {
+			plainHTTP, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("parsing store location %w", err)
+			}
+		}
+		password, _ := location.User.Password()
+		return oci.New(oci.Config{
+			Registry:   location.Host,
+			Repository: strings.TrimPrefix(location.Path, "/"),
+			PlainHTTP:  plainHTTP,
+			Username:   location.User.Username(),
+			Password:   password,
+		})
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedStore, location.Scheme)
+	}
+}
+
+// isOCIStore returns true if the store location is an OCI registry. The URLs of the objects in a
+// registry are references to OCI artifacts that the clients cannot download.
+func isOCIStore(location string) bool {
+	return strings.HasPrefix(location, "oci://")
+}
+
+// downloadProxyStore returns the store used by the download proxy. If the artifacts are stored
+// under a prefix, the proxy must resolve their keys from their ids.
+func downloadProxyStore(objectStore store.ObjectStore, keyPrefix bool) (store.ObjectStore, error) {
+	if !keyPrefix {
+		return objectStore, nil
+	}
+
+	// the store server resolves the keys (see the store command's --key-prefix option)
+	if _, ok := objectStore.(*client.StoreClient); ok {
+		return objectStore, nil
+	}
+
+	prefixed, err := keyprefix.New(keyprefix.Config{Store: objectStore})
+	if err != nil {
+		return nil, fmt.Errorf("--proxy-downloads with --store-key-prefix: %w", err)
+	}
+
+	return prefixed, nil
+}
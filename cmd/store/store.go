@@ -2,15 +2,23 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
 	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6build/pkg/store/keyprefix"
+	"github.com/grafana/k6build/pkg/store/scrubber"
 	"github.com/grafana/k6build/pkg/store/server"
+	"github.com/grafana/k6build/pkg/util"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 )
 
@@ -22,13 +30,35 @@ The object server offers a REST API for storing and downloading objects.
 
 Objects can be retrieved by a download url returned when the object is stored.
 
+The ids of the objects must match the --id-pattern. By default, only the ids of the artifacts
+generated by the build server are accepted, to prevent the store from being used for storing
+arbitrary objects. Use --id-pattern '.+' for accepting any id.
+
 The --download-url specifies the base URL for downloading objects. This is necessary to allow
 downloading the objects from different machines.
+
+The --scrub-interval enables a background scrubber that periodically re-reads the objects and
+verifies their checksum. Corrupted objects are logged and counted in the
+k6build_store_corrupted_objects_total metric. If --scrub-delete-corrupted is specified, corrupted
+objects are deleted, so they are built again on the next request.
+
+The --store-max-size limits the total size of the objects. When storing an object exceeds it, the
+least recently used objects (either stored or retrieved) are evicted. Objects larger than the
+limit are rejected.
+
+Objects can be pinned to prevent their eviction with a POST to /store/{id}/pin. Each pin adds a
+reference to the object, which is released with a POST to /store/{id}/release. Objects are
+evicted only when all their references are released. The references are kept across restarts.
+
+The --key-prefix option allows retrieving the artifacts stored under a prefix by a build server
+using --store-key-prefix (e.g. k6-linux-amd64-v0.50.0/<id>) by their id, as needed for proxying
+their downloads (--proxy-downloads). The ids are resolved by listing the objects in the store.
+The ids containing '/' must be escaped in the requests' path (e.g. /store/k6-linux-amd64-v0.50.0%2F<id>).
 `
 
 	example = `
-# start the server serving an external url
-k6build store --download-url http://external.url
+# start the server serving an external url, accepting any object id
+k6build store --download-url http://external.url --id-pattern '.+'
 
 # store object from same host
 curl -x POST http://localhost:9000/store/objectID -d "object content" | jq .
@@ -43,6 +73,15 @@ curl -x POST http://localhost:9000/store/objectID -d "object content" | jq .
 
 # download object from another machine using the external url
 curl http://external.url:9000/store/objectID/download
+
+# verify the objects every 24 hours and delete the corrupted ones
+k6build store --scrub-interval 24h --scrub-delete-corrupted
+
+# keep the store within 10GiB, evicting the least recently used objects
+k6build store --store-max-size 10737418240
+
+# pin an object to prevent its eviction
+curl -X POST http://localhost:9000/store/objectID/pin
 `
 )
 
@@ -53,6 +92,17 @@ func New() *cobra.Command {
 		storeSrvURL string
 		port        int
 		logLevel    string
+		idPattern   string
+		readOnly    bool
+		keyPrefix   bool
+
+		scrubInterval        time.Duration
+		scrubDeleteCorrupted bool
+
+		checksumAlgorithm string
+		maxSize           int64
+
+		httpOpts util.HTTPServerOpts
 	)
 
 	cmd := &cobra.Command{
@@ -80,27 +130,54 @@ func New() *cobra.Command {
 				),
 			)
 
-			store, err := file.NewFileStore(storeDir)
+			store, err := file.New(file.Config{Dir: storeDir, ChecksumAlgorithm: checksumAlgorithm, MaxSize: maxSize})
 			if err != nil {
 				return fmt.Errorf("creating object store %w", err)
 			}
 
+			// the scrubber works on the objects' keys, so only the server resolves the prefixed ids
+			srvStore := store
+			if keyPrefix {
+				srvStore, err = keyprefix.New(keyprefix.Config{Store: store})
+				if err != nil {
+					return fmt.Errorf("creating object store %w", err)
+				}
+			}
+
 			config := server.StoreServerConfig{
-				BaseURL: storeSrvURL,
-				Store:   store,
-				Log:     log,
+				BaseURL:   storeSrvURL,
+				Store:     srvStore,
+				Log:       log,
+				IDPattern: idPattern,
+				ReadOnly:  readOnly,
 			}
 			storeSrv, err := server.NewStoreServer(config)
 			if err != nil {
 				return fmt.Errorf("creating store server %w", err)
 			}
 
+			if scrubInterval > 0 {
+				storeScrubber, err := scrubber.New(scrubber.Config{
+					Store:           store,
+					Interval:        scrubInterval,
+					DeleteCorrupted: scrubDeleteCorrupted,
+					Registerer:      prometheus.DefaultRegisterer,
+					Log:             log,
+				})
+				if err != nil {
+					return fmt.Errorf("creating store scrubber %w", err)
+				}
+
+				go storeScrubber.Run(context.Background())
+			}
+
 			srv := http.NewServeMux()
 			srv.Handle("/store/", storeSrv)
+			srv.Handle("/metrics", promhttp.Handler())
 
 			listerAddr := fmt.Sprintf("0.0.0.0:%d", port)
 			log.Info("starting server", "address", listerAddr, "object store", storeDir)
-			err = http.ListenAndServe(listerAddr, srv) //nolint:gosec
+			err = util.NewHTTPServer(listerAddr, srv, httpOpts).ListenAndServe()
 			if err != nil {
 				log.Info("server ended", "error", err.Error())
 			}
@@ -111,12 +188,71 @@ func New() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&storeDir, "store-dir", "c", "/tmp/k6build/store", "object store directory")
+	cmd.Flags().Int64Var(
+		&maxSize,
+		"store-max-size",
+		0,
+		"maximum total size in bytes of the objects. When exceeded, the least recently used objects"+
+			"\nare evicted. If 0, the size is not limited",
+	)
 	cmd.Flags().IntVarP(&port, "port", "p", 9000, "port server will listen")
+	cmd.Flags().BoolVar(
+		&httpOpts.H2C,
+		"h2c",
+		false,
+		"serve HTTP/2 over cleartext connections (h2c) besides HTTP/1.1. Intended for internal use",
+	)
+	cmd.Flags().DurationVar(
+		&httpOpts.KeepAliveTimeout,
+		"keep-alive-timeout",
+		util.DefaultKeepAliveTimeout,
+		"time an idle connection is kept open waiting for the next request. If 0, keep-alives are disabled",
+	)
 	cmd.Flags().StringVarP(&storeSrvURL,
 		"download-url", "d", "", "base url used for downloading objects."+
 			"\nIf not specified http://localhost:<port> is used",
 	)
 	cmd.Flags().StringVarP(&logLevel, "log-level", "l", "INFO", "log level")
+	cmd.Flags().StringVar(
+		&idPattern,
+		"id-pattern",
+		server.ArtifactIDPattern,
+		"regular expression object ids must match. Requests with non-conforming ids are rejected."+
+			"\nThe default accepts the ids of the artifacts, optionally prefixed (see --key-prefix)."+
+			"\nUse '"+server.AnyIDPattern+"' for accepting any id",
+	)
+	cmd.Flags().StringVar(
+		&checksumAlgorithm,
+		"checksum-algorithm",
+		store.ChecksumSHA256,
+		"checksum algorithm for the objects (sha256, sha512)."+
+			"\nChecksums other than sha256 are prefixed with the algorithm (e.g. sha512:<checksum>)",
+	)
+	cmd.Flags().BoolVar(
+		&readOnly,
+		"read-only",
+		false,
+		"reject requests for storing objects or updating their references. Useful for replicas serving downloads",
+	)
+	cmd.Flags().BoolVar(
+		&keyPrefix,
+		"key-prefix",
+		false,
+		"resolve the ids of the objects stored under a prefix (e.g. k6-linux-amd64-v0.50.0/<id>) by a build"+
+			"\nserver using --store-key-prefix, so they can be retrieved by their id",
+	)
+	cmd.Flags().DurationVar(
+		&scrubInterval,
+		"scrub-interval",
+		0,
+		"interval for verifying the checksum of the objects. If 0, objects are not verified",
+	)
+	cmd.Flags().BoolVar(
+		&scrubDeleteCorrupted,
+		"scrub-delete-corrupted",
+		false,
+		"delete the objects found corrupted when verifying their checksum",
+	)
 
 	return cmd
 }
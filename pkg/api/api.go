@@ -17,13 +17,135 @@ var (
 	ErrRequestFailed = errors.New("request failed")
 	// ErrBuildFailed signals the build process failed
 	ErrBuildFailed = errors.New("build failed")
+	// ErrCannotSatisfy signals the dependencies cannot be satisfied
+	// (e.g. unknown dependency or no version satisfies the constraints)
+	ErrCannotSatisfy = errors.New("cannot satisfy dependencies")
+	// ErrTimeout signals the request was not completed in the time the client waits for it
+	ErrTimeout = errors.New("request timeout")
+	// ErrQueueFull signals the build service rejected the request because too many builds
+	// are waiting to start. The request can be retried later (see QueuePositionHeader)
+	ErrQueueFull = errors.New("build queue full")
+	// ErrInsufficientStorage signals the build service doesn't have enough free space for building.
+	// The request can be retried later or in another instance of the build service
+	ErrInsufficientStorage = errors.New("insufficient storage")
+	// ErrProxyAuth signals the go module proxy used by the build service rejected its credentials
+	// (e.g. they expired). The build will fail until the build service's configuration is fixed
+	ErrProxyAuth = errors.New("module proxy authentication failed")
 )
 
+// Error codes included in the responses, so clients can identify the errors without relying
+// on their messages. Each code corresponds to an error defined in this package.
+const (
+	CodeInvalidRequest = "INVALID_REQUEST"
+	CodeRequestFailed  = "REQUEST_FAILED"
+	CodeBuildFailed    = "BUILD_FAILED"
+	CodeCannotSatisfy  = "CANNOT_SATISFY"
+	CodeTimeout        = "TIMEOUT"
+	CodeQueueFull      = "QUEUE_FULL"
+	// CodeInsufficientStorage is returned with status 507 (Insufficient Storage)
+	CodeInsufficientStorage = "INSUFFICIENT_STORAGE"
+	// CodeProxyAuth is returned with status 502 (Bad Gateway)
+	CodeProxyAuth = "PROXY_AUTH_FAILED"
+)
+
+// codeErrors maps the codes to their errors, from the most to the least specific
+var codeErrors = []struct {
+	code string
+	err  error
+}{
+	{CodeTimeout, ErrTimeout},
+	{CodeQueueFull, ErrQueueFull},
+	{CodeInsufficientStorage, ErrInsufficientStorage},
+	{CodeProxyAuth, ErrProxyAuth},
+	{CodeCannotSatisfy, ErrCannotSatisfy},
+	{CodeInvalidRequest, ErrInvalidRequest},
+	{CodeBuildFailed, ErrBuildFailed},
+	{CodeRequestFailed, ErrRequestFailed},
+}
+
+// ErrorCode returns the code of the most specific error defined in this package that
+// the error matches. Returns an empty string if it doesn't match any.
+func ErrorCode(err error) string {
+	for _, c := range codeErrors {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// CodeError returns the error defined in this package for the code.
+// Returns nil if the code is unknown.
+func CodeError(code string) error {
+	for _, c := range codeErrors {
+		if c.code == code {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// RequestTimeoutHeader is the header used by clients for informing the build service the time
+// they will wait for the response (e.g. "30s"), so the build service can stop processing the
+// request when it is no longer needed. It uses a duration instead of a deadline to be
+// independent of clock differences between the client and the server.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// Headers of the 503 (Service Unavailable) response to a request rejected because the build
+// queue is full, besides the Retry-After header with the estimated wait in seconds
+const (
+	// QueuePositionHeader is the position the build would have had in the queue
+	QueuePositionHeader = "X-Queue-Position"
+	// EstimatedWaitHeader is the estimated wait for the build to start in that position (e.g. "1m30s").
+	// It is not included if the wait cannot be estimated.
+	EstimatedWaitHeader = "X-Estimated-Wait"
+)
+
+// EnsureParam is the query parameter of a build request that makes explicit the request only
+// ensures the artifact exists (resolving the dependencies and building it into the store if needed)
+// and returns its metadata, including the URL for downloading it later. The artifact's binary is
+// never returned in the response, even if the request accepts application/octet-stream. This is the
+// default behavior of build requests.
+const EnsureParam = "ensure"
+
+// Aliases for the platform of the machine the client runs on. The build service cannot know
+// this platform, so clients must replace the aliases before sending the request.
+const (
+	PlatformNative = "native"
+	PlatformHost   = "host"
+)
+
+// IsPlatformAlias returns true if the platform is an alias for the client's platform
+func IsPlatformAlias(platform string) bool {
+	return platform == PlatformNative || platform == PlatformHost
+}
+
 // BuildRequest defines a request to the build service
 type BuildRequest struct {
 	K6Constrains string               `json:"k6,omitempty"`
 	Dependencies []k6build.Dependency `json:"dependencies,omitempty"`
 	Platform     string               `json:"platform,omitempty"`
+	// Profile is the name of a set of dependencies defined by the build service.
+	// The dependencies of the profile are merged with the Dependencies of the request,
+	// which take precedence.
+	Profile string `json:"profile,omitempty"`
+	// NoCache forces building the artifact even if it is available in the store
+	NoCache bool `json:"no_cache,omitempty"`
+	// NoStore prevents the artifact built from being written to the store
+	NoStore bool `json:"no_store,omitempty"`
+	// CurrentArtifact is the ID of the artifact the client already has. If the request resolves to
+	// the same artifact, the build service responds with 304 (Not Modified) and no content.
+	CurrentArtifact string `json:"current_artifact,omitempty"`
+	// Fallback retries the build with lower versions of the dependencies if the resolved
+	// versions fail to build
+	Fallback bool `json:"fallback,omitempty"`
+	// Replacements pin modules of the build (k6 or the dependencies' modules, by module path) to an
+	// exact version or pseudo-version (e.g. v0.0.0-20240101120000-abcdef123456), regardless of the
+	// versions their constraints resolve to. A replacement takes precedence over the resolution.
+	Replacements map[string]string `json:"replacements,omitempty"`
+	// K6Repo is an alternative module (e.g. a fork) with version used for building k6 instead of
+	// go.k6.io/k6 (e.g. github.com/org/k6@v0.50.1). Rejected unless the build service allows forks.
+	K6Repo string `json:"k6_repo,omitempty"`
 }
 
 // String returns a text serialization of the BuildRequest
@@ -31,6 +153,9 @@ func (r BuildRequest) String() string {
 	buffer := &bytes.Buffer{}
 	buffer.WriteString(fmt.Sprintf("platform: %s", r.Platform))
 	buffer.WriteString(fmt.Sprintf("k6: %s", r.K6Constrains))
+	if r.Profile != "" {
+		buffer.WriteString(fmt.Sprintf("profile: %s", r.Profile))
+	}
 	for _, d := range r.Dependencies {
 		buffer.WriteString(fmt.Sprintf("%s:%q", d.Name, d.Constraints))
 	}
@@ -43,6 +168,119 @@ type BuildResponse struct {
 	// This Error can be compared to the errors defined in this package using errors.Is
 	// to know the type of error, and use Unwrap to obtain its cause if available.
 	Error *k6build.WrappedError `json:"error,omitempty"`
+	// Code identifies the error (e.g. CANNOT_SATISFY). See CodeError
+	Code string `json:"code,omitempty"`
+	// ValidationErrors lists the invalid fields of the request, if it was rejected
+	// because of them (see BuildRequest.Validate)
+	ValidationErrors []FieldError `json:"validation_errors,omitempty"`
+	// DependencyResults reports the result of resolving each dependency of the request (including k6),
+	// if any of them cannot be resolved
+	DependencyResults []DependencyResult `json:"dependency_results,omitempty"`
 	// Artifact metadata. If an error occurred, content is undefined
 	Artifact k6build.Artifact `json:"artifact,omitempty"`
+	// Warnings about the request. For example, floating constraints (e.g. '*') that can
+	// resolve to different versions in subsequent requests.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// DependencyResult is the result of resolving a dependency of a request
+type DependencyResult struct {
+	// Name of the dependency (e.g. k6/x/kubernetes)
+	Name string `json:"name"`
+	// Version the dependency resolves to. Empty if it cannot be resolved
+	Version string `json:"version,omitempty"`
+	// Error describes why the dependency cannot be resolved (e.g. no version satisfies its constraints).
+	// Empty if it is resolved
+	Error string `json:"error,omitempty"`
+}
+
+// ArtifactIDResponse defines the response for a request of the artifact that satisfies a BuildRequest,
+// without building it
+type ArtifactIDResponse struct {
+	// If not empty an error occurred processing the request
+	Error *k6build.WrappedError `json:"error,omitempty"`
+	// Code identifies the error (e.g. CANNOT_SATISFY). See CodeError
+	Code string `json:"code,omitempty"`
+	// ValidationErrors lists the invalid fields of the request, if it was rejected
+	// because of them (see BuildRequest.Validate)
+	ValidationErrors []FieldError `json:"validation_errors,omitempty"`
+	// DependencyResults reports the result of resolving each dependency of the request (including k6),
+	// if any of them cannot be resolved
+	DependencyResults []DependencyResult `json:"dependency_results,omitempty"`
+	// ID of the artifact. The same ID is returned by a build of the request
+	ID string `json:"id,omitempty"`
+	// Platform of the artifact
+	Platform string `json:"platform,omitempty"`
+	// Dependencies resolved to versions
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// Capabilities describes the configuration of a build service that is relevant to its clients
+type Capabilities struct {
+	// Platforms supported by the build service (e.g. linux/amd64)
+	Platforms []string `json:"platforms,omitempty"`
+	// CgoEnabled indicates if the binaries are built with CGO enabled by default.
+	// Even if false, CGO is enabled for dependencies that require it.
+	CgoEnabled bool `json:"cgo_enabled"`
+	// Catalog is the location of the extension catalog used by the build service
+	Catalog string `json:"catalog,omitempty"`
+	// MaxArtifactAge is the maximum age of artifacts built from floating constraints
+	// served from the store (e.g. 24h0m0s). Empty if artifacts never expire
+	MaxArtifactAge string `json:"max_artifact_age,omitempty"`
+	// Profiles are the names of the build profiles that can be used in build requests
+	Profiles []string `json:"profiles,omitempty"`
+}
+
+// CatalogVersion describes a version of a dependency in the catalog
+type CatalogVersion struct {
+	Version string `json:"version"`
+	// Prerelease indicates the version is a pre-release (e.g. v0.2.0-rc1)
+	Prerelease bool `json:"prerelease,omitempty"`
+}
+
+// CatalogVersionsResponse defines the response for a request of all the versions of a dependency
+// in the catalog
+type CatalogVersionsResponse struct {
+	// If not empty an error occurred processing the request
+	Error *k6build.WrappedError `json:"error,omitempty"`
+	// Code identifies the error (e.g. CANNOT_SATISFY). See CodeError
+	Code string `json:"code,omitempty"`
+	// Dependency the versions belong to (e.g. k6/x/kubernetes)
+	Dependency string `json:"dependency,omitempty"`
+	// Versions of the dependency, newest first
+	Versions []CatalogVersion `json:"versions"`
+}
+
+// CatalogDependency describes a dependency in the catalog
+type CatalogDependency struct {
+	// Name of the dependency (e.g. k6/x/kubernetes)
+	Name string `json:"name"`
+	// Module is the path of the go module that implements the dependency
+	Module string `json:"module"`
+	// Cgo indicates if the module requires cgo
+	Cgo bool `json:"cgo,omitempty"`
+	// Versions of the stable channel, newest first
+	Versions []CatalogVersion `json:"versions"`
+	// Channels maps the release channels to the versions published on them, newest first
+	Channels map[string][]CatalogVersion `json:"channels,omitempty"`
+}
+
+// CatalogResponse defines the response for a request of the contents of the catalog
+type CatalogResponse struct {
+	// If not empty an error occurred processing the request
+	Error *k6build.WrappedError `json:"error,omitempty"`
+	// Code identifies the error (e.g. CANNOT_SATISFY). See CodeError
+	Code string `json:"code,omitempty"`
+	// Dependencies in the catalog, sorted by name
+	Dependencies []CatalogDependency `json:"dependencies"`
+}
+
+// VersionsResponse defines the response for a request of the versions that satisfy a dependency
+type VersionsResponse struct {
+	// If not empty an error occurred processing the request
+	Error *k6build.WrappedError `json:"error,omitempty"`
+	// Code identifies the error (e.g. CANNOT_SATISFY). See CodeError
+	Code string `json:"code,omitempty"`
+	// Versions that satisfy the dependency's constraints, newest first
+	Versions []string `json:"versions"`
 }
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// FieldError describes a problem with a field of a request
+type FieldError struct {
+	// Field is the path of the field in the request (e.g. dependencies[0].constraints)
+	Field string `json:"field"`
+	// Message describes what is wrong with the field's value
+	Message string `json:"message"`
+}
+
+// ValidationError reports all the invalid fields of a request
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	problems := make([]string, 0, len(e))
+	for _, f := range e {
+		problems = append(problems, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return "invalid fields: " + strings.Join(problems, "; ")
+}
+
+// Validate checks the fields of the request, returning a ValidationError listing
+// each invalid field, or nil if the request is valid.
+// It checks the syntax of the fields, not whether the dependencies can be satisfied.
+func (r BuildRequest) Validate() error {
+	errs := ValidationError{}
+	invalid := func(field string, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case r.Platform == "":
+		invalid("platform", "is required")
+	case IsPlatformAlias(r.Platform):
+		invalid("platform", "alias %q must be replaced by the client's platform", r.Platform)
+	default:
+		if goos, arch, found := strings.Cut(r.Platform, "/"); !found || goos == "" || arch == "" {
+			invalid("platform", "%q must have the form os/arch (e.g. linux/amd64)", r.Platform)
+		}
+	}
+
+	if r.K6Constrains != "" {
+		if _, err := semver.NewConstraint(r.K6Constrains); err != nil {
+			invalid("k6", "invalid constraints %q", r.K6Constrains)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, d := range r.Dependencies {
+		field := fmt.Sprintf("dependencies[%d]", i)
+
+		switch {
+		case d.Name == "":
+			invalid(field+".name", "is required")
+		case names[d.Name]:
+			invalid(field+".name", "duplicated dependency %q", d.Name)
+		}
+		names[d.Name] = true
+
+		if d.Constraints == "" {
+			invalid(field+".constraints", "is required (use '*' for any version)")
+			continue
+		}
+		if _, err := semver.NewConstraint(d.Constraints); err != nil {
+			invalid(field+".constraints", "invalid constraints %q", d.Constraints)
+		}
+	}
+
+	paths := make([]string, 0, len(r.Replacements))
+	for path := range r.Replacements {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		field := fmt.Sprintf("replacements[%q]", path)
+		if path == "" {
+			invalid(field, "module path is required")
+			continue
+		}
+		if version := r.Replacements[path]; !validModuleVersion(version) {
+			invalid(field, "invalid version %q (e.g. v0.1.0 or a pseudo-version)", version)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validModuleVersion returns true if the version is an exact module version: a semantic version
+// prefixed with 'v' (e.g. v0.1.0), including pseudo-versions (e.g. v0.0.0-20240101120000-abcdef123456)
+func validModuleVersion(version string) bool {
+	semanticVersion, found := strings.CutPrefix(version, "v")
+	if !found {
+		return false
+	}
+
+	_, err := semver.StrictNewVersion(semanticVersion)
+	return err == nil
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/k6build"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		req    BuildRequest
+		expect []FieldError
+	}{
+		{
+			title: "valid request",
+			req: BuildRequest{
+				Platform:     "linux/amd64",
+				K6Constrains: "v0.1.0",
+				Dependencies: []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			},
+		},
+		{
+			title: "missing platform",
+			req:   BuildRequest{K6Constrains: "v0.1.0"},
+			expect: []FieldError{
+				{Field: "platform", Message: "is required"},
+			},
+		},
+		{
+			title: "platform alias",
+			req:   BuildRequest{Platform: "native"},
+			expect: []FieldError{
+				{Field: "platform", Message: `alias "native" must be replaced by the client's platform`},
+			},
+		},
+		{
+			title: "malformed platform",
+			req:   BuildRequest{Platform: "linux"},
+			expect: []FieldError{
+				{Field: "platform", Message: `"linux" must have the form os/arch (e.g. linux/amd64)`},
+			},
+		},
+		{
+			title: "multiple invalid fields",
+			req: BuildRequest{
+				Platform:     "linux/amd64",
+				K6Constrains: "latest",
+				Dependencies: []k6build.Dependency{
+					{Name: "k6/x/ext", Constraints: "*"},
+					{Name: "", Constraints: "v0.1.0"},
+					{Name: "k6/x/ext", Constraints: ""},
+					{Name: "k6/x/ext2", Constraints: "v0.1"},
+					{Name: "k6/x/ext3", Constraints: "> v0.1.0 <"},
+				},
+			},
+			expect: []FieldError{
+				{Field: "k6", Message: `invalid constraints "latest"`},
+				{Field: "dependencies[1].name", Message: "is required"},
+				{Field: "dependencies[2].name", Message: `duplicated dependency "k6/x/ext"`},
+				{Field: "dependencies[2].constraints", Message: "is required (use '*' for any version)"},
+				{Field: "dependencies[4].constraints", Message: `invalid constraints "> v0.1.0 <"`},
+			},
+		},
+		{
+			title: "replacements",
+			req: BuildRequest{
+				Platform: "linux/amd64",
+				Replacements: map[string]string{
+					"go.k6.io/k6":          "v0.1.0",
+					"github.com/org/xk6-a": "v0.0.0-20240101120000-abcdef123456",
+					"github.com/org/xk6-b": "latest",
+					"github.com/org/xk6-c": "0.1.0",
+					"":                     "v0.1.0",
+				},
+			},
+			expect: []FieldError{
+				{Field: `replacements[""]`, Message: "module path is required"},
+				{
+					Field:   `replacements["github.com/org/xk6-b"]`,
+					Message: `invalid version "latest" (e.g. v0.1.0 or a pseudo-version)`,
+				},
+				{
+					Field:   `replacements["github.com/org/xk6-c"]`,
+					Message: `invalid version "0.1.0" (e.g. v0.1.0 or a pseudo-version)`,
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.req.Validate()
+			if tc.expect == nil {
+				if err != nil {
+					t.Fatalf("unexpected %v", err)
+				}
+				return
+			}
+
+			validationErr := ValidationError{}
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected validation error got %v", err)
+			}
+
+			if diff := cmp.Diff(tc.expect, []FieldError(validationErr)); diff != "" {
+				t.Fatalf("field errors mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -4,17 +4,30 @@ package builder
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/sha1" //nolint:gosec
+	"debug/buildinfo"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
-	"sync"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/grafana/k6build"
 	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/lock"
+	"github.com/grafana/k6build/pkg/signature"
 	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/keyprefix"
 	"github.com/grafana/k6foundry"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -35,6 +48,9 @@ var (
 	ErrInitializingBuilder   = errors.New("initializing builder")                    //nolint:revive
 	ErrInvalidParameters     = errors.New("invalid build parameters")                //nolint:revive
 	ErrBuildSemverNotAllowed = errors.New("semvers with build metadata not allowed") //nolint:revive
+	ErrExtensionNotAllowed   = errors.New("extension not allowed")                   //nolint:revive
+	ErrK6VersionNotSupported = errors.New("k6 version not supported")                //nolint:revive
+	ErrK6ForkNotAllowed      = errors.New("k6 fork not allowed")                     //nolint:revive
 
 	constrainRe = regexp.MustCompile(opRe + verRe + buildRe)
 )
@@ -63,37 +79,168 @@ type Opts struct {
 	Verbose bool
 	// Build environment options
 	GoOpts
+	// EnvAllowlist are the variables of the build environment (including the go environment
+	// if CopyGoEnv is set) whose values can be exposed in the errors and the build output.
+	// The values of other variables are redacted, as well as credentials in URLs.
+	// Defaults to DefaultEnvAllowlist
+	EnvAllowlist []string
+	// MaxArtifactAge is the maximum age of an artifact built from floating constraints
+	// (e.g. '*' or '>v0.1.0') to be served from the store. Older artifacts are rebuilt and replaced
+	// once the new build succeeds. If the rebuild fails, the stored artifact is served.
+	// Artifacts built from exact versions are always served from the store.
+	// Requires a store that supports deleting objects. If 0, artifacts never expire.
+	MaxArtifactAge time.Duration
+	// K6Repo is an alternative repository (e.g. a fork) used for building k6 instead of go.k6.io/k6.
+	// Either a module path with version (e.g. github.com/org/k6@v0.50.1) or a local directory.
+	// Artifacts built from a local directory are never served from the store, as its content may change.
+	K6Repo string
+	// AllowK6Fork allows the build requests to set the repository used for building k6
+	// (see k6build.BuildOpts.K6Repo), overriding K6Repo. Local directories are not allowed.
+	AllowK6Fork bool
+	// NoCache forces building the artifacts even if they are available in the store.
+	// It can also be set for a build using k6build.WithBuildOpts.
+	NoCache bool
+	// SlowBuildThreshold is the duration above which a build is considered slow.
+	// Slow builds are logged and counted in the slow_builds_total metric. If 0, it is disabled.
+	SlowBuildThreshold time.Duration
+	// KeyPrefix stores the artifacts under a human-readable prefix (e.g. k6-linux-amd64-v0.50.0/<id>)
+	// to make the store easier to browse. The artifact's id is not affected.
+	// Requires a store that supports '/' in the keys (e.g. the file and s3 stores).
+	KeyPrefix bool
+	// MaxConcurrentBuilds is the maximum number of artifacts compiled concurrently. Builds served
+	// from the store are not limited. Defaults to the CPUs available to the process: GOMAXPROCS
+	// limited by the CPU quota of the container (cgroup), if any.
+	MaxConcurrentBuilds int
+	// MaxQueuedBuilds is the maximum number of builds waiting for a build slot (see MaxConcurrentBuilds).
+	// Further builds are rejected with a k6build.QueueFullError, which estimates the wait from the
+	// duration of the recent builds. If 0, the builds waiting are not limited.
+	MaxQueuedBuilds int
+	// Fallback retries the builds that fail compiling with lower versions of the dependencies that
+	// satisfy their constraints. It can also be set for a build using k6build.WithBuildOpts.
+	// Requires a catalog that can list the versions of the dependencies (see catalog.VersionLister).
+	Fallback bool
+	// MaxFallbacks is the maximum number of builds attempted with lower versions when a build
+	// fails compiling. Defaults to DefaultMaxFallbacks
+	MaxFallbacks int
+	// BuildTimeout is the maximum duration of the compilation of an artifact. If 0, it is not limited.
+	BuildTimeout time.Duration
+	// ExtensionBuildTimeouts overrides the BuildTimeout for the builds with extensions that take longer
+	// to compile (e.g. using cgo). The keys are either dependency names (e.g. k6/x/sql) or module path
+	// prefixes (e.g. github.com/grafana/xk6-sql). If several match, the longest timeout is used.
+	ExtensionBuildTimeouts map[string]time.Duration
+	// ServeLastSuccessful serves the last artifact successfully built for a request with floating
+	// constraints (e.g. '*' or '>v0.1.0') if the versions they resolve to fail compiling.
+	// The artifacts are remembered only while the builder runs.
+	ServeLastSuccessful bool
+	// AllowedExtensions are the only dependencies (e.g. k6/x/kubernetes) that can be built,
+	// even if others can be resolved. If empty, all dependencies are allowed. k6 is always allowed.
+	AllowedExtensions []string
+	// DeniedExtensions are dependencies that cannot be built, even if allowed by AllowedExtensions
+	DeniedExtensions []string
+	// BuildRetries is the maximum number of times a build that fails for a transient reason
+	// (see TransientErrors) is retried. Failures compiling the binary are never retried.
+	// If 0, builds are not retried.
+	BuildRetries int
+	// BuildRetryDelay is the delay before retrying a build, doubled on each retry.
+	// Defaults to DefaultBuildRetryDelay
+	BuildRetryDelay time.Duration
+	// TransientErrors are regular expressions matching the errors or output of the builds that failed
+	// for transient reasons (e.g. network errors downloading the modules). Defaults to DefaultTransientErrors
+	TransientErrors []string
+	// GoCache is the directory of the go build cache (GOCACHE). Keeping it in a persistent volume
+	// avoids slow builds after restarts. Overrides the GOCACHE given in Env or copied from the
+	// go environment.
+	GoCache string
+	// GoModCache is the directory of the go module cache (GOMODCACHE). Overrides the GOMODCACHE
+	// given in Env or copied from the go environment.
+	GoModCache string
+	// MinFreeSpace is the minimum free space in bytes required for starting a build in the
+	// temporary directory and the go caches (GoCache and GoModCache), if specified. Builds are
+	// rejected with ErrInsufficientSpace if any of them has less free space. If 0, it is not checked.
+	// Only checked in linux and darwin.
+	MinFreeSpace int64
+	// MinK6Version is the lowest k6 version (e.g. v0.50.0) that can be built. Requests resolving
+	// to a lower version are rejected. Not checked for k6 versions with build metadata.
+	// If empty, all versions can be built.
+	MinK6Version string
 }
 
 // Config defines the configuration for a Builder
 type Config struct {
-	Opts       Opts
-	Catalog    catalog.Catalog
+	Opts Opts
+	// Catalog used for resolving the dependencies. Not required if a Resolver is given
+	Catalog catalog.Catalog
+	// Resolver used for resolving the dependencies. Defaults to a CatalogResolver using the Catalog
+	Resolver   Resolver
 	Store      store.ObjectStore
 	Foundry    Foundry
 	Registerer prometheus.Registerer
+	Log        *slog.Logger
+	// SigningKey used for signing the artifacts (see k6build.Artifact.Signature).
+	// If not specified, the artifacts are not signed
+	SigningKey ed25519.PrivateKey
+	// Lock used for preventing concurrent builds of the same artifact. A lock shared by the builders
+	// using the same store (e.g. lock.RedisLock) prevents them from building the same artifact.
+	// Defaults to a lock.MemoryLock
+	Lock lock.Lock
 }
 
 // Builder implements the BuildService interface
 type Builder struct {
-	opts    Opts
-	catalog catalog.Catalog
-	store   store.ObjectStore
-	mutexes sync.Map
-	foundry Foundry
-	metrics *metrics
+	opts     Opts
+	catalog  atomic.Pointer[catalog.Catalog]
+	resolver Resolver
+	store    store.ObjectStore
+	lock     lock.Lock
+	foundry  Foundry
+	metrics  *metrics
+	log      *slog.Logger
+	redactor *redactor
+	// slots for the builds in progress, limits the concurrent builds
+	buildSlots chan struct{}
+	// builds waiting for a slot
+	queued atomic.Int64
+	// duration of the recent builds, for estimating the wait for a slot
+	buildDurations durations
+	// last artifacts built for requests with floating constraints
+	lastBuilds lastBuilds
+	// patterns of the errors of the builds that can be retried
+	transientErrors []*regexp.Regexp
+	// lowest k6 version that can be built, if any
+	minK6Version *semver.Version
+	// returns the free space of a directory
+	freeSpace func(dir string) (uint64, error)
+	// key for signing the artifacts, if any
+	signingKey ed25519.PrivateKey
 }
 
 // New returns a new instance of Builder given a BuilderConfig
 func New(_ context.Context, config Config) (*Builder, error) {
-	if config.Catalog == nil {
-		return nil, k6build.NewWrappedError(ErrInitializingBuilder, errors.New("catalog cannot be nil"))
+	if config.Catalog == nil && config.Resolver == nil {
+		return nil, k6build.NewWrappedError(ErrInitializingBuilder, errors.New("either a catalog or a resolver is required"))
 	}
 
 	if config.Store == nil {
 		return nil, k6build.NewWrappedError(ErrInitializingBuilder, errors.New("store cannot be nil"))
 	}
 
+	if err := validateK6Repo(config.Opts.K6Repo); err != nil {
+		return nil, k6build.NewWrappedError(ErrInitializingBuilder, err)
+	}
+
+	transientErrors, err := compileTransientErrors(config.Opts.TransientErrors)
+	if err != nil {
+		return nil, k6build.NewWrappedError(ErrInitializingBuilder, err)
+	}
+
+	var minK6Version *semver.Version
+	if config.Opts.MinK6Version != "" {
+		minK6Version, err = semver.NewVersion(config.Opts.MinK6Version)
+		if err != nil {
+			return nil, k6build.NewWrappedError(ErrInitializingBuilder, err)
+		}
+	}
+
 	foundry := config.Foundry
 	if foundry == nil {
 		foundry = FoundryFunction(k6foundry.NewNativeBuilder)
@@ -107,17 +254,83 @@ func New(_ context.Context, config Config) (*Builder, error) {
 		}
 	}
 
-	return &Builder{
-		catalog: config.Catalog,
-		opts:    config.Opts,
-		store:   config.Store,
-		foundry: foundry,
-		metrics: metrics,
-	}, nil
+	log := config.Log
+	if log == nil {
+		log = slog.New(
+			slog.NewTextHandler(
+				io.Discard,
+				&slog.HandlerOptions{},
+			),
+		)
+	}
+
+	// the values of the build environment that must not be exposed
+	env := map[string]string{}
+	if config.Opts.CopyGoEnv {
+		var err error
+		env, err = goEnv()
+		if err != nil {
+			log.Warn("getting go environment for redacting it", "error", err.Error())
+			env = map[string]string{}
+		}
+	}
+	maps.Copy(env, config.Opts.Env)
+
+	allowlist := config.Opts.EnvAllowlist
+	if allowlist == nil {
+		allowlist = DefaultEnvAllowlist
+	}
+
+	artifactLock := config.Lock
+	if artifactLock == nil {
+		artifactLock = lock.NewMemoryLock()
+	}
+
+	builder := &Builder{
+		opts:     config.Opts,
+		store:    config.Store,
+		lock:     artifactLock,
+		foundry:  foundry,
+		metrics:  metrics,
+		log:      log,
+		resolver: config.Resolver,
+		redactor: newRedactor(env, allowlist),
+
+		transientErrors: transientErrors,
+		minK6Version:    minK6Version,
+		freeSpace:       diskFreeSpace,
+		signingKey:      config.SigningKey,
+	}
+
+	maxBuilds := config.Opts.MaxConcurrentBuilds
+	if maxBuilds <= 0 {
+		maxBuilds = availableCPUs()
+	}
+	builder.buildSlots = make(chan struct{}, maxBuilds)
+	builder.SetCatalog(config.Catalog)
+
+	return builder, nil
+}
+
+// SetCatalog replaces the catalog used for resolving dependencies (e.g. when it is reloaded).
+// Builds in progress continue using the catalog they started with.
+// Has no effect if the builder uses a custom Resolver.
+func (b *Builder) SetCatalog(c catalog.Catalog) {
+	b.catalog.Store(&c)
+}
+
+// getResolver returns the resolver for a build
+func (b *Builder) getResolver() Resolver {
+	if b.resolver != nil {
+		return b.resolver
+	}
+
+	// all dependencies are resolved using the same catalog even if it is replaced during the build
+	return NewCatalogResolver(*b.catalog.Load())
 }
 
 // Build builds a custom k6 binary with dependencies
-func (b *Builder) Build( //nolint:funlen
+func (b *Builder) Build(
 	ctx context.Context,
 	platform string,
 	k6Constrains string,
@@ -125,7 +338,7 @@ func (b *Builder) Build( //nolint:funlen
 ) (artifact k6build.Artifact, buildErr error) {
 	b.metrics.requestCounter.Inc()
 
-	requestTimer := prometheus.NewTimer(b.metrics.buildTimeHistogram)
+	requestTimer := prometheus.NewTimer(b.metrics.requestTimeHistogram)
 	defer func() {
 		if buildErr == nil {
 			requestTimer.ObserveDuration()
@@ -135,17 +348,113 @@ func (b *Builder) Build( //nolint:funlen
 		// an invalid parameters error and we need to increment the metrics in all of them
 		if errors.Is(buildErr, ErrInvalidParameters) {
 			b.metrics.buildsInvalidCounter.Inc()
+			b.metrics.buildsFailedCounter.WithLabelValues(failureResolve).Inc()
 		}
 	}()
 
+	req, err := b.resolve(ctx, platform, k6Constrains, deps)
+	if err != nil {
+		return k6build.Artifact{}, err
+	}
+
+	artifact, err = b.build(ctx, req)
+	if isCompileError(err) && b.fallbackEnabled(ctx) {
+		artifact, err = b.buildFallback(ctx, req, err)
+	}
+
+	if b.opts.ServeLastSuccessful && isFloating(k6Constrains, deps) {
+		if err == nil {
+			b.lastBuilds.add(req, b.storeKey(artifact.ID, platform, req.k6Mod.Version), artifact)
+		} else if isCompileError(err) {
+			artifact, err = b.serveLastSuccessful(ctx, req, err)
+		}
+	}
+
+	if err == nil && b.signingKey != nil {
+		artifact.Signature = signature.Sign(b.signingKey, artifact.ID, artifact.Checksum)
+	}
+
+	return artifact, err
+}
+
+// ResolveArtifact returns the artifact that satisfies the dependencies without building it:
+// only its ID, platform and resolved dependencies are returned. The artifact may not be available
+// in the store.
+// If the k6 version has build metadata (e.g. v0.0.0+build), the version of k6 is not known
+// until the artifact is built and the build metadata is returned instead.
+func (b *Builder) ResolveArtifact(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	req, err := b.resolve(ctx, platform, k6Constrains, deps)
+	if err != nil {
+		return k6build.Artifact{}, err
+	}
+
+	id, resolved := b.artifactID(req)
+
+	return k6build.Artifact{
+		ID:           id,
+		Dependencies: resolved,
+		Platform:     platform,
+	}, nil
+}
+
+// InvalidateArtifact removes the artifact from the store, so it is built again on the next request.
+// It is not supported if the store doesn't support deleting objects.
+// If the KeyPrefix option is set, the artifact's key is resolved from its ID listing the store
+// (see keyprefix.Store). Stores that cannot be listed must resolve it (e.g. a http store using keyprefix.Store).
+func (b *Builder) InvalidateArtifact(ctx context.Context, id string) error {
+	deleter, ok := b.store.(store.ObjectDeleter)
+	if !ok {
+		return k6build.NewWrappedError(ErrAccessingArtifact, store.ErrNotSupported)
+	}
+
+	if b.opts.KeyPrefix {
+		if prefixed, err := keyprefix.New(keyprefix.Config{Store: b.store}); err == nil {
+			deleter = prefixed
+		}
+	}
+
+	// prevent invalidating the artifact while it is being built
+	unlock, _, err := b.lockArtifact(ctx, id)
+	if err != nil {
+		return k6build.NewWrappedError(ErrAccessingArtifact, err)
+	}
+	defer unlock()
+
+	err = deleter.Delete(ctx, id)
+	if errors.Is(err, store.ErrObjectNotFound) {
+		return k6build.NewWrappedError(k6build.ErrArtifactNotFound, err)
+	}
+	if err != nil {
+		return k6build.NewWrappedError(ErrAccessingArtifact, err)
+	}
+
+	b.metrics.invalidatedCounter.Inc()
+	b.log.Debug("artifact invalidated", "id", id)
+
+	return nil
+}
+
+// resolve resolves the dependencies of a build to modules
+func (b *Builder) resolve(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (buildRequest, error) {
 	buildPlatform, err := k6foundry.ParsePlatform(platform)
 	if err != nil {
-		return k6build.Artifact{}, k6build.NewWrappedError(ErrInvalidParameters, err)
+		return buildRequest{}, k6build.NewWrappedError(ErrInvalidParameters, err)
 	}
 
+	resolver := b.getResolver()
+
 	// sort dependencies to ensure idempotence of build
 	sort.Slice(deps, func(i, j int) bool { return deps[i].Name < deps[j].Name })
-	resolved := map[string]string{}
 
 	// check if it is a semver of the form v0.0.0+<build>
 	// if it is, we don't check with the catalog, but instead we use
@@ -155,48 +464,144 @@ func (b *Builder) Build( //nolint:funlen
 	var k6Mod catalog.Module
 	buildMetadata, err := hasBuildMetadata(k6Constrains)
 	if err != nil {
-		return k6build.Artifact{}, err
+		return buildRequest{}, err
+	}
+	if buildMetadata != "" && !b.opts.AllowBuildSemvers {
+		return buildRequest{}, k6build.NewWrappedError(ErrInvalidParameters, ErrBuildSemverNotAllowed)
+	}
+
+	if err = b.checkExtensions(deps); err != nil {
+		return buildRequest{}, k6build.NewWrappedError(ErrInvalidParameters, err)
 	}
+
+	// resolve all dependencies (including k6, unless built from build metadata) together
+	// to report all the ones that cannot be resolved
+	catalogDeps := []catalog.Dependency{}
+	if buildMetadata == "" {
+		catalogDeps = append(catalogDeps, catalog.Dependency{Name: k6Dep, Constrains: k6Constrains})
+	}
+	for _, d := range deps {
+		catalogDeps = append(
+			catalogDeps,
+			catalog.Dependency{Name: d.Name, Constrains: d.Constraints, Channel: d.Channel},
+		)
+	}
+	modules, err := resolver.Resolve(ctx, catalogDeps)
+	if err == nil && len(modules) != len(catalogDeps) {
+		err = fmt.Errorf("resolver returned %d modules for %d dependencies", len(modules), len(catalogDeps))
+	}
+	if err != nil {
+		return buildRequest{}, k6build.NewWrappedError(ErrInvalidParameters, err)
+	}
+
 	if buildMetadata != "" {
-		if !b.opts.AllowBuildSemvers {
-			return k6build.Artifact{}, k6build.NewWrappedError(ErrInvalidParameters, ErrBuildSemverNotAllowed)
-		}
 		k6Mod = catalog.Module{Path: k6Path, Version: buildMetadata}
 	} else {
-		k6Mod, err = b.catalog.Resolve(ctx, catalog.Dependency{Name: k6Dep, Constrains: k6Constrains})
-		if err != nil {
-			return k6build.Artifact{}, k6build.NewWrappedError(ErrInvalidParameters, err)
+		k6Mod, modules = modules[0], slices.Clone(modules[1:])
+	}
+
+	// replacements take precedence over the resolved versions
+	replacements := k6build.BuildOptsFromContext(ctx).Replacements
+	buildModules := []*catalog.Module{&k6Mod}
+	for i := range modules {
+		buildModules = append(buildModules, &modules[i])
+	}
+	if err = applyReplacements(replacements, buildModules); err != nil {
+		return buildRequest{}, k6build.NewWrappedError(ErrInvalidParameters, err)
+	}
+
+	if buildMetadata == "" {
+		if err = b.checkK6Version(k6Mod.Version); err != nil {
+			return buildRequest{}, k6build.NewWrappedError(ErrInvalidParameters, err)
 		}
 	}
-	resolved[k6Dep] = k6Mod.Version
+
+	k6Repo, err := b.k6Repo(ctx)
+	if err != nil {
+		return buildRequest{}, k6build.NewWrappedError(ErrInvalidParameters, err)
+	}
+
+	return buildRequest{
+		platform:      platform,
+		buildPlatform: buildPlatform,
+		k6Constrains:  k6Constrains,
+		deps:          deps,
+		buildMetadata: buildMetadata,
+		k6Mod:         k6Mod,
+		modules:       modules,
+		replacements:  replacements,
+		k6Repo:        k6Repo,
+	}, nil
+}
+
+// buildRequest defines a build with its dependencies resolved to modules
+type buildRequest struct {
+	platform      string
+	buildPlatform k6foundry.Platform
+	k6Constrains  string
+	deps          []k6build.Dependency
+	// build metadata of the k6 version, if built from a version of the form v0.0.0+<build>
+	buildMetadata string
+	k6Mod         catalog.Module
+	// modules resolved for the dependencies, in the same order
+	modules []catalog.Module
+	// versions pinned by module path, which take precedence over the resolved versions
+	replacements map[string]string
+	// alternative repository k6 is built from (e.g. a fork), if any
+	k6Repo string
+}
+
+// build returns the artifact for the resolved modules, either from the store or compiling it
+func (b *Builder) build( //nolint:funlen
+	ctx context.Context,
+	req buildRequest,
+) (artifact k6build.Artifact, buildErr error) {
+	platform, k6Constrains, deps, k6Mod := req.platform, req.k6Constrains, req.deps, req.k6Mod
+	buildMetadata := req.buildMetadata
 
 	mods := []k6foundry.Module{}
 	cgoEnabled := false
-	for _, d := range deps {
-		m, modErr := b.catalog.Resolve(ctx, catalog.Dependency{Name: d.Name, Constrains: d.Constraints})
-		if modErr != nil {
-			return k6build.Artifact{}, k6build.NewWrappedError(ErrInvalidParameters, modErr)
-		}
+	for _, m := range req.modules {
 		mods = append(mods, k6foundry.Module{Path: m.Path, Version: m.Version})
-		resolved[d.Name] = m.Version
 		cgoEnabled = cgoEnabled || m.Cgo
 	}
 
-	// generate id form sorted list of dependencies
-	hashData := bytes.Buffer{}
-	hashData.WriteString(platform)
-	hashData.WriteString(fmt.Sprintf(":k6%s", k6Mod.Version))
-	for _, d := range deps {
-		hashData.WriteString(fmt.Sprintf(":%s%s", d, resolved[d.Name]))
+	id, resolved := b.artifactID(req)
+
+	// the dependencies resolve to the artifact the client already has
+	buildOpts := k6build.BuildOptsFromContext(ctx)
+	if buildOpts.CurrentArtifact != "" && buildOpts.CurrentArtifact == id {
+		return k6build.Artifact{}, k6build.ErrArtifactUnchanged
 	}
-	id := fmt.Sprintf("%x", sha1.Sum(hashData.Bytes())) //nolint:gosec
 
-	unlock := b.lockArtifact(id)
+	unlock, waited, err := b.lockArtifact(ctx, id)
+	if err != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(ErrAccessingArtifact, err)
+	}
 	defer unlock()
 
-	artifactObject, err := b.store.Get(ctx, id)
-	if err == nil {
+	key := b.storeKey(id, platform, k6Mod.Version)
+	// the content of a local repository may have changed since the artifact was stored
+	noCache := b.opts.NoCache || buildOpts.NoCache || isLocalRepo(req.k6Repo)
+	storeArtifact := !buildOpts.NoStore
+
+	artifactObject, err := b.store.Get(ctx, key)
+	if err != nil && !errors.Is(err, store.ErrObjectNotFound) {
+		b.metrics.buildsFailedCounter.WithLabelValues(failureStore).Inc()
+		return k6build.Artifact{}, k6build.NewWrappedError(ErrAccessingArtifact, err)
+	}
+	found := err == nil
+	stale := found && !noCache && b.isStale(artifactObject, k6Constrains, deps)
+
+	if found && !noCache && !stale {
 		b.metrics.storeHitsCounter.Inc()
+		if artifactObject.Fallback {
+			b.metrics.degradedCounter.WithLabelValues(degradedFallbackStore).Inc()
+		}
+		// the artifact was built by the request holding the lock
+		if waited {
+			b.metrics.coalescedCounter.Inc()
+		}
 
 		return k6build.Artifact{
 			ID:           id,
@@ -207,55 +612,207 @@ func (b *Builder) Build( //nolint:funlen
 		}, nil
 	}
 
-	if !errors.Is(err, store.ErrObjectNotFound) {
-		return k6build.Artifact{}, k6build.NewWrappedError(ErrAccessingArtifact, err)
-	}
+	// the stale artifact is served until it is replaced, so a failed rebuild doesn't fail the request
+	if stale {
+		staleObject := artifactObject
+		defer func() {
+			if buildErr == nil || !stale {
+				return
+			}
 
-	// set CGO_ENABLED if any of the dependencies require it
-	env := b.opts.Env
-	if cgoEnabled {
-		if env == nil {
-			env = map[string]string{}
-		}
-		env["CGO_ENABLED"] = "1"
+			b.log.Warn("rebuilding stale artifact", "id", id, "error", buildErr.Error())
+			b.metrics.degradedCounter.WithLabelValues(degradedStaleArtifact).Inc()
+			artifact, buildErr = k6build.Artifact{
+				ID:           id,
+				Checksum:     staleObject.Checksum,
+				URL:          staleObject.URL,
+				Dependencies: resolved,
+				Platform:     platform,
+			}, nil
+		}()
 	}
 
 	builderOpts := k6foundry.NativeBuilderOpts{
 		GoOpts: k6foundry.GoOpts{
-			Env:       env,
+			Env:       b.buildEnv(cgoEnabled),
 			CopyGoEnv: b.opts.CopyGoEnv,
 		},
+		K6Repo: req.k6Repo,
 	}
 	if b.opts.Verbose {
-		builderOpts.Stdout = os.Stdout
-		builderOpts.Stderr = os.Stderr
+		builderOpts.Stdout = b.redactor.writer(os.Stdout)
+		builderOpts.Stderr = b.redactor.writer(os.Stderr)
+	}
+	if buildOpts.Output != nil {
+		output := b.redactor.writer(&outputWriter{out: buildOpts.Output})
+		builderOpts.Stdout = teeOutput(builderOpts.Stdout, output)
+		builderOpts.Stderr = teeOutput(builderOpts.Stderr, output)
+	}
+	// the output is needed for classifying the errors (e.g. transient errors)
+	captured := &capturedOutput{}
+	builderOpts.Stdout = teeOutput(builderOpts.Stdout, captured)
+	builderOpts.Stderr = teeOutput(builderOpts.Stderr, captured)
+
+	// wait for a build slot, to prevent oversubscribing the CPUs
+	releaseSlot, err := b.acquireBuildSlot(ctx)
+	if err != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(ErrBuildingArtifact, err)
+	}
+	defer releaseSlot()
+
+	// the artifact's lock may be local to this builder. Another builder sharing the store may have
+	// stored the artifact while waiting for the build slot
+	if !noCache {
+		stored, getErr := b.store.Get(ctx, key)
+		if getErr == nil && !b.isStale(stored, k6Constrains, deps) {
+			b.metrics.storeHitsCounter.Inc()
+			if stored.Fallback {
+				b.metrics.degradedCounter.WithLabelValues(degradedFallbackStore).Inc()
+			}
+
+			return k6build.Artifact{
+				ID:           id,
+				Checksum:     stored.Checksum,
+				URL:          stored.URL,
+				Dependencies: resolved,
+				Platform:     platform,
+			}, nil
+		}
+	}
+
+	// fail before building if the build would run out of space
+	if err = b.checkFreeSpace(); err != nil {
+		b.metrics.buildsFailedCounter.WithLabelValues(failureSpace).Inc()
+		b.log.Error("insufficient space for building", "id", id, "error", err.Error())
+		return k6build.Artifact{}, k6build.NewWrappedError(ErrBuildingArtifact, err)
 	}
 
 	builder, err := b.foundry.NewBuilder(ctx, builderOpts)
 	if err != nil {
-		return k6build.Artifact{}, k6build.NewWrappedError(ErrInitializingBuilder, err)
+		b.metrics.buildsFailedCounter.WithLabelValues(failureInfra).Inc()
+		return k6build.Artifact{}, k6build.NewWrappedError(ErrInitializingBuilder, b.redactor.redactError(err))
 	}
 	b.metrics.buildCounter.Inc()
-	buildTimer := prometheus.NewTimer(b.metrics.buildTimeHistogram)
+
+	// the go.mod is generated by the foundry, log the requirements used for generating it
+	b.log.Debug(
+		"building artifact",
+		"id", id,
+		"platform", platform,
+		"cgo", cgoEnabled,
+		"k6repo", req.k6Repo,
+		"require", requirements(k6Mod, mods),
+	)
+
+	buildStart := time.Now()
+
+	buildCtx := ctx
+	timeout := b.buildTimeout(req)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		buildCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	artifactBuffer := &bytes.Buffer{}
-	buildInfo, err := builder.Build(ctx, buildPlatform, k6Mod.Version, mods, []string{}, artifactBuffer)
+	buildInfo, err := b.compile(buildCtx, builder, req.buildPlatform, k6Mod.Version, mods, artifactBuffer, captured)
 	if err != nil {
-		b.metrics.buildsFailedCounter.Inc()
-		return k6build.Artifact{}, k6build.NewWrappedError(ErrAccessingArtifact, err)
+		// the modules can't be downloaded until the credentials are fixed, so it is neither
+		// retried with other versions
+		if msg := proxyAuthError(err, captured.String()); msg != "" {
+			b.metrics.buildsFailedCounter.WithLabelValues(failureInfra).Inc()
+			b.metrics.proxyAuthCounter.Inc()
+			authErr := fmt.Errorf("%w: %s", ErrProxyAuth, b.redactor.redact(msg))
+			b.log.Error("building artifact", "id", id, "error", authErr.Error())
+			return k6build.Artifact{}, k6build.NewWrappedError(ErrBuildingArtifact, authErr)
+		}
+
+		b.metrics.buildsFailedCounter.WithLabelValues(failureCompile).Inc()
+
+		// timing out is not a failure of the modules, so it is not retried with other versions
+		if ctx.Err() == nil && errors.Is(buildCtx.Err(), context.DeadlineExceeded) {
+			return k6build.Artifact{}, k6build.NewWrappedError(
+				ErrBuildingArtifact,
+				fmt.Errorf("build timed out after %s: %w", timeout, context.DeadlineExceeded),
+			)
+		}
+
+		// neither are transient errors
+		if errors.Is(err, errTransientBuild) {
+			return k6build.Artifact{}, k6build.NewWrappedError(ErrBuildingArtifact, b.redactor.redactError(err))
+		}
+
+		return k6build.Artifact{}, k6build.NewWrappedError(
+			ErrAccessingArtifact,
+			compileError{b.redactor.redactError(err)},
+		)
 	}
 
-	buildTimer.ObserveDuration()
+	buildDuration := time.Since(buildStart)
+	b.buildDurations.add(buildDuration)
+	b.log.Debug("built artifact", "id", id, "modules", fmt.Sprintf("%v", buildInfo.ModVersions))
+	observeWithExemplar(ctx, b.metrics.buildTimeHistogram, buildDuration.Seconds())
+
+	if b.opts.SlowBuildThreshold > 0 && buildDuration > b.opts.SlowBuildThreshold {
+		b.metrics.slowBuildsCounter.Inc()
+		b.log.Warn(
+			"slow build",
+			"id", id,
+			"duration", buildDuration.String(),
+			"platform", platform,
+			"k6", k6Constrains,
+			"dependencies", fmt.Sprintf("%v", deps),
+			"resolved", fmt.Sprintf("%v", resolved),
+		)
+	}
 
 	// if the version has a build metadata, we must use the actual version built
 	// TODO: check this version is supported
-	if buildMetadata != "" {
+	if buildMetadata != "" && req.k6Repo == "" {
 		resolved[k6Dep] = buildInfo.ModVersions[k6Mod.Path]
 	}
 
-	artifactObject, err = b.store.Put(ctx, id, artifactBuffer)
+	goVersion, moduleSums := binaryBuildInfo(artifactBuffer.Bytes())
+
+	// the artifact rebuilt ignoring the store or because it was stale replaces the stored one, if it
+	// can be evicted. It is evicted only once rebuilt, so a failed build doesn't lose the stored artifact.
+	if found && (noCache || stale) && storeArtifact {
+		switch {
+		case b.evict(ctx, key):
+			stale = false
+		case stale:
+			// the stale artifact cannot be replaced, so it is still served
+			return k6build.Artifact{}, k6build.NewWrappedError(ErrAccessingArtifact, store.ErrDeletingObject)
+		default:
+			storeArtifact = false
+			b.metrics.degradedCounter.WithLabelValues(degradedStoreWrite).Inc()
+		}
+	}
+
+	if !storeArtifact {
+		hash, _ := store.NewHash(store.ChecksumSHA256)
+		_, _ = hash.Write(artifactBuffer.Bytes())
+
+		return k6build.Artifact{
+			ID:           id,
+			Checksum:     store.FormatChecksum(store.ChecksumSHA256, hash.Sum(nil)),
+			Dependencies: resolved,
+			Platform:     platform,
+			GoVersion:    goVersion,
+			ModuleSums:   moduleSums,
+		}, nil
+	}
+
+	artifactObject, err = b.store.Put(ctx, key, artifactBuffer)
 	if err != nil {
-		return k6build.Artifact{}, k6build.NewWrappedError(ErrAccessingArtifact, err)
+		// another builder sharing the store may have stored the artifact while it was being built
+		stored, getErr := b.store.Get(ctx, key)
+		if getErr != nil {
+			b.metrics.buildsFailedCounter.WithLabelValues(failureStore).Inc()
+			return k6build.Artifact{}, k6build.NewWrappedError(ErrAccessingArtifact, err)
+		}
+		b.metrics.degradedCounter.WithLabelValues(degradedStoreWrite).Inc()
+		artifactObject = stored
 	}
 
 	return k6build.Artifact{
@@ -264,23 +821,228 @@ func (b *Builder) Build( //nolint:funlen
 		URL:          artifactObject.URL,
 		Dependencies: resolved,
 		Platform:     platform,
+		GoVersion:    goVersion,
+		ModuleSums:   moduleSums,
 	}, nil
 }
 
-// lockArtifact obtains a mutex used to prevent concurrent builds of the same artifact and
-// returns a function that will unlock the mutex associated to the given id in the object store.
-// The lock is also removed from the map. Subsequent calls will get another lock on the same
-// id but this is safe as the object should already be in the object store and no further
-// builds are needed.
-func (b *Builder) lockArtifact(id string) func() {
-	value, _ := b.mutexes.LoadOrStore(id, &sync.Mutex{})
-	mtx, _ := value.(*sync.Mutex)
-	mtx.Lock()
+// artifactID returns the id of the artifact for the resolved modules and the version of each dependency.
+// The id is generated from the sorted list of dependencies, so it is deterministic.
+func (b *Builder) artifactID(req buildRequest) (string, map[string]string) {
+	resolved := map[string]string{}
+	resolved[k6Dep] = req.k6Mod.Version
+	for i, m := range req.modules {
+		resolved[req.deps[i].Name] = m.Version
+	}
+
+	hashData := bytes.Buffer{}
+	hashData.WriteString(req.platform)
+	hashData.WriteString(fmt.Sprintf(":k6%s", req.k6Mod.Version))
+	// artifacts built from a k6 fork must not collide with the ones built from k6. The fork is
+	// reported as the k6 dependency, as its version is the one built
+	if req.k6Repo != "" {
+		hashData.WriteString(fmt.Sprintf(":k6repo%s", req.k6Repo))
+		resolved[k6Dep] = req.k6Repo
+	}
+	// the channel is not included as the resolved version already identifies the artifact
+	for _, d := range req.deps {
+		hashData.WriteString(fmt.Sprintf(":{%s %s}%s", d.Name, d.Constraints, resolved[d.Name]))
+	}
+
+	return fmt.Sprintf("%x", sha1.Sum(hashData.Bytes())), resolved //nolint:gosec
+}
+
+// binaryBuildInfo returns the version of the go toolchain that compiled the binary and the
+// hashes of the modules compiled into it (see k6build.Artifact.ModuleSums) from its build info.
+// Returns empty values if the binary has no build info.
+func binaryBuildInfo(binary []byte) (string, map[string]string) {
+	info, err := buildinfo.Read(bytes.NewReader(binary))
+	if err != nil {
+		return "", nil
+	}
+
+	var sums map[string]string
+	for _, dep := range info.Deps {
+		// the hash is of the module actually compiled
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		if dep.Sum == "" {
+			continue
+		}
+		if sums == nil {
+			sums = map[string]string{}
+		}
+		sums[dep.Path+"@"+dep.Version] = dep.Sum
+	}
+
+	return info.GoVersion, sums
+}
+
+// storeKey returns the key of the artifact in the store. If the KeyPrefix option is set, the id
+// is prefixed with the platform and the k6 version (e.g. k6-linux-amd64-v0.50.0/<id>)
+func (b *Builder) storeKey(id string, platform string, k6Version string) string {
+	if !b.opts.KeyPrefix {
+		return id
+	}
+
+	return fmt.Sprintf("k6-%s-%s/%s", strings.ReplaceAll(platform, "/", "-"), k6Version, id)
+}
+
+// requirements returns the module requirements for building the artifact, in go.mod's
+// require directive format (e.g. "go.k6.io/k6 v0.50.0; github.com/grafana/xk6-kubernetes v0.9.0")
+func requirements(k6Mod catalog.Module, mods []k6foundry.Module) string {
+	require := []string{fmt.Sprintf("%s %s", k6Path, k6Mod.Version)}
+	for _, m := range mods {
+		require = append(require, fmt.Sprintf("%s %s", m.Path, m.Version))
+	}
+
+	return strings.Join(require, "; ")
+}
+
+// lockArtifact obtains a lock used to prevent concurrent builds of the same artifact and
+// returns a function that will release the lock associated to the given id in the object store.
+// Also returns if the lock was held by another request, which may have built the artifact.
+// If the context is cancelled while waiting for the lock, the context's error is returned.
+func (b *Builder) lockArtifact(ctx context.Context, id string) (func(), bool, error) {
+	unlock, locked, err := b.lock.Try(ctx, id)
+	if err != nil || locked {
+		return unlock, false, err
+	}
+
+	unlock, err = b.lock.Lock(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return unlock, true, nil
+}
+
+// isStale returns true if the artifact is older than the maximum artifact age and any of the
+// constraints is floating (e.g. '*' or '>v0.1.0'). Artifacts are never stale if the store
+// cannot replace them.
+func (b *Builder) isStale(object store.Object, k6Constrains string, deps []k6build.Dependency) bool {
+	if b.opts.MaxArtifactAge == 0 || object.CreatedAt.IsZero() {
+		return false
+	}
+
+	if _, ok := b.store.(store.ObjectDeleter); !ok {
+		return false
+	}
+
+	if time.Since(object.CreatedAt) < b.opts.MaxArtifactAge {
+		return false
+	}
+
+	return isFloating(k6Constrains, deps)
+}
+
+// buildEnv returns the environment of a build: the Env option with the go caches, if
+// specified, and CGO_ENABLED set if any of the dependencies require it
+func (b *Builder) buildEnv(cgoEnabled bool) map[string]string {
+	env := maps.Clone(b.opts.Env)
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	if b.opts.GoCache != "" {
+		env["GOCACHE"] = b.opts.GoCache
+	}
+	if b.opts.GoModCache != "" {
+		env["GOMODCACHE"] = b.opts.GoModCache
+	}
+	if cgoEnabled {
+		env["CGO_ENABLED"] = "1"
+	}
+
+	return env
+}
+
+// buildTimeout returns the timeout for compiling the artifact: the longest of the extension
+// build timeouts matching the dependencies or modules of the build, or the build timeout if none matches
+func (b *Builder) buildTimeout(req buildRequest) time.Duration {
+	timeout := time.Duration(0)
+	for i, d := range req.deps {
+		for extension, extTimeout := range b.opts.ExtensionBuildTimeouts {
+			if d.Name == extension || strings.HasPrefix(req.modules[i].Path, extension) {
+				timeout = max(timeout, extTimeout)
+			}
+		}
+	}
+
+	if timeout == 0 {
+		return b.opts.BuildTimeout
+	}
+
+	return timeout
+}
+
+// isFloating returns true if any of the constraints is floating (e.g. '*' or '>v0.1.0')
+func isFloating(k6Constrains string, deps []k6build.Dependency) bool {
+	if !catalog.IsPinned(k6Constrains) {
+		return true
+	}
+
+	for _, d := range deps {
+		if !catalog.IsPinned(d.Constraints) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evict removes an artifact from the store. Returns false if the artifact could not be removed.
+func (b *Builder) evict(ctx context.Context, id string) bool {
+	deleter, ok := b.store.(store.ObjectDeleter)
+	if !ok {
+		return false
+	}
+
+	return deleter.Delete(ctx, id) == nil
+}
+
+// k6Repo returns the repository k6 is built from: the one of the build request, if allowed,
+// or the K6Repo option. Empty if k6 is built from go.k6.io/k6.
+func (b *Builder) k6Repo(ctx context.Context) (string, error) {
+	repo := k6build.BuildOptsFromContext(ctx).K6Repo
+	if repo == "" {
+		return b.opts.K6Repo, nil
+	}
+
+	if !b.opts.AllowK6Fork {
+		return "", ErrK6ForkNotAllowed
+	}
+
+	if isLocalRepo(repo) {
+		return "", fmt.Errorf("%w: k6 repository %q must have the form module@version", ErrK6ForkNotAllowed, repo)
+	}
+
+	if err := validateK6Repo(repo); err != nil {
+		return "", err
+	}
+
+	return repo, nil
+}
+
+// isLocalRepo returns true if the k6 repository is a local directory
+func isLocalRepo(repo string) bool {
+	return strings.HasPrefix(repo, ".") || filepath.IsAbs(repo)
+}
 
-	return func() {
-		b.mutexes.Delete(id)
-		mtx.Unlock()
+// validateK6Repo checks the alternative k6 repository is either a local directory
+// or a module path with a version
+func validateK6Repo(repo string) error {
+	if repo == "" || isLocalRepo(repo) {
+		return nil
 	}
+
+	path, version, found := strings.Cut(repo, "@")
+	if !found || path == "" || version == "" {
+		return fmt.Errorf("k6 repository %q must be a local directory or have the form module@version", repo)
+	}
+
+	return nil
 }
 
 // hasBuildMetadata checks if the constrain references a version with a build metadata.
@@ -314,3 +1076,44 @@ func hasBuildMetadata(constrain string) (string, error) {
 	}
 	return build, nil
 }
+
+// checkK6Version returns an error if the k6 version resolved is lower than the minimum version
+func (b *Builder) checkK6Version(version string) error {
+	if b.minK6Version == nil {
+		return nil
+	}
+
+	resolved, err := semver.NewVersion(version)
+	if err != nil {
+		return err
+	}
+
+	if resolved.LessThan(b.minK6Version) {
+		return fmt.Errorf(
+			"%w: %s is lower than the minimum version %s",
+			ErrK6VersionNotSupported,
+			version,
+			b.minK6Version.Original(),
+		)
+	}
+
+	return nil
+}
+
+// checkExtensions checks the dependencies are allowed by the AllowedExtensions and DeniedExtensions
+// options, reporting all the ones that are not
+func (b *Builder) checkExtensions(deps []k6build.Dependency) error {
+	notAllowed := []string{}
+	for _, d := range deps {
+		allowed := len(b.opts.AllowedExtensions) == 0 || slices.Contains(b.opts.AllowedExtensions, d.Name)
+		if !allowed || slices.Contains(b.opts.DeniedExtensions, d.Name) {
+			notAllowed = append(notAllowed, d.Name)
+		}
+	}
+
+	if len(notAllowed) > 0 {
+		return fmt.Errorf("%w: %s", ErrExtensionNotAllowed, strings.Join(notAllowed, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package builder
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cgroup files with the CPU quota of the process' container (cgroup v2 and v1)
+const (
+	cgroupV2CPUMax       = "/sys/fs/cgroup/cpu.max"
+	cgroupV1CPUQuota     = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupV1CPUPeriod    = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+	cgroupUnlimitedQuota = "max"
+)
+
+// availableCPUs returns the number of CPUs available for builds: runtime.GOMAXPROCS(0),
+// limited by the CPU quota of the container, if any.
+func availableCPUs() int {
+	cpus := runtime.GOMAXPROCS(0)
+
+	if quota, ok := cgroupCPUQuota(); ok && quota < cpus {
+		cpus = quota
+	}
+
+	return cpus
+}
+
+// cgroupCPUQuota returns the CPU quota of the cgroup, rounded up to a whole CPU.
+// Returns false if there is no quota or it cannot be read.
+func cgroupCPUQuota() (int, bool) {
+	// cgroup v2: "<quota> <period>" or "max <period>"
+	if content, err := os.ReadFile(cgroupV2CPUMax); err == nil {
+		fields := strings.Fields(string(content))
+		if len(fields) != 2 || fields[0] == cgroupUnlimitedQuota {
+			return 0, false
+		}
+		return cpuQuota(fields[0], fields[1])
+	}
+
+	// cgroup v1: quota is -1 if unlimited
+	quota, err := os.ReadFile(cgroupV1CPUQuota)
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile(cgroupV1CPUPeriod)
+	if err != nil {
+		return 0, false
+	}
+
+	return cpuQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// cpuQuota returns the number of CPUs for a quota and period, rounded up
+func cpuQuota(quota string, period string) (int, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+
+	return int(math.Ceil(q / p)), true
+}
@@ -0,0 +1,47 @@
+package builder
+
+import (
+	"testing"
+)
+
+func TestCPUQuota(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		quota  string
+		period string
+		expect int
+		ok     bool
+	}{
+		{title: "whole cpus", quota: "200000", period: "100000", expect: 2, ok: true},
+		{title: "fraction of cpu", quota: "50000", period: "100000", expect: 1, ok: true},
+		{title: "rounded up", quota: "150000", period: "100000", expect: 2, ok: true},
+		{title: "unlimited (cgroup v1)", quota: "-1", period: "100000", ok: false},
+		{title: "invalid quota", quota: "max", period: "100000", ok: false},
+		{title: "invalid period", quota: "100000", period: "0", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			cpus, ok := cpuQuota(tc.quota, tc.period)
+			if ok != tc.ok {
+				t.Fatalf("expected ok %t got %t", tc.ok, ok)
+			}
+
+			if ok && cpus != tc.expect {
+				t.Fatalf("expected %d got %d", tc.expect, cpus)
+			}
+		})
+	}
+}
+
+func TestAvailableCPUs(t *testing.T) {
+	t.Parallel()
+
+	if cpus := availableCPUs(); cpus < 1 {
+		t.Fatalf("expected at least one cpu got %d", cpus)
+	}
+}
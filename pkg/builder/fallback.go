@@ -0,0 +1,118 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/catalog"
+)
+
+// DefaultMaxFallbacks is the default maximum number of builds attempted with lower versions
+// of the dependencies when a build fails compiling
+const DefaultMaxFallbacks = 3
+
+// compileError signals the binary could not be compiled from the resolved modules
+type compileError struct {
+	error
+}
+
+func (e compileError) Unwrap() error {
+	return e.error
+}
+
+// isCompileError returns true if the build failed compiling the binary
+func isCompileError(err error) bool {
+	return errors.As(err, &compileError{})
+}
+
+// fallbackEnabled returns true if the build falls back to lower versions of the dependencies
+// when compiling fails, either for all the builds or for this build
+func (b *Builder) fallbackEnabled(ctx context.Context) bool {
+	return b.opts.Fallback || k6build.BuildOptsFromContext(ctx).Fallback
+}
+
+// buildFallback retries a build that failed compiling using lower versions of the dependencies
+// (k6 is never lowered) that satisfy their constraints, taken from the catalog.
+// Each attempt lowers the version of only one dependency, keeping the resolved version of the
+// others: first the next-lower version of each dependency, then the following one, and so on,
+// up to the maximum number of fallbacks.
+// The artifact returns the dependencies lowered with the version that failed (see Artifact.Fallbacks).
+// If no attempt succeeds, the original error is returned.
+func (b *Builder) buildFallback(ctx context.Context, req buildRequest, buildErr error) (k6build.Artifact, error) {
+	// the versions are listed from the catalog, not available if a custom resolver is used
+	if b.resolver != nil {
+		return k6build.Artifact{}, buildErr
+	}
+	lister, ok := (*b.catalog.Load()).(catalog.VersionLister)
+	if !ok {
+		return k6build.Artifact{}, buildErr
+	}
+
+	// versions lower than the resolved one that satisfy the dependency's constraints, newest first
+	lower := make([][]string, len(req.deps))
+	for i, d := range req.deps {
+		// pinned modules are not replaced by lower versions
+		if _, pinned := req.replacements[req.modules[i].Path]; pinned {
+			continue
+		}
+		versions, err := lister.Versions(
+			ctx,
+			catalog.Dependency{Name: d.Name, Constrains: d.Constraints, Channel: d.Channel},
+		)
+		if err != nil {
+			b.log.Debug("listing versions for fallback", "dependency", d.Name, "error", err.Error())
+			continue
+		}
+		if idx := slices.Index(versions, req.modules[i].Version); idx >= 0 {
+			lower[i] = versions[idx+1:]
+		}
+	}
+
+	maxFallbacks := b.opts.MaxFallbacks
+	if maxFallbacks <= 0 {
+		maxFallbacks = DefaultMaxFallbacks
+	}
+
+	attempts := 0
+	for step := 0; attempts < maxFallbacks; step++ {
+		attempted := false
+		for i, d := range req.deps {
+			if step >= len(lower[i]) || attempts >= maxFallbacks {
+				continue
+			}
+			attempted = true
+			attempts++
+
+			attempt := req
+			attempt.modules = slices.Clone(req.modules)
+			attempt.modules[i].Version = lower[i][step]
+
+			b.log.Info(
+				"build failed, falling back to a lower version",
+				"dependency", d.Name,
+				"failed", req.modules[i].Version,
+				"fallback", attempt.modules[i].Version,
+			)
+			b.metrics.fallbackBuildsCounter.Inc()
+
+			artifact, err := b.build(ctx, attempt)
+			if err == nil {
+				artifact.Fallbacks = map[string]string{d.Name: req.modules[i].Version}
+				b.metrics.degradedCounter.WithLabelValues(degradedVersionFallback).Inc()
+				return artifact, nil
+			}
+
+			if !isCompileError(err) {
+				return k6build.Artifact{}, err
+			}
+		}
+
+		if !attempted {
+			break
+		}
+	}
+
+	return k6build.Artifact{}, buildErr
+}
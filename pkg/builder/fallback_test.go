@@ -0,0 +1,183 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6foundry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const fallbackCatalogJSON = `
+{
+"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0"]},
+"k6/x/ext": {"module": "go.k6.io/k6ext", "versions": ["v0.1.0", "v0.2.0", "v0.3.0"]},
+"k6/x/ext2": {"module": "go.k6.io/k6ext2", "versions": ["v0.1.0", "v0.2.0"]}
+}
+`
+
+// brokenBuilder fails compiling if any of the modules has a broken version (module@version)
+type brokenBuilder struct {
+	mockBuilder
+	broken []string
+}
+
+func (b *brokenBuilder) Build(
+	ctx context.Context,
+	platform k6foundry.Platform,
+	k6Version string,
+	mods []k6foundry.Module,
+	buildOpts []string,
+	out io.Writer,
+) (*k6foundry.BuildInfo, error) {
+	for _, m := range mods {
+		for _, broken := range b.broken {
+			if broken == fmt.Sprintf("%s@%s", m.Path, m.Version) {
+				return nil, fmt.Errorf("compiling %s", broken)
+			}
+		}
+	}
+
+	return b.mockBuilder.Build(ctx, platform, k6Version, mods, buildOpts, out)
+}
+
+func TestFallback(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title          string
+		opts           Opts
+		buildOpts      k6build.BuildOpts
+		deps           []k6build.Dependency
+		broken         []string
+		expectErr      bool
+		expectDeps     map[string]string
+		expectFallback map[string]string
+	}{
+		{
+			title:     "fallback disabled",
+			deps:      []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			broken:    []string{"go.k6.io/k6ext@v0.3.0"},
+			expectErr: true,
+		},
+		{
+			title:          "fallback to previous version",
+			opts:           Opts{Fallback: true},
+			deps:           []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			broken:         []string{"go.k6.io/k6ext@v0.3.0"},
+			expectDeps:     map[string]string{"k6": "v0.1.0", "k6/x/ext": "v0.2.0"},
+			expectFallback: map[string]string{"k6/x/ext": "v0.3.0"},
+		},
+		{
+			title:          "fallback enabled for the build",
+			buildOpts:      k6build.BuildOpts{Fallback: true},
+			deps:           []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			broken:         []string{"go.k6.io/k6ext@v0.3.0"},
+			expectDeps:     map[string]string{"k6": "v0.1.0", "k6/x/ext": "v0.2.0"},
+			expectFallback: map[string]string{"k6/x/ext": "v0.3.0"},
+		},
+		{
+			title:          "skip multiple broken versions",
+			opts:           Opts{Fallback: true},
+			deps:           []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			broken:         []string{"go.k6.io/k6ext@v0.3.0", "go.k6.io/k6ext@v0.2.0"},
+			expectDeps:     map[string]string{"k6": "v0.1.0", "k6/x/ext": "v0.1.0"},
+			expectFallback: map[string]string{"k6/x/ext": "v0.3.0"},
+		},
+		{
+			title:     "max fallbacks exceeded",
+			opts:      Opts{Fallback: true, MaxFallbacks: 1},
+			deps:      []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			broken:    []string{"go.k6.io/k6ext@v0.3.0", "go.k6.io/k6ext@v0.2.0"},
+			expectErr: true,
+		},
+		{
+			title:     "lower versions must satisfy the constraints",
+			opts:      Opts{Fallback: true},
+			deps:      []k6build.Dependency{{Name: "k6/x/ext", Constraints: ">v0.1.0"}},
+			broken:    []string{"go.k6.io/k6ext@v0.3.0", "go.k6.io/k6ext@v0.2.0"},
+			expectErr: true,
+		},
+		{
+			title:     "pinned version",
+			opts:      Opts{Fallback: true},
+			deps:      []k6build.Dependency{{Name: "k6/x/ext", Constraints: "v0.3.0"}},
+			broken:    []string{"go.k6.io/k6ext@v0.3.0"},
+			expectErr: true,
+		},
+		{
+			title: "lower only the failing dependency",
+			opts:  Opts{Fallback: true},
+			deps: []k6build.Dependency{
+				{Name: "k6/x/ext", Constraints: "*"},
+				{Name: "k6/x/ext2", Constraints: "*"},
+			},
+			broken:         []string{"go.k6.io/k6ext2@v0.2.0"},
+			expectDeps:     map[string]string{"k6": "v0.1.0", "k6/x/ext": "v0.3.0", "k6/x/ext2": "v0.1.0"},
+			expectFallback: map[string]string{"k6/x/ext2": "v0.2.0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			catalog, err := catalog.NewCatalogFromJSON(strings.NewReader(fallbackCatalogJSON))
+			if err != nil {
+				t.Fatalf("setting up test builder %v", err)
+			}
+
+			store, err := file.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("creating temporary object store %v", err)
+			}
+
+			foundry := func(_ context.Context, opts k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+				return &brokenBuilder{mockBuilder: mockBuilder{opts: opts}, broken: tc.broken}, nil
+			}
+
+			builder, err := New(context.Background(), Config{
+				Opts:    tc.opts,
+				Catalog: catalog,
+				Store:   store,
+				Foundry: FoundryFunction(foundry),
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+
+			ctx := k6build.WithBuildOpts(context.Background(), tc.buildOpts)
+			artifact, err := builder.Build(ctx, "linux/amd64", "v0.1.0", tc.deps)
+			if tc.expectErr {
+				if !isCompileError(err) {
+					t.Fatalf("expected compile error got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if diff := cmp.Diff(tc.expectDeps, artifact.Dependencies); diff != "" {
+				t.Fatalf("dependencies mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.expectFallback, artifact.Fallbacks); diff != "" {
+				t.Fatalf("fallbacks mismatch (-want +got):\n%s", diff)
+			}
+
+			degraded := testutil.ToFloat64(builder.metrics.degradedCounter.WithLabelValues(degradedVersionFallback))
+			if expected := float64(len(tc.expectFallback)); degraded != expected {
+				t.Fatalf("expected %v degraded builds got %v", expected, degraded)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grafana/k6build"
+)
+
+// lastBuild is the last artifact successfully built for a request
+type lastBuild struct {
+	// key of the artifact in the store
+	key      string
+	artifact k6build.Artifact
+}
+
+// lastBuilds remembers the last artifact successfully built for each request with floating constraints
+type lastBuilds struct {
+	mtx       sync.Mutex
+	artifacts map[string]lastBuild
+}
+
+// requestKey identifies a build request by its platform and constraints, instead of the versions
+// they resolve to
+func requestKey(req buildRequest) string {
+	key := &strings.Builder{}
+	key.WriteString(fmt.Sprintf("%s:k6%s", req.platform, req.k6Constrains))
+	for _, d := range req.deps {
+		key.WriteString(fmt.Sprintf(":{%s %s %s}", d.Name, d.Constraints, d.Channel))
+	}
+	paths := make([]string, 0, len(req.replacements))
+	for path := range req.replacements {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		key.WriteString(fmt.Sprintf(":{%s => %s}", path, req.replacements[path]))
+	}
+	return key.String()
+}
+
+// add records the artifact built for the request. Artifacts that were not stored are ignored.
+func (l *lastBuilds) add(req buildRequest, key string, artifact k6build.Artifact) {
+	if artifact.URL == "" {
+		return
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.artifacts == nil {
+		l.artifacts = map[string]lastBuild{}
+	}
+	l.artifacts[requestKey(req)] = lastBuild{key: key, artifact: artifact}
+}
+
+// get returns the last artifact built for the request, if any
+func (l *lastBuilds) get(req buildRequest) (lastBuild, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	last, found := l.artifacts[requestKey(req)]
+	return last, found
+}
+
+// serveLastSuccessful returns the last artifact successfully built for a request whose
+// resolved versions failed compiling, if it is still in the store. Otherwise, returns the
+// build error.
+func (b *Builder) serveLastSuccessful(ctx context.Context, req buildRequest, buildErr error) (k6build.Artifact, error) {
+	last, found := b.lastBuilds.get(req)
+	if !found {
+		return k6build.Artifact{}, buildErr
+	}
+
+	// the artifact's URL may have expired (e.g. presigned URLs)
+	object, err := b.store.Get(ctx, last.key)
+	if err != nil {
+		b.log.Debug("getting last successful artifact", "id", last.artifact.ID, "error", err.Error())
+		return k6build.Artifact{}, buildErr
+	}
+
+	b.log.Warn(
+		"build failed, serving the last successful artifact",
+		"id", last.artifact.ID,
+		"dependencies", fmt.Sprintf("%v", last.artifact.Dependencies),
+		"error", buildErr.Error(),
+	)
+	b.metrics.degradedCounter.WithLabelValues(degradedLastSuccessful).Inc()
+
+	artifact := last.artifact
+	artifact.URL = object.URL
+	artifact.Checksum = object.Checksum
+
+	return artifact, nil
+}
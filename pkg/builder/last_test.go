@@ -0,0 +1,112 @@
+package builder
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6foundry"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServeLastSuccessful(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title      string
+		opts       Opts
+		deps       []k6build.Dependency
+		expectErr  bool
+		expectDeps map[string]string
+	}{
+		{
+			title:     "disabled",
+			deps:      []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			expectErr: true,
+		},
+		{
+			title:      "floating constraints",
+			opts:       Opts{ServeLastSuccessful: true},
+			deps:       []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}},
+			expectDeps: map[string]string{"k6": "v0.1.0", "k6/x/ext": "v0.1.0"},
+		},
+		{
+			title:     "different constraints",
+			opts:      Opts{ServeLastSuccessful: true},
+			deps:      []k6build.Dependency{{Name: "k6/x/ext", Constraints: ">v0.0.1"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			store, err := file.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("creating temporary object store %v", err)
+			}
+
+			foundry := func(_ context.Context, opts k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+				broken := []string{"go.k6.io/k6ext@v0.2.0"}
+				return &brokenBuilder{mockBuilder: mockBuilder{opts: opts}, broken: broken}, nil
+			}
+
+			initial, err := catalog.NewCatalogFromJSON(strings.NewReader(
+				`{"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0"]},` +
+					`"k6/x/ext": {"module": "go.k6.io/k6ext", "versions": ["v0.1.0"]}}`,
+			))
+			if err != nil {
+				t.Fatalf("setting up test builder %v", err)
+			}
+
+			builder, err := New(context.Background(), Config{
+				Opts:    tc.opts,
+				Catalog: initial,
+				Store:   store,
+				Foundry: FoundryFunction(foundry),
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+
+			deps := []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}}
+			if _, err = builder.Build(context.TODO(), "linux/amd64", "*", deps); err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			// a new version is released that fails compiling
+			released, err := catalog.NewCatalogFromJSON(strings.NewReader(
+				`{"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0"]},` +
+					`"k6/x/ext": {"module": "go.k6.io/k6ext", "versions": ["v0.1.0", "v0.2.0"]}}`,
+			))
+			if err != nil {
+				t.Fatalf("setting up test builder %v", err)
+			}
+			builder.SetCatalog(released)
+
+			artifact, err := builder.Build(context.TODO(), "linux/amd64", "*", tc.deps)
+			if tc.expectErr {
+				if !isCompileError(err) {
+					t.Fatalf("expected compile error got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if diff := cmp.Diff(tc.expectDeps, artifact.Dependencies); diff != "" {
+				t.Fatalf("dependencies mismatch (-want +got):\n%s", diff)
+			}
+
+			if artifact.URL == "" {
+				t.Fatalf("expected artifact url")
+			}
+		})
+	}
+}
@@ -1,19 +1,59 @@
 package builder
 
 import (
+	"context"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const metricsNamespace = "k6build"
 
+// reasons for a build failure, used as label in the builds_failed_total metric
+const (
+	// the dependencies could not be resolved (e.g. invalid constraints or unknown dependency)
+	failureResolve = "resolve"
+	// the binary could not be compiled
+	failureCompile = "compile"
+	// the object store could not be accessed
+	failureStore = "store"
+	// the build environment could not be set up
+	failureInfra = "infra"
+	// there was not enough free space for building
+	failureSpace = "insufficient_space"
+)
+
+// reasons for a build that didn't take the normal path, used as label in the
+// degraded_operations_total metric
+const (
+	// the artifact was served from the fallback store
+	degradedFallbackStore = "fallback_store"
+	// the artifact could not be written to the store
+	degradedStoreWrite = "store_write"
+	// the artifact was built with a lower version of a dependency
+	degradedVersionFallback = "version_fallback"
+	// the last artifact successfully built for the request was served
+	degradedLastSuccessful = "last_successful"
+	// the stale artifact was served because it could not be rebuilt
+	degradedStaleArtifact = "stale_artifact"
+)
+
 type metrics struct {
-	requestCounter       prometheus.Counter
-	requestTimeHistogram prometheus.Histogram
-	buildCounter         prometheus.Counter
-	storeHitsCounter     prometheus.Counter
-	buildsFailedCounter  prometheus.Counter
-	buildsInvalidCounter prometheus.Counter
-	buildTimeHistogram   prometheus.Histogram
+	requestCounter        prometheus.Counter
+	requestTimeHistogram  prometheus.Histogram
+	buildCounter          prometheus.Counter
+	storeHitsCounter      prometheus.Counter
+	buildsFailedCounter   *prometheus.CounterVec
+	buildsInvalidCounter  prometheus.Counter
+	buildTimeHistogram    prometheus.Histogram
+	slowBuildsCounter     prometheus.Counter
+	fallbackBuildsCounter prometheus.Counter
+	buildsRejectedCounter prometheus.Counter
+	degradedCounter       *prometheus.CounterVec
+	coalescedCounter      prometheus.Counter
+	buildRetriesCounter   prometheus.Counter
+	proxyAuthCounter      prometheus.Counter
+	invalidatedCounter    prometheus.Counter
 }
 
 func newMetrics() *metrics {
@@ -23,7 +63,7 @@ func newMetrics() *metrics {
 		Help:      "The total number of builds requests",
 	})
 
-	buildTimeHistogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+	requestTimeHistogram := prometheus.NewHistogram(prometheus.HistogramOpts{
 		Namespace: metricsNamespace,
 		Name:      "request_duration_seconds",
 		Help:      "The duration of the build request in seconds",
@@ -36,11 +76,16 @@ func newMetrics() *metrics {
 		Help:      "The total number of builds",
 	})
 
-	buildsFailedCounter := prometheus.NewCounter(prometheus.CounterOpts{
+	buildsFailedCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: metricsNamespace,
 		Name:      "builds_failed_total",
 		Help:      "The total number of failed builds",
-	})
+	}, []string{"reason"})
+
+	// initialize the counters for all reasons
+	for _, reason := range []string{failureResolve, failureCompile, failureStore, failureInfra, failureSpace} {
+		buildsFailedCounter.WithLabelValues(reason)
+	}
 
 	buildsInvalidCounter := prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: metricsNamespace,
@@ -54,21 +99,85 @@ func newMetrics() *metrics {
 		Help:      "The total number of object store hits",
 	})
 
-	requestDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+	buildTimeHistogram := prometheus.NewHistogram(prometheus.HistogramOpts{
 		Namespace: metricsNamespace,
 		Name:      "build_duration_seconds",
 		Help:      "The duration of the build in seconds",
 		Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300},
 	})
 
+	slowBuildsCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "slow_builds_total",
+		Help:      "The total number of builds that exceeded the slow build threshold",
+	})
+
+	fallbackBuildsCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "fallback_builds_total",
+		Help:      "The total number of builds attempted with lower versions after a build failed compiling",
+	})
+
+	buildsRejectedCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "builds_rejected_total",
+		Help:      "The total number of builds rejected because the build queue was full",
+	})
+
+	degradedCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "degraded_operations_total",
+		Help:      "The total number of builds that completed using a fallback or degraded path",
+	}, []string{"reason"})
+
+	coalescedCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "build_coalesced_total",
+		Help:      "The total number of requests served with the artifact built by a concurrent request",
+	})
+
+	buildRetriesCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "build_retries_total",
+		Help:      "The total number of builds retried after failing for a transient reason",
+	})
+
+	proxyAuthCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "proxy_auth_failures_total",
+		Help:      "The total number of builds that failed because the module proxy rejected the credentials",
+	})
+
+	invalidatedCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "builds_invalidated_total",
+		Help:      "The total number of artifacts invalidated, forcing them to be built again",
+	})
+
+	// initialize the counters for all reasons
+	for _, reason := range []string{
+		degradedFallbackStore, degradedStoreWrite, degradedVersionFallback, degradedLastSuccessful,
+		degradedStaleArtifact,
+	} {
+		degradedCounter.WithLabelValues(reason)
+	}
+
 	return &metrics{
-		requestCounter:       requestCounter,
-		requestTimeHistogram: requestDuration,
-		buildCounter:         buildCounter,
-		buildsFailedCounter:  buildsFailedCounter,
-		buildsInvalidCounter: buildsInvalidCounter,
-		storeHitsCounter:     storeHitsCounter,
-		buildTimeHistogram:   buildTimeHistogram,
+		requestCounter:        requestCounter,
+		requestTimeHistogram:  requestTimeHistogram,
+		buildCounter:          buildCounter,
+		buildsFailedCounter:   buildsFailedCounter,
+		buildsInvalidCounter:  buildsInvalidCounter,
+		storeHitsCounter:      storeHitsCounter,
+		buildTimeHistogram:    buildTimeHistogram,
+		slowBuildsCounter:     slowBuildsCounter,
+		fallbackBuildsCounter: fallbackBuildsCounter,
+		buildsRejectedCounter: buildsRejectedCounter,
+		degradedCounter:       degradedCounter,
+		coalescedCounter:      coalescedCounter,
+		buildRetriesCounter:   buildRetriesCounter,
+		proxyAuthCounter:      proxyAuthCounter,
+		invalidatedCounter:    invalidatedCounter,
 	}
 }
 
@@ -101,5 +210,50 @@ func (m *metrics) register(registerer prometheus.Registerer) error {
 		return err
 	}
 
+	if err := registerer.Register(m.slowBuildsCounter); err != nil {
+		return err
+	}
+
+	if err := registerer.Register(m.fallbackBuildsCounter); err != nil {
+		return err
+	}
+
+	if err := registerer.Register(m.buildsRejectedCounter); err != nil {
+		return err
+	}
+
+	if err := registerer.Register(m.degradedCounter); err != nil {
+		return err
+	}
+
+	if err := registerer.Register(m.coalescedCounter); err != nil {
+		return err
+	}
+
+	if err := registerer.Register(m.buildRetriesCounter); err != nil {
+		return err
+	}
+
+	if err := registerer.Register(m.proxyAuthCounter); err != nil {
+		return err
+	}
+
+	if err := registerer.Register(m.invalidatedCounter); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// observeWithExemplar observes a value in a histogram. If the context has a valid trace span,
+// its trace id is added as an exemplar, allowing to link the observation to the trace.
+func observeWithExemplar(ctx context.Context, histogram prometheus.Histogram, value float64) {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	observer, ok := histogram.(prometheus.ExemplarObserver)
+	if !ok || !spanCtx.IsValid() {
+		histogram.Observe(value)
+		return
+	}
+
+	observer.ObserveWithExemplar(value, prometheus.Labels{"trace_id": spanCtx.TraceID().String()})
+}
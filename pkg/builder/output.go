@@ -0,0 +1,33 @@
+package builder
+
+import (
+	"io"
+	"sync"
+)
+
+// outputWriter writes the output of a build to the writer given in the build options.
+// The output of the build process comes from both its stdout and stderr, so writes are
+// serialized. Errors are ignored, so a failing writer doesn't fail the build.
+type outputWriter struct {
+	mtx sync.Mutex
+	out io.Writer
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	_, _ = w.out.Write(p)
+
+	return len(p), nil
+}
+
+// teeOutput returns a writer that writes to both the output of the build process (if any)
+// and the build's output
+func teeOutput(w io.Writer, output io.Writer) io.Writer {
+	if w == nil {
+		return output
+	}
+
+	return io.MultiWriter(w, output)
+}
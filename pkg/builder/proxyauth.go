@@ -0,0 +1,27 @@
+package builder
+
+import (
+	"regexp"
+
+	"github.com/grafana/k6build"
+)
+
+// ErrProxyAuth signals the module proxy (GOPROXY) rejected the credentials of the build service.
+// It is the same error as k6build.ErrProxyAuth, so it can be identified by the clients of
+// the build service.
+var ErrProxyAuth = k6build.ErrProxyAuth //nolint:revive
+
+// proxyAuthRe matches the errors reported by the go command when the module proxy rejects
+// the request for a module because the credentials are missing, invalid or expired.
+// e.g. "reading https://goproxy.example.com/k6ext/@v/list: 401 Unauthorized"
+var proxyAuthRe = regexp.MustCompile(`reading https?://\S+: (401 Unauthorized|403 Forbidden)`)
+
+// proxyAuthError returns the message reporting the module proxy rejected the credentials,
+// given the error and output of a build. Returns an empty string if there is none.
+func proxyAuthError(err error, output string) string {
+	if msg := proxyAuthRe.FindString(err.Error()); msg != "" {
+		return msg
+	}
+
+	return proxyAuthRe.FindString(output)
+}
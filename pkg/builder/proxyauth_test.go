@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6foundry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProxyAuthErrors(t *testing.T) {
+	t.Parallel()
+
+	resolveErr := fmt.Errorf("%w: %w: exit status 1", k6foundry.ErrResolvingDependency, k6foundry.ErrExecutingGoCommand)
+
+	testCases := []struct {
+		title       string
+		err         error
+		output      string
+		expectErr   error
+		expectCount float64
+	}{
+		{
+			title:       "unauthorized",
+			err:         resolveErr,
+			output:      "go: go.k6.io/k6ext@v0.1.0: reading https://goproxy.example.com/go.k6.io/k6ext/@v/v0.1.0.info: 401 Unauthorized",
+			expectErr:   ErrProxyAuth,
+			expectCount: 1,
+		},
+		{
+			title:       "forbidden",
+			err:         resolveErr,
+			output:      "go: go.k6.io/k6ext@v0.1.0: reading https://goproxy.example.com/go.k6.io/k6ext/@v/v0.1.0.info: 403 Forbidden",
+			expectErr:   ErrProxyAuth,
+			expectCount: 1,
+		},
+		{
+			title: "in error message",
+			err: fmt.Errorf(
+				"%w: reading http://goproxy.internal/go.k6.io/k6ext/@v/list: 401 Unauthorized",
+				k6foundry.ErrResolvingDependency,
+			),
+			expectErr:   ErrProxyAuth,
+			expectCount: 1,
+		},
+		{
+			// built with a lower version of the dependency
+			title:       "other error",
+			err:         resolveErr,
+			output:      "go: go.k6.io/k6ext@v0.1.0: invalid version: unknown revision v0.1.0",
+			expectErr:   nil,
+			expectCount: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			catalog, err := catalog.NewCatalogFromJSON(strings.NewReader(catalogJSON))
+			if err != nil {
+				t.Fatalf("setting up test builder %v", err)
+			}
+
+			store, err := file.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("creating temporary object store %v", err)
+			}
+
+			attempts := &atomic.Int32{}
+			foundry := func(_ context.Context, opts k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+				return &flakyBuilder{
+					mockBuilder: mockBuilder{opts: opts},
+					failures:    1,
+					err:         tc.err,
+					output:      tc.output,
+					attempts:    attempts,
+				}, nil
+			}
+
+			// retrying or falling back to other versions would hide the error
+			builder, err := New(context.Background(), Config{
+				Opts: Opts{
+					BuildRetries:    2,
+					BuildRetryDelay: time.Millisecond,
+					TransientErrors: []string{"Unauthorized", "Forbidden"},
+					Fallback:        true,
+				},
+				Catalog: catalog,
+				Store:   store,
+				Foundry: FoundryFunction(foundry),
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+
+			deps := []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}}
+			_, err = builder.Build(context.TODO(), "linux/amd64", "v0.1.0", deps)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if count := testutil.ToFloat64(builder.metrics.proxyAuthCounter); count != tc.expectCount {
+				t.Fatalf("expected %f proxy auth failures got %f", tc.expectCount, count)
+			}
+
+			if tc.expectCount > 0 && attempts.Load() != 1 {
+				t.Fatalf("expected 1 attempt got %d", attempts.Load())
+			}
+		})
+	}
+}
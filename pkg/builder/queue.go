@@ -0,0 +1,89 @@
+package builder
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grafana/k6build"
+)
+
+// recentBuilds is the number of recent builds whose duration is used for estimating the wait
+// for a build slot
+const recentBuilds = 100
+
+// durations keeps the duration of the most recent builds
+type durations struct {
+	mtx    sync.Mutex
+	values []time.Duration
+	next   int
+}
+
+// add records the duration of a build, replacing the oldest one if the maximum is reached
+func (d *durations) add(value time.Duration) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if len(d.values) < recentBuilds {
+		d.values = append(d.values, value)
+		return
+	}
+
+	d.values[d.next] = value
+	d.next = (d.next + 1) % recentBuilds
+}
+
+// median returns the median of the recorded durations. Zero if no duration is recorded.
+func (d *durations) median() time.Duration {
+	d.mtx.Lock()
+	sorted := slices.Clone(d.values)
+	d.mtx.Unlock()
+
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// acquireBuildSlot waits for a build slot and returns a function that releases it.
+// If the maximum number of queued builds is reached, the build is rejected with a
+// k6build.QueueFullError.
+func (b *Builder) acquireBuildSlot(ctx context.Context) (func(), error) {
+	release := func() {
+		<-b.buildSlots
+	}
+
+	select {
+	case b.buildSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	position := int(b.queued.Add(1))
+	defer b.queued.Add(-1)
+
+	if b.opts.MaxQueuedBuilds > 0 && position > b.opts.MaxQueuedBuilds {
+		b.metrics.buildsRejectedCounter.Inc()
+		return nil, &k6build.QueueFullError{Position: position, EstimatedWait: b.estimatedWait(position)}
+	}
+
+	select {
+	case b.buildSlots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// estimatedWait returns the estimated wait for a build in the given position of the queue to
+// start, assuming the builds take the median duration of the recent builds. Zero if unknown.
+func (b *Builder) estimatedWait(position int) time.Duration {
+	// the builds ahead in the queue start in rounds of as many builds as slots, after the
+	// builds in progress complete
+	rounds := (position + cap(b.buildSlots) - 1) / cap(b.buildSlots)
+
+	return time.Duration(rounds) * b.buildDurations.median()
+}
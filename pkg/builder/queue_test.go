@@ -0,0 +1,116 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+)
+
+func TestDurationsMedian(t *testing.T) {
+	t.Parallel()
+
+	d := durations{}
+	if median := d.median(); median != 0 {
+		t.Fatalf("expected 0 got %s", median)
+	}
+
+	// only the most recent builds are kept
+	for i := 1; i <= recentBuilds+50; i++ {
+		d.add(time.Duration(i) * time.Second)
+	}
+
+	if median := d.median(); median != 101*time.Second {
+		t.Fatalf("expected %s got %s", 101*time.Second, median)
+	}
+}
+
+func TestMaxQueuedBuilds(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title       string
+		queued      int
+		durations   []time.Duration
+		expectErr   error
+		expectQueue *k6build.QueueFullError
+	}{
+		{
+			title:     "queue not full",
+			queued:    0,
+			expectErr: context.DeadlineExceeded,
+		},
+		{
+			title:       "queue full",
+			queued:      1,
+			durations:   []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second},
+			expectErr:   k6build.ErrBuildQueueFull,
+			expectQueue: &k6build.QueueFullError{Position: 2, EstimatedWait: 40 * time.Second},
+		},
+		{
+			title:       "unknown wait",
+			queued:      1,
+			expectErr:   k6build.ErrBuildQueueFull,
+			expectQueue: &k6build.QueueFullError{Position: 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			catalog, err := catalog.NewCatalogFromJSON(strings.NewReader(catalogJSON))
+			if err != nil {
+				t.Fatalf("setting up test builder %v", err)
+			}
+
+			store, err := file.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("creating temporary object store %v", err)
+			}
+
+			builder, err := New(context.Background(), Config{
+				Opts:    Opts{MaxConcurrentBuilds: 1, MaxQueuedBuilds: 1},
+				Catalog: catalog,
+				Store:   store,
+				Foundry: FoundryFunction(MockFoundryFactory),
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+
+			// take the build slot and simulate the builds waiting for it
+			builder.buildSlots <- struct{}{}
+			builder.queued.Add(int64(tc.queued))
+			for _, d := range tc.durations {
+				builder.buildDurations.add(d)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			_, err = builder.Build(ctx, "linux/amd64", "v0.1.0", nil)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectQueue == nil {
+				return
+			}
+
+			queueErr := &k6build.QueueFullError{}
+			if !errors.As(err, &queueErr) {
+				t.Fatalf("expected a queue full error got %v", err)
+			}
+
+			if *queueErr != *tc.expectQueue {
+				t.Fatalf("expected %v got %v", tc.expectQueue, queueErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6build/pkg/catalog"
+)
+
+// ErrInvalidReplacement signals a replacement that cannot be applied to the build
+var ErrInvalidReplacement = errors.New("invalid replacement")
+
+// applyReplacements pins the modules of the build to the versions of the replacements
+// (module path to version). The modules are modified in place.
+// All the replacements must be for modules of the build and exact versions (or pseudo-versions).
+func applyReplacements(replacements map[string]string, modules []*catalog.Module) error {
+	if len(replacements) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(replacements))
+	for path := range replacements {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		version := replacements[path]
+		semanticVersion, found := strings.CutPrefix(version, "v")
+		if _, err := semver.StrictNewVersion(semanticVersion); err != nil || !found {
+			return fmt.Errorf("%w: %q is not an exact version of %s", ErrInvalidReplacement, version, path)
+		}
+
+		replaced := false
+		for _, m := range modules {
+			if m.Path == path {
+				m.Version = version
+				replaced = true
+			}
+		}
+		if !replaced {
+			return fmt.Errorf("%w: %s is not a module of the build", ErrInvalidReplacement, path)
+		}
+	}
+
+	return nil
+}
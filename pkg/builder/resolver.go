@@ -0,0 +1,40 @@
+package builder
+
+import (
+	"context"
+
+	"github.com/grafana/k6build/pkg/catalog"
+)
+
+// Resolver resolves the dependencies of a build to the go modules that satisfy their constraints
+type Resolver interface {
+	// Resolve returns the modules that satisfy the dependencies, in the same order.
+	// If any dependency cannot be resolved, the returned error should report all the
+	// dependencies that cannot be resolved.
+	Resolve(ctx context.Context, deps []catalog.Dependency) ([]catalog.Module, error)
+}
+
+// CatalogResolver is a Resolver backed by a catalog
+type CatalogResolver struct {
+	catalog catalog.Catalog
+}
+
+// NewCatalogResolver returns a Resolver that resolves the dependencies using a catalog
+func NewCatalogResolver(c catalog.Catalog) *CatalogResolver {
+	return &CatalogResolver{catalog: c}
+}
+
+// Resolve implements the Resolver interface
+func (r *CatalogResolver) Resolve(ctx context.Context, deps []catalog.Dependency) ([]catalog.Module, error) {
+	resolutions, err := catalog.ResolveAll(ctx, r.catalog, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	mods := make([]catalog.Module, 0, len(resolutions))
+	for _, r := range resolutions {
+		mods = append(mods, r.Module)
+	}
+
+	return mods, nil
+}
@@ -0,0 +1,149 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/grafana/k6foundry"
+)
+
+// DefaultBuildRetryDelay is the default delay before retrying a build that failed with a transient error
+const DefaultBuildRetryDelay = time.Second
+
+// DefaultTransientErrors are the default patterns of the errors and output of the builds that
+// failed for transient reasons, mostly network errors downloading the modules
+var DefaultTransientErrors = []string{ //nolint:gochecknoglobals
+	`(?i)connection (reset|refused|timed out)`,
+	`(?i)i/o timeout`,
+	`(?i)tls handshake timeout`,
+	`(?i)no such host`,
+	`(?i)temporary failure in name resolution`,
+	`(?i)(429 too many requests|502 bad gateway|503 service unavailable|504 gateway timeout)`,
+}
+
+// maxCapturedOutput is the maximum size of the build output kept for classifying the build errors
+const maxCapturedOutput = 64 * 1024
+
+// errTransientBuild signals the build failed for transient reasons after retrying it
+var errTransientBuild = errors.New("transient build error")
+
+// compileTransientErrors compiles the patterns of the transient errors
+func compileTransientErrors(patterns []string) ([]*regexp.Regexp, error) {
+	if patterns == nil {
+		patterns = DefaultTransientErrors
+	}
+
+	transient := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transient error pattern %q: %w", p, err)
+		}
+		transient = append(transient, re)
+	}
+
+	return transient, nil
+}
+
+// isTransient returns true if the build failed for a transient reason, given its error and output.
+// Failures compiling the binary, authenticating with the module proxy and cancellations are
+// never transient.
+func (b *Builder) isTransient(err error, output string) bool {
+	if errors.Is(err, k6foundry.ErrCompiling) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		proxyAuthError(err, output) != "" {
+		return false
+	}
+
+	for _, re := range b.transientErrors {
+		if re.MatchString(err.Error()) || re.MatchString(output) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compile builds the artifact into the buffer, retrying the builds that fail for transient reasons
+// up to BuildRetries times. The build output is captured for classifying the errors.
+// If the retries are exhausted, the error wraps errTransientBuild. If BuildRetries is 0, errors
+// are not classified.
+func (b *Builder) compile(
+	ctx context.Context,
+	builder k6foundry.Builder,
+	platform k6foundry.Platform,
+	k6Version string,
+	mods []k6foundry.Module,
+	artifact *bytes.Buffer,
+	output *capturedOutput,
+) (*k6foundry.BuildInfo, error) {
+	delay := b.opts.BuildRetryDelay
+	if delay <= 0 {
+		delay = DefaultBuildRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		artifact.Reset()
+		output.reset()
+
+		buildInfo, err := builder.Build(ctx, platform, k6Version, mods, []string{}, artifact)
+		if err == nil || b.opts.BuildRetries <= 0 || !b.isTransient(err, output.String()) {
+			return buildInfo, err
+		}
+
+		if attempt >= b.opts.BuildRetries {
+			return nil, fmt.Errorf("%w: %w", errTransientBuild, err)
+		}
+
+		b.metrics.buildRetriesCounter.Inc()
+		b.log.Warn(
+			"retrying build",
+			"attempt", attempt+1,
+			"error", b.redactor.redactError(err).Error(),
+		)
+
+		select {
+		case <-time.After(delay << attempt):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// capturedOutput keeps the tail of the output of a build
+type capturedOutput struct {
+	mtx sync.Mutex
+	buf []byte
+}
+
+func (c *capturedOutput) Write(p []byte) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) > maxCapturedOutput {
+		c.buf = c.buf[len(c.buf)-maxCapturedOutput:]
+	}
+
+	return len(p), nil
+}
+
+func (c *capturedOutput) String() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return string(c.buf)
+}
+
+func (c *capturedOutput) reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.buf = c.buf[:0]
+}
@@ -0,0 +1,215 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6foundry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// flakyBuilder is a mock builder that fails the first builds with the given error and output
+type flakyBuilder struct {
+	mockBuilder
+	failures int32
+	err      error
+	output   string
+	attempts *atomic.Int32
+}
+
+func (f *flakyBuilder) Build(
+	ctx context.Context,
+	platform k6foundry.Platform,
+	k6Version string,
+	mods []k6foundry.Module,
+	buildOpts []string,
+	out io.Writer,
+) (*k6foundry.BuildInfo, error) {
+	if f.attempts.Add(1) <= f.failures {
+		if f.opts.Stderr != nil {
+			_, _ = f.opts.Stderr.Write([]byte(f.output))
+		}
+		return nil, f.err
+	}
+
+	return f.mockBuilder.Build(ctx, platform, k6Version, mods, buildOpts, out)
+}
+
+func TestBuildRetries(t *testing.T) {
+	t.Parallel()
+
+	resolveErr := fmt.Errorf("%w: %w: exit status 1", k6foundry.ErrResolvingDependency, k6foundry.ErrExecutingGoCommand)
+	compileErr := fmt.Errorf("%w: %w: exit status 1", k6foundry.ErrCompiling, k6foundry.ErrExecutingGoCommand)
+	networkOutput := "go: go.k6.io/k6ext@v0.1.0: reading https://proxy.golang.org/go.k6.io/k6ext/@v/v0.1.0.zip: 502 Bad Gateway"
+
+	testCases := []struct {
+		title          string
+		retries        int
+		patterns       []string
+		failures       int32
+		err            error
+		output         string
+		expectErr      error
+		expectAttempts int32
+		expectRetries  float64
+	}{
+		{
+			title:          "transient error retried",
+			retries:        2,
+			failures:       1,
+			err:            resolveErr,
+			output:         networkOutput,
+			expectErr:      nil,
+			expectAttempts: 2,
+			expectRetries:  1,
+		},
+		{
+			title:          "transient error exceeds retries",
+			retries:        2,
+			failures:       5,
+			err:            resolveErr,
+			output:         networkOutput,
+			expectErr:      ErrBuildingArtifact,
+			expectAttempts: 3,
+			expectRetries:  2,
+		},
+		{
+			title:          "transient error in error message",
+			retries:        2,
+			failures:       1,
+			err:            fmt.Errorf("%w: dial tcp: lookup proxy.golang.org: no such host", k6foundry.ErrResolvingDependency),
+			output:         "",
+			expectErr:      nil,
+			expectAttempts: 2,
+			expectRetries:  1,
+		},
+		{
+			title:          "retries disabled",
+			retries:        0,
+			failures:       1,
+			err:            resolveErr,
+			output:         networkOutput,
+			expectErr:      ErrAccessingArtifact,
+			expectAttempts: 1,
+			expectRetries:  0,
+		},
+		{
+			title:          "compile error not retried",
+			retries:        2,
+			failures:       1,
+			err:            compileErr,
+			output:         networkOutput,
+			expectErr:      ErrAccessingArtifact,
+			expectAttempts: 1,
+			expectRetries:  0,
+		},
+		{
+			title:          "permanent error not retried",
+			retries:        2,
+			failures:       1,
+			err:            resolveErr,
+			output:         "go: go.k6.io/k6ext@v0.1.0: invalid version: unknown revision v0.1.0",
+			expectErr:      ErrAccessingArtifact,
+			expectAttempts: 1,
+			expectRetries:  0,
+		},
+		{
+			title:          "custom patterns",
+			retries:        2,
+			failures:       1,
+			patterns:       []string{"unknown revision"},
+			err:            resolveErr,
+			output:         "go: go.k6.io/k6ext@v0.1.0: invalid version: unknown revision v0.1.0",
+			expectErr:      nil,
+			expectAttempts: 2,
+			expectRetries:  1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			catalog, err := catalog.NewCatalogFromJSON(strings.NewReader(catalogJSON))
+			if err != nil {
+				t.Fatalf("setting up test builder %v", err)
+			}
+
+			store, err := file.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("creating temporary object store %v", err)
+			}
+
+			attempts := &atomic.Int32{}
+			foundry := func(_ context.Context, opts k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+				return &flakyBuilder{
+					mockBuilder: mockBuilder{opts: opts},
+					failures:    tc.failures,
+					err:         tc.err,
+					output:      tc.output,
+					attempts:    attempts,
+				}, nil
+			}
+
+			builder, err := New(context.Background(), Config{
+				Opts: Opts{
+					BuildRetries:    tc.retries,
+					BuildRetryDelay: time.Millisecond,
+					TransientErrors: tc.patterns,
+				},
+				Catalog: catalog,
+				Store:   store,
+				Foundry: FoundryFunction(foundry),
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+
+			deps := []k6build.Dependency{{Name: "k6/x/ext", Constraints: "v0.1.0"}}
+			_, err = builder.Build(context.TODO(), "linux/amd64", "v0.1.0", deps)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if n := attempts.Load(); n != tc.expectAttempts {
+				t.Fatalf("expected %d attempts got %d", tc.expectAttempts, n)
+			}
+
+			if retries := testutil.ToFloat64(builder.metrics.buildRetriesCounter); retries != tc.expectRetries {
+				t.Fatalf("expected %f retries got %f", tc.expectRetries, retries)
+			}
+		})
+	}
+}
+
+func TestInvalidTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	catalog, err := catalog.NewCatalogFromJSON(strings.NewReader(catalogJSON))
+	if err != nil {
+		t.Fatalf("setting up test builder %v", err)
+	}
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating temporary object store %v", err)
+	}
+
+	_, err = New(context.Background(), Config{
+		Opts:    Opts{TransientErrors: []string{"("}},
+		Catalog: catalog,
+		Store:   store,
+	})
+	if !errors.Is(err, ErrInitializingBuilder) {
+		t.Fatalf("expected %v got %v", ErrInitializingBuilder, err)
+	}
+}
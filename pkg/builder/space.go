@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/grafana/k6build"
+)
+
+// ErrInsufficientSpace signals there is not enough free space for building.
+// It is the same error as k6build.ErrInsufficientSpace, so it can be identified by the clients of
+// the build service.
+var ErrInsufficientSpace = k6build.ErrInsufficientSpace //nolint:revive
+
+// errFreeSpaceNotSupported is returned when the free space cannot be checked in the platform
+var errFreeSpaceNotSupported = errors.New("checking free space not supported")
+
+// checkFreeSpace verifies the directories used by the builds (the temporary directory where
+// the builds run and the go caches, if specified) have at least MinFreeSpace bytes free.
+// Directories whose free space cannot be obtained are not checked.
+func (b *Builder) checkFreeSpace() error {
+	if b.opts.MinFreeSpace <= 0 {
+		return nil
+	}
+
+	for _, dir := range []string{os.TempDir(), b.opts.GoCache, b.opts.GoModCache} {
+		if dir == "" {
+			continue
+		}
+
+		free, err := b.freeSpace(dir)
+		if err != nil {
+			if !errors.Is(err, errFreeSpaceNotSupported) && !errors.Is(err, os.ErrNotExist) {
+				b.log.Warn("checking free space", "dir", dir, "error", err.Error())
+			}
+			continue
+		}
+
+		if free < uint64(b.opts.MinFreeSpace) {
+			return fmt.Errorf(
+				"%w: %s has %d bytes free, %d required",
+				ErrInsufficientSpace,
+				dir,
+				free,
+				b.opts.MinFreeSpace,
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package builder
+
+// diskFreeSpace is not supported in this platform
+func diskFreeSpace(_ string) (uint64, error) {
+	return 0, errFreeSpaceNotSupported
+}
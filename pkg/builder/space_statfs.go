@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package builder
+
+import "syscall"
+
+// diskFreeSpace returns the bytes available to unprivileged users in the file system of the directory
+func diskFreeSpace(dir string) (uint64, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil //nolint:unconvert
+}
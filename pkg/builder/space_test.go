@@ -0,0 +1,97 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInsufficientSpace(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title        string
+		minFreeSpace int64
+		freeSpace    uint64
+		spaceErr     error
+		expectErr    error
+	}{
+		{
+			title:        "enough space",
+			minFreeSpace: 1024,
+			freeSpace:    2048,
+			expectErr:    nil,
+		},
+		{
+			title:        "insufficient space",
+			minFreeSpace: 1024,
+			freeSpace:    512,
+			expectErr:    ErrInsufficientSpace,
+		},
+		{
+			title:        "check disabled",
+			minFreeSpace: 0,
+			freeSpace:    0,
+			expectErr:    nil,
+		},
+		{
+			title:        "free space not supported",
+			minFreeSpace: 1024,
+			spaceErr:     errFreeSpaceNotSupported,
+			expectErr:    nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			catalog, err := catalog.NewCatalogFromJSON(strings.NewReader(catalogJSON))
+			if err != nil {
+				t.Fatalf("setting up test builder %v", err)
+			}
+
+			store, err := file.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("creating temporary object store %v", err)
+			}
+
+			builder, err := New(context.Background(), Config{
+				Opts:    Opts{MinFreeSpace: tc.minFreeSpace},
+				Catalog: catalog,
+				Store:   store,
+				Foundry: FoundryFunction(MockFoundryFactory),
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+			builder.freeSpace = func(string) (uint64, error) {
+				return tc.freeSpace, tc.spaceErr
+			}
+
+			_, err = builder.Build(context.TODO(), "linux/amd64", "v0.1.0", []k6build.Dependency{})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr == nil {
+				return
+			}
+
+			if !errors.Is(err, k6build.ErrInsufficientSpace) || !errors.Is(err, ErrBuildingArtifact) {
+				t.Fatalf("expected %v got %v", k6build.ErrInsufficientSpace, err)
+			}
+
+			failed := testutil.ToFloat64(builder.metrics.buildsFailedCounter.WithLabelValues(failureSpace))
+			if failed != 1 {
+				t.Fatalf("expected 1 failed build got %f", failed)
+			}
+		})
+	}
+}
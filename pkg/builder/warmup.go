@@ -0,0 +1,33 @@
+package builder
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/k6build"
+)
+
+// Warmup compiles a baseline k6 (without extensions) for each platform to populate the go build
+// and module caches, so the first builds after a restart are faster. The binaries are not stored.
+// Returns the first error, after attempting all the platforms.
+func (b *Builder) Warmup(ctx context.Context, k6Constrains string, platforms ...string) error {
+	// build even if the artifact is in the store, but don't store it
+	ctx = k6build.WithBuildOpts(ctx, k6build.BuildOpts{NoCache: true, NoStore: true})
+
+	var warmupErr error
+	for _, platform := range platforms {
+		start := time.Now()
+		_, err := b.Build(ctx, platform, k6Constrains, nil)
+		if err != nil {
+			b.log.Warn("warming up build cache", "platform", platform, "error", err.Error())
+			if warmupErr == nil {
+				warmupErr = err
+			}
+			continue
+		}
+
+		b.log.Info("warmed up build cache", "platform", platform, "duration", time.Since(start).String())
+	}
+
+	return warmupErr
+}
@@ -0,0 +1,83 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6foundry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWarmup(t *testing.T) {
+	t.Parallel()
+
+	catalog, err := catalog.NewCatalogFromJSON(strings.NewReader(catalogJSON))
+	if err != nil {
+		t.Fatalf("setting up test builder %v", err)
+	}
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating temporary object store %v", err)
+	}
+
+	mtx := sync.Mutex{}
+	envs := []map[string]string{}
+	foundry := func(ctx context.Context, opts k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		envs = append(envs, opts.Env)
+
+		return MockFoundryFactory(ctx, opts)
+	}
+
+	env := map[string]string{"GOFLAGS": "-mod=mod"}
+	builder, err := New(context.Background(), Config{
+		Opts: Opts{
+			GoOpts:     GoOpts{Env: env},
+			GoCache:    "/cache/go-build",
+			GoModCache: "/cache/mod",
+		},
+		Catalog: catalog,
+		Store:   store,
+		Foundry: FoundryFunction(foundry),
+	})
+	if err != nil {
+		t.Fatalf("creating builder %v", err)
+	}
+
+	err = builder.Warmup(context.TODO(), "v0.1.0", "linux/amd64", "invalid", "darwin/arm64")
+	if !errors.Is(err, ErrInvalidParameters) {
+		t.Fatalf("expected %v got %v", ErrInvalidParameters, err)
+	}
+
+	if builds := testutil.ToFloat64(builder.metrics.buildCounter); builds != 2 {
+		t.Fatalf("expected 2 builds got %f", builds)
+	}
+
+	// the warmup builds are not stored
+	if _, err = builder.Build(context.TODO(), "linux/amd64", "v0.1.0", nil); err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+	if hits := testutil.ToFloat64(builder.metrics.storeHitsCounter); hits != 0 {
+		t.Fatalf("expected no store hits got %f", hits)
+	}
+
+	for _, buildEnv := range envs {
+		if buildEnv["GOCACHE"] != "/cache/go-build" || buildEnv["GOMODCACHE"] != "/cache/mod" {
+			t.Fatalf("expected the go caches in the build environment got %v", buildEnv)
+		}
+		if buildEnv["GOFLAGS"] != "-mod=mod" {
+			t.Fatalf("expected the build environment to include the Env option got %v", buildEnv)
+		}
+	}
+
+	if len(env) != 1 {
+		t.Fatalf("the Env option must not be modified %v", env)
+	}
+}
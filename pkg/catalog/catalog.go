@@ -11,15 +11,21 @@
 //		     "<dependency>": {
 //	              "module": "<module path>",
 //	              "versions": ["<version>", "<version>", ... "<version>"],
-//	              "cgo": <bool>
+//	              "cgo": <bool>,
+//	              "channels": {"<channel>": ["<version>", ... "<version>"]}
 //		     },
 //		}
 //
 // where:
 // <dependency>: is the import path for the dependency
 // module: is the path to the go module that implements the dependency
-// versions: is the list of supported versions
+// versions: is the list of supported versions (stable channel)
 // cgo: is a boolean that indicates if the module requires cgo
+// channels: (optional) maps release channels (e.g. beta, canary) to the versions published on them
+//
+// A dependency resolved on a channel other than stable considers both the stable versions and
+// the versions published on the channel. Prerelease versions published on a channel satisfy the
+// constrains as their release version. E.g. v0.2.0-beta.1 satisfies >v0.1.0
 //
 // Example:
 //
@@ -40,15 +46,27 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6build"
 )
 
 const (
 	DefaultCatalogFile = "catalog.json"                        //nolint:revive
 	DefaultCatalogURL  = "https://registry.k6.io/catalog.json" //nolint:revive
+
+	// ChannelStable is the default release channel
+	ChannelStable = "stable"
+
+	// AllVersions is a constraint satisfied by all the versions, including pre-releases
+	AllVersions = ">=v0.0.0-0"
+
+	// MaxAvailableVersions is the maximum number of available versions reported (newest first)
+	// when a dependency cannot be satisfied
+	MaxAvailableVersions = 10
 )
 
 var (
@@ -64,10 +82,12 @@ var (
 // Dependency defines a Dependency with a version constrain
 // Examples:
 // Name: k6/x/k6-kubernetes   Constrains *
-// Name: k6/x/k6-output-kafka Constrains >v0.9.0
+// Name: k6/x/k6-output-kafka Constrains >v0.9.0 Channel beta
 type Dependency struct {
 	Name       string `json:"name,omitempty"`
 	Constrains string `json:"constrains,omitempty"`
+	// Channel is the release channel. Defaults to ChannelStable
+	Channel string `json:"channel,omitempty"`
 }
 
 // Module defines a go module that resolves a Dependency
@@ -83,11 +103,98 @@ type Catalog interface {
 	Resolve(ctx context.Context, dep Dependency) (Module, error)
 }
 
+// VersionLister is implemented by catalogs that can list the versions that satisfy a Dependency
+// without resolving it. This is a fast, best-effort path for discovery (e.g. autocompletion)
+// that answers from the versions already known by the catalog.
+type VersionLister interface {
+	// Versions returns the versions that satisfy the Dependency, newest first
+	Versions(ctx context.Context, dep Dependency) ([]string, error)
+}
+
+// Lister is implemented by catalogs that can list all the dependencies they contain
+// (e.g. for discovering the extensions that can be installed)
+type Lister interface {
+	// List returns the dependencies in the catalog, sorted by name
+	List(ctx context.Context) ([]Listing, error)
+}
+
+// Listing describes a dependency in the catalog
+type Listing struct {
+	// Name of the dependency (e.g. k6/x/kubernetes)
+	Name string
+	// Module is the path of the go module that implements the dependency
+	Module string
+	// Cgo indicates if the module requires cgo
+	Cgo bool
+	// Versions of the stable channel, newest first
+	Versions []string
+	// Channels maps the release channels to the versions published on them, newest first
+	Channels map[string][]string
+}
+
+// Resolution is the result of resolving a Dependency.
+// Either Module or Err is set.
+type Resolution struct {
+	Dependency Dependency
+	Module     Module
+	Err        error
+}
+
+// ResolveError reports the result of resolving each dependency of a set when any of them cannot be
+// resolved. It matches the errors of the dependencies that cannot be resolved (e.g. ErrCannotSatisfy).
+type ResolveError struct {
+	Resolutions []Resolution
+}
+
+func (e *ResolveError) Error() string {
+	return errors.Join(e.Unwrap()...).Error()
+}
+
+// Unwrap returns the errors of the dependencies that cannot be resolved
+func (e *ResolveError) Unwrap() []error {
+	errs := []error{}
+	for _, r := range e.Resolutions {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errs
+}
+
+// ResolveAll resolves all the dependencies returning the result of each one,
+// instead of stopping at the first dependency that cannot be resolved.
+// If any dependency cannot be resolved, the returned error is a *ResolveError.
+func ResolveAll(ctx context.Context, c Catalog, deps []Dependency) ([]Resolution, error) {
+	resolutions := make([]Resolution, 0, len(deps))
+	failed := false
+	for _, dep := range deps {
+		mod, err := c.Resolve(ctx, dep)
+		failed = failed || err != nil
+		resolutions = append(resolutions, Resolution{Dependency: dep, Module: mod, Err: err})
+	}
+
+	if failed {
+		return resolutions, &ResolveError{Resolutions: resolutions}
+	}
+
+	return resolutions, nil
+}
+
+// IsPinned returns true if the constrain matches exactly one version. E.g. v0.1.0 or =v0.1.0
+// Other constrains (e.g. '*' or '>v0.1.0') are floating: they can resolve to different versions
+// as new versions are added to the catalog.
+func IsPinned(constrain string) bool {
+	version := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(constrain), "="))
+	_, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+	return err == nil
+}
+
 // entry defines a catalog entry
 type entry struct {
-	Module   string   `json:"module,omitempty"`
-	Versions []string `json:"versions,omitempty"`
-	Cgo      bool     `json:"cgo,omitempty"`
+	Module   string              `json:"module,omitempty"`
+	Versions []string            `json:"versions,omitempty"`
+	Cgo      bool                `json:"cgo,omitempty"`
+	Channels map[string][]string `json:"channels,omitempty"`
 }
 
 type catalog struct {
@@ -150,6 +257,7 @@ func NewCatalogFromURL(ctx context.Context, catalogURL string) (Catalog, error)
 	if err != nil {
 		return nil, fmt.Errorf("%w %w", ErrDownload, err)
 	}
+	req.Header.Set("User-Agent", k6build.UserAgent)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -175,34 +283,159 @@ func DefaultCatalog() (Catalog, error) {
 }
 
 func (c catalog) Resolve(ctx context.Context, dep Dependency) (Module, error) {
-	entry, err := c.getVersions(ctx, dep.Name)
+	entry, versions, err := c.candidates(ctx, dep)
 	if err != nil {
 		return Module{}, err
 	}
 
+	if len(versions) == 0 {
+		// report the versions that are available, so the constraints can be fixed
+		_, available, _ := c.candidates(ctx, Dependency{Name: dep.Name, Constrains: AllVersions, Channel: dep.Channel})
+		return Module{}, fmt.Errorf(
+			"%w : %s %s (%s)",
+			ErrCannotSatisfy,
+			dep.Name,
+			dep.Constrains,
+			availableVersions(available),
+		)
+	}
+
+	return Module{Path: entry.Module, Version: versions[0], Cgo: entry.Cgo}, nil
+}
+
+// availableVersions returns a description of the available versions (sorted newest first)
+// listing the newest MaxAvailableVersions in ascending order. E.g. "available: v1.0.0, v1.1.0"
+func availableVersions(versions []string) string {
+	if len(versions) == 0 {
+		return "no versions available"
+	}
+
+	listed := slices.Clone(versions[:min(len(versions), MaxAvailableVersions)])
+	slices.Reverse(listed)
+
+	omitted := ""
+	if len(versions) > len(listed) {
+		omitted = fmt.Sprintf("%d older versions omitted, ", len(versions)-len(listed))
+	}
+
+	return fmt.Sprintf("available: %s%s", omitted, strings.Join(listed, ", "))
+}
+
+// Versions returns the versions in the catalog that satisfy the dependency, newest first.
+// Returns an empty list if no version satisfies it.
+func (c catalog) Versions(ctx context.Context, dep Dependency) ([]string, error) {
+	_, versions, err := c.candidates(ctx, dep)
+	return versions, err
+}
+
+// List returns the dependencies in the catalog, sorted by name, with their versions newest first
+func (c catalog) List(_ context.Context) ([]Listing, error) {
+	names := make([]string, 0, len(c.dependencies))
+	for name := range c.dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listings := make([]Listing, 0, len(names))
+	for _, name := range names {
+		entry := c.dependencies[name]
+
+		versions, err := sortVersions(entry.Versions)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %w", ErrInvalidCatalog, name, err)
+		}
+
+		var channels map[string][]string
+		for channel, channelVersions := range entry.Channels {
+			sorted, err := sortVersions(channelVersions)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s %w", ErrInvalidCatalog, name, err)
+			}
+			if channels == nil {
+				channels = map[string][]string{}
+			}
+			channels[channel] = sorted
+		}
+
+		listings = append(listings, Listing{
+			Name:     name,
+			Module:   entry.Module,
+			Cgo:      entry.Cgo,
+			Versions: versions,
+			Channels: channels,
+		})
+	}
+
+	return listings, nil
+}
+
+// sortVersions returns the versions sorted newest first
+func sortVersions(versions []string) ([]string, error) {
+	parsed := make([]*semver.Version, 0, len(versions))
+	for _, v := range versions {
+		version, err := semver.NewVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, version)
+	}
+
+	sort.Sort(sort.Reverse(semver.Collection(parsed)))
+	sorted := make([]string, 0, len(parsed))
+	for _, v := range parsed {
+		sorted = append(sorted, v.Original())
+	}
+
+	return sorted, nil
+}
+
+// candidates returns the catalog entry for the dependency and the versions that satisfy
+// its constrains, sorted newest first
+func (c catalog) candidates(ctx context.Context, dep Dependency) (entry, []string, error) {
+	entry, err := c.getVersions(ctx, dep.Name)
+	if err != nil {
+		return entry, nil, err
+	}
+
 	constrain, err := semver.NewConstraint(dep.Constrains)
 	if err != nil {
-		return Module{}, fmt.Errorf("%w : %s", ErrInvalidConstrain, dep.Constrains)
+		return entry, nil, fmt.Errorf("%w : %s", ErrInvalidConstrain, dep.Constrains)
 	}
 
 	versions := []*semver.Version{}
 	for _, v := range entry.Versions {
 		version, err := semver.NewVersion(v)
 		if err != nil {
-			return Module{}, err
+			return entry, nil, err
 		}
 		versions = append(versions, version)
 	}
 
-	if len(versions) > 0 {
-		// try to find the higher version that satisfies the condition
-		sort.Sort(sort.Reverse(semver.Collection(versions)))
-		for _, v := range versions {
-			if constrain.Check(v) {
-				return Module{Path: entry.Module, Version: v.Original(), Cgo: entry.Cgo}, nil
+	// versions published on the channel, which can be prereleases
+	channelVersions := map[*semver.Version]bool{}
+	if dep.Channel != "" && dep.Channel != ChannelStable {
+		for _, v := range entry.Channels[dep.Channel] {
+			version, err := semver.NewVersion(v)
+			if err != nil {
+				return entry, nil, err
 			}
+			versions = append(versions, version)
+			channelVersions[version] = true
+		}
+	}
+
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+	candidates := []string{}
+	for _, v := range versions {
+		candidate := v
+		if channelVersions[v] && v.Prerelease() != "" {
+			release, _ := v.SetPrerelease("")
+			candidate = &release
+		}
+		if constrain.Check(candidate) {
+			candidates = append(candidates, v.Original())
 		}
 	}
 
-	return Module{}, fmt.Errorf("%w : %s %s", ErrCannotSatisfy, dep.Name, dep.Constrains)
+	return entry, candidates, nil
 }
@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 const testCatalog = `{
-"dep": {"Module": "github.com/dep", "Versions": ["v0.1.0", "v0.2.0"]},
+"dep": {"Module": "github.com/dep", "Versions": ["v0.1.0", "v0.2.0"], "Channels": {"beta": ["v0.3.0-beta.1"]}},
 "dep2": {"Module": "github.com/dep2", "Versions": ["v0.1.0"], "Cgo": true}
 }`
 
@@ -50,6 +53,31 @@ func TestResolve(t *testing.T) {
 			dep:       Dependency{Name: "dep", Constrains: ">v0.2.0"},
 			expectErr: ErrCannotSatisfy,
 		},
+		{
+			title:  "resolve latest version on channel",
+			dep:    Dependency{Name: "dep", Constrains: "*", Channel: "beta"},
+			expect: Module{Path: "github.com/dep", Version: "v0.3.0-beta.1", Cgo: false},
+		},
+		{
+			title:  "resolve > constrain on channel",
+			dep:    Dependency{Name: "dep", Constrains: ">v0.2.0", Channel: "beta"},
+			expect: Module{Path: "github.com/dep", Version: "v0.3.0-beta.1", Cgo: false},
+		},
+		{
+			title:  "resolve stable version on channel",
+			dep:    Dependency{Name: "dep", Constrains: "v0.1.0", Channel: "beta"},
+			expect: Module{Path: "github.com/dep", Version: "v0.1.0", Cgo: false},
+		},
+		{
+			title:  "resolve latest version on stable channel",
+			dep:    Dependency{Name: "dep", Constrains: "*", Channel: ChannelStable},
+			expect: Module{Path: "github.com/dep", Version: "v0.2.0", Cgo: false},
+		},
+		{
+			title:  "resolve latest version on channel without versions",
+			dep:    Dependency{Name: "dep2", Constrains: "*", Channel: "beta"},
+			expect: Module{Path: "github.com/dep2", Version: "v0.1.0", Cgo: true},
+		},
 	}
 
 	json := bytes.NewBuffer([]byte(testCatalog))
@@ -75,6 +103,98 @@ func TestResolve(t *testing.T) {
 	}
 }
 
+func TestResolveAll(t *testing.T) {
+	t.Parallel()
+
+	json := bytes.NewBuffer([]byte(testCatalog))
+	catalog, err := NewCatalogFromJSON(json)
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	deps := []Dependency{
+		{Name: "dep", Constrains: ">v0.2.0"},
+		{Name: "dep2", Constrains: "v0.1.0"},
+		{Name: "dep3", Constrains: "*"},
+	}
+
+	resolutions, err := ResolveAll(context.TODO(), catalog, deps)
+	if !errors.Is(err, ErrCannotSatisfy) || !errors.Is(err, ErrUnknownDependency) {
+		t.Fatalf("expected %v and %v got %v", ErrCannotSatisfy, ErrUnknownDependency, err)
+	}
+
+	resolveErr := &ResolveError{}
+	if !errors.As(err, &resolveErr) || len(resolveErr.Resolutions) != len(deps) {
+		t.Fatalf("expected a resolve error with %d resolutions got %v", len(deps), err)
+	}
+
+	if len(resolutions) != len(deps) {
+		t.Fatalf("expected %d resolutions got %d", len(deps), len(resolutions))
+	}
+
+	if !errors.Is(resolutions[0].Err, ErrCannotSatisfy) {
+		t.Fatalf("expected %v got %v", ErrCannotSatisfy, resolutions[0].Err)
+	}
+
+	expected := Module{Path: "github.com/dep2", Version: "v0.1.0", Cgo: true}
+	if resolutions[1].Err != nil || resolutions[1].Module != expected {
+		t.Fatalf("expected %v got %v (%v)", expected, resolutions[1].Module, resolutions[1].Err)
+	}
+
+	if !errors.Is(resolutions[2].Err, ErrUnknownDependency) {
+		t.Fatalf("expected %v got %v", ErrUnknownDependency, resolutions[2].Err)
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	json := bytes.NewBuffer([]byte(testCatalog))
+	catalog, err := NewCatalogFromJSON(json)
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	lister, ok := catalog.(Lister)
+	if !ok {
+		t.Fatalf("expected catalog to be a Lister")
+	}
+
+	listings, err := lister.List(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []Listing{
+		{
+			Name:     "dep",
+			Module:   "github.com/dep",
+			Versions: []string{"v0.2.0", "v0.1.0"},
+			Channels: map[string][]string{"beta": {"v0.3.0-beta.1"}},
+		},
+		{
+			Name:     "dep2",
+			Module:   "github.com/dep2",
+			Cgo:      true,
+			Versions: []string{"v0.1.0"},
+		},
+	}
+	if !reflect.DeepEqual(expected, listings) {
+		t.Fatalf("expected %v got %v", expected, listings)
+	}
+
+	invalidCatalog := `{"dep": {"module": "github.com/dep", "versions": ["latest"]}}`
+	invalid, err := NewCatalogFromJSON(bytes.NewBufferString(invalidCatalog))
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	_, err = invalid.(Lister).List(context.TODO())
+	if !errors.Is(err, ErrInvalidCatalog) {
+		t.Fatalf("expected %v got %v", ErrInvalidCatalog, err)
+	}
+}
+
 func TestCatalogFromJSON(t *testing.T) {
 	t.Parallel()
 
@@ -185,3 +305,64 @@ func TestCatalogFromFile(t *testing.T) {
 		})
 	}
 }
+
+func TestCannotSatisfyAvailableVersions(t *testing.T) {
+	t.Parallel()
+
+	versions := []string{}
+	for i := range MaxAvailableVersions + 2 {
+		versions = append(versions, fmt.Sprintf(`"v1.%d.0"`, i))
+	}
+	testCatalog := fmt.Sprintf(`{
+"dep": {"module": "github.com/dep", "versions": ["v0.1.0", "v0.2.0"], "channels": {"beta": ["v0.3.0-beta.1"]}},
+"many": {"module": "github.com/many", "versions": [%s]},
+"none": {"module": "github.com/none", "versions": []}
+}`, strings.Join(versions, ","))
+
+	catalog, err := NewCatalogFromJSON(bytes.NewBufferString(testCatalog))
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	testCases := []struct {
+		title  string
+		dep    Dependency
+		expect string
+	}{
+		{
+			title:  "available versions",
+			dep:    Dependency{Name: "dep", Constrains: ">v2.0.0"},
+			expect: "(available: v0.1.0, v0.2.0)",
+		},
+		{
+			title:  "available versions on channel",
+			dep:    Dependency{Name: "dep", Constrains: ">v2.0.0", Channel: "beta"},
+			expect: "(available: v0.1.0, v0.2.0, v0.3.0-beta.1)",
+		},
+		{
+			title:  "newest versions",
+			dep:    Dependency{Name: "many", Constrains: ">v2.0.0"},
+			expect: "(available: 2 older versions omitted, v1.2.0, v1.3.0,",
+		},
+		{
+			title:  "no versions",
+			dep:    Dependency{Name: "none", Constrains: "*"},
+			expect: "(no versions available)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := catalog.Resolve(context.TODO(), tc.dep)
+			if !errors.Is(err, ErrCannotSatisfy) {
+				t.Fatalf("expected %v got %v", ErrCannotSatisfy, err)
+			}
+
+			if !strings.Contains(err.Error(), tc.expect) {
+				t.Fatalf("expected %q in %q", tc.expect, err.Error())
+			}
+		})
+	}
+}
@@ -3,15 +3,22 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/grafana/k6build"
 	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6build/pkg/signature"
 )
 
 // ErrInvalidConfiguration signals an error in the configuration
@@ -23,8 +30,15 @@ const (
 
 // BuildServiceClientConfig defines the configuration for accessing a remote build service
 type BuildServiceClientConfig struct {
-	// URL to build service
+	// URL to build service. A unix domain socket can be specified as unix:///path/to/socket
 	URL string
+	// URLs of additional build services. The requests are balanced among all the build services
+	// in a round-robin fashion and fail over to the next one on connection errors.
+	// Unix domain sockets are not supported when multiple build services are specified.
+	URLs []string
+	// FailureCooldown is the time a build service is avoided after a connection error.
+	// Defaults to DefaultFailureCooldown
+	FailureCooldown time.Duration
 	// Authorization credentials passed in the Authorization: <type> <credentials> header
 	// See AuthorizationType
 	Authorization string
@@ -35,43 +49,104 @@ type BuildServiceClientConfig struct {
 	Headers map[string]string
 	// HTTPClient custom http client
 	HTTPClient *http.Client
+	// TLSConfig used for connecting to the build service. For example, for presenting a client
+	// certificate (mTLS) or validating the server's certificate using a custom CA.
+	// Ignored if HTTPClient is specified.
+	TLSConfig *tls.Config
+	// UserAgent sent in the requests. Defaults to k6build.UserAgent
+	UserAgent string
+	// Compress the request body using gzip
+	Compress bool
+	// PublicKey of the build service used for verifying the signature of the artifacts.
+	// If specified, artifacts without a valid signature are rejected. See the signature package
+	PublicKey ed25519.PublicKey
 }
 
 // NewBuildServiceClient returns a new client for a remote build service
-func NewBuildServiceClient(config BuildServiceClientConfig) (k6build.BuildService, error) {
-	if config.URL == "" {
-		return nil, ErrInvalidConfiguration
+func NewBuildServiceClient(config BuildServiceClientConfig) (*BuildClient, error) {
+	srvURLs := []*url.URL{}
+	for _, u := range append([]string{config.URL}, config.URLs...) {
+		if u == "" {
+			continue
+		}
+
+		srvURL, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server %w", err)
+		}
+		srvURLs = append(srvURLs, srvURL)
 	}
 
-	srvURL, err := url.Parse(config.URL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid server %w", err)
+	if len(srvURLs) == 0 {
+		return nil, ErrInvalidConfiguration
 	}
 
 	client := config.HTTPClient
 	if client == nil {
 		client = http.DefaultClient
+		if config.TLSConfig != nil {
+			transport, _ := http.DefaultTransport.(*http.Transport)
+			transport = transport.Clone()
+			transport.TLSClientConfig = config.TLSConfig
+			client = &http.Client{Transport: transport}
+		}
+	}
+
+	// connect to the unix domain socket. Requests are sent as plain http
+	if srvURL := srvURLs[0]; srvURL.Scheme == "unix" {
+		if len(srvURLs) > 1 {
+			return nil, fmt.Errorf("%w: unix socket cannot be used with multiple servers", ErrInvalidConfiguration)
+		}
+
+		socket := srvURL.Path
+		transport, _ := http.DefaultTransport.(*http.Transport)
+		transport = transport.Clone()
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		client = &http.Client{Transport: transport}
+		srvURLs[0] = &url.URL{Scheme: "http", Host: "localhost"}
+	}
+
+	for _, srvURL := range srvURLs[1:] {
+		if srvURL.Scheme == "unix" {
+			return nil, fmt.Errorf("%w: unix socket cannot be used with multiple servers", ErrInvalidConfiguration)
+		}
+	}
+
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = k6build.UserAgent
 	}
+
 	return &BuildClient{
-		srvURL:   srvURL,
-		auth:     config.Authorization,
-		authType: config.AuthorizationType,
-		headers:  config.Headers,
-		client:   client,
+		endpoints: newEndpoints(srvURLs, config.FailureCooldown),
+		auth:      config.Authorization,
+		authType:  config.AuthorizationType,
+		headers:   config.Headers,
+		client:    client,
+		userAgent: userAgent,
+		compress:  config.Compress,
+		publicKey: config.PublicKey,
 	}, nil
 }
 
 // BuildClient defines a client of a build service
 type BuildClient struct {
-	srvURL   *url.URL
-	authType string
-	auth     string
-	headers  map[string]string
-	client   *http.Client
+	endpoints *endpoints
+	authType  string
+	auth      string
+	headers   map[string]string
+	client    *http.Client
+	userAgent string
+	compress  bool
+	publicKey ed25519.PublicKey
 }
 
 // Build request building an artifact to a build service
 // The build service is expected to return a k6build.Artifact
+// The platform can be an alias for the client's platform (see ExpandPlatform).
 // In case of error, the returned error is expected to match any of the errors
 // defined in the api package and calling errors.Unwrap(err) will provide
 // the cause, if available.
@@ -81,39 +156,121 @@ func (r *BuildClient) Build(
 	k6Constrains string,
 	deps []k6build.Dependency,
 ) (k6build.Artifact, error) {
+	buildOpts := k6build.BuildOptsFromContext(ctx)
 	buildRequest := api.BuildRequest{
-		Platform:     platform,
-		K6Constrains: k6Constrains,
-		Dependencies: deps,
+		Platform:        ExpandPlatform(platform),
+		K6Constrains:    k6Constrains,
+		Dependencies:    deps,
+		NoCache:         buildOpts.NoCache,
+		NoStore:         buildOpts.NoStore,
+		CurrentArtifact: buildOpts.CurrentArtifact,
+		Fallback:        buildOpts.Fallback,
+		Replacements:    buildOpts.Replacements,
+		K6Repo:          buildOpts.K6Repo,
 	}
-	marshaled := &bytes.Buffer{}
-	err := json.NewEncoder(marshaled).Encode(buildRequest)
+	marshaled, err := r.encodeBody(buildRequest)
 	if err != nil {
 		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrInvalidRequest, err)
 	}
+	body := marshaled.Bytes()
+
+	resp, err := r.do(ctx, func(srvURL *url.URL) (*http.Request, error) {
+		reqURL := srvURL.JoinPath("build")
+		reqURL.RawQuery = url.Values{api.EnsureParam: []string{"true"}}.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		if r.compress {
+			req.Header.Add("Content-Encoding", "gzip")
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			req.Header.Add(api.RequestTimeoutHeader, time.Until(deadline).String())
+		}
 
-	reqURL := r.srvURL.JoinPath("build")
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), marshaled)
+		return req, nil
+	})
 	if err != nil {
 		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
 	}
-	req.Header.Add("Content-Type", "application/json")
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
-	// add authorization header "Authorization: <type> <auth>"
-	if r.auth != "" {
-		authType := r.authType
-		if authType == "" {
-			authType = defaultAuthType
+	if resp.StatusCode == http.StatusNotModified {
+		return k6build.Artifact{}, k6build.ErrArtifactUnchanged
+	}
+
+	if resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get(api.QueuePositionHeader) != "" {
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrQueueFull, queueFullError(resp.Header))
+	}
+
+	// builds failed for reasons of the build service's environment (e.g. lack of space) include
+	// the error in the response. Other statuses may come from proxies
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusInsufficientStorage, http.StatusBadGateway:
+	default:
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, errors.New(resp.Status))
+	}
+
+	buildResponse := api.BuildResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, errors.New(resp.Status))
 		}
-		req.Header.Add("Authorization", fmt.Sprintf("%s %s", authType, r.auth))
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
 	}
 
-	// add custom headers
-	for h, v := range r.headers {
-		req.Header.Add(h, v)
+	if buildResponse.Error != nil {
+		return k6build.Artifact{}, codeError(buildResponse.Code, buildResponse.Error)
+	}
+
+	if r.publicKey != nil {
+		artifact := buildResponse.Artifact
+		err = signature.Verify(r.publicKey, artifact.ID, artifact.Checksum, artifact.Signature)
+		if err != nil {
+			return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
+		}
+	}
+
+	return buildResponse.Artifact, nil
+}
+
+// ResolveArtifact returns the ID, platform and resolved dependencies of the artifact that a build
+// with the same parameters would return, without building it.
+// Implements the k6build.ArtifactResolver interface.
+func (r *BuildClient) ResolveArtifact(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	platform = ExpandPlatform(platform)
+	marshaled, err := r.encodeBody(api.BuildRequest{
+		Platform:     platform,
+		K6Constrains: k6Constrains,
+		Dependencies: deps,
+	})
+	if err != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrInvalidRequest, err)
 	}
+	body := marshaled.Bytes()
 
-	resp, err := r.client.Do(req)
+	resp, err := r.do(ctx, func(srvURL *url.URL) (*http.Request, error) {
+		reqURL := srvURL.JoinPath("artifacts", "id")
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		if r.compress {
+			req.Header.Add("Content-Encoding", "gzip")
+		}
+
+		return req, nil
+	})
 	if err != nil {
 		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
 	}
@@ -121,19 +278,143 @@ func (r *BuildClient) Build(
 		_ = resp.Body.Close()
 	}()
 
+	// errors are reported in the response's body, if the endpoint is supported
+	idResponse := api.ArtifactIDResponse{}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&idResponse)
+	if decodeErr == nil && idResponse.Error != nil {
+		return k6build.Artifact{}, codeError(idResponse.Code, idResponse.Error)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, errors.New(resp.Status))
 	}
 
-	buildResponse := api.BuildResponse{}
-	err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+	if decodeErr != nil {
+		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, decodeErr)
+	}
+
+	return k6build.Artifact{
+		ID:           idResponse.ID,
+		Platform:     idResponse.Platform,
+		Dependencies: idResponse.Dependencies,
+	}, nil
+}
+
+// Capabilities returns the capabilities of the build service
+func (r *BuildClient) Capabilities(ctx context.Context) (api.Capabilities, error) {
+	resp, err := r.do(ctx, func(srvURL *url.URL) (*http.Request, error) {
+		reqURL := srvURL.JoinPath("capabilities")
+		return http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	})
 	if err != nil {
-		return k6build.Artifact{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
+		return api.Capabilities{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
 	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
-	if buildResponse.Error != nil {
-		return k6build.Artifact{}, buildResponse.Error
+	if resp.StatusCode != http.StatusOK {
+		return api.Capabilities{}, k6build.NewWrappedError(api.ErrRequestFailed, errors.New(resp.Status))
 	}
 
-	return buildResponse.Artifact, nil
+	capabilities := api.Capabilities{}
+	err = json.NewDecoder(resp.Body).Decode(&capabilities)
+	if err != nil {
+		return api.Capabilities{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
+	}
+
+	return capabilities, nil
+}
+
+// do sends the request created by newRequest to the build services, starting with the next one
+// in the round-robin and failing over to the others on connection errors
+func (r *BuildClient) do(
+	ctx context.Context,
+	newRequest func(srvURL *url.URL) (*http.Request, error),
+) (*http.Response, error) {
+	var err error
+	for _, ep := range r.endpoints.candidates() {
+		var req *http.Request
+		req, err = newRequest(ep.url)
+		if err != nil {
+			return nil, err
+		}
+		r.addHeaders(req)
+
+		var resp *http.Response
+		resp, err = r.client.Do(req)
+		if err == nil {
+			ep.succeeded()
+			return resp, nil
+		}
+
+		// the request was cancelled, not failed
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		ep.failed()
+	}
+
+	return nil, err
+}
+
+// encodeBody returns the json encoding of the request body, compressed if required
+func (r *BuildClient) encodeBody(body any) (*bytes.Buffer, error) {
+	buffer := &bytes.Buffer{}
+	if !r.compress {
+		err := json.NewEncoder(buffer).Encode(body)
+		return buffer, err
+	}
+
+	gz := gzip.NewWriter(buffer)
+	err := json.NewEncoder(gz).Encode(body)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer, nil
+}
+
+// addHeaders adds the user agent, authorization and custom headers to the request
+func (r *BuildClient) addHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", r.userAgent)
+
+	// add authorization header "Authorization: <type> <auth>"
+	if r.auth != "" {
+		authType := r.authType
+		if authType == "" {
+			authType = defaultAuthType
+		}
+		req.Header.Add("Authorization", fmt.Sprintf("%s %s", authType, r.auth))
+	}
+
+	// add custom headers
+	for h, v := range r.headers {
+		req.Header.Add(h, v)
+	}
+}
+
+// queueFullError returns the k6build.QueueFullError reported in the headers of a response to
+// a build rejected because the build queue is full
+func queueFullError(header http.Header) *k6build.QueueFullError {
+	position, _ := strconv.Atoi(header.Get(api.QueuePositionHeader))
+	wait, _ := time.ParseDuration(header.Get(api.EstimatedWaitHeader))
+
+	return &k6build.QueueFullError{Position: position, EstimatedWait: wait}
+}
+
+// codeError returns the error wrapped by the error defined in the api package for its code,
+// allowing the error to be checked with errors.Is (e.g. errors.Is(err, api.ErrCannotSatisfy))
+func codeError(code string, err *k6build.WrappedError) error {
+	codeErr := api.CodeError(code)
+	if codeErr == nil || errors.Is(err, codeErr) {
+		return err
+	}
+
+	return k6build.NewWrappedError(codeErr, err)
 }
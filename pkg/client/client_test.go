@@ -2,16 +2,26 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/grafana/k6build"
 	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6build/pkg/signature"
 )
 
 type testSrv struct {
@@ -39,6 +49,35 @@ func withValidateRequest() requestHandler {
 	}
 }
 
+func withGzipBody() requestHandler {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+		r.Body = body
+
+		return true
+	}
+}
+
+func withTimeoutCheck() requestHandler {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		timeout, err := time.ParseDuration(r.Header.Get(api.RequestTimeoutHeader))
+		if err != nil || timeout <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+		return true
+	}
+}
+
 func withAuthorizationCheck(authType string, auth string) requestHandler {
 	return func(w http.ResponseWriter, r *http.Request) bool {
 		authHeader := fmt.Sprintf("%s %s", authType, auth)
@@ -103,6 +142,9 @@ func TestRemote(t *testing.T) {
 		headers   map[string]string
 		auth      string
 		authType  string
+		userAgent string
+		compress  bool
+		timeout   time.Duration
 		handlers  []requestHandler
 		expectErr error
 	}{
@@ -119,6 +161,33 @@ func TestRemote(t *testing.T) {
 			},
 			expectErr: api.ErrBuildFailed,
 		},
+		{
+			title: "build error with code",
+			handlers: []requestHandler{
+				withResponse(http.StatusOK, api.BuildResponse{
+					Error: k6build.NewWrappedError(api.ErrBuildFailed, errors.New("cannot satisfy dependency")),
+					Code:  api.CodeCannotSatisfy,
+				}),
+			},
+			expectErr: api.ErrCannotSatisfy,
+		},
+		{
+			title: "build error with code keeps error",
+			handlers: []requestHandler{
+				withResponse(http.StatusOK, api.BuildResponse{
+					Error: k6build.NewWrappedError(api.ErrBuildFailed, errors.New("deadline exceeded")),
+					Code:  api.CodeTimeout,
+				}),
+			},
+			expectErr: api.ErrBuildFailed,
+		},
+		{
+			title: "artifact unchanged",
+			handlers: []requestHandler{
+				withResponse(http.StatusNotModified, api.BuildResponse{}),
+			},
+			expectErr: k6build.ErrArtifactUnchanged,
+		},
 		{
 			title:    "auth header",
 			auth:     "token",
@@ -154,6 +223,38 @@ func TestRemote(t *testing.T) {
 			},
 			expectErr: nil,
 		},
+		{
+			title: "default user agent",
+			handlers: []requestHandler{
+				withHeadersCheck(map[string]string{"User-Agent": k6build.UserAgent}),
+			},
+			expectErr: nil,
+		},
+		{
+			title:     "custom user agent",
+			userAgent: "custom-agent/v1.0.0",
+			handlers: []requestHandler{
+				withHeadersCheck(map[string]string{"User-Agent": "custom-agent/v1.0.0"}),
+			},
+			expectErr: nil,
+		},
+		{
+			title:    "compressed request",
+			compress: true,
+			handlers: []requestHandler{
+				withGzipBody(),
+				withValidateRequest(),
+			},
+			expectErr: nil,
+		},
+		{
+			title:   "request timeout",
+			timeout: time.Minute,
+			handlers: []requestHandler{
+				withTimeoutCheck(),
+			},
+			expectErr: nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -173,6 +274,130 @@ func TestRemote(t *testing.T) {
 					Headers:           tc.headers,
 					Authorization:     tc.auth,
 					AuthorizationType: tc.authType,
+					UserAgent:         tc.userAgent,
+					Compress:          tc.compress,
+				},
+			)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			ctx := context.TODO()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			_, err = client.Build(
+				ctx,
+				"linux/amd64",
+				"v0.1.0",
+				[]k6build.Dependency{{Name: "k6/x/test", Constraints: "*"}},
+			)
+
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	t.Parallel()
+
+	capabilities := api.Capabilities{
+		Platforms:  []string{"linux/amd64"},
+		CgoEnabled: false,
+		Catalog:    "https://example.com/catalog.json",
+	}
+
+	testCases := []struct {
+		title     string
+		status    int
+		expectErr error
+	}{
+		{
+			title:  "get capabilities",
+			status: http.StatusOK,
+		},
+		{
+			title:     "request failed",
+			status:    http.StatusInternalServerError,
+			expectErr: api.ErrRequestFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/capabilities" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Add("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(capabilities) //nolint:errchkjson
+			}))
+			defer srv.Close()
+
+			client, err := NewBuildServiceClient(BuildServiceClientConfig{URL: srv.URL})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			got, err := client.Capabilities(context.TODO())
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(capabilities, got) {
+				t.Fatalf("expected %v got %v", capabilities, got)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(testSrv{})
+	t.Cleanup(srv.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	testCases := []struct {
+		title     string
+		tlsConfig *tls.Config
+		expectErr error
+	}{
+		{
+			title:     "unknown server certificate",
+			tlsConfig: nil,
+			expectErr: api.ErrRequestFailed,
+		},
+		{
+			title:     "custom CA",
+			tlsConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			expectErr: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := NewBuildServiceClient(
+				BuildServiceClientConfig{
+					URL:       srv.URL,
+					TLSConfig: tc.tlsConfig,
 				},
 			)
 			if err != nil {
@@ -185,10 +410,342 @@ func TestRemote(t *testing.T) {
 				"v0.1.0",
 				[]k6build.Dependency{{Name: "k6/x/test", Constraints: "*"}},
 			)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	socket := filepath.Join(t.TempDir(), "k6build.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(testSrv{handlers: []requestHandler{withValidateRequest()}})
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	client, err := NewBuildServiceClient(BuildServiceClientConfig{URL: "unix://" + socket})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	_, err = client.Build(
+		context.TODO(),
+		"linux/amd64",
+		"v0.1.0",
+		[]k6build.Dependency{{Name: "k6/x/test", Constraints: "*"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+}
 
+func TestMultipleServers(t *testing.T) {
+	t.Parallel()
+
+	// a server that is not listening
+	unavailable := httptest.NewServer(http.NotFoundHandler())
+	unavailable.Close()
+
+	testCases := []struct {
+		title     string
+		down      []bool
+		requests  int
+		expect    []int
+		expectErr error
+	}{
+		{
+			title:    "balance requests",
+			down:     []bool{false, false},
+			requests: 4,
+			expect:   []int{2, 2},
+		},
+		{
+			title:    "fail over unavailable server",
+			down:     []bool{true, false},
+			requests: 4,
+			expect:   []int{0, 4},
+		},
+		{
+			title:     "all servers unavailable",
+			down:      []bool{true, true},
+			requests:  1,
+			expect:    []int{0, 0},
+			expectErr: api.ErrRequestFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			received := make([]int, len(tc.down))
+			urls := []string{}
+			for i, down := range tc.down {
+				if down {
+					urls = append(urls, unavailable.URL)
+					continue
+				}
+
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					received[i]++
+					w.Header().Add("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(api.Capabilities{}) //nolint:errchkjson
+				}))
+				defer srv.Close()
+
+				urls = append(urls, srv.URL)
+			}
+
+			client, err := NewBuildServiceClient(BuildServiceClientConfig{URL: urls[0], URLs: urls[1:]})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			for range tc.requests {
+				_, err = client.Capabilities(context.TODO())
+				if !errors.Is(err, tc.expectErr) {
+					t.Fatalf("expected %v got %v", tc.expectErr, err)
+				}
+			}
+
+			if !reflect.DeepEqual(received, tc.expect) {
+				t.Fatalf("expected requests %v got %v", tc.expect, received)
+			}
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "90")
+		w.Header().Set(api.QueuePositionHeader, "3")
+		w.Header().Set(api.EstimatedWaitHeader, "1m30s")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client, err := NewBuildServiceClient(BuildServiceClientConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	_, err = client.Build(context.TODO(), "linux/amd64", "v0.1.0", nil)
+	if !errors.Is(err, api.ErrQueueFull) || !errors.Is(err, k6build.ErrBuildQueueFull) {
+		t.Fatalf("expected %v got %v", api.ErrQueueFull, err)
+	}
+
+	queueErr := &k6build.QueueFullError{}
+	if !errors.As(err, &queueErr) {
+		t.Fatalf("expected a queue full error got %v", err)
+	}
+
+	expected := k6build.QueueFullError{Position: 3, EstimatedWait: 90 * time.Second}
+	if *queueErr != expected {
+		t.Fatalf("expected %v got %v", expected, *queueErr)
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		status    int
+		response  *api.BuildResponse
+		expectErr error
+	}{
+		{
+			title:  "insufficient storage",
+			status: http.StatusInsufficientStorage,
+			response: &api.BuildResponse{
+				Error: k6build.NewWrappedError(api.ErrInsufficientStorage, errors.New("no space left")),
+				Code:  api.CodeInsufficientStorage,
+			},
+			expectErr: api.ErrInsufficientStorage,
+		},
+		{
+			title:  "proxy authentication",
+			status: http.StatusBadGateway,
+			response: &api.BuildResponse{
+				Error: k6build.NewWrappedError(api.ErrProxyAuth, errors.New("403 Forbidden")),
+				Code:  api.CodeProxyAuth,
+			},
+			expectErr: api.ErrProxyAuth,
+		},
+		{
+			title:     "bad gateway without response",
+			status:    http.StatusBadGateway,
+			response:  nil,
+			expectErr: api.ErrRequestFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.status)
+				if tc.response != nil {
+					_ = json.NewEncoder(w).Encode(tc.response) //nolint:errchkjson
+				}
+			}))
+			defer srv.Close()
+
+			client, err := NewBuildServiceClient(BuildServiceClientConfig{URL: srv.URL})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			_, err = client.Build(context.TODO(), "linux/amd64", "v0.1.0", nil)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestSignatureVerification(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+
+	testCases := []struct {
+		title     string
+		publicKey ed25519.PublicKey
+		signature string
+		expectErr error
+	}{
+		{
+			title:     "valid signature",
+			publicKey: public,
+			signature: signature.Sign(private, "artifact", "checksum"),
+			expectErr: nil,
+		},
+		{
+			title:     "tampered checksum",
+			publicKey: public,
+			signature: signature.Sign(private, "artifact", "other"),
+			expectErr: signature.ErrInvalidSignature,
+		},
+		{
+			title:     "unsigned artifact",
+			publicKey: public,
+			signature: "",
+			expectErr: signature.ErrMissingSignature,
+		},
+		{
+			title:     "no public key",
+			publicKey: nil,
+			signature: "",
+			expectErr: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			artifact := k6build.Artifact{ID: "artifact", Checksum: "checksum", Signature: tc.signature}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_ = json.NewEncoder(w).Encode(api.BuildResponse{Artifact: artifact}) //nolint:errchkjson
+			}))
+			defer srv.Close()
+
+			client, err := NewBuildServiceClient(BuildServiceClientConfig{URL: srv.URL, PublicKey: tc.publicKey})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			_, err = client.Build(context.TODO(), "linux/amd64", "v0.1.0", nil)
 			if !errors.Is(err, tc.expectErr) {
 				t.Fatalf("expected %v got %v", tc.expectErr, err)
 			}
+
+			if tc.expectErr != nil && !errors.Is(err, api.ErrRequestFailed) {
+				t.Fatalf("expected %v got %v", api.ErrRequestFailed, err)
+			}
+		})
+	}
+}
+
+func TestResolveArtifact(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		status    int
+		response  api.ArtifactIDResponse
+		expectErr error
+	}{
+		{
+			title:    "resolve artifact",
+			status:   http.StatusOK,
+			response: api.ArtifactIDResponse{ID: "artifact", Dependencies: map[string]string{"k6": "v0.1.0"}},
+		},
+		{
+			title:  "cannot satisfy",
+			status: http.StatusBadRequest,
+			response: api.ArtifactIDResponse{
+				Error: k6build.NewWrappedError(api.ErrInvalidRequest, errors.New("cannot satisfy")),
+				Code:  api.CodeCannotSatisfy,
+			},
+			expectErr: api.ErrCannotSatisfy,
+		},
+		{
+			title:     "not supported",
+			status:    http.StatusNotFound,
+			expectErr: api.ErrRequestFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/artifacts/id" {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+
+				if tc.status == http.StatusNotFound {
+					http.NotFound(w, r)
+					return
+				}
+
+				w.Header().Add("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.response) //nolint:errchkjson
+			}))
+			defer srv.Close()
+
+			client, err := NewBuildServiceClient(BuildServiceClientConfig{URL: srv.URL})
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			artifact, err := client.ResolveArtifact(context.TODO(), "linux/amd64", "v0.1.0", nil)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr == nil && artifact.ID != tc.response.ID {
+				t.Fatalf("expected id %q got %q", tc.response.ID, artifact.ID)
+			}
 		})
 	}
 }
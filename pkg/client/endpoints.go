@@ -0,0 +1,84 @@
+package client
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultFailureCooldown is the default time a build service is avoided after a connection failure
+const DefaultFailureCooldown = 30 * time.Second
+
+// endpoint is a build service the client sends requests to
+type endpoint struct {
+	url      *url.URL
+	mtx      sync.Mutex
+	failures int
+	failedAt time.Time
+}
+
+// failed records a connection failure
+func (e *endpoint) failed() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.failures++
+	e.failedAt = time.Now()
+}
+
+// succeeded clears the failures
+func (e *endpoint) succeeded() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.failures = 0
+}
+
+// healthy returns true if the endpoint has not failed in the cooldown period
+func (e *endpoint) healthy(cooldown time.Duration) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	return e.failures == 0 || time.Since(e.failedAt) > cooldown
+}
+
+// endpoints balances the requests among the build services in a round-robin fashion
+type endpoints struct {
+	list     []*endpoint
+	next     atomic.Uint64
+	cooldown time.Duration
+}
+
+func newEndpoints(urls []*url.URL, cooldown time.Duration) *endpoints {
+	list := make([]*endpoint, 0, len(urls))
+	for _, u := range urls {
+		list = append(list, &endpoint{url: u})
+	}
+
+	if cooldown <= 0 {
+		cooldown = DefaultFailureCooldown
+	}
+
+	return &endpoints{list: list, cooldown: cooldown}
+}
+
+// candidates returns the endpoints in the order they should be tried for a request.
+// Starting from the next endpoint in the round-robin, the healthy endpoints are tried first and
+// then the ones that failed recently, in case they have recovered.
+func (e *endpoints) candidates() []*endpoint {
+	start := int(e.next.Add(1)-1) % len(e.list) //nolint:gosec
+
+	healthy := make([]*endpoint, 0, len(e.list))
+	failed := []*endpoint{}
+	for i := range e.list {
+		ep := e.list[(start+i)%len(e.list)]
+		if ep.healthy(e.cooldown) {
+			healthy = append(healthy, ep)
+		} else {
+			failed = append(failed, ep)
+		}
+	}
+
+	return append(healthy, failed...)
+}
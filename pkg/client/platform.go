@@ -0,0 +1,19 @@
+package client
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/grafana/k6build/pkg/api"
+)
+
+// ExpandPlatform returns the platform of the machine the client runs on (GOOS/GOARCH) if the
+// platform is an alias for it (api.PlatformNative or api.PlatformHost). Otherwise, the platform
+// is returned unchanged.
+func ExpandPlatform(platform string) string {
+	if api.IsPlatformAlias(platform) {
+		return fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	return platform
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestExpandPlatform(t *testing.T) {
+	t.Parallel()
+
+	native := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+
+	testCases := []struct {
+		platform string
+		expect   string
+	}{
+		{platform: "native", expect: native},
+		{platform: "host", expect: native},
+		{platform: "linux/arm64", expect: "linux/arm64"},
+		{platform: "", expect: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.platform, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ExpandPlatform(tc.platform); got != tc.expect {
+				t.Fatalf("expected %q got %q", tc.expect, got)
+			}
+		})
+	}
+}
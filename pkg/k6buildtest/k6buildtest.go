@@ -0,0 +1,94 @@
+// Package k6buildtest offers utilities for testing code that uses a k6build.BuildService
+package k6buildtest
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/grafana/k6build"
+)
+
+// BuildCall records the arguments of a call to the FakeBuildService
+type BuildCall struct {
+	Platform     string
+	K6Constrains string
+	Dependencies []k6build.Dependency
+	// Opts passed in the context of the call (see k6build.WithBuildOpts)
+	Opts k6build.BuildOpts
+}
+
+// BuildFunc returns the result of a call to the FakeBuildService
+type BuildFunc func(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error)
+
+// FakeBuildService is a k6build.BuildService that returns canned results and records the calls.
+// It is safe for concurrent use.
+type FakeBuildService struct {
+	// Artifact returned by the calls
+	Artifact k6build.Artifact
+	// Err returned by the calls. If not nil, Artifact is ignored
+	Err error
+	// BuildFunc returns the result of the calls. If not nil, Artifact and Err are ignored
+	BuildFunc BuildFunc
+
+	mtx   sync.Mutex
+	calls []BuildCall
+}
+
+// NewFakeBuildService returns a FakeBuildService returning the artifact
+func NewFakeBuildService(artifact k6build.Artifact) *FakeBuildService {
+	return &FakeBuildService{Artifact: artifact}
+}
+
+// NewFailingBuildService returns a FakeBuildService returning the error
+func NewFailingBuildService(err error) *FakeBuildService {
+	return &FakeBuildService{Err: err}
+}
+
+// Build records the call and returns the configured result
+func (f *FakeBuildService) Build(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	f.mtx.Lock()
+	f.calls = append(f.calls, BuildCall{
+		Platform:     platform,
+		K6Constrains: k6Constrains,
+		Dependencies: slices.Clone(deps),
+		Opts:         k6build.BuildOptsFromContext(ctx),
+	})
+	f.mtx.Unlock()
+
+	if f.BuildFunc != nil {
+		return f.BuildFunc(ctx, platform, k6Constrains, deps)
+	}
+
+	if f.Err != nil {
+		return k6build.Artifact{}, f.Err
+	}
+
+	return f.Artifact, nil
+}
+
+// Calls returns the calls received, in order
+func (f *FakeBuildService) Calls() []BuildCall {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return slices.Clone(f.calls)
+}
+
+// Reset clears the calls received
+func (f *FakeBuildService) Reset() {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.calls = nil
+}
@@ -0,0 +1,79 @@
+package k6buildtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/k6build"
+)
+
+func TestFakeBuildService(t *testing.T) {
+	t.Parallel()
+
+	artifact := k6build.Artifact{ID: "artifact", Platform: "linux/amd64"}
+
+	testCases := []struct {
+		title     string
+		fake      *FakeBuildService
+		expect    k6build.Artifact
+		expectErr error
+	}{
+		{
+			title:  "return artifact",
+			fake:   NewFakeBuildService(artifact),
+			expect: artifact,
+		},
+		{
+			title:     "return error",
+			fake:      NewFailingBuildService(k6build.ErrBuildFailed),
+			expectErr: k6build.ErrBuildFailed,
+		},
+		{
+			title: "build function",
+			fake: &FakeBuildService{
+				Artifact: artifact,
+				BuildFunc: func(_ context.Context, platform string, _ string, _ []k6build.Dependency) (k6build.Artifact, error) {
+					return k6build.Artifact{ID: "custom", Platform: platform}, nil
+				},
+			},
+			expect: k6build.Artifact{ID: "custom", Platform: "linux/amd64"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			deps := []k6build.Dependency{{Name: "k6/x/ext", Constraints: "*"}}
+			ctx := k6build.WithBuildOpts(context.TODO(), k6build.BuildOpts{NoCache: true})
+
+			got, err := tc.fake.Build(ctx, "linux/amd64", "v0.1.0", deps)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, got)
+			}
+
+			expectCalls := []BuildCall{
+				{
+					Platform:     "linux/amd64",
+					K6Constrains: "v0.1.0",
+					Dependencies: deps,
+					Opts:         k6build.BuildOpts{NoCache: true},
+				},
+			}
+			if calls := tc.fake.Calls(); !reflect.DeepEqual(calls, expectCalls) {
+				t.Fatalf("expected calls %v got %v", expectCalls, calls)
+			}
+
+			tc.fake.Reset()
+			if calls := tc.fake.Calls(); len(calls) != 0 {
+				t.Fatalf("expected no calls after reset got %v", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/grafana/k6build"
+)
+
+const (
+	// DefaultDynamoLease is the default time a lock is valid without being renewed.
+	// Locks are renewed while held, so it only limits the time a lock is kept after its holder
+	// fails without releasing it.
+	DefaultDynamoLease = 30 * time.Second
+
+	// DefaultDynamoBackoff is the default delay between attempts to obtain a lock held by another holder
+	DefaultDynamoBackoff = 250 * time.Millisecond
+
+	// DefaultDynamoGrace is the default time an expired lock is still considered held, to tolerate
+	// differences between the clocks of the holders
+	DefaultDynamoGrace = 5 * time.Second
+
+	// attributes of the lock items. The table's partition key must be the id (string).
+	// The expiration can be used as the table's TTL attribute for removing abandoned locks.
+	idAttribute      = "id"
+	ownerAttribute   = "owner"
+	expiresAttribute = "expires"
+)
+
+// DynamoConfig defines the configuration of a DynamoLock
+type DynamoConfig struct {
+	// Table is the name of the DynamoDB table. Its partition key must be a string attribute named "id"
+	Table string
+	// DynamoDB client. If not specified, a client is created using the default AWS configuration
+	Client *dynamodb.Client
+	// AWS endpoint (used for testing)
+	Endpoint string
+	// AWS Region
+	Region string
+	// Lease is the time the lock is valid without being renewed. Defaults to DefaultDynamoLease
+	Lease time.Duration
+	// Backoff is the delay between attempts to obtain a held lock. Defaults to DefaultDynamoBackoff
+	Backoff time.Duration
+	// Grace is the time an expired lock is still considered held, to tolerate differences between
+	// the clocks of the holders. Defaults to DefaultDynamoGrace
+	Grace time.Duration
+	// MaxLease is the maximum time a lock is renewed. After it, the lock expires even if its holder
+	// has not released it, so a stuck holder doesn't prevent building the artifact.
+	// If 0, the lock is renewed until released.
+	MaxLease time.Duration
+}
+
+// DynamoLock is a Lock shared by the processes using the same DynamoDB table.
+// A lock is an item with the artifact's id, the holder's random token as owner and an
+// expiration. It is created only if the item doesn't exist or has expired (conditional write).
+// While held, its expiration is extended in background.
+type DynamoLock struct {
+	client   *dynamodb.Client
+	table    string
+	lease    time.Duration
+	backoff  time.Duration
+	grace    time.Duration
+	maxLease time.Duration
+	now      func() time.Time
+}
+
+// NewDynamoLock returns a Lock kept in a DynamoDB table
+func NewDynamoLock(conf DynamoConfig) (*DynamoLock, error) {
+	if conf.Table == "" {
+		return nil, fmt.Errorf("%w: table name cannot be empty", ErrInitializingLock)
+	}
+
+	if conf.Lease < 0 || conf.Backoff < 0 || conf.Grace < 0 || conf.MaxLease < 0 {
+		return nil, fmt.Errorf("%w: lease, backoff, grace and max lease cannot be negative", ErrInitializingLock)
+	}
+
+	client := conf.Client
+	if client == nil {
+		awsOpts := []func(*config.LoadOptions) error{}
+		if conf.Region != "" {
+			awsOpts = append(awsOpts, config.WithRegion(conf.Region))
+		}
+		cfg, err := config.LoadDefaultConfig(context.TODO(), awsOpts...)
+		if err != nil {
+			return nil, k6build.NewWrappedError(ErrInitializingLock, err)
+		}
+
+		dynamoOpts := []func(*dynamodb.Options){}
+		if conf.Endpoint != "" {
+			dynamoOpts = append(dynamoOpts, func(o *dynamodb.Options) {
+				o.BaseEndpoint = aws.String(conf.Endpoint)
+			})
+		}
+		client = dynamodb.NewFromConfig(cfg, dynamoOpts...)
+	}
+
+	lease := conf.Lease
+	if lease == 0 {
+		lease = DefaultDynamoLease
+	}
+
+	backoff := conf.Backoff
+	if backoff == 0 {
+		backoff = DefaultDynamoBackoff
+	}
+
+	grace := conf.Grace
+	if grace == 0 {
+		grace = DefaultDynamoGrace
+	}
+
+	return &DynamoLock{
+		client:   client,
+		table:    conf.Table,
+		lease:    lease,
+		backoff:  backoff,
+		grace:    grace,
+		maxLease: conf.MaxLease,
+		now:      time.Now,
+	}, nil
+}
+
+// Lock obtains the lock for the id, retrying after the backoff while it is held by another holder
+func (d *DynamoLock) Lock(ctx context.Context, id string) (func(), error) {
+	for {
+		release, locked, err := d.Try(ctx, id)
+		if err != nil || locked {
+			return release, err
+		}
+
+		select {
+		case <-time.After(d.backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Try obtains the lock for the id if it is not held
+func (d *DynamoLock) Try(ctx context.Context, id string) (func(), bool, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, false, k6build.NewWrappedError(ErrLocking, err)
+	}
+	token := hex.EncodeToString(random)
+
+	now := d.now()
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item: map[string]types.AttributeValue{
+			idAttribute:      &types.AttributeValueMemberS{Value: id},
+			ownerAttribute:   &types.AttributeValueMemberS{Value: token},
+			expiresAttribute: epoch(now.Add(d.lease)),
+		},
+		// the lock doesn't exist or expired more than the grace period ago
+		ConditionExpression:      aws.String("attribute_not_exists(#id) OR #expires < :expired"),
+		ExpressionAttributeNames: map[string]string{"#id": idAttribute, "#expires": expiresAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":expired": epoch(now.Add(-d.grace)),
+		},
+	})
+	if err != nil {
+		if conditionFailed(err) {
+			return nil, false, nil
+		}
+		return nil, false, k6build.NewWrappedError(ErrLocking, err)
+	}
+
+	return d.hold(id, token, now), true, nil
+}
+
+// hold extends the expiration of the lock in background and returns the function for releasing it
+func (d *DynamoLock) hold(id string, token string, acquired time.Time) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(d.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			now := d.now()
+			if d.maxLease > 0 && now.Sub(acquired) >= d.maxLease {
+				return
+			}
+
+			_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:           aws.String(d.table),
+				Key:                 map[string]types.AttributeValue{idAttribute: &types.AttributeValueMemberS{Value: id}},
+				UpdateExpression:    aws.String("SET #expires = :expires"),
+				ConditionExpression: aws.String("#owner = :owner"),
+				ExpressionAttributeNames: map[string]string{
+					"#expires": expiresAttribute,
+					"#owner":   ownerAttribute,
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":expires": epoch(now.Add(d.lease)),
+					":owner":   &types.AttributeValueMemberS{Value: token},
+				},
+			})
+			// the lock expired and may be held by another holder. Retry on other errors, as
+			// the lease may not have expired yet
+			if conditionFailed(err) {
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+
+			// if the lock cannot be released, it expires after the lease. If it is held by another
+			// holder, the condition fails and it is kept.
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), d.lease)
+			defer releaseCancel()
+			_, _ = d.client.DeleteItem(releaseCtx, &dynamodb.DeleteItemInput{
+				TableName:                aws.String(d.table),
+				Key:                      map[string]types.AttributeValue{idAttribute: &types.AttributeValueMemberS{Value: id}},
+				ConditionExpression:      aws.String("#owner = :owner"),
+				ExpressionAttributeNames: map[string]string{"#owner": ownerAttribute},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":owner": &types.AttributeValueMemberS{Value: token},
+				},
+			})
+		})
+	}
+}
+
+// epoch returns the time as seconds since the epoch, as required by the DynamoDB TTL attributes
+func epoch(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
+
+func conditionFailed(err error) bool {
+	var conditionErr *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionErr)
+}
@@ -0,0 +1,319 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const testTable = "k6build-locks"
+
+type attributes map[string]map[string]string
+
+// dynamoServer is a minimal implementation of the DynamoDB API that supports the requests
+// made by the DynamoLock
+type dynamoServer struct {
+	mtx   sync.Mutex
+	items map[string]attributes
+	url   string
+}
+
+func newDynamoServer(t *testing.T) *dynamoServer {
+	t.Helper()
+
+	srv := &dynamoServer{items: map[string]attributes{}}
+	httpSrv := httptest.NewServer(srv)
+	t.Cleanup(httpSrv.Close)
+	srv.url = httpSrv.URL
+
+	return srv
+}
+
+func (s *dynamoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	req := struct {
+		TableName                 string
+		Item                      attributes
+		Key                       attributes
+		ConditionExpression       string
+		UpdateExpression          string
+		ExpressionAttributeValues attributes
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TableName != testTable {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+	values := req.ExpressionAttributeValues
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+	switch operation {
+	case "PutItem":
+		id := req.Item[idAttribute]["S"]
+		if item, exists := s.items[id]; exists && number(item[expiresAttribute]) >= number(values[":expired"]) {
+			conditionalCheckFailed(w)
+			return
+		}
+		s.items[id] = req.Item
+	case "UpdateItem":
+		id := req.Key[idAttribute]["S"]
+		item, exists := s.items[id]
+		if !exists || item[ownerAttribute]["S"] != values[":owner"]["S"] {
+			conditionalCheckFailed(w)
+			return
+		}
+		item[expiresAttribute] = values[":expires"]
+	case "DeleteItem":
+		id := req.Key[idAttribute]["S"]
+		item, exists := s.items[id]
+		if !exists || item[ownerAttribute]["S"] != values[":owner"]["S"] {
+			conditionalCheckFailed(w)
+			return
+		}
+		delete(s.items, id)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, _ = w.Write([]byte("{}"))
+}
+
+func number(value map[string]string) int64 {
+	n, _ := strconv.ParseInt(value["N"], 10, 64)
+	return n
+}
+
+func conditionalCheckFailed(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write([]byte(
+		`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",` +
+			`"message":"The conditional request failed"}`,
+	))
+}
+
+// set sets the lock as if held by another holder
+func (s *dynamoServer) set(id string, owner string, expires time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.items[id] = attributes{
+		idAttribute:      {"S": id},
+		ownerAttribute:   {"S": owner},
+		expiresAttribute: {"N": fmt.Sprintf("%d", expires.Unix())},
+	}
+}
+
+func (s *dynamoServer) item(id string) attributes {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	item, exists := s.items[id]
+	if !exists {
+		return nil
+	}
+
+	copied := attributes{}
+	for name, value := range item {
+		copied[name] = value
+	}
+
+	return copied
+}
+
+func newTestDynamoLock(t *testing.T, srv *dynamoServer, lease time.Duration) *DynamoLock {
+	t.Helper()
+
+	client := dynamodb.New(dynamodb.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.url),
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+
+	lock, err := NewDynamoLock(DynamoConfig{
+		Table:   testTable,
+		Client:  client,
+		Lease:   lease,
+		Backoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("creating lock %v", err)
+	}
+
+	return lock
+}
+
+func TestDynamoLockConcurrency(t *testing.T) {
+	t.Parallel()
+
+	srv := newDynamoServer(t)
+
+	holders := atomic.Int32{}
+	errs := make(chan error, 10)
+	wg := sync.WaitGroup{}
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// each goroutine has its own lock, as different processes would
+			lock := newTestDynamoLock(t, srv, time.Minute)
+
+			release, err := lock.Lock(context.TODO(), "artifact")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer release()
+
+			if holders.Add(1) > 1 {
+				errs <- fmt.Errorf("lock %d obtained while held", i)
+			}
+			time.Sleep(10 * time.Millisecond)
+			holders.Add(-1)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if item := srv.item("artifact"); item != nil {
+		t.Fatalf("expected the lock to be released")
+	}
+}
+
+func TestDynamoLockExpiry(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title string
+		test  func(t *testing.T, srv *dynamoServer, lock *DynamoLock)
+	}{
+		{
+			title: "lock of a failed holder expires",
+			test: func(t *testing.T, srv *dynamoServer, lock *DynamoLock) {
+				srv.set("artifact", "failed holder", time.Now().Add(-time.Minute))
+
+				release, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || !locked {
+					t.Fatalf("expected the lock to be obtained (error %v)", err)
+				}
+				release()
+			},
+		},
+		{
+			title: "expired lock is held during the grace period",
+			test: func(t *testing.T, srv *dynamoServer, lock *DynamoLock) {
+				srv.set("artifact", "other holder", time.Now().Add(-time.Second))
+
+				_, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || locked {
+					t.Fatalf("expected the lock to be held (error %v)", err)
+				}
+
+				// after the grace period
+				lock.now = func() time.Time { return time.Now().Add(DefaultDynamoGrace) }
+				release, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || !locked {
+					t.Fatalf("expected the lock to be obtained (error %v)", err)
+				}
+				release()
+			},
+		},
+		{
+			title: "lock is renewed while held",
+			test: func(t *testing.T, srv *dynamoServer, lock *DynamoLock) {
+				release, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || !locked {
+					t.Fatalf("expected the lock to be obtained (error %v)", err)
+				}
+				defer release()
+
+				expires := number(srv.item("artifact")[expiresAttribute])
+				time.Sleep(1500 * time.Millisecond)
+
+				if renewed := number(srv.item("artifact")[expiresAttribute]); renewed <= expires {
+					t.Fatalf("expected the lock to be renewed")
+				}
+			},
+		},
+		{
+			title: "lock is not renewed after the max lease",
+			test: func(t *testing.T, srv *dynamoServer, lock *DynamoLock) {
+				lock.maxLease = time.Millisecond
+
+				release, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || !locked {
+					t.Fatalf("expected the lock to be obtained (error %v)", err)
+				}
+				defer release()
+
+				expires := number(srv.item("artifact")[expiresAttribute])
+				time.Sleep(1500 * time.Millisecond)
+
+				if renewed := number(srv.item("artifact")[expiresAttribute]); renewed != expires {
+					t.Fatalf("expected the lock not to be renewed")
+				}
+			},
+		},
+		{
+			title: "expired lock held by another holder is not released",
+			test: func(t *testing.T, srv *dynamoServer, lock *DynamoLock) {
+				release, err := lock.Lock(context.TODO(), "artifact")
+				if err != nil {
+					t.Fatalf("obtaining lock %v", err)
+				}
+
+				// the lock expired (e.g. the holder couldn't renew it) and was obtained by another holder
+				srv.set("artifact", "other holder", time.Now().Add(time.Minute))
+				release()
+
+				if owner := srv.item("artifact")[ownerAttribute]["S"]; owner != "other holder" {
+					t.Fatalf("expected the lock to be kept by the other holder got %q", owner)
+				}
+			},
+		},
+		{
+			title: "waiting for lock is cancelled",
+			test: func(t *testing.T, srv *dynamoServer, lock *DynamoLock) {
+				srv.set("artifact", "other holder", time.Now().Add(time.Minute))
+
+				ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+				defer cancel()
+
+				_, err := lock.Lock(ctx, "artifact")
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newDynamoServer(t)
+			tc.test(t, srv, newTestDynamoLock(t, srv, 3*time.Second))
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// Package lock implements the locks used for preventing concurrent builds of the same artifact
+package lock
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrLocking is returned when the lock cannot be obtained for reasons other than being held
+// (e.g. the lock service is not available)
+var ErrLocking = errors.New("obtaining lock")
+
+// Lock is a set of locks identified by the id of the artifacts they protect.
+// The functions returned for releasing the locks must be called once.
+type Lock interface {
+	// Lock obtains the lock for the id, waiting until it is released by its holder.
+	// Returns the context's error if the context is cancelled while waiting.
+	Lock(ctx context.Context, id string) (func(), error)
+	// Try obtains the lock for the id if it is not held. Returns false if it is held.
+	Try(ctx context.Context, id string) (func(), bool, error)
+}
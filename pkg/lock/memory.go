@@ -0,0 +1,55 @@
+package lock
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryLock is a Lock held in memory, which only prevents concurrent builds within the process
+type MemoryLock struct {
+	mutexes sync.Map
+}
+
+// NewMemoryLock returns a Lock held in memory
+func NewMemoryLock() *MemoryLock {
+	return &MemoryLock{}
+}
+
+// Lock obtains the lock for the id, waiting until it is released by its holder.
+// When the lock is released it is also removed. Subsequent calls will get another lock on the same id.
+func (m *MemoryLock) Lock(ctx context.Context, id string) (func(), error) {
+	lock := m.get(id)
+
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return m.release(id, lock), nil
+}
+
+// Try obtains the lock for the id if it is not held
+func (m *MemoryLock) Try(_ context.Context, id string) (func(), bool, error) {
+	lock := m.get(id)
+
+	select {
+	case lock <- struct{}{}:
+		return m.release(id, lock), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+func (m *MemoryLock) get(id string) chan struct{} {
+	value, _ := m.mutexes.LoadOrStore(id, make(chan struct{}, 1))
+	lock, _ := value.(chan struct{})
+	return lock
+}
+
+func (m *MemoryLock) release(id string, lock chan struct{}) func() {
+	return func() {
+		m.mutexes.Delete(id)
+		<-lock
+	}
+}
@@ -0,0 +1,51 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryLock(t *testing.T) {
+	t.Parallel()
+
+	lock := NewMemoryLock()
+
+	release, locked, err := lock.Try(context.TODO(), "artifact")
+	if err != nil || !locked {
+		t.Fatalf("expected the lock to be obtained (error %v)", err)
+	}
+
+	_, locked, _ = lock.Try(context.TODO(), "artifact")
+	if locked {
+		t.Fatalf("expected the lock to be held")
+	}
+
+	// other ids are not affected
+	other, locked, _ := lock.Try(context.TODO(), "other")
+	if !locked {
+		t.Fatalf("expected the lock to be obtained")
+	}
+	other()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = lock.Lock(ctx, "artifact"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+
+	obtained := make(chan func())
+	go func() {
+		waiting, _ := lock.Lock(context.TODO(), "artifact")
+		obtained <- waiting
+	}()
+
+	release()
+	select {
+	case waiting := <-obtained:
+		waiting()
+	case <-time.After(time.Second):
+		t.Fatalf("expected the lock to be obtained after being released")
+	}
+}
@@ -0,0 +1,171 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/k6build"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultRedisLease is the default time a lock is kept by Redis without being renewed.
+	// Locks are renewed while held, so it only limits the time a lock is kept after its holder
+	// fails without releasing it.
+	DefaultRedisLease = 30 * time.Second
+
+	// DefaultRedisBackoff is the default delay between attempts to obtain a lock held by another holder
+	DefaultRedisBackoff = 100 * time.Millisecond
+
+	// prefix of the keys of the locks
+	redisKeyPrefix = "k6build:lock:"
+)
+
+// scripts for renewing and releasing the locks only if they are still held by the holder (the key
+// has the holder's token), as the lock may have expired and been obtained by another holder
+var (
+	renewScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then ` +
+		`return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+	releaseScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then ` +
+		`return redis.call("del", KEYS[1]) else return 0 end`)
+)
+
+// ErrInitializingLock is returned when the lock cannot be created
+var ErrInitializingLock = errors.New("initializing lock")
+
+// RedisConfig defines the configuration of a RedisLock
+type RedisConfig struct {
+	// Addr is the address of the Redis server (host:port)
+	Addr string
+	// Password used for authenticating with the Redis server, if required
+	Password string
+	// Lease is the time the lock is kept by Redis without being renewed. Defaults to DefaultRedisLease
+	Lease time.Duration
+	// Backoff is the delay between attempts to obtain a held lock. Defaults to DefaultRedisBackoff
+	Backoff time.Duration
+}
+
+// RedisLock is a Lock shared by the processes using the same Redis server.
+// A lock is a key set only if it doesn't exist, with the holder's random token as value and
+// a lease as expiration. While held, the lease is renewed in background.
+type RedisLock struct {
+	client  *redis.Client
+	lease   time.Duration
+	backoff time.Duration
+}
+
+// NewRedisLock returns a Lock kept in a Redis server
+func NewRedisLock(config RedisConfig) (*RedisLock, error) {
+	if config.Addr == "" {
+		return nil, fmt.Errorf("%w: redis address cannot be empty", ErrInitializingLock)
+	}
+
+	if config.Lease < 0 || config.Backoff < 0 {
+		return nil, fmt.Errorf("%w: lease and backoff cannot be negative", ErrInitializingLock)
+	}
+
+	lease := config.Lease
+	if lease == 0 {
+		lease = DefaultRedisLease
+	}
+
+	backoff := config.Backoff
+	if backoff == 0 {
+		backoff = DefaultRedisBackoff
+	}
+
+	return &RedisLock{
+		client: redis.NewClient(&redis.Options{
+			Addr:     config.Addr,
+			Password: config.Password,
+		}),
+		lease:   lease,
+		backoff: backoff,
+	}, nil
+}
+
+// Lock obtains the lock for the id, retrying after the backoff while it is held by another holder
+func (r *RedisLock) Lock(ctx context.Context, id string) (func(), error) {
+	for {
+		release, locked, err := r.Try(ctx, id)
+		if err != nil || locked {
+			return release, err
+		}
+
+		select {
+		case <-time.After(r.backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Try obtains the lock for the id if it is not held
+func (r *RedisLock) Try(ctx context.Context, id string) (func(), bool, error) {
+	key := redisKeyPrefix + id
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, false, k6build.NewWrappedError(ErrLocking, err)
+	}
+	token := hex.EncodeToString(random)
+
+	locked, err := r.client.SetNX(ctx, key, token, r.lease).Result()
+	if err != nil {
+		return nil, false, k6build.NewWrappedError(ErrLocking, err)
+	}
+
+	// the key exists
+	if !locked {
+		return nil, false, nil
+	}
+
+	return r.hold(key, token), true, nil
+}
+
+// hold renews the lease of the lock in background and returns the function for releasing it
+func (r *RedisLock) hold(key string, token string) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(r.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			renewed, err := renewScript.Run(ctx, r.client, []string{key}, token, r.lease.Milliseconds()).Int64()
+			// the lock expired and may be held by another holder. Retry on other errors, as
+			// the lease may not have expired yet
+			if err == nil && renewed == 0 {
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+
+			// if the lock cannot be released, it expires after the lease
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), r.lease)
+			defer releaseCancel()
+			_ = releaseScript.Run(releaseCtx, r.client, []string{key}, token).Err()
+		})
+	}
+}
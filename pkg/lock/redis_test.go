@@ -0,0 +1,271 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// redisServer is an in-memory Redis server. The keys expire only when the server's clock is
+// fast-forwarded (see miniredis.FastForward)
+type redisServer struct {
+	*miniredis.Miniredis
+	addr string
+}
+
+func newRedisServer(t *testing.T, password string) *redisServer {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+	if password != "" {
+		srv.RequireAuth(password)
+	}
+
+	return &redisServer{Miniredis: srv, addr: srv.Addr()}
+}
+
+// set sets the key as if held by another holder
+func (s *redisServer) set(key string, value string, lease time.Duration) {
+	_ = s.Set(redisKeyPrefix+key, value)
+	s.SetTTL(redisKeyPrefix+key, lease)
+}
+
+func (s *redisServer) value(key string) string {
+	value, _ := s.Get(redisKeyPrefix + key)
+	return value
+}
+
+func TestRedisLockConcurrency(t *testing.T) {
+	t.Parallel()
+
+	srv := newRedisServer(t, "")
+
+	holders := atomic.Int32{}
+	errs := make(chan error, 10)
+	wg := sync.WaitGroup{}
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// each goroutine has its own lock, as different processes would
+			lock, err := NewRedisLock(RedisConfig{Addr: srv.addr, Backoff: 5 * time.Millisecond})
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			release, err := lock.Lock(context.TODO(), "artifact")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer release()
+
+			if holders.Add(1) > 1 {
+				errs <- fmt.Errorf("lock %d obtained while held", i)
+			}
+			time.Sleep(10 * time.Millisecond)
+			holders.Add(-1)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if value := srv.value("artifact"); value != "" {
+		t.Fatalf("expected the lock to be released")
+	}
+}
+
+func TestRedisLockExpiry(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title string
+		test  func(t *testing.T, srv *redisServer, lock *RedisLock)
+	}{
+		{
+			title: "lock of a failed holder expires",
+			test: func(t *testing.T, srv *redisServer, lock *RedisLock) {
+				srv.set("artifact", "failed holder", 100*time.Millisecond)
+
+				_, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || locked {
+					t.Fatalf("expected the lock to be held (error %v)", err)
+				}
+
+				srv.FastForward(100 * time.Millisecond)
+
+				ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+				defer cancel()
+
+				release, err := lock.Lock(ctx, "artifact")
+				if err != nil {
+					t.Fatalf("expected the lock to expire %v", err)
+				}
+				release()
+			},
+		},
+		{
+			title: "lock is renewed while held",
+			test: func(t *testing.T, srv *redisServer, lock *RedisLock) {
+				release, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || !locked {
+					t.Fatalf("expected the lock to be obtained (error %v)", err)
+				}
+				defer release()
+
+				// hold the lock longer than its lease
+				for range 4 {
+					time.Sleep(50 * time.Millisecond)
+					srv.FastForward(50 * time.Millisecond)
+				}
+
+				_, locked, err = lock.Try(context.TODO(), "artifact")
+				if err != nil || locked {
+					t.Fatalf("expected the lock to be held (error %v)", err)
+				}
+			},
+		},
+		{
+			title: "released lock can be obtained",
+			test: func(t *testing.T, _ *redisServer, lock *RedisLock) {
+				release, err := lock.Lock(context.TODO(), "artifact")
+				if err != nil {
+					t.Fatalf("obtaining lock %v", err)
+				}
+				release()
+				// releasing twice has no effect
+				release()
+
+				release, locked, err := lock.Try(context.TODO(), "artifact")
+				if err != nil || !locked {
+					t.Fatalf("expected the lock to be obtained (error %v)", err)
+				}
+				release()
+			},
+		},
+		{
+			title: "expired lock held by another holder is not released",
+			test: func(t *testing.T, srv *redisServer, lock *RedisLock) {
+				release, err := lock.Lock(context.TODO(), "artifact")
+				if err != nil {
+					t.Fatalf("obtaining lock %v", err)
+				}
+
+				// the lock expired (e.g. the holder couldn't renew it) and was obtained by another holder
+				srv.set("artifact", "other holder", time.Minute)
+				release()
+
+				if value := srv.value("artifact"); value != "other holder" {
+					t.Fatalf("expected the lock to be kept by the other holder got %q", value)
+				}
+			},
+		},
+		{
+			title: "waiting for lock is cancelled",
+			test: func(t *testing.T, srv *redisServer, lock *RedisLock) {
+				srv.set("artifact", "other holder", time.Minute)
+
+				ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+				defer cancel()
+
+				_, err := lock.Lock(ctx, "artifact")
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newRedisServer(t, "")
+			lock, err := NewRedisLock(RedisConfig{
+				Addr:    srv.addr,
+				Lease:   60 * time.Millisecond,
+				Backoff: 10 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("creating lock %v", err)
+			}
+
+			tc.test(t, srv, lock)
+		})
+	}
+}
+
+func TestRedisLockErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := newRedisServer(t, "secret")
+
+	// a closed listener's address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening %v", err)
+	}
+	unavailable := listener.Addr().String()
+	_ = listener.Close()
+
+	testCases := []struct {
+		title     string
+		config    RedisConfig
+		expectErr error
+	}{
+		{
+			title:     "authenticated",
+			config:    RedisConfig{Addr: srv.addr, Password: "secret"},
+			expectErr: nil,
+		},
+		{
+			title:     "wrong password",
+			config:    RedisConfig{Addr: srv.addr, Password: "wrong"},
+			expectErr: ErrLocking,
+		},
+		{
+			title:     "server unavailable",
+			config:    RedisConfig{Addr: unavailable},
+			expectErr: ErrLocking,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			lock, err := NewRedisLock(tc.config)
+			if err != nil {
+				t.Fatalf("creating lock %v", err)
+			}
+
+			release, _, err := lock.Try(context.TODO(), strings.ReplaceAll(tc.title, " ", "-"))
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if release != nil {
+				release()
+			}
+		})
+	}
+
+	_, err = NewRedisLock(RedisConfig{})
+	if !errors.Is(err, ErrInitializingLock) {
+		t.Fatalf("expected %v got %v", ErrInitializingLock, err)
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/downloader"
+)
+
+const (
+	formatTarGz = "tar.gz"
+	formatZip   = "zip"
+
+	// names of the files in the archive
+	archiveBinary   = "k6"
+	archiveManifest = "manifest.json"
+)
+
+// serveArchive returns an archive in the given format with the artifact's binary
+// and a manifest with the artifact's metadata
+func (p *DownloadProxy) serveArchive(w http.ResponseWriter, r *http.Request, object store.Object, format string) {
+	content, err := downloader.Read(r.Context(), p.client, p.store, object)
+	if err != nil {
+		p.log.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	manifest, err := json.MarshalIndent(
+		k6build.Artifact{
+			ID:       object.ID,
+			Checksum: object.Checksum,
+		},
+		"",
+		"  ",
+	)
+	if err != nil {
+		p.log.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	modTime := object.CreatedAt
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	switch format {
+	case formatTarGz:
+		// tar requires the size of the binary in advance
+		spool, size, err := spoolContent(content)
+		if err != nil {
+			p.log.Error(err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"k6-%s.tar.gz\"", object.ID))
+		w.WriteHeader(http.StatusOK)
+
+		err = writeTarGz(w, spool, size, manifest, modTime)
+		if err != nil {
+			p.log.Error("writing archive", "id", object.ID, "error", err.Error())
+		}
+	case formatZip:
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"k6-%s.zip\"", object.ID))
+		w.WriteHeader(http.StatusOK)
+
+		err = writeZip(w, content, manifest, modTime)
+		if err != nil {
+			p.log.Error("writing archive", "id", object.ID, "error", err.Error())
+		}
+	}
+}
+
+// spoolContent copies the content to a temporary file and returns it positioned at the start
+// together with the size of the content
+func spoolContent(content io.Reader) (*os.File, int64, error) {
+	spool, err := os.CreateTemp("", "k6build-archive-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(spool, content)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+		return nil, 0, err
+	}
+
+	return spool, size, nil
+}
+
+func writeTarGz(out io.Writer, binary io.Reader, size int64, manifest []byte, modTime time.Time) error {
+	gz := gzip.NewWriter(out)
+	archive := tar.NewWriter(gz)
+
+	err := archive.WriteHeader(&tar.Header{
+		Name:    archiveBinary,
+		Mode:    0o755,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(archive, binary); err != nil {
+		return err
+	}
+
+	err = archive.WriteHeader(&tar.Header{
+		Name:    archiveManifest,
+		Mode:    0o644,
+		Size:    int64(len(manifest)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = archive.Write(manifest); err != nil {
+		return err
+	}
+
+	if err = archive.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func writeZip(out io.Writer, binary io.Reader, manifest []byte, modTime time.Time) error {
+	archive := zip.NewWriter(out)
+
+	header := &zip.FileHeader{Name: archiveBinary, Method: zip.Deflate, Modified: modTime}
+	header.SetMode(0o755)
+	file, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, binary); err != nil {
+		return err
+	}
+
+	header = &zip.FileHeader{Name: archiveManifest, Method: zip.Deflate, Modified: modTime}
+	header.SetMode(0o644)
+	file, err = archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(manifest); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store/file"
+)
+
+// readArchive returns the content of the files in an archive
+func readArchive(format string, body []byte) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	switch format {
+	case formatTarGz:
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		archive := tar.NewReader(gz)
+		for {
+			header, err := archive.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			content, err := io.ReadAll(archive)
+			if err != nil {
+				return nil, err
+			}
+			files[header.Name] = content
+		}
+	case formatZip:
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range archive.File {
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := io.ReadAll(r)
+			_ = r.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[f.Name] = content
+		}
+	default:
+		return nil, fmt.Errorf("unexpected format %s", format)
+	}
+
+	return files, nil
+}
+
+func TestDownloadArchive(t *testing.T) {
+	t.Parallel()
+
+	const content = "content object 1"
+
+	localStore, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	object, err := localStore.Put(context.TODO(), "object1", bytes.NewBufferString(content))
+	if err != nil {
+		t.Fatalf("test setup: %v", err)
+	}
+
+	handler := http.NewServeMux()
+	handler.Handle("GET /artifacts/{id}/download", NewDownloadProxy(DownloadProxyConfig{Store: localStore}))
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		title  string
+		format string
+		status int
+	}{
+		{
+			title:  "tar.gz archive",
+			format: formatTarGz,
+			status: http.StatusOK,
+		},
+		{
+			title:  "zip archive",
+			format: formatZip,
+			status: http.StatusOK,
+		},
+		{
+			title:  "unsupported format",
+			format: "rar",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequestWithContext(
+				context.TODO(),
+				http.MethodGet,
+				fmt.Sprintf("%s/artifacts/%s/download?format=%s", srv.URL, object.ID, tc.format),
+				nil,
+			)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("accessing server %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading content %v", err)
+			}
+
+			files, err := readArchive(tc.format, body)
+			if err != nil {
+				t.Fatalf("reading archive %v", err)
+			}
+
+			if string(files[archiveBinary]) != content {
+				t.Fatalf("expected binary %q got %q", content, string(files[archiveBinary]))
+			}
+
+			manifest := k6build.Artifact{}
+			if err = json.Unmarshal(files[archiveManifest], &manifest); err != nil {
+				t.Fatalf("reading manifest %v", err)
+			}
+
+			if manifest.ID != object.ID || manifest.Checksum != object.Checksum {
+				t.Fatalf("expected manifest %s %s got %s %s", object.ID, object.Checksum, manifest.ID, manifest.Checksum)
+			}
+		})
+	}
+}
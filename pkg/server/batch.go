@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+)
+
+// DefaultBatchConcurrency is the default number of builds of a batch request that run concurrently
+const DefaultBatchConcurrency = 4
+
+// BuildBatch handles a batch of build requests, given as a JSON array of build requests.
+// The requests are built concurrently, up to the batch concurrency, and the response is a JSON
+// array with the build response for each request, in the same order. Each response carries its
+// own error, so the failure of a request doesn't fail the others.
+func (a *APIServer) BuildBatch(w http.ResponseWriter, r *http.Request) {
+	resp := api.BuildResponse{}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	// ensure errors are reported and logged
+	defer func() {
+		if resp.Error != nil {
+			if resp.Code == "" {
+				resp.Code = api.ErrorCode(resp.Error)
+			}
+			a.log.Error(resp.Error.Error())
+			_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		}
+	}()
+
+	reqs := []api.BuildRequest{}
+	if status, err := a.decodeRequest(w, r, &reqs); err != nil {
+		w.WriteHeader(status)
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		return
+	}
+
+	if len(reqs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, errors.New("empty batch"))
+		return
+	}
+
+	// propagate request scoped values (e.g. tracing spans) but don't cancel the builds
+	// if the client disconnects
+	ctx := context.WithoutCancel(r.Context())
+
+	responses := make([]api.BuildResponse, len(reqs))
+	workers := make(chan struct{}, a.batchWorkers)
+	wg := sync.WaitGroup{}
+	for i, req := range reqs {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			responses[i] = a.batchBuild(ctx, r, req)
+		}()
+	}
+	wg.Wait()
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(responses) //nolint:errchkjson
+}
+
+// batchBuild builds a request of a batch and returns its response.
+// If the artifact is unchanged (see api.BuildRequest.CurrentArtifact), the response's artifact
+// only has its ID.
+func (a *APIServer) batchBuild(ctx context.Context, r *http.Request, req api.BuildRequest) api.BuildResponse {
+	resp := api.BuildResponse{}
+
+	a.log.Debug("processing", "request", req.String())
+
+	err := req.Validate()
+	if err == nil {
+		req.Dependencies, err = a.expandProfile(req)
+	}
+	if err != nil {
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		resp.Code = api.CodeInvalidRequest
+		resp.ValidationErrors = validationErrors(err)
+		a.log.Error(resp.Error.Error())
+		return resp
+	}
+
+	ctx = k6build.WithBuildOpts(
+		ctx,
+		k6build.BuildOpts{
+			NoCache:         req.NoCache,
+			NoStore:         req.NoStore,
+			CurrentArtifact: req.CurrentArtifact,
+			Fallback:        req.Fallback,
+			Replacements:    req.Replacements,
+			K6Repo:          req.K6Repo,
+		},
+	)
+
+	artifact, err := a.srv.Build(ctx, req.Platform, req.K6Constrains, req.Dependencies)
+	if errors.Is(err, k6build.ErrArtifactUnchanged) {
+		resp.Artifact = k6build.Artifact{ID: req.CurrentArtifact}
+		return resp
+	}
+
+	if err != nil {
+		_, apiErr, code := serviceError(err)
+		switch {
+		case errors.Is(err, k6build.ErrBuildQueueFull):
+			resp.Error = k6build.NewWrappedError(api.ErrQueueFull, err)
+			resp.Code = api.CodeQueueFull
+		case apiErr != nil:
+			resp.Error = k6build.NewWrappedError(apiErr, err)
+			resp.Code = code
+		default:
+			resp.Error = k6build.NewWrappedError(api.ErrBuildFailed, err)
+			resp.Code = buildErrorCode(ctx, err)
+			resp.DependencyResults = dependencyResults(err)
+		}
+		a.log.Error(resp.Error.Error())
+		a.notify(WebhookBuildFailed, req, resp)
+		return resp
+	}
+
+	artifact.URL = a.artifactURL(r, artifact)
+
+	resp.Artifact = artifact
+	resp.Warnings = floatingConstraintsWarnings(req, artifact)
+	a.notify(WebhookBuildSucceeded, req, resp)
+
+	return resp
+}
+
+// decodeRequest decodes the request's body into the value. If the body cannot be decoded,
+// returns the status code for the response.
+func (a *APIServer) decodeRequest(w http.ResponseWriter, r *http.Request, value any) (int, error) {
+	body, err := a.requestBody(w, r)
+	if err != nil {
+		if errors.Is(err, errUnsupportedEncoding) {
+			return http.StatusUnsupportedMediaType, err
+		}
+		return http.StatusBadRequest, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	err = json.NewDecoder(body).Decode(value)
+	if err != nil {
+		maxBytesErr := &http.MaxBytesError{}
+		if errors.As(err, &maxBytesErr) {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		return http.StatusBadRequest, err
+	}
+
+	return http.StatusOK, nil
+}
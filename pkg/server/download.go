@@ -0,0 +1,174 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/downloader"
+)
+
+// DownloadProxyConfig defines the configuration for the DownloadProxy
+type DownloadProxyConfig struct {
+	Store      store.ObjectStore
+	Log        *slog.Logger
+	HTTPClient *http.Client
+}
+
+// DownloadProxy serves the content of the artifacts by proxying it from the object store.
+// This allows clients to download artifacts when the store is not reachable from them.
+//
+// Range requests are passed through to the store when the object is served over http.
+// Objects stored locally, or read from stores that implement store.ObjectReader with seekable
+// content, are served supporting Range requests.
+//
+// The artifact can also be downloaded as an archive with the binary and a manifest with the
+// artifact's metadata using the format query parameter (format=tar.gz or format=zip).
+type DownloadProxy struct {
+	store  store.ObjectStore
+	log    *slog.Logger
+	client *http.Client
+}
+
+// NewDownloadProxy returns a new DownloadProxy
+func NewDownloadProxy(config DownloadProxyConfig) *DownloadProxy {
+	log := config.Log
+	if log == nil {
+		log = slog.New(
+			slog.NewTextHandler(
+				io.Discard,
+				&slog.HandlerOptions{},
+			),
+		)
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &DownloadProxy{
+		store:  config.Store,
+		log:    log,
+		client: client,
+	}
+}
+
+// ServeHTTP returns the content of the artifact with the id given in the request path
+func (p *DownloadProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	object, err := p.store.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrObjectNotFound) {
+			p.log.Debug(err.Error())
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			p.log.Error(err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+	case formatTarGz, formatZip:
+		p.serveArchive(w, r, object, format)
+		return
+	default:
+		p.log.Debug("unsupported download format", "format", format)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	objectURL, err := url.Parse(object.URL)
+	if err != nil {
+		p.log.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if objectURL.Scheme == "http" || objectURL.Scheme == "https" {
+		p.proxy(w, r, object)
+		return
+	}
+
+	content, err := downloader.Read(r.Context(), p.client, p.store, object)
+	if err != nil {
+		p.log.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf("%q", object.ID))
+
+	// serve supporting range requests if possible
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, seeker)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, content)
+}
+
+// proxy request the object's content passing through the range headers
+func (p *DownloadProxy) proxy(w http.ResponseWriter, r *http.Request, object store.Object) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, object.URL, nil)
+	if err != nil {
+		p.log.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for _, h := range []string{"Range", "If-Range"} {
+		if value := r.Header.Get(h); value != "" {
+			req.Header.Set(h, value)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.log.Error(err.Error())
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+	case http.StatusNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	default:
+		p.log.Error("downloading object", "id", object.ID, "status", resp.Status)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	for _, h := range []string{"Content-Length", "Content-Range", "Accept-Ranges"} {
+		if value := resp.Header.Get(h); value != "" {
+			w.Header().Set(h, value)
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf("%q", object.ID))
+
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6build/pkg/builder"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/client"
+	"github.com/grafana/k6build/pkg/store/downloader"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6build/pkg/store/keyprefix"
+	storesrv "github.com/grafana/k6build/pkg/store/server"
+
+	"github.com/grafana/k6foundry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// readerStore is a store whose objects' URLs cannot be downloaded (as in an OCI store), so their
+// content is read from the store
+type readerStore struct {
+	store.ObjectStore
+}
+
+func (s readerStore) Get(ctx context.Context, id string) (store.Object, error) {
+	object, err := s.ObjectStore.Get(ctx, id)
+	object.URL = "oci://registry/repository@" + id
+	return object, err
+}
+
+func (s readerStore) Read(ctx context.Context, object store.Object) (io.ReadCloser, error) {
+	id, _ := strings.CutPrefix(object.URL, "oci://registry/repository@")
+	stored, err := s.ObjectStore.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return downloader.Download(ctx, http.DefaultClient, stored)
+}
+
+func TestDownloadProxy(t *testing.T) {
+	t.Parallel()
+
+	const content = "content object 1"
+
+	// local store serves file urls
+	localStore, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	if _, err = localStore.Put(context.TODO(), "object1", bytes.NewBufferString(content)); err != nil {
+		t.Fatalf("test setup: %v", err)
+	}
+
+	// remote store serves http urls
+	storeHandler, err := storesrv.NewStoreServer(storesrv.StoreServerConfig{Store: localStore, IDPattern: storesrv.AnyIDPattern})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+	storeSrv := httptest.NewServer(storeHandler)
+	t.Cleanup(storeSrv.Close)
+
+	remoteStore, err := client.NewStoreClient(client.StoreClientConfig{Server: storeSrv.URL})
+	if err != nil {
+		t.Fatalf("creating store client %v", err)
+	}
+
+	testCases := []struct {
+		title   string
+		store   store.ObjectStore
+		id      string
+		rangeH  string
+		status  int
+		content string
+	}{
+		{
+			title:   "download from local store",
+			store:   localStore,
+			id:      "object1",
+			status:  http.StatusOK,
+			content: content,
+		},
+		{
+			title:   "download range from local store",
+			store:   localStore,
+			id:      "object1",
+			rangeH:  "bytes=8-",
+			status:  http.StatusPartialContent,
+			content: content[8:],
+		},
+		{
+			title:  "object not found in local store",
+			store:  localStore,
+			id:     "not_found",
+			status: http.StatusNotFound,
+		},
+		{
+			title:   "download from reader store",
+			store:   readerStore{localStore},
+			id:      "object1",
+			status:  http.StatusOK,
+			content: content,
+		},
+		{
+			title:   "download range from reader store",
+			store:   readerStore{localStore},
+			id:      "object1",
+			rangeH:  "bytes=8-",
+			status:  http.StatusPartialContent,
+			content: content[8:],
+		},
+		{
+			title:   "download from remote store",
+			store:   remoteStore,
+			id:      "object1",
+			status:  http.StatusOK,
+			content: content,
+		},
+		{
+			title:  "object not found in remote store",
+			store:  remoteStore,
+			id:     "not_found",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			handler := http.NewServeMux()
+			handler.Handle("GET /artifacts/{id}/download", NewDownloadProxy(DownloadProxyConfig{Store: tc.store}))
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			req, err := http.NewRequestWithContext(
+				context.TODO(),
+				http.MethodGet,
+				fmt.Sprintf("%s/artifacts/%s/download", srv.URL, tc.id),
+				nil,
+			)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+			if tc.rangeH != "" {
+				req.Header.Set("Range", tc.rangeH)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("accessing server %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+
+			if tc.content == "" {
+				return
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading content %v", err)
+			}
+
+			if string(body) != tc.content {
+				t.Fatalf("expected %q got %q", tc.content, string(body))
+			}
+		})
+	}
+}
+
+// TestDownloadProxyKeyPrefix checks the artifacts stored under a prefix by the builder are
+// downloaded by their id
+func TestDownloadProxyKeyPrefix(t *testing.T) {
+	t.Parallel()
+
+	// remote store resolving the prefixed keys in the store server
+	remoteStore := func(t *testing.T) (store.ObjectStore, store.ObjectStore) {
+		t.Helper()
+
+		fileStore, err := file.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("creating test file store %v", err)
+		}
+
+		prefixedStore, err := keyprefix.New(keyprefix.Config{Store: fileStore})
+		if err != nil {
+			t.Fatalf("creating key prefix store %v", err)
+		}
+
+		storeHandler, err := storesrv.NewStoreServer(storesrv.StoreServerConfig{Store: prefixedStore})
+		if err != nil {
+			t.Fatalf("creating store server %v", err)
+		}
+		storeSrv := httptest.NewServer(storeHandler)
+		t.Cleanup(storeSrv.Close)
+
+		storeClient, err := client.NewStoreClient(client.StoreClientConfig{Server: storeSrv.URL})
+		if err != nil {
+			t.Fatalf("creating store client %v", err)
+		}
+
+		return storeClient, storeClient
+	}
+
+	// local store resolving the prefixed keys in the download proxy
+	localStore := func(t *testing.T) (store.ObjectStore, store.ObjectStore) {
+		t.Helper()
+
+		fileStore, err := file.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("creating test file store %v", err)
+		}
+
+		prefixedStore, err := keyprefix.New(keyprefix.Config{Store: fileStore})
+		if err != nil {
+			t.Fatalf("creating key prefix store %v", err)
+		}
+
+		return fileStore, prefixedStore
+	}
+
+	testCases := []struct {
+		title string
+		setup func(t *testing.T) (store.ObjectStore, store.ObjectStore)
+	}{
+		{
+			title: "local store",
+			setup: localStore,
+		},
+		{
+			title: "remote store",
+			setup: remoteStore,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			buildStore, proxyStore := tc.setup(t)
+
+			catalog, err := catalog.NewCatalogFromJSON(bytes.NewBufferString(
+				`{"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0"]}}`,
+			))
+			if err != nil {
+				t.Fatalf("creating catalog %v", err)
+			}
+
+			buildsrv, err := builder.New(context.Background(), builder.Config{
+				Opts:    builder.Opts{KeyPrefix: true},
+				Catalog: catalog,
+				Store:   buildStore,
+				Foundry: builder.FoundryFunction(
+					func(context.Context, k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+						return slowFoundryBuilder{builds: &atomic.Int32{}}, nil
+					},
+				),
+				Registerer: prometheus.NewRegistry(),
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+
+			artifact, err := buildsrv.Build(context.TODO(), "linux/amd64", "v0.1.0", nil)
+			if err != nil {
+				t.Fatalf("building artifact %v", err)
+			}
+
+			handler := http.NewServeMux()
+			handler.Handle("GET /artifacts/{id}/download", NewDownloadProxy(DownloadProxyConfig{Store: proxyStore}))
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			resp, err := http.Get(fmt.Sprintf("%s/artifacts/%s/download", srv.URL, artifact.ID))
+			if err != nil {
+				t.Fatalf("accessing server %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected %s got %s", http.StatusText(http.StatusOK), resp.Status)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading content %v", err)
+			}
+
+			if string(body) != "k6 binary" {
+				t.Fatalf("expected %q got %q", "k6 binary", string(body))
+			}
+		})
+	}
+}
@@ -2,31 +2,154 @@
 package server
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/grafana/k6build"
 	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/downloader"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errUnknownProfile      = errors.New("unknown profile")
 )
 
+// DefaultMaxRequestSize is the default limit for the size of the (decompressed) request body
+const DefaultMaxRequestSize = 1 << 20
+
+// cacheMaxAge is how long clients can cache the responses of GET requests (download redirects and
+// artifact ids with pinned constraints, and the catalog)
+const cacheMaxAge = 5 * time.Minute
+
 // APIServerConfig defines the configuration for the APIServer
 type APIServerConfig struct {
 	BuildService k6build.BuildService
 	Log          *slog.Logger
+	// ProxyDownloads makes the artifact URLs point to the API server's download endpoint
+	// (/artifacts/{id}/download) instead of the object store. See DownloadProxy.
+	ProxyDownloads bool
+	// DownloadURL is the base URL for the artifact URLs when ProxyDownloads is enabled.
+	// If not specified, the URL is derived from the request.
+	DownloadURL string
+	// ExternalStoreURL is the base URL the clients use for reaching the object store, when the
+	// store's URLs reference a host they cannot reach (e.g. a store behind an ingress).
+	// The scheme and host of the artifact URLs are replaced by the ones of this URL, and its path
+	// is prepended to the artifact URL's path. Only http(s) artifact URLs are rewritten.
+	// Ignored if ProxyDownloads is enabled.
+	ExternalStoreURL string
+	// Capabilities of the build service reported to the clients
+	Capabilities api.Capabilities
+	// MaxRequestSize limits the size of the request body after decompression.
+	// Defaults to DefaultMaxRequestSize
+	MaxRequestSize int64
+	// Catalog used for listing the versions of the dependencies. If the catalog is not a
+	// catalog.VersionLister, the GET /versions endpoint is not available. If it is not a
+	// catalog.Lister, the GET /catalog endpoint is not available.
+	Catalog catalog.Catalog
+	// Profiles maps the names of build profiles to the dependencies they expand to.
+	// The names of the profiles are added to the Capabilities.
+	Profiles map[string][]k6build.Dependency
+	// Webhook notified when a build request completes, either successfully or not
+	Webhook WebhookConfig
+	// BatchConcurrency is the number of builds of a batch request that run concurrently.
+	// Defaults to DefaultBatchConcurrency
+	BatchConcurrency int
+	// HTTPClient used for downloading the binaries streamed in the build responses.
+	// Defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Store used by the build service. The binaries streamed in the build responses are read from
+	// the store if it implements store.ObjectReader (e.g. if their URLs cannot be downloaded).
+	// Optional
+	Store store.ObjectStore
 }
 
 // APIServer defines a k6build API server
+// It handles the following requests:
+//
+//	POST /[?ensure=true]
+//	POST /build[?ensure=true]
+//	POST /build/batch
+//	GET  /download?platform=<platform>&k6=<constraints>&dep=<name>[:<constraints>]&profile=<profile>
+//	POST /artifacts/id
+//	GET  /artifacts/id?platform=<platform>&k6=<constraints>&dep=<name>[:<constraints>]&profile=<profile>
+//	DELETE /build/{id}
+//	GET  /capabilities
+//	GET  /versions/{dependency}?constraints=<constraints>&channel=<channel>
+//	GET  /catalog[?name=<name>]
+//	GET  /catalog/{dependency}/versions
+//
+// Request bodies can be compressed using gzip (Content-Encoding: gzip)
+//
+// Build requests return the artifact's metadata once it is available in the store. The binary
+// can be downloaded later using the artifact's URL (see api.EnsureParam), or streamed in the
+// response if the request accepts application/octet-stream but not application/json (e.g. for
+// clients that cannot reach the store).
+//
+// If the build service is a k6build.ArtifactResolver, the /artifacts/id endpoint returns the ID and
+// the resolved dependencies of the artifact for a build request without building it. The request
+// can also be given as query parameters (GET), as in download requests, so the responses can be
+// cached.
+//
+// If the build service is a k6build.ArtifactInvalidator, DELETE /build/{id} invalidates the
+// artifact, forcing it to be built again on the next request (e.g. when a dependency's version
+// was re-tagged).
+//
+// Build requests can reference a build profile, a named set of dependencies defined
+// in the APIServerConfig, instead of listing all the dependencies.
+//
+// Download requests build the artifact for the constraints given as query parameters, as a build
+// request would, and redirect to the artifact's URL.
+//
+// Batch requests (/build/batch) build a JSON array of build requests concurrently, returning an
+// array with the response for each request, in the same order. See BuildBatch.
+//
+// If a webhook is configured, the completion of each build is posted to it (see WebhookEvent).
+//
+// The trace context propagated by the clients (W3C traceparent header) is added to the requests'
+// context, unless it already has a trace span (e.g. the handler is instrumented by a tracer). This
+// allows the build service to link its metrics to the clients' traces (e.g. the builder's exemplars).
 type APIServer struct {
-	srv k6build.BuildService
-	log *slog.Logger
+	srv            k6build.BuildService
+	log            *slog.Logger
+	proxyDownloads bool
+	downloadURL    *url.URL
+	externalURL    *url.URL
+	capabilities   api.Capabilities
+	maxRequestSize int64
+	versions       catalog.VersionLister
+	lister         catalog.Lister
+	profiles       map[string][]k6build.Dependency
+	webhook        *webhook
+	resolver       k6build.ArtifactResolver
+	invalidator    k6build.ArtifactInvalidator
+	client         *http.Client
+	store          store.ObjectStore
+	batchWorkers   int
+	handler        *http.ServeMux
 }
 
-// NewAPIServer creates a new build service API server
-// TODO: add logger
-func NewAPIServer(config APIServerConfig) *APIServer {
+// NewAPIServer creates a new build service API server.
+// Returns an error if the DownloadURL or the ExternalStoreURL are not valid absolute urls.
+func NewAPIServer(config APIServerConfig) (*APIServer, error) {
 	log := config.Log
 	if log == nil {
 		log = slog.New(
@@ -36,14 +159,274 @@ func NewAPIServer(config APIServerConfig) *APIServer {
 			),
 		)
 	}
-	return &APIServer{
-		srv: config.BuildService,
-		log: log,
+
+	downloadURL, err := parseURL(config.DownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download url %w", err)
+	}
+
+	externalURL, err := parseURL(config.ExternalStoreURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid external store url %w", err)
+	}
+
+	maxRequestSize := config.MaxRequestSize
+	if maxRequestSize <= 0 {
+		maxRequestSize = DefaultMaxRequestSize
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	batchWorkers := config.BatchConcurrency
+	if batchWorkers <= 0 {
+		batchWorkers = DefaultBatchConcurrency
+	}
+
+	capabilities := config.Capabilities
+	for name := range config.Profiles {
+		capabilities.Profiles = append(capabilities.Profiles, name)
+	}
+	sort.Strings(capabilities.Profiles)
+
+	server := &APIServer{
+		srv:            config.BuildService,
+		log:            log,
+		proxyDownloads: config.ProxyDownloads,
+		downloadURL:    downloadURL,
+		externalURL:    externalURL,
+		capabilities:   capabilities,
+		maxRequestSize: maxRequestSize,
+		profiles:       config.Profiles,
+		webhook:        newWebhook(config.Webhook, log),
+		client:         client,
+		store:          config.Store,
+		batchWorkers:   batchWorkers,
+	}
+
+	handler := http.NewServeMux()
+	handler.HandleFunc("POST /build", server.Build)
+	handler.HandleFunc("POST /build/batch", server.BuildBatch)
+	handler.HandleFunc("GET /download", server.Download)
+	handler.HandleFunc("GET /capabilities", server.Capabilities)
+	if resolver, ok := config.BuildService.(k6build.ArtifactResolver); ok {
+		server.resolver = resolver
+		handler.HandleFunc("POST /artifacts/id", server.ArtifactID)
+		handler.HandleFunc("GET /artifacts/id", server.ArtifactID)
+	}
+	if invalidator, ok := config.BuildService.(k6build.ArtifactInvalidator); ok {
+		server.invalidator = invalidator
+		handler.HandleFunc("DELETE /build/{id}", server.Invalidate)
+	}
+	if versions, ok := config.Catalog.(catalog.VersionLister); ok {
+		server.versions = versions
+		handler.HandleFunc("GET /versions/{dependency...}", server.Versions)
+		// the dependency's name has '/', so the path is parsed by the handler
+		handler.HandleFunc("GET /catalog/{path...}", server.CatalogVersions)
 	}
+	if lister, ok := config.Catalog.(catalog.Lister); ok {
+		server.lister = lister
+		handler.HandleFunc("GET /catalog", server.Catalog)
+	}
+	server.handler = handler
+
+	return server, nil
+}
+
+// withTraceContext returns the request with the trace context propagated in its headers, if any,
+// unless the request's context already has a trace span
+func withTraceContext(r *http.Request) *http.Request {
+	if trace.SpanContextFromContext(r.Context()).IsValid() {
+		return r
+	}
+
+	ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return r
+	}
+
+	return r.WithContext(ctx)
 }
 
-// ServeHTTP implements the request handler for the build API server
+// parseURL parses an absolute url. Returns nil if the url is empty
+func parseURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if !parsed.IsAbs() || parsed.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute url", rawURL)
+	}
+
+	return parsed, nil
+}
+
+// ServeHTTP implements the request handler for the build API server.
+// A POST to the root path is handled as a build request, for compatibility with servers that mount
+// the APIServer at the build endpoint (e.g. using http.StripPrefix("/build", apiServer)). Only build
+// requests are available when mounted this way.
 func (a *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = withTraceContext(r)
+
+	if r.Method == http.MethodPost && (r.URL.Path == "" || r.URL.Path == "/") {
+		a.Build(w, r)
+		return
+	}
+
+	a.handler.ServeHTTP(w, r)
+}
+
+// Capabilities returns the capabilities of the build service
+func (a *APIServer) Capabilities(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(a.capabilities) //nolint:errchkjson
+}
+
+// Versions returns the versions of a dependency that satisfy the constraints (by default, all versions).
+// The versions are obtained from the catalog without resolving the dependency.
+func (a *APIServer) Versions(w http.ResponseWriter, r *http.Request) {
+	resp := api.VersionsResponse{}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	dep := catalog.Dependency{
+		Name:       r.PathValue("dependency"),
+		Constrains: r.URL.Query().Get("constraints"),
+		Channel:    r.URL.Query().Get("channel"),
+	}
+	if dep.Constrains == "" {
+		dep.Constrains = "*"
+	}
+
+	versions, err := a.versions.Versions(r.Context(), dep)
+	if err != nil {
+		resp.Code = api.CodeInvalidRequest
+		switch {
+		case errors.Is(err, catalog.ErrUnknownDependency):
+			w.WriteHeader(http.StatusNotFound)
+			resp.Code = api.CodeCannotSatisfy
+		case errors.Is(err, catalog.ErrInvalidConstrain):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		a.log.Debug(resp.Error.Error())
+		_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		return
+	}
+
+	resp.Versions = versions
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+}
+
+// CatalogVersions returns all the versions of a dependency in the catalog, newest first,
+// flagging the pre-releases. Unlike Versions, it doesn't filter the versions by constraints.
+func (a *APIServer) CatalogVersions(w http.ResponseWriter, r *http.Request) {
+	dependency, found := strings.CutSuffix(r.PathValue("path"), "/versions")
+	if !found || dependency == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	resp := api.CatalogVersionsResponse{Dependency: dependency, Versions: []api.CatalogVersion{}}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	versions, err := a.versions.Versions(r.Context(), catalog.Dependency{Name: dependency, Constrains: catalog.AllVersions})
+	if err != nil {
+		if errors.Is(err, catalog.ErrUnknownDependency) {
+			w.WriteHeader(http.StatusNotFound)
+			resp.Code = api.CodeCannotSatisfy
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			resp.Code = api.CodeInvalidRequest
+		}
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		a.log.Debug(resp.Error.Error())
+		_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		return
+	}
+
+	resp.Versions = catalogVersions(versions)
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+}
+
+// Catalog returns the dependencies in the catalog with their versions, newest first, flagging
+// the pre-releases. If the name query parameter is given, only the dependencies whose name
+// contains it are returned.
+func (a *APIServer) Catalog(w http.ResponseWriter, r *http.Request) {
+	resp := api.CatalogResponse{Dependencies: []api.CatalogDependency{}}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	listings, err := a.lister.List(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		resp.Code = api.CodeInvalidRequest
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		a.log.Debug(resp.Error.Error())
+		_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	for _, listing := range listings {
+		if !strings.Contains(listing.Name, name) {
+			continue
+		}
+
+		var channels map[string][]api.CatalogVersion
+		if len(listing.Channels) > 0 {
+			channels = map[string][]api.CatalogVersion{}
+			for channel, versions := range listing.Channels {
+				channels[channel] = catalogVersions(versions)
+			}
+		}
+
+		resp.Dependencies = append(resp.Dependencies, api.CatalogDependency{
+			Name:     listing.Name,
+			Module:   listing.Module,
+			Cgo:      listing.Cgo,
+			Versions: catalogVersions(listing.Versions),
+			Channels: channels,
+		})
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(cacheMaxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+}
+
+// catalogVersions returns the versions of a dependency flagging the pre-releases
+func catalogVersions(versions []string) []api.CatalogVersion {
+	flagged := make([]api.CatalogVersion, 0, len(versions))
+	for _, v := range versions {
+		version, err := semver.NewVersion(v)
+		flagged = append(flagged, api.CatalogVersion{
+			Version:    v,
+			Prerelease: err == nil && version.Prerelease() != "",
+		})
+	}
+
+	return flagged
+}
+
+// Build handles a build request. If the request accepts application/octet-stream but not
+// application/json, the artifact's binary is returned instead of its metadata, unless the
+// request has the ensure parameter.
+func (a *APIServer) Build(w http.ResponseWriter, r *http.Request) {
 	resp := api.BuildResponse{}
 
 	w.Header().Add("Content-Type", "application/json")
@@ -51,36 +434,641 @@ func (a *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// ensure errors are reported and logged
 	defer func() {
 		if resp.Error != nil {
+			if resp.Code == "" {
+				resp.Code = api.ErrorCode(resp.Error)
+			}
 			a.log.Error(resp.Error.Error())
 			_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
 		}
 	}()
 
-	req := api.BuildRequest{}
-	err := json.NewDecoder(r.Body).Decode(&req)
+	ensure := r.URL.Query().Get(api.EnsureParam)
+	if ensure != "" {
+		if ok, parseErr := strconv.ParseBool(ensure); parseErr != nil || !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			resp.Error = k6build.NewWrappedError(
+				api.ErrInvalidRequest,
+				fmt.Errorf("unsupported %s=%s: build requests only return the artifact's metadata", api.EnsureParam, ensure),
+			)
+			return
+		}
+	}
+
+	req, status, err := a.readBuildRequest(w, r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(status)
 		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		resp.ValidationErrors = validationErrors(err)
 		return
 	}
 
-	a.log.Debug("processing", "request", req.String())
+	stream := ensure == "" && acceptsBinary(r)
+	if stream && req.NoStore {
+		w.WriteHeader(http.StatusBadRequest)
+		resp.Error = k6build.NewWrappedError(
+			api.ErrInvalidRequest,
+			errors.New("artifacts that are not stored cannot be streamed"),
+		)
+		return
+	}
+
+	// propagate request scoped values (e.g. tracing spans) but don't cancel the build
+	// if the client disconnects, unless the client informed the time it will wait for it
+	ctx := context.WithoutCancel(r.Context())
+	if timeout := r.Header.Get(api.RequestTimeoutHeader); timeout != "" {
+		duration, parseErr := time.ParseDuration(timeout)
+		if parseErr != nil || duration <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			resp.Error = k6build.NewWrappedError(
+				api.ErrInvalidRequest,
+				fmt.Errorf("invalid %s header %q", api.RequestTimeoutHeader, timeout),
+			)
+			return
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
 
-	artifact, err := a.srv.Build( //nolint:contextcheck
-		context.Background(),
+	ctx = k6build.WithBuildOpts(
+		ctx,
+		k6build.BuildOpts{
+			NoCache:         req.NoCache,
+			NoStore:         req.NoStore,
+			CurrentArtifact: req.CurrentArtifact,
+			Fallback:        req.Fallback,
+			Replacements:    req.Replacements,
+			K6Repo:          req.K6Repo,
+		},
+	)
+
+	artifact, err := a.srv.Build(
+		ctx,
 		req.Platform,
 		req.K6Constrains,
 		req.Dependencies,
 	)
+	if errors.Is(err, k6build.ErrArtifactUnchanged) {
+		a.log.Debug("artifact unchanged", "id", req.CurrentArtifact)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// the build was not started, the client can retry it later
+	queueErr := &k6build.QueueFullError{}
+	if errors.As(err, &queueErr) {
+		setQueueHeaders(w, queueErr)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		resp.Error = k6build.NewWrappedError(api.ErrQueueFull, err)
+		resp.Code = api.CodeQueueFull
+		return
+	}
+
+	if status, apiErr, code := serviceError(err); apiErr != nil {
+		w.WriteHeader(status)
+		resp.Error = k6build.NewWrappedError(apiErr, err)
+		resp.Code = code
+		a.notify(WebhookBuildFailed, req, resp)
+		return
+	}
+
 	if err != nil {
-		w.WriteHeader(http.StatusOK)
+		// clients expecting the binary cannot tell a failed build from a successful one
+		// by the content, so the failure must have a non-2xx status
+		if stream {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
 		resp.Error = k6build.NewWrappedError(api.ErrBuildFailed, err)
+		resp.Code = buildErrorCode(ctx, err)
+		resp.DependencyResults = dependencyResults(err)
+		a.notify(WebhookBuildFailed, req, resp)
+		return
+	}
+
+	if stream {
+		resp.Artifact = artifact
+		if err = a.streamArtifact(w, r, artifact); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			resp.Error = k6build.NewWrappedError(api.ErrRequestFailed, err)
+			return
+		}
+		a.notify(WebhookBuildSucceeded, req, resp)
 		return
 	}
 
+	artifact.URL = a.artifactURL(r, artifact)
+
 	a.log.Debug("returning", "artifact", artifact.String())
 
 	resp.Artifact = artifact
+	resp.Warnings = floatingConstraintsWarnings(req, artifact)
+	for _, warning := range resp.Warnings {
+		w.Header().Add("Warning", fmt.Sprintf("299 k6build %q", warning))
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+
+	a.notify(WebhookBuildSucceeded, req, resp)
+}
+
+// streamArtifact writes the artifact's binary to the response, reading it from the store.
+// Returns an error if the download fails before writing the response.
+func (a *APIServer) streamArtifact(w http.ResponseWriter, r *http.Request, artifact k6build.Artifact) error {
+	object := store.Object{ID: artifact.ID, URL: artifact.URL, Checksum: artifact.Checksum}
+	content, err := downloader.Read(r.Context(), a.client, a.store, object)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	a.log.Debug("streaming", "artifact", artifact.String())
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf("%q", artifact.ID))
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, content)
+
+	return nil
+}
+
+// acceptsBinary returns true if the request accepts application/octet-stream but not application/json
+func acceptsBinary(r *http.Request) bool {
+	binary := false
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			switch strings.TrimSpace(mediaType) {
+			case "application/json":
+				return false
+			case "application/octet-stream":
+				binary = true
+			}
+		}
+	}
+
+	return binary
+}
+
+// Download builds the artifact for the constraints given in the query parameters and redirects
+// to its URL. Dependencies are given as name[:constraints] in one or more dep parameters.
+// The k6 and dependencies' constraints default to '*'.
+//
+// Redirects of requests with floating constraints are not cached, as subsequent requests may
+// resolve to newer versions. Errors are returned as a build response with a non-2xx status.
+func (a *APIServer) Download(w http.ResponseWriter, r *http.Request) {
+	resp := api.BuildResponse{}
+
+	// ensure errors are reported and logged
+	defer func() {
+		if resp.Error != nil {
+			if resp.Code == "" {
+				resp.Code = api.ErrorCode(resp.Error)
+			}
+			a.log.Error(resp.Error.Error())
+			_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		}
+	}()
+
+	req, err := a.queryRequest(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		resp.ValidationErrors = validationErrors(err)
+		return
+	}
+
+	ctx := k6build.WithBuildOpts(context.WithoutCancel(r.Context()), k6build.BuildOpts{})
+	artifact, err := a.srv.Build(ctx, req.Platform, req.K6Constrains, req.Dependencies)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+
+		queueErr := &k6build.QueueFullError{}
+		status, apiErr, code := serviceError(err)
+		switch {
+		case errors.As(err, &queueErr):
+			setQueueHeaders(w, queueErr)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			resp.Error = k6build.NewWrappedError(api.ErrQueueFull, err)
+			resp.Code = api.CodeQueueFull
+			return
+		case apiErr != nil:
+			w.WriteHeader(status)
+			resp.Error = k6build.NewWrappedError(apiErr, err)
+			resp.Code = code
+			a.notify(WebhookBuildFailed, req, resp)
+			return
+		case errors.Is(err, catalog.ErrCannotSatisfy), errors.Is(err, catalog.ErrUnknownDependency):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		resp.Error = k6build.NewWrappedError(api.ErrBuildFailed, err)
+		resp.Code = buildErrorCode(ctx, err)
+		resp.DependencyResults = dependencyResults(err)
+		a.notify(WebhookBuildFailed, req, resp)
+		return
+	}
+
+	artifact.URL = a.artifactURL(r, artifact)
+
+	resp.Artifact = artifact
+	resp.Warnings = floatingConstraintsWarnings(req, artifact)
+	for _, warning := range resp.Warnings {
+		w.Header().Add("Warning", fmt.Sprintf("299 k6build %q", warning))
+	}
+	if len(resp.Warnings) > 0 {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(cacheMaxAge.Seconds())))
+	}
+
+	a.log.Debug("redirecting", "artifact", artifact.String())
+
+	http.Redirect(w, r, artifact.URL, http.StatusFound)
+
+	a.notify(WebhookBuildSucceeded, req, resp)
+}
+
+// queryRequest returns the build request for the query parameters of a GET request (download or
+// artifact id), expanding its profile if any
+func (a *APIServer) queryRequest(r *http.Request) (api.BuildRequest, error) {
+	query := r.URL.Query()
+
+	req := api.BuildRequest{
+		Platform:     query.Get("platform"),
+		K6Constrains: query.Get("k6"),
+		Profile:      query.Get("profile"),
+		Dependencies: []k6build.Dependency{},
+	}
+	if req.K6Constrains == "" {
+		req.K6Constrains = "*"
+	}
+	for _, d := range query["dep"] {
+		name, constrains, _ := strings.Cut(d, ":")
+		if constrains == "" {
+			constrains = "*"
+		}
+		req.Dependencies = append(req.Dependencies, k6build.Dependency{Name: name, Constraints: constrains})
+	}
+
+	a.log.Debug("processing", "request", req.String())
+
+	if err := req.Validate(); err != nil {
+		return req, err
+	}
+
+	deps, err := a.expandProfile(req)
+	if err != nil {
+		return req, err
+	}
+	req.Dependencies = deps
+
+	return req, nil
+}
+
+// ArtifactID returns the ID and the resolved dependencies of the artifact that satisfies a build
+// request, without building it. The build request is read from the body (POST) or from the query
+// parameters (GET) as in Download requests.
+//
+// The response has the artifact's ID as ETag, which identifies the resolved dependencies, and
+// requests with a matching If-None-Match header are answered with 304 (Not Modified). As in Download
+// requests, responses to requests with floating constraints are not cached.
+func (a *APIServer) ArtifactID(w http.ResponseWriter, r *http.Request) {
+	resp := api.ArtifactIDResponse{}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	// ensure errors are reported and logged
+	defer func() {
+		if resp.Error != nil {
+			if resp.Code == "" {
+				resp.Code = api.ErrorCode(resp.Error)
+			}
+			a.log.Debug(resp.Error.Error())
+			_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		}
+	}()
+
+	var (
+		req    api.BuildRequest
+		status = http.StatusBadRequest
+		err    error
+	)
+	if r.Method == http.MethodGet {
+		req, err = a.queryRequest(r)
+	} else {
+		req, status, err = a.readBuildRequest(w, r)
+	}
+	if err != nil {
+		w.WriteHeader(status)
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		resp.ValidationErrors = validationErrors(err)
+		return
+	}
+
+	artifact, err := a.resolver.ResolveArtifact(r.Context(), req.Platform, req.K6Constrains, req.Dependencies)
+	if err != nil {
+		switch {
+		case errors.Is(err, catalog.ErrCannotSatisfy), errors.Is(err, catalog.ErrUnknownDependency):
+			w.WriteHeader(http.StatusBadRequest)
+			resp.Code = api.CodeCannotSatisfy
+		case errors.Is(err, catalog.ErrInvalidConstrain):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		resp.DependencyResults = dependencyResults(err)
+		return
+	}
+
+	resp.ID = artifact.ID
+	resp.Platform = artifact.Platform
+	resp.Dependencies = artifact.Dependencies
+
+	etag := fmt.Sprintf("%q", artifact.ID)
+	w.Header().Set("ETag", etag)
+	if len(floatingConstraintsWarnings(req, artifact)) > 0 {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(cacheMaxAge.Seconds())))
+	}
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
 }
+
+// Invalidate removes an artifact from the build service given its ID, so it is built again on
+// the next request. Returns 204 (No Content) if the artifact was removed and 404 (Not Found)
+// if it was not available.
+func (a *APIServer) Invalidate(w http.ResponseWriter, r *http.Request) {
+	resp := api.BuildResponse{}
+
+	// ensure errors are reported and logged
+	defer func() {
+		if resp.Error != nil {
+			if resp.Code == "" {
+				resp.Code = api.ErrorCode(resp.Error)
+			}
+			a.log.Error(resp.Error.Error())
+			_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		}
+	}()
+
+	id := r.PathValue("id")
+	err := a.invalidator.InvalidateArtifact(r.Context(), id)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		if errors.Is(err, k6build.ErrArtifactNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			resp.Error = k6build.NewWrappedError(api.ErrRequestFailed, err)
+		}
+		return
+	}
+
+	a.log.Info("artifact invalidated", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readBuildRequest reads a build request from the request's body, expanding its profile if any.
+// If the request is not valid, returns the status code for the response.
+func (a *APIServer) readBuildRequest(w http.ResponseWriter, r *http.Request) (api.BuildRequest, int, error) {
+	req := api.BuildRequest{}
+	if status, err := a.decodeRequest(w, r, &req); err != nil {
+		return req, status, err
+	}
+
+	a.log.Debug("processing", "request", req.String())
+
+	if err := req.Validate(); err != nil {
+		return req, http.StatusBadRequest, err
+	}
+
+	var err error
+	req.Dependencies, err = a.expandProfile(req)
+	if err != nil {
+		return req, http.StatusBadRequest, err
+	}
+
+	return req, http.StatusOK, nil
+}
+
+// validationErrors returns the invalid fields reported by the error, if any
+func validationErrors(err error) []api.FieldError {
+	validationErr := api.ValidationError{}
+	if errors.As(err, &validationErr) {
+		return validationErr
+	}
+	return nil
+}
+
+// dependencyResults returns the result of resolving each dependency if the error reports
+// dependencies that cannot be resolved
+func dependencyResults(err error) []api.DependencyResult {
+	resolveErr := &catalog.ResolveError{}
+	if !errors.As(err, &resolveErr) {
+		return nil
+	}
+
+	results := make([]api.DependencyResult, 0, len(resolveErr.Resolutions))
+	for _, r := range resolveErr.Resolutions {
+		result := api.DependencyResult{Name: r.Dependency.Name}
+		if r.Err != nil {
+			result.Error = r.Err.Error()
+		} else {
+			result.Version = r.Module.Version
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// notify posts the completion of a build to the webhook, if configured
+func (a *APIServer) notify(event string, req api.BuildRequest, resp api.BuildResponse) {
+	if a.webhook == nil {
+		return
+	}
+
+	a.webhook.notify(WebhookEvent{
+		Event:     event,
+		Timestamp: time.Now(),
+		Request:   req,
+		Response:  resp,
+	})
+}
+
+// setQueueHeaders sets the headers that inform the client when to retry a build rejected
+// because the build queue is full. If the wait is unknown, the client is asked to retry in 1s.
+func setQueueHeaders(w http.ResponseWriter, queueErr *k6build.QueueFullError) {
+	retryAfter := int64(math.Ceil(queueErr.EstimatedWait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	w.Header().Set(api.QueuePositionHeader, strconv.Itoa(queueErr.Position))
+	if queueErr.EstimatedWait > 0 {
+		w.Header().Set(api.EstimatedWaitHeader, queueErr.EstimatedWait.String())
+	}
+}
+
+// requestBody returns the body of the request, decompressing it if needed.
+// The size of the decompressed body is limited to prevent decompression bombs.
+func (a *APIServer) requestBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+		body = r.Body
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = gz
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+	}
+
+	return http.MaxBytesReader(w, body, a.maxRequestSize), nil
+}
+
+// serviceError returns the status, error and code of the response for the errors caused by the
+// build service's environment instead of the request: lack of space for building (507) and
+// failures authenticating with the module proxy (502). Returns a nil error for other errors.
+func serviceError(err error) (int, error, string) { //nolint:revive
+	switch {
+	case errors.Is(err, k6build.ErrInsufficientSpace):
+		return http.StatusInsufficientStorage, api.ErrInsufficientStorage, api.CodeInsufficientStorage
+	case errors.Is(err, k6build.ErrProxyAuth):
+		return http.StatusBadGateway, api.ErrProxyAuth, api.CodeProxyAuth
+	default:
+		return 0, nil, ""
+	}
+}
+
+// buildErrorCode returns the code for an error returned by the build service
+func buildErrorCode(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return api.CodeTimeout
+	case errors.Is(err, catalog.ErrCannotSatisfy), errors.Is(err, catalog.ErrUnknownDependency):
+		return api.CodeCannotSatisfy
+	default:
+		return api.CodeBuildFailed
+	}
+}
+
+// expandProfile returns the dependencies of the request merged with the dependencies of
+// the request's profile, if any. The dependencies in the request take precedence.
+func (a *APIServer) expandProfile(req api.BuildRequest) ([]k6build.Dependency, error) {
+	if req.Profile == "" {
+		return req.Dependencies, nil
+	}
+
+	profile, found := a.profiles[req.Profile]
+	if !found {
+		return nil, fmt.Errorf("%w %q", errUnknownProfile, req.Profile)
+	}
+
+	requested := map[string]bool{}
+	for _, d := range req.Dependencies {
+		requested[d.Name] = true
+	}
+
+	deps := append([]k6build.Dependency{}, req.Dependencies...)
+	for _, d := range profile {
+		if !requested[d.Name] {
+			deps = append(deps, d)
+		}
+	}
+
+	return deps, nil
+}
+
+// floatingConstraintsWarnings returns a warning for each floating constraint in the request
+// (e.g. '*' or '>v0.1.0') naming the version it resolved to. Subsequent requests may resolve these
+// constraints to newer versions.
+func floatingConstraintsWarnings(req api.BuildRequest, artifact k6build.Artifact) []string {
+	warnings := []string{}
+
+	constraints := []k6build.Dependency{{Name: "k6", Constraints: req.K6Constrains}}
+	constraints = append(constraints, req.Dependencies...)
+	for _, c := range constraints {
+		if catalog.IsPinned(c.Constraints) {
+			continue
+		}
+		warnings = append(
+			warnings,
+			fmt.Sprintf("floating constraint %s %q resolved to %s", c.Name, c.Constraints, artifact.Dependencies[c.Name]),
+		)
+	}
+
+	return warnings
+}
+
+// artifactURL returns the URL for downloading the artifact returned to the clients: the API
+// server's download endpoint if the downloads are proxied or the artifact's URL rewritten to
+// the external store URL, if any.
+func (a *APIServer) artifactURL(r *http.Request, artifact k6build.Artifact) string {
+	if artifact.URL == "" {
+		return ""
+	}
+
+	if a.proxyDownloads {
+		return getDownloadURL(a.downloadURL, r, artifact.ID)
+	}
+
+	if a.externalURL != nil {
+		return getExternalURL(a.externalURL, artifact.URL)
+	}
+
+	return artifact.URL
+}
+
+// getExternalURL returns the artifact URL relative to the external base URL. URLs that are
+// not http(s) URLs are returned unchanged.
+func getExternalURL(baseURL *url.URL, artifactURL string) string {
+	parsed, err := url.Parse(artifactURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return artifactURL
+	}
+
+	external := baseURL.JoinPath(parsed.Path)
+	external.RawQuery = parsed.RawQuery
+
+	return external.String()
+}
+
+// getDownloadURL returns the URL for downloading the artifact from the API server
+func getDownloadURL(baseURL *url.URL, r *http.Request, id string) string {
+	if baseURL != nil {
+		return baseURL.JoinPath("artifacts", id, "download").String()
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	url := url.URL{
+		Scheme: scheme,
+		Host:   r.Host,
+		Path:   "/artifacts/" + id + "/download",
+	}
+
+	return url.String()
+}
@@ -2,15 +2,30 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/grafana/k6build"
 	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6build/pkg/builder"
+	"github.com/grafana/k6build/pkg/catalog"
+	"github.com/grafana/k6build/pkg/store/file"
+	"github.com/grafana/k6foundry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 type buildFunction func(
@@ -49,6 +64,18 @@ func buildErr(
 	return k6build.Artifact{}, k6build.ErrBuildFailed
 }
 
+// newAPIServer creates an APIServer, failing the test if the configuration is not valid
+func newAPIServer(t *testing.T, config APIServerConfig) *APIServer {
+	t.Helper()
+
+	server, err := NewAPIServer(config)
+	if err != nil {
+		t.Fatalf("creating api server %v", err)
+	}
+
+	return server
+}
+
 func TestAPIServer(t *testing.T) {
 	t.Parallel()
 
@@ -76,6 +103,14 @@ func TestAPIServer(t *testing.T) {
 			artifact: k6build.Artifact{},
 			err:      api.ErrBuildFailed,
 		},
+		{
+			title:    "platform alias",
+			build:    buildFunction(buildOk),
+			req:      []byte(`{"platform": "native", "k6": "v0.1.0"}`),
+			status:   http.StatusBadRequest,
+			artifact: k6build.Artifact{},
+			err:      api.ErrInvalidRequest,
+		},
 		{
 			title:    "invalid request",
 			build:    buildFunction(buildOk),
@@ -94,7 +129,7 @@ func TestAPIServer(t *testing.T) {
 			config := APIServerConfig{
 				BuildService: tc.build,
 			}
-			apiserver := httptest.NewServer(NewAPIServer(config))
+			apiserver := httptest.NewServer(newAPIServer(t, config))
 
 			req := bytes.Buffer{}
 			req.Write(tc.req)
@@ -123,3 +158,2230 @@ func TestAPIServer(t *testing.T) {
 		})
 	}
 }
+
+// TestAPIServerMountedAtBuild checks the server handles build requests when mounted at the
+// build endpoint, as servers embedding it did before it handled other endpoints
+func TestNewAPIServerInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		config    APIServerConfig
+		expectErr bool
+	}{
+		{
+			title:  "valid download url",
+			config: APIServerConfig{DownloadURL: "http://localhost:8000/download"},
+		},
+		{
+			title:     "malformed download url",
+			config:    APIServerConfig{DownloadURL: "http://local host:8000"},
+			expectErr: true,
+		},
+		{
+			title:     "relative download url",
+			config:    APIServerConfig{DownloadURL: "/download"},
+			expectErr: true,
+		},
+		{
+			title:  "valid external store url",
+			config: APIServerConfig{ExternalStoreURL: "https://store.example.com/k6build"},
+		},
+		{
+			title:     "malformed external store url",
+			config:    APIServerConfig{ExternalStoreURL: "https://store example.com"},
+			expectErr: true,
+		},
+		{
+			title:     "external store url without host",
+			config:    APIServerConfig{ExternalStoreURL: "store.example.com"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			tc.config.BuildService = buildFunction(buildOk)
+			_, err := NewAPIServer(tc.config)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %t got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestAPIServerMountedAtBuild(t *testing.T) {
+	t.Parallel()
+
+	buildAPI := newAPIServer(t, APIServerConfig{BuildService: buildFunction(buildOk)})
+	mux := http.NewServeMux()
+	mux.Handle("POST /build", http.StripPrefix("/build", buildAPI))
+	apiserver := httptest.NewServer(mux)
+	defer apiserver.Close()
+
+	req := bytes.NewBufferString(`{"platform": "linux/amd64", "k6": "v0.1.0"}`)
+	resp, err := http.Post(apiserver.URL+"/build", "application/json", req)
+	if err != nil {
+		t.Fatalf("making request %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code: %d got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	buildResponse := api.BuildResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+	if err != nil {
+		t.Fatalf("decoding response %v", err)
+	}
+
+	if buildResponse.Error != nil {
+		t.Fatalf("unexpected error %v", buildResponse.Error)
+	}
+}
+
+func TestAPIServerValidationErrors(t *testing.T) {
+	t.Parallel()
+
+	apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildFunction(buildOk)}))
+	defer apiserver.Close()
+
+	req := bytes.NewBufferString(`{"k6": "v0.1.0", "dependencies": [{"name": "k6/x/ext"}]}`)
+	resp, err := http.Post(apiserver.URL+"/build", "application/json", req)
+	if err != nil {
+		t.Fatalf("making request %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status code: %d got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	buildResponse := api.BuildResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+	if err != nil {
+		t.Fatalf("decoding response %v", err)
+	}
+
+	if buildResponse.Code != api.CodeInvalidRequest {
+		t.Fatalf("expected code %q got %q", api.CodeInvalidRequest, buildResponse.Code)
+	}
+
+	expected := []api.FieldError{
+		{Field: "platform", Message: "is required"},
+		{Field: "dependencies[0].constraints", Message: "is required (use '*' for any version)"},
+	}
+	if !reflect.DeepEqual(expected, buildResponse.ValidationErrors) {
+		t.Fatalf("expected %v got %v", expected, buildResponse.ValidationErrors)
+	}
+}
+
+func TestAPIServerProxyDownloads(t *testing.T) {
+	t.Parallel()
+
+	build := buildFunction(func(
+		_ context.Context,
+		_ string,
+		_ string,
+		_ []k6build.Dependency,
+	) (k6build.Artifact, error) {
+		return k6build.Artifact{ID: "artifact", URL: "http://store.internal/store/artifact/download"}, nil
+	})
+
+	testCases := []struct {
+		title       string
+		downloadURL string
+		expect      string
+	}{
+		{
+			title:       "with download url",
+			downloadURL: "http://builder.example.com",
+			expect:      "http://builder.example.com/artifacts/artifact/download",
+		},
+		{
+			title:  "url from request",
+			expect: "/artifacts/artifact/download",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := APIServerConfig{
+				BuildService:   build,
+				ProxyDownloads: true,
+				DownloadURL:    tc.downloadURL,
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			req := bytes.NewBufferString(`{"platform": "linux/amd64", "k6": "v0.1.0"}`)
+			resp, err := http.Post(apiserver.URL, "application/json", req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			expect := tc.expect
+			if tc.downloadURL == "" {
+				expect = apiserver.URL + tc.expect
+			}
+
+			if buildResponse.Artifact.URL != expect {
+				t.Fatalf("expected url %q got %q", expect, buildResponse.Artifact.URL)
+			}
+		})
+	}
+}
+
+func TestAPIServerExternalStoreURL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title          string
+		artifactURL    string
+		externalURL    string
+		proxyDownloads bool
+		expect         string
+	}{
+		{
+			title:       "external host",
+			artifactURL: "http://store.internal:9000/store/artifact/download",
+			externalURL: "https://store.example.com",
+			expect:      "https://store.example.com/store/artifact/download",
+		},
+		{
+			title:       "external base path",
+			artifactURL: "http://store.internal:9000/store/artifact/download",
+			externalURL: "https://example.com/k6build/",
+			expect:      "https://example.com/k6build/store/artifact/download",
+		},
+		{
+			title:       "query preserved",
+			artifactURL: "http://minio.internal/bucket/artifact?X-Amz-Expires=3600&X-Amz-Signature=abc",
+			externalURL: "https://minio.example.com",
+			expect:      "https://minio.example.com/bucket/artifact?X-Amz-Expires=3600&X-Amz-Signature=abc",
+		},
+		{
+			title:       "not an http url",
+			artifactURL: "oci://registry.internal/k6@sha256:abc",
+			externalURL: "https://registry.example.com",
+			expect:      "oci://registry.internal/k6@sha256:abc",
+		},
+		{
+			title:       "no external url",
+			artifactURL: "http://store.internal:9000/store/artifact/download",
+			expect:      "http://store.internal:9000/store/artifact/download",
+		},
+		{
+			title:          "proxied downloads",
+			artifactURL:    "http://store.internal:9000/store/artifact/download",
+			externalURL:    "https://store.example.com",
+			proxyDownloads: true,
+			expect:         "http://builder.example.com/artifacts/artifact/download",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			build := buildFunction(func(
+				_ context.Context,
+				_ string,
+				_ string,
+				_ []k6build.Dependency,
+			) (k6build.Artifact, error) {
+				return k6build.Artifact{ID: "artifact", URL: tc.artifactURL}, nil
+			})
+
+			config := APIServerConfig{
+				BuildService:     build,
+				ProxyDownloads:   tc.proxyDownloads,
+				DownloadURL:      "http://builder.example.com",
+				ExternalStoreURL: tc.externalURL,
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			req := bytes.NewBufferString(`{"platform": "linux/amd64", "k6": "v0.1.0"}`)
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if buildResponse.Artifact.URL != tc.expect {
+				t.Fatalf("expected url %q got %q", tc.expect, buildResponse.Artifact.URL)
+			}
+		})
+	}
+}
+
+func TestAPIServerCapabilities(t *testing.T) {
+	t.Parallel()
+
+	capabilities := api.Capabilities{
+		Platforms:  []string{"linux/amd64", "windows/amd64"},
+		CgoEnabled: true,
+		Catalog:    "https://example.com/catalog.json",
+	}
+
+	config := APIServerConfig{
+		BuildService: buildFunction(buildOk),
+		Capabilities: capabilities,
+		Profiles:     map[string][]k6build.Dependency{"minimal": nil, "full": nil},
+	}
+	capabilities.Profiles = []string{"full", "minimal"}
+	apiserver := httptest.NewServer(newAPIServer(t, config))
+	defer apiserver.Close()
+
+	resp, err := http.Get(apiserver.URL + "/capabilities")
+	if err != nil {
+		t.Fatalf("making request %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	got := api.Capabilities{}
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	if err != nil {
+		t.Fatalf("decoding response %v", err)
+	}
+
+	if !reflect.DeepEqual(capabilities, got) {
+		t.Fatalf("expected %v got %v", capabilities, got)
+	}
+}
+
+func gzipped(content []byte) []byte {
+	buffer := &bytes.Buffer{}
+	gz := gzip.NewWriter(buffer)
+	_, _ = gz.Write(content)
+	_ = gz.Close()
+	return buffer.Bytes()
+}
+
+func TestAPIServerCompressedRequest(t *testing.T) {
+	t.Parallel()
+
+	buildRequest := []byte(`{"platform": "linux/amd64", "k6": "v0.1.0"}`)
+
+	testCases := []struct {
+		title    string
+		encoding string
+		req      []byte
+		maxSize  int64
+		status   int
+		err      error
+	}{
+		{
+			title:    "gzip request",
+			encoding: "gzip",
+			req:      gzipped(buildRequest),
+			status:   http.StatusOK,
+		},
+		{
+			title:    "invalid gzip content",
+			encoding: "gzip",
+			req:      buildRequest,
+			status:   http.StatusBadRequest,
+			err:      api.ErrInvalidRequest,
+		},
+		{
+			title:    "unsupported encoding",
+			encoding: "br",
+			req:      buildRequest,
+			status:   http.StatusUnsupportedMediaType,
+			err:      api.ErrInvalidRequest,
+		},
+		{
+			title:    "decompressed request too large",
+			encoding: "gzip",
+			req:      gzipped(append(bytes.Repeat([]byte(" "), 1024), buildRequest...)),
+			maxSize:  512,
+			status:   http.StatusRequestEntityTooLarge,
+			err:      api.ErrInvalidRequest,
+		},
+		{
+			title:   "uncompressed request too large",
+			req:     append(bytes.Repeat([]byte(" "), 1024), buildRequest...),
+			maxSize: 512,
+			status:  http.StatusRequestEntityTooLarge,
+			err:     api.ErrInvalidRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := APIServerConfig{
+				BuildService:   buildFunction(buildOk),
+				MaxRequestSize: tc.maxSize,
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			req, err := http.NewRequest(http.MethodPost, apiserver.URL+"/build", bytes.NewReader(tc.req))
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if tc.err != nil && !errors.Is(buildResponse.Error, tc.err) {
+				t.Fatalf("expected error: %q got %q", tc.err, buildResponse.Error)
+			}
+		})
+	}
+}
+
+func TestAPIServerWarnings(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title    string
+		req      string
+		warnings int
+	}{
+		{
+			title:    "pinned constraints",
+			req:      `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			warnings: 0,
+		},
+		{
+			title:    "floating k6 constraint",
+			req:      `{"platform": "linux/amd64", "k6": "*"}`,
+			warnings: 1,
+		},
+		{
+			title: "floating dependency constraint",
+			req: `{"platform": "linux/amd64", "k6": "=v0.1.0",` +
+				` "dependencies": [{"name": "k6/x/ext", "constraints": ">v0.1.0"}]}`,
+			warnings: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := APIServerConfig{
+				BuildService: buildFunction(buildOk),
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBufferString(tc.req))
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if len(buildResponse.Warnings) != tc.warnings {
+				t.Fatalf("expected %d warnings got %v", tc.warnings, buildResponse.Warnings)
+			}
+
+			if headers := resp.Header.Values("Warning"); len(headers) != tc.warnings {
+				t.Fatalf("expected %d warning headers got %v", tc.warnings, headers)
+			}
+		})
+	}
+}
+
+func TestAPIServerRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title       string
+		timeout     string
+		status      int
+		hasDeadline bool
+	}{
+		{
+			title:       "no timeout",
+			timeout:     "",
+			status:      http.StatusOK,
+			hasDeadline: false,
+		},
+		{
+			title:       "with timeout",
+			timeout:     "10s",
+			status:      http.StatusOK,
+			hasDeadline: true,
+		},
+		{
+			title:   "invalid timeout",
+			timeout: "ten seconds",
+			status:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			hasDeadline := false
+			build := func(
+				ctx context.Context,
+				platform string,
+				k6Constrains string,
+				deps []k6build.Dependency,
+			) (k6build.Artifact, error) {
+				_, hasDeadline = ctx.Deadline()
+				return buildOk(ctx, platform, k6Constrains, deps)
+			}
+
+			config := APIServerConfig{
+				BuildService: buildFunction(build),
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			req, err := http.NewRequest(
+				http.MethodPost,
+				apiserver.URL+"/build",
+				bytes.NewBufferString(`{"platform": "linux/amd64", "k6": "v0.1.0"}`),
+			)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+			if tc.timeout != "" {
+				req.Header.Set(api.RequestTimeoutHeader, tc.timeout)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+
+			if hasDeadline != tc.hasDeadline {
+				t.Fatalf("expected build deadline %t got %t", tc.hasDeadline, hasDeadline)
+			}
+		})
+	}
+}
+
+func TestAPIServerVersions(t *testing.T) {
+	t.Parallel()
+
+	catalogJSON := `{
+"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0", "v0.2.0", "v0.3.0"]},
+"k6/x/ext": {"module": "go.k6.io/k6ext", "versions": ["v0.1.0"], "channels": {"beta": ["v0.2.0-beta.1"]}}
+}`
+	catalog, err := catalog.NewCatalogFromJSON(bytes.NewBufferString(catalogJSON))
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	config := APIServerConfig{
+		BuildService: buildFunction(buildOk),
+		Catalog:      catalog,
+	}
+	apiserver := httptest.NewServer(newAPIServer(t, config))
+	t.Cleanup(apiserver.Close)
+
+	testCases := []struct {
+		title    string
+		path     string
+		status   int
+		versions []string
+	}{
+		{
+			title:    "all versions",
+			path:     "/versions/k6",
+			status:   http.StatusOK,
+			versions: []string{"v0.3.0", "v0.2.0", "v0.1.0"},
+		},
+		{
+			title:    "versions satisfying constraints",
+			path:     "/versions/k6?constraints=" + url.QueryEscape("<v0.3.0"),
+			status:   http.StatusOK,
+			versions: []string{"v0.2.0", "v0.1.0"},
+		},
+		{
+			title:    "extension versions on channel",
+			path:     "/versions/k6/x/ext?channel=beta",
+			status:   http.StatusOK,
+			versions: []string{"v0.2.0-beta.1", "v0.1.0"},
+		},
+		{
+			title:    "no version satisfies constraints",
+			path:     "/versions/k6?constraints=" + url.QueryEscape(">v0.3.0"),
+			status:   http.StatusOK,
+			versions: []string{},
+		},
+		{
+			title:  "unknown dependency",
+			path:   "/versions/k6/x/unknown",
+			status: http.StatusNotFound,
+		},
+		{
+			title:  "invalid constraints",
+			path:   "/versions/k6?constraints=invalid",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(apiserver.URL + tc.path)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			versionsResponse := api.VersionsResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&versionsResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if !reflect.DeepEqual(tc.versions, versionsResponse.Versions) {
+				t.Fatalf("expected %v got %v", tc.versions, versionsResponse.Versions)
+			}
+		})
+	}
+}
+
+func TestAPIServerCatalogVersions(t *testing.T) {
+	t.Parallel()
+
+	catalogJSON := `{
+"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0", "v0.3.0-rc1", "v0.2.0"]},
+"k6/x/ext": {"module": "go.k6.io/k6ext", "versions": ["v0.1.0"]}
+}`
+	catalog, err := catalog.NewCatalogFromJSON(bytes.NewBufferString(catalogJSON))
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	config := APIServerConfig{
+		BuildService: buildFunction(buildOk),
+		Catalog:      catalog,
+	}
+	apiserver := httptest.NewServer(newAPIServer(t, config))
+	t.Cleanup(apiserver.Close)
+
+	testCases := []struct {
+		title    string
+		path     string
+		status   int
+		versions []api.CatalogVersion
+	}{
+		{
+			title:  "versions newest first",
+			path:   "/catalog/k6/versions",
+			status: http.StatusOK,
+			versions: []api.CatalogVersion{
+				{Version: "v0.3.0-rc1", Prerelease: true},
+				{Version: "v0.2.0"},
+				{Version: "v0.1.0"},
+			},
+		},
+		{
+			title:    "extension versions",
+			path:     "/catalog/k6/x/ext/versions",
+			status:   http.StatusOK,
+			versions: []api.CatalogVersion{{Version: "v0.1.0"}},
+		},
+		{
+			title:  "unknown dependency",
+			path:   "/catalog/k6/x/unknown/versions",
+			status: http.StatusNotFound,
+		},
+		{
+			title:  "unknown path",
+			path:   "/catalog/k6",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(apiserver.URL + tc.path)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			versionsResponse := api.CatalogVersionsResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&versionsResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if !reflect.DeepEqual(tc.versions, versionsResponse.Versions) {
+				t.Fatalf("expected %v got %v", tc.versions, versionsResponse.Versions)
+			}
+		})
+	}
+}
+
+func TestAPIServerCatalog(t *testing.T) {
+	t.Parallel()
+
+	catalogJSON := `{
+"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0", "v0.2.0"]},
+"k6/x/output-kafka": {"module": "github.com/grafana/xk6-output-kafka", "versions": ["v0.1.0"],
+	"channels": {"beta": ["v0.2.0-beta.1"]}},
+"k6/x/sql": {"module": "github.com/grafana/xk6-sql", "cgo": true, "versions": ["v0.1.0"]}
+}`
+	catalog, err := catalog.NewCatalogFromJSON(bytes.NewBufferString(catalogJSON))
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	config := APIServerConfig{
+		BuildService: buildFunction(buildOk),
+		Catalog:      catalog,
+	}
+	apiserver := httptest.NewServer(newAPIServer(t, config))
+	t.Cleanup(apiserver.Close)
+
+	k6 := api.CatalogDependency{
+		Name:     "k6",
+		Module:   "go.k6.io/k6",
+		Versions: []api.CatalogVersion{{Version: "v0.2.0"}, {Version: "v0.1.0"}},
+	}
+	kafka := api.CatalogDependency{
+		Name:     "k6/x/output-kafka",
+		Module:   "github.com/grafana/xk6-output-kafka",
+		Versions: []api.CatalogVersion{{Version: "v0.1.0"}},
+		Channels: map[string][]api.CatalogVersion{
+			"beta": {{Version: "v0.2.0-beta.1", Prerelease: true}},
+		},
+	}
+	sql := api.CatalogDependency{
+		Name:     "k6/x/sql",
+		Module:   "github.com/grafana/xk6-sql",
+		Cgo:      true,
+		Versions: []api.CatalogVersion{{Version: "v0.1.0"}},
+	}
+
+	testCases := []struct {
+		title        string
+		path         string
+		dependencies []api.CatalogDependency
+	}{
+		{
+			title:        "all dependencies",
+			path:         "/catalog",
+			dependencies: []api.CatalogDependency{k6, kafka, sql},
+		},
+		{
+			title:        "filter by name",
+			path:         "/catalog?name=kafka",
+			dependencies: []api.CatalogDependency{kafka},
+		},
+		{
+			title:        "extensions",
+			path:         "/catalog?name=k6/x/",
+			dependencies: []api.CatalogDependency{kafka, sql},
+		},
+		{
+			title:        "no match",
+			path:         "/catalog?name=kubernetes",
+			dependencies: []api.CatalogDependency{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.Get(apiserver.URL + tc.path)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code: %d got %d", http.StatusOK, resp.StatusCode)
+			}
+
+			if cacheControl := resp.Header.Get("Cache-Control"); !strings.HasPrefix(cacheControl, "private, max-age=") {
+				t.Fatalf("expected cache control header got %q", cacheControl)
+			}
+
+			catalogResponse := api.CatalogResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&catalogResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if !reflect.DeepEqual(tc.dependencies, catalogResponse.Dependencies) {
+				t.Fatalf("expected %v got %v", tc.dependencies, catalogResponse.Dependencies)
+			}
+		})
+	}
+}
+
+func TestAPIServerProfiles(t *testing.T) {
+	t.Parallel()
+
+	profiles := map[string][]k6build.Dependency{
+		"minimal": {
+			{Name: "k6/x/ext", Constraints: "v0.1.0"},
+			{Name: "k6/x/ext2", Constraints: "v0.1.0"},
+		},
+	}
+
+	testCases := []struct {
+		title  string
+		req    string
+		status int
+		err    error
+		deps   []k6build.Dependency
+	}{
+		{
+			title: "no profile",
+			req: `{"platform": "linux/amd64", "k6": "v0.1.0",` +
+				` "dependencies": [{"name": "k6/x/ext", "constraints": "v0.2.0"}]}`,
+			status: http.StatusOK,
+			deps:   []k6build.Dependency{{Name: "k6/x/ext", Constraints: "v0.2.0"}},
+		},
+		{
+			title:  "profile",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0", "profile": "minimal"}`,
+			status: http.StatusOK,
+			deps:   profiles["minimal"],
+		},
+		{
+			title: "profile merged with dependencies",
+			req: `{"platform": "linux/amd64", "k6": "v0.1.0", "profile": "minimal",` +
+				` "dependencies": [{"name": "k6/x/ext", "constraints": "v0.2.0"},` +
+				` {"name": "k6/x/ext3", "constraints": "v0.1.0"}]}`,
+			status: http.StatusOK,
+			deps: []k6build.Dependency{
+				{Name: "k6/x/ext", Constraints: "v0.2.0"},
+				{Name: "k6/x/ext3", Constraints: "v0.1.0"},
+				{Name: "k6/x/ext2", Constraints: "v0.1.0"},
+			},
+		},
+		{
+			title:  "unknown profile",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0", "profile": "unknown"}`,
+			status: http.StatusBadRequest,
+			err:    api.ErrInvalidRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			var requested []k6build.Dependency
+			build := func(
+				_ context.Context,
+				_ string,
+				_ string,
+				deps []k6build.Dependency,
+			) (k6build.Artifact, error) {
+				requested = deps
+				return k6build.Artifact{}, nil
+			}
+
+			config := APIServerConfig{
+				BuildService: buildFunction(build),
+				Profiles:     profiles,
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBufferString(tc.req))
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if tc.err != nil {
+				if !errors.Is(buildResponse.Error, tc.err) {
+					t.Fatalf("expected error: %q got %q", tc.err, buildResponse.Error)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(requested, tc.deps) {
+				t.Fatalf("expected dependencies %v got %v", tc.deps, requested)
+			}
+		})
+	}
+}
+
+func TestAPIServerEnsure(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		query  string
+		status int
+	}{
+		{
+			title:  "no ensure parameter",
+			query:  "",
+			status: http.StatusOK,
+		},
+		{
+			title:  "ensure",
+			query:  "?ensure=true",
+			status: http.StatusOK,
+		},
+		{
+			title:  "not ensure",
+			query:  "?ensure=false",
+			status: http.StatusBadRequest,
+		},
+		{
+			title:  "invalid ensure",
+			query:  "?ensure=maybe",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			config := APIServerConfig{
+				BuildService: buildFunction(buildOk),
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			resp, err := http.Post(
+				apiserver.URL+"/build"+tc.query,
+				"application/json",
+				bytes.NewBufferString(`{"platform": "linux/amd64", "k6": "v0.1.0"}`),
+			)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if tc.status != http.StatusOK && !errors.Is(buildResponse.Error, api.ErrInvalidRequest) {
+				t.Fatalf("expected error: %q got %q", api.ErrInvalidRequest, buildResponse.Error)
+			}
+		})
+	}
+}
+
+func TestAPIServerErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	buildErrorFunc := func(err error) buildFunction {
+		return func(_ context.Context, _ string, _ string, _ []k6build.Dependency) (k6build.Artifact, error) {
+			return k6build.Artifact{}, err
+		}
+	}
+
+	testCases := []struct {
+		title string
+		build buildFunction
+		req   string
+		code  string
+	}{
+		{
+			title: "invalid request",
+			build: buildFunction(buildOk),
+			req:   "",
+			code:  api.CodeInvalidRequest,
+		},
+		{
+			title: "build failed",
+			build: buildFunction(buildErr),
+			req:   `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			code:  api.CodeBuildFailed,
+		},
+		{
+			title: "cannot satisfy",
+			build: buildErrorFunc(k6build.NewWrappedError(errors.New("invalid parameters"), catalog.ErrCannotSatisfy)),
+			req:   `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			code:  api.CodeCannotSatisfy,
+		},
+		{
+			title: "unknown dependency",
+			build: buildErrorFunc(catalog.ErrUnknownDependency),
+			req:   `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			code:  api.CodeCannotSatisfy,
+		},
+		{
+			title: "timeout",
+			build: buildErrorFunc(k6build.NewWrappedError(k6build.ErrBuildFailed, context.DeadlineExceeded)),
+			req:   `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			code:  api.CodeTimeout,
+		},
+		{
+			title: "insufficient space",
+			build: buildErrorFunc(k6build.NewWrappedError(k6build.ErrBuildFailed, k6build.ErrInsufficientSpace)),
+			req:   `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			code:  api.CodeInsufficientStorage,
+		},
+		{
+			title: "proxy authentication",
+			build: buildErrorFunc(k6build.NewWrappedError(k6build.ErrBuildFailed, k6build.ErrProxyAuth)),
+			req:   `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			code:  api.CodeProxyAuth,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: tc.build}))
+			defer apiserver.Close()
+
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBufferString(tc.req))
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if buildResponse.Code != tc.code {
+				t.Fatalf("expected code %q got %q", tc.code, buildResponse.Code)
+			}
+		})
+	}
+}
+
+func TestAPIServerDependencyResults(t *testing.T) {
+	t.Parallel()
+
+	resolveErr := &catalog.ResolveError{
+		Resolutions: []catalog.Resolution{
+			{
+				Dependency: catalog.Dependency{Name: "k6", Constrains: "v0.1.0"},
+				Module:     catalog.Module{Path: "go.k6.io/k6", Version: "v0.1.0"},
+			},
+			{
+				Dependency: catalog.Dependency{Name: "k6/x/ext", Constrains: "v0.2.0"},
+				Err:        catalog.ErrCannotSatisfy,
+			},
+		},
+	}
+	build := func(_ context.Context, _ string, _ string, _ []k6build.Dependency) (k6build.Artifact, error) {
+		return k6build.Artifact{}, k6build.NewWrappedError(errors.New("invalid parameters"), resolveErr)
+	}
+
+	apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildFunction(build)}))
+	defer apiserver.Close()
+
+	req := `{"platform": "linux/amd64", "k6": "v0.1.0", "dependencies": [{"name": "k6/x/ext", "constraints": "v0.2.0"}]}`
+	resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBufferString(req))
+	if err != nil {
+		t.Fatalf("making request %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	buildResponse := api.BuildResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+	if err != nil {
+		t.Fatalf("decoding response %v", err)
+	}
+
+	if buildResponse.Code != api.CodeCannotSatisfy {
+		t.Fatalf("expected code %q got %q", api.CodeCannotSatisfy, buildResponse.Code)
+	}
+
+	expected := []api.DependencyResult{
+		{Name: "k6", Version: "v0.1.0"},
+		{Name: "k6/x/ext", Error: catalog.ErrCannotSatisfy.Error()},
+	}
+	if !reflect.DeepEqual(expected, buildResponse.DependencyResults) {
+		t.Fatalf("expected %v got %v", expected, buildResponse.DependencyResults)
+	}
+}
+
+func TestAPIServerQueueFull(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title      string
+		err        *k6build.QueueFullError
+		retryAfter string
+		position   string
+		waitHeader string
+	}{
+		{
+			title:      "estimated wait",
+			err:        &k6build.QueueFullError{Position: 3, EstimatedWait: 1500 * time.Millisecond},
+			retryAfter: "2",
+			position:   "3",
+			waitHeader: "1.5s",
+		},
+		{
+			title:      "unknown wait",
+			err:        &k6build.QueueFullError{Position: 1},
+			retryAfter: "1",
+			position:   "1",
+			waitHeader: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			build := func(_ context.Context, _ string, _ string, _ []k6build.Dependency) (k6build.Artifact, error) {
+				return k6build.Artifact{}, k6build.NewWrappedError(errors.New("building artifact"), tc.err)
+			}
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildFunction(build)}))
+			defer apiserver.Close()
+
+			req := `{"platform": "linux/amd64", "k6": "v0.1.0"}`
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBufferString(req))
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Fatalf("expected %s got %s", http.StatusText(http.StatusServiceUnavailable), resp.Status)
+			}
+
+			headers := map[string]string{
+				"Retry-After":           tc.retryAfter,
+				api.QueuePositionHeader: tc.position,
+				api.EstimatedWaitHeader: tc.waitHeader,
+			}
+			for header, expected := range headers {
+				if got := resp.Header.Get(header); got != expected {
+					t.Fatalf("%s: expected %q got %q", header, expected, got)
+				}
+			}
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if buildResponse.Code != api.CodeQueueFull {
+				t.Fatalf("expected code %q got %q", api.CodeQueueFull, buildResponse.Code)
+			}
+		})
+	}
+}
+
+func TestAPIServerStreaming(t *testing.T) {
+	t.Parallel()
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	content := []byte("k6 binary")
+	object, err := store.Put(context.TODO(), "artifact", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("test setup: %v", err)
+	}
+
+	buildStored := func(_ context.Context, platform string, _ string, _ []k6build.Dependency) (k6build.Artifact, error) {
+		return k6build.Artifact{
+			ID:           object.ID,
+			URL:          object.URL,
+			Checksum:     object.Checksum,
+			Platform:     platform,
+			Dependencies: map[string]string{"k6": "v0.1.0"},
+		}, nil
+	}
+
+	testCases := []struct {
+		title        string
+		build        buildFunction
+		accept       string
+		query        string
+		req          string
+		status       int
+		expectBinary bool
+	}{
+		{
+			title:  "default",
+			build:  buildStored,
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusOK,
+		},
+		{
+			title:  "accept json",
+			build:  buildStored,
+			accept: "application/json",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusOK,
+		},
+		{
+			title:        "accept binary",
+			build:        buildStored,
+			accept:       "application/octet-stream",
+			req:          `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status:       http.StatusOK,
+			expectBinary: true,
+		},
+		{
+			title:  "accept binary and json",
+			build:  buildStored,
+			accept: "application/octet-stream, application/json;q=0.9",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusOK,
+		},
+		{
+			title:  "accept binary with ensure",
+			build:  buildStored,
+			accept: "application/octet-stream",
+			query:  "?ensure=true",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusOK,
+		},
+		{
+			title:  "accept binary build failed",
+			build:  buildErr,
+			accept: "application/octet-stream",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusInternalServerError,
+		},
+		{
+			title:  "accept binary not stored",
+			build:  buildStored,
+			accept: "application/octet-stream",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0", "no_store": true}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: tc.build}))
+			defer apiserver.Close()
+
+			req, err := http.NewRequestWithContext(
+				context.TODO(),
+				http.MethodPost,
+				apiserver.URL+"/build"+tc.query,
+				bytes.NewBufferString(tc.req),
+			)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+
+			if tc.expectBinary {
+				if contentType := resp.Header.Get("Content-Type"); contentType != "application/octet-stream" {
+					t.Fatalf("expected binary content got %q", contentType)
+				}
+
+				if etag := resp.Header.Get("ETag"); etag != fmt.Sprintf("%q", object.ID) {
+					t.Fatalf("expected ETag %q got %q", object.ID, etag)
+				}
+
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("reading response %v", err)
+				}
+				if !bytes.Equal(body, content) {
+					t.Fatalf("expected %q got %q", content, body)
+				}
+				return
+			}
+
+			buildResponse := api.BuildResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&buildResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if tc.status == http.StatusOK && buildResponse.Artifact.ID != object.ID {
+				t.Fatalf("expected artifact %q got %v", object.ID, buildResponse)
+			}
+		})
+	}
+}
+
+// artifactResolver is a build service that resolves the artifacts without building them
+type artifactResolver struct {
+	buildFunction
+	resolve buildFunction
+}
+
+func (r artifactResolver) ResolveArtifact(
+	ctx context.Context,
+	platform string,
+	k6Constrains string,
+	deps []k6build.Dependency,
+) (k6build.Artifact, error) {
+	return r.resolve(ctx, platform, k6Constrains, deps)
+}
+
+// artifactInvalidator is a build service that invalidates the artifacts
+type artifactInvalidator struct {
+	buildFunction
+	invalidate func(context.Context, string) error
+}
+
+func (i artifactInvalidator) InvalidateArtifact(ctx context.Context, id string) error {
+	return i.invalidate(ctx, id)
+}
+
+func TestAPIServerInvalidate(t *testing.T) {
+	t.Parallel()
+
+	invalidate := func(_ context.Context, id string) error {
+		switch id {
+		case "artifact":
+			return nil
+		case "missing":
+			return k6build.ErrArtifactNotFound
+		default:
+			return errors.New("store error")
+		}
+	}
+
+	testCases := []struct {
+		title  string
+		srv    k6build.BuildService
+		id     string
+		status int
+	}{
+		{
+			title:  "invalidate artifact",
+			srv:    artifactInvalidator{buildFunction: buildOk, invalidate: invalidate},
+			id:     "artifact",
+			status: http.StatusNoContent,
+		},
+		{
+			title:  "artifact not found",
+			srv:    artifactInvalidator{buildFunction: buildOk, invalidate: invalidate},
+			id:     "missing",
+			status: http.StatusNotFound,
+		},
+		{
+			title:  "error invalidating artifact",
+			srv:    artifactInvalidator{buildFunction: buildOk, invalidate: invalidate},
+			id:     "other",
+			status: http.StatusInternalServerError,
+		},
+		{
+			title:  "not supported by the build service",
+			srv:    buildFunction(buildOk),
+			id:     "artifact",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: tc.srv}))
+			defer apiserver.Close()
+
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodDelete, apiserver.URL+"/build/"+tc.id, nil)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+		})
+	}
+}
+
+func TestAPIServerArtifactID(t *testing.T) {
+	t.Parallel()
+
+	resolveOk := func(_ context.Context, platform string, _ string, _ []k6build.Dependency) (k6build.Artifact, error) {
+		return k6build.Artifact{
+			ID:           "artifact",
+			Platform:     platform,
+			Dependencies: map[string]string{"k6": "v0.1.0"},
+		}, nil
+	}
+
+	resolveErr := func(_ context.Context, _ string, _ string, _ []k6build.Dependency) (k6build.Artifact, error) {
+		return k6build.Artifact{}, k6build.NewWrappedError(errors.New("invalid parameters"), catalog.ErrCannotSatisfy)
+	}
+
+	testCases := []struct {
+		title  string
+		srv    k6build.BuildService
+		req    string
+		status int
+		code   string
+		expect api.ArtifactIDResponse
+	}{
+		{
+			title:  "resolve artifact",
+			srv:    artifactResolver{buildFunction: buildErr, resolve: resolveOk},
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusOK,
+			expect: api.ArtifactIDResponse{
+				ID:           "artifact",
+				Platform:     "linux/amd64",
+				Dependencies: map[string]string{"k6": "v0.1.0"},
+			},
+		},
+		{
+			title:  "cannot satisfy",
+			srv:    artifactResolver{buildFunction: buildErr, resolve: resolveErr},
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusBadRequest,
+			code:   api.CodeCannotSatisfy,
+		},
+		{
+			title:  "invalid request",
+			srv:    artifactResolver{buildFunction: buildErr, resolve: resolveOk},
+			req:    "",
+			status: http.StatusBadRequest,
+			code:   api.CodeInvalidRequest,
+		},
+		{
+			title:  "not supported by the build service",
+			srv:    buildFunction(buildOk),
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: tc.srv}))
+			defer apiserver.Close()
+
+			resp, err := http.Post(apiserver.URL+"/artifacts/id", "application/json", bytes.NewBufferString(tc.req))
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+
+			if tc.status == http.StatusNotFound {
+				return
+			}
+
+			idResponse := api.ArtifactIDResponse{}
+			err = json.NewDecoder(resp.Body).Decode(&idResponse)
+			if err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if idResponse.Code != tc.code {
+				t.Fatalf("expected code %q got %q", tc.code, idResponse.Code)
+			}
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			if !reflect.DeepEqual(idResponse, tc.expect) {
+				t.Fatalf("expected %v got %v", tc.expect, idResponse)
+			}
+		})
+	}
+}
+
+func TestAPIServerArtifactIDQuery(t *testing.T) {
+	t.Parallel()
+
+	resolve := func(_ context.Context, platform string, _ string, deps []k6build.Dependency) (k6build.Artifact, error) {
+		resolved := map[string]string{"k6": "v0.1.0"}
+		for _, d := range deps {
+			resolved[d.Name] = "v0.2.0"
+		}
+		return k6build.Artifact{
+			ID:           "artifact-" + platform,
+			Platform:     platform,
+			Dependencies: resolved,
+		}, nil
+	}
+
+	srv := artifactResolver{buildFunction: buildErr, resolve: resolve}
+	apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: srv}))
+	t.Cleanup(apiserver.Close)
+
+	testCases := []struct {
+		title       string
+		query       string
+		ifNoneMatch string
+		status      int
+		expectCache string
+		expectDeps  map[string]string
+	}{
+		{
+			title:       "pinned constraints",
+			query:       "platform=linux/amd64&k6=v0.1.0&dep=k6/x/ext:v0.2.0",
+			status:      http.StatusOK,
+			expectCache: "private, max-age=300",
+			expectDeps:  map[string]string{"k6": "v0.1.0", "k6/x/ext": "v0.2.0"},
+		},
+		{
+			title:       "floating constraints",
+			query:       "platform=linux/amd64&dep=k6/x/ext",
+			status:      http.StatusOK,
+			expectCache: "no-store",
+			expectDeps:  map[string]string{"k6": "v0.1.0", "k6/x/ext": "v0.2.0"},
+		},
+		{
+			title:       "not modified",
+			query:       "platform=linux/amd64&k6=v0.1.0",
+			ifNoneMatch: `"artifact-linux/amd64"`,
+			status:      http.StatusNotModified,
+			expectCache: "private, max-age=300",
+		},
+		{
+			title:  "missing platform",
+			query:  "k6=v0.1.0",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, apiserver.URL+"/artifacts/id?"+tc.query, nil)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+
+			if tc.status == http.StatusBadRequest {
+				return
+			}
+
+			if etag := resp.Header.Get("ETag"); etag != `"artifact-linux/amd64"` {
+				t.Fatalf("unexpected ETag %q", etag)
+			}
+
+			if cache := resp.Header.Get("Cache-Control"); cache != tc.expectCache {
+				t.Fatalf("expected Cache-Control %q got %q", tc.expectCache, cache)
+			}
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			idResponse := api.ArtifactIDResponse{}
+			if err = json.NewDecoder(resp.Body).Decode(&idResponse); err != nil {
+				t.Fatalf("decoding response %v", err)
+			}
+
+			if !reflect.DeepEqual(idResponse.Dependencies, tc.expectDeps) {
+				t.Fatalf("expected %v got %v", tc.expectDeps, idResponse.Dependencies)
+			}
+		})
+	}
+}
+
+func TestAPIServerCurrentArtifact(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title   string
+		current string
+		status  int
+	}{
+		{
+			title:  "no current artifact",
+			status: http.StatusOK,
+		},
+		{
+			title:   "artifact changed",
+			current: "other",
+			status:  http.StatusOK,
+		},
+		{
+			title:   "artifact unchanged",
+			current: "artifact",
+			status:  http.StatusNotModified,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			build := func(
+				ctx context.Context,
+				_ string,
+				_ string,
+				_ []k6build.Dependency,
+			) (k6build.Artifact, error) {
+				if k6build.BuildOptsFromContext(ctx).CurrentArtifact == "artifact" {
+					return k6build.Artifact{}, k6build.ErrArtifactUnchanged
+				}
+				return k6build.Artifact{ID: "artifact"}, nil
+			}
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildFunction(build)}))
+			defer apiserver.Close()
+
+			req, err := json.Marshal(api.BuildRequest{Platform: "linux/amd64", K6Constrains: "*", CurrentArtifact: tc.current})
+			if err != nil {
+				t.Fatalf("encoding request %v", err)
+			}
+
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// slowFoundryBuilder is a foundry builder that takes a given time to build and counts the builds
+type slowFoundryBuilder struct {
+	delay  time.Duration
+	builds *atomic.Int32
+}
+
+func (s slowFoundryBuilder) Build(
+	_ context.Context,
+	platform k6foundry.Platform,
+	_ string,
+	mods []k6foundry.Module,
+	_ []string,
+	out io.Writer,
+) (*k6foundry.BuildInfo, error) {
+	s.builds.Add(1)
+	time.Sleep(s.delay)
+
+	modVersions := map[string]string{}
+	for _, mod := range mods {
+		modVersions[mod.Path] = mod.Version
+	}
+
+	if _, err := out.Write([]byte("k6 binary")); err != nil {
+		return nil, err
+	}
+
+	return &k6foundry.BuildInfo{Platform: platform.String(), ModVersions: modVersions}, nil
+}
+
+// TestAPIServerCoalescedBuilds checks concurrent identical requests are served with a single build
+func TestAPIServerCoalescedBuilds(t *testing.T) {
+	t.Parallel()
+
+	const requests = 50
+
+	catalog, err := catalog.NewCatalogFromJSON(bytes.NewBufferString(
+		`{"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0"]}}`,
+	))
+	if err != nil {
+		t.Fatalf("creating catalog %v", err)
+	}
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	builds := &atomic.Int32{}
+	registry := prometheus.NewRegistry()
+	buildsrv, err := builder.New(context.Background(), builder.Config{
+		Catalog: catalog,
+		Store:   store,
+		Foundry: builder.FoundryFunction(
+			func(context.Context, k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+				return slowFoundryBuilder{delay: time.Second, builds: builds}, nil
+			},
+		),
+		Registerer: registry,
+	})
+	if err != nil {
+		t.Fatalf("creating builder %v", err)
+	}
+
+	apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildsrv}))
+	t.Cleanup(apiserver.Close)
+
+	artifacts := make(chan k6build.Artifact, requests)
+	errs := make(chan error, requests)
+	wg := sync.WaitGroup{}
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := `{"platform": "linux/amd64", "k6": "v0.1.0"}`
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBufferString(req))
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			buildResponse := api.BuildResponse{}
+			if err = json.NewDecoder(resp.Body).Decode(&buildResponse); err != nil {
+				errs <- err
+				return
+			}
+			if buildResponse.Error != nil {
+				errs <- buildResponse.Error
+				return
+			}
+
+			artifacts <- buildResponse.Artifact
+		}()
+	}
+	wg.Wait()
+	close(artifacts)
+
+	select {
+	case err = <-errs:
+		t.Fatalf("unexpected %v", err)
+	default:
+	}
+
+	if n := builds.Load(); n != 1 {
+		t.Fatalf("expected 1 build got %d", n)
+	}
+
+	first := <-artifacts
+	for artifact := range artifacts {
+		if !reflect.DeepEqual(first, artifact) {
+			t.Fatalf("expected %v got %v", first, artifact)
+		}
+	}
+
+	expected := fmt.Sprintf(`
+# HELP k6build_build_coalesced_total The total number of requests served with the artifact built by a concurrent request
+# TYPE k6build_build_coalesced_total counter
+k6build_build_coalesced_total %d
+`, requests-1)
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "k6build_build_coalesced_total")
+	if err != nil {
+		t.Fatalf("unexpected metrics %v", err)
+	}
+}
+
+func TestAPIServerDownload(t *testing.T) {
+	t.Parallel()
+
+	// build returns an artifact with the dependencies resolved to v0.1.0
+	build := func(_ context.Context, _ string, _ string, deps []k6build.Dependency) (k6build.Artifact, error) {
+		resolved := map[string]string{"k6": "v0.1.0"}
+		for _, d := range deps {
+			if d.Name == "k6/x/unknown" {
+				return k6build.Artifact{}, k6build.NewWrappedError(errors.New("invalid parameters"), catalog.ErrUnknownDependency)
+			}
+			resolved[d.Name] = "v0.1.0"
+		}
+		return k6build.Artifact{
+			ID:           "artifact",
+			URL:          "http://store/artifact",
+			Dependencies: resolved,
+		}, nil
+	}
+
+	testCases := []struct {
+		title        string
+		query        string
+		status       int
+		location     string
+		cacheControl string
+		warnings     int
+		code         string
+	}{
+		{
+			title:        "pinned constraints",
+			query:        "platform=linux/amd64&k6=v0.1.0&dep=k6/x/ext:v0.1.0",
+			status:       http.StatusFound,
+			location:     "http://store/artifact",
+			cacheControl: "private, max-age=300",
+			warnings:     0,
+		},
+		{
+			title:        "floating constraints",
+			query:        "platform=linux/amd64&dep=k6/x/ext",
+			status:       http.StatusFound,
+			location:     "http://store/artifact",
+			cacheControl: "no-store",
+			warnings:     2,
+		},
+		{
+			title:  "missing platform",
+			query:  "k6=v0.1.0",
+			status: http.StatusBadRequest,
+			code:   api.CodeInvalidRequest,
+		},
+		{
+			title:  "unknown dependency",
+			query:  "platform=linux/amd64&k6=v0.1.0&dep=k6/x/unknown:v0.1.0",
+			status: http.StatusBadRequest,
+			code:   api.CodeCannotSatisfy,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildFunction(build)}))
+			t.Cleanup(apiserver.Close)
+
+			client := &http.Client{
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+
+			resp, err := client.Get(apiserver.URL + "/download?" + tc.query)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected status code: %d got %d", tc.status, resp.StatusCode)
+			}
+
+			if tc.status != http.StatusFound {
+				buildResponse := api.BuildResponse{}
+				if err = json.NewDecoder(resp.Body).Decode(&buildResponse); err != nil {
+					t.Fatalf("decoding response %v", err)
+				}
+				if buildResponse.Code != tc.code {
+					t.Fatalf("expected code %q got %q", tc.code, buildResponse.Code)
+				}
+				return
+			}
+
+			if location := resp.Header.Get("Location"); location != tc.location {
+				t.Fatalf("expected location %q got %q", tc.location, location)
+			}
+
+			if cacheControl := resp.Header.Get("Cache-Control"); cacheControl != tc.cacheControl {
+				t.Fatalf("expected cache control %q got %q", tc.cacheControl, cacheControl)
+			}
+
+			if warnings := len(resp.Header.Values("Warning")); warnings != tc.warnings {
+				t.Fatalf("expected %d warnings got %d", tc.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestAPIServerBatch(t *testing.T) {
+	t.Parallel()
+
+	catalog, err := catalog.NewCatalogFromJSON(bytes.NewBufferString(
+		`{"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0"]}}`,
+	))
+	if err != nil {
+		t.Fatalf("creating catalog %v", err)
+	}
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	builds := &atomic.Int32{}
+	registry := prometheus.NewRegistry()
+	buildsrv, err := builder.New(context.Background(), builder.Config{
+		Catalog: catalog,
+		Store:   store,
+		Foundry: builder.FoundryFunction(
+			func(context.Context, k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+				return slowFoundryBuilder{delay: 10 * time.Millisecond, builds: builds}, nil
+			},
+		),
+		Registerer: registry,
+	})
+	if err != nil {
+		t.Fatalf("creating builder %v", err)
+	}
+
+	apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildsrv, BatchConcurrency: 2}))
+	t.Cleanup(apiserver.Close)
+
+	testCases := []struct {
+		title  string
+		req    string
+		status int
+		expect []api.BuildResponse
+	}{
+		{
+			title: "batch",
+			req: `[
+				{"platform": "linux/amd64", "k6": "v0.1.0"},
+				{"platform": "darwin/arm64", "k6": "v0.1.0"},
+				{"platform": "linux/amd64", "k6": "v0.2.0"},
+				{"k6": "v0.1.0"}
+			]`,
+			status: http.StatusOK,
+			expect: []api.BuildResponse{
+				{Artifact: k6build.Artifact{Platform: "linux/amd64"}},
+				{Artifact: k6build.Artifact{Platform: "darwin/arm64"}},
+				{Code: api.CodeCannotSatisfy},
+				{Code: api.CodeInvalidRequest},
+			},
+		},
+		{
+			title:  "empty batch",
+			req:    `[]`,
+			status: http.StatusBadRequest,
+		},
+		{
+			title:  "invalid batch",
+			req:    `{"platform": "linux/amd64", "k6": "v0.1.0"}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		resp, err := http.Post(apiserver.URL+"/build/batch", "application/json", bytes.NewBufferString(tc.req))
+		if err != nil {
+			t.Fatalf("%s: making request %v", tc.title, err)
+		}
+
+		if resp.StatusCode != tc.status {
+			_ = resp.Body.Close()
+			t.Fatalf("%s: expected %s got %s", tc.title, http.StatusText(tc.status), resp.Status)
+		}
+
+		if tc.status != http.StatusOK {
+			_ = resp.Body.Close()
+			continue
+		}
+
+		responses := []api.BuildResponse{}
+		err = json.NewDecoder(resp.Body).Decode(&responses)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: decoding response %v", tc.title, err)
+		}
+
+		if len(responses) != len(tc.expect) {
+			t.Fatalf("%s: expected %d responses got %d", tc.title, len(tc.expect), len(responses))
+		}
+
+		for i, expected := range tc.expect {
+			got := responses[i]
+			if got.Code != expected.Code {
+				t.Fatalf("%s: response %d expected code %q got %q", tc.title, i, expected.Code, got.Code)
+			}
+
+			if expected.Code != "" {
+				if got.Error == nil {
+					t.Fatalf("%s: response %d expected error", tc.title, i)
+				}
+				continue
+			}
+
+			if got.Error != nil || got.Artifact.ID == "" || got.Artifact.Platform != expected.Artifact.Platform {
+				t.Fatalf("%s: response %d expected artifact for %s got %v", tc.title, i, expected.Artifact.Platform, got)
+			}
+		}
+	}
+
+	// the builds of the batch are counted as single build requests
+	expected := `
+# HELP k6build_requests_total The total number of builds requests
+# TYPE k6build_requests_total counter
+k6build_requests_total 3
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "k6build_requests_total")
+	if err != nil {
+		t.Fatalf("unexpected metrics %v", err)
+	}
+
+	if n := builds.Load(); n != 2 {
+		t.Fatalf("expected 2 builds got %d", n)
+	}
+}
+
+// TestAPIServerTraceContext checks the trace context propagated by the clients is recorded as
+// exemplar of the build duration
+func TestAPIServerTraceContext(t *testing.T) {
+	t.Parallel()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	testCases := []struct {
+		title    string
+		header   string
+		exemplar bool
+	}{
+		{
+			title:    "traceparent",
+			header:   "00-" + traceID + "-00f067aa0ba902b7-01",
+			exemplar: true,
+		},
+		{
+			title:    "no traceparent",
+			exemplar: false,
+		},
+		{
+			title:    "invalid traceparent",
+			header:   "00-" + traceID,
+			exemplar: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			catalog, err := catalog.NewCatalogFromJSON(bytes.NewBufferString(
+				`{"k6": {"module": "go.k6.io/k6", "versions": ["v0.1.0"]}}`,
+			))
+			if err != nil {
+				t.Fatalf("creating catalog %v", err)
+			}
+
+			store, err := file.NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("creating store %v", err)
+			}
+
+			registry := prometheus.NewPedanticRegistry()
+			buildsrv, err := builder.New(context.Background(), builder.Config{
+				Catalog: catalog,
+				Store:   store,
+				Foundry: builder.FoundryFunction(
+					func(context.Context, k6foundry.NativeBuilderOpts) (k6foundry.Builder, error) {
+						return slowFoundryBuilder{builds: &atomic.Int32{}}, nil
+					},
+				),
+				Registerer: registry,
+			})
+			if err != nil {
+				t.Fatalf("creating builder %v", err)
+			}
+
+			apiserver := httptest.NewServer(newAPIServer(t, APIServerConfig{BuildService: buildsrv}))
+			t.Cleanup(apiserver.Close)
+
+			req, err := http.NewRequest(
+				http.MethodPost,
+				apiserver.URL+"/build",
+				bytes.NewBufferString(`{"platform": "linux/amd64", "k6": "v0.1.0"}`),
+			)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tc.header != "" {
+				req.Header.Set("traceparent", tc.header)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected %s got %s", http.StatusText(http.StatusOK), resp.Status)
+			}
+
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatalf("gathering metrics %v", err)
+			}
+
+			exemplar := false
+			for _, family := range families {
+				if family.GetName() != "k6build_build_duration_seconds" {
+					continue
+				}
+
+				for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+					for _, label := range bucket.GetExemplar().GetLabel() {
+						exemplar = exemplar || (label.GetName() == "trace_id" && label.GetValue() == traceID)
+					}
+				}
+			}
+
+			if exemplar != tc.exemplar {
+				t.Fatalf("expected exemplar %t got %t", tc.exemplar, exemplar)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+)
+
+const (
+	// WebhookEventHeader is the header with the type of event notified by a webhook
+	WebhookEventHeader = "X-K6build-Event"
+	// WebhookSignatureHeader is the header with the signature of the webhook's payload,
+	// in the form sha256=<hex encoded HMAC-SHA256 of the body using the webhook secret>
+	WebhookSignatureHeader = "X-K6build-Signature"
+
+	// WebhookBuildSucceeded is the event notified when a build request succeeds
+	WebhookBuildSucceeded = "build.succeeded"
+	// WebhookBuildFailed is the event notified when a build request fails
+	WebhookBuildFailed = "build.failed"
+
+	// DefaultWebhookRetries is the default number of retries for delivering a webhook
+	DefaultWebhookRetries = 3
+	// DefaultWebhookBackoff is the default wait before the first retry. It doubles on each retry
+	DefaultWebhookBackoff = time.Second
+	// DefaultWebhookTimeout is the default timeout for each delivery attempt
+	DefaultWebhookTimeout = 10 * time.Second
+)
+
+// WebhookConfig defines the configuration of the webhook notified on build completion
+type WebhookConfig struct {
+	// URL the events are posted to. If empty, the webhook is disabled
+	URL string
+	// Secret used for signing the payload (see WebhookSignatureHeader). If empty, payloads are not signed
+	Secret string
+	// Retries is the number of retries when the delivery fails. Defaults to DefaultWebhookRetries.
+	// Use a negative value for disabling retries.
+	Retries int
+	// Backoff is the wait before the first retry. Defaults to DefaultWebhookBackoff
+	Backoff time.Duration
+	// Timeout for each delivery attempt. Defaults to DefaultWebhookTimeout
+	Timeout time.Duration
+	// HTTPClient used for delivering the events. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// WebhookEvent is the payload posted to the webhook
+type WebhookEvent struct {
+	// Event type (WebhookBuildSucceeded or WebhookBuildFailed)
+	Event string `json:"event"`
+	// Timestamp of the event
+	Timestamp time.Time `json:"timestamp"`
+	// Request that triggered the build, after expanding its profile
+	Request api.BuildRequest `json:"request"`
+	// Response returned to the client
+	Response api.BuildResponse `json:"response"`
+}
+
+// webhook delivers the events to the configured URL
+type webhook struct {
+	url     string
+	secret  []byte
+	retries int
+	backoff time.Duration
+	timeout time.Duration
+	client  *http.Client
+	log     *slog.Logger
+}
+
+// newWebhook returns a webhook from its configuration, or nil if it is disabled
+func newWebhook(config WebhookConfig, log *slog.Logger) *webhook {
+	if config.URL == "" {
+		return nil
+	}
+
+	retries := config.Retries
+	if retries == 0 {
+		retries = DefaultWebhookRetries
+	}
+	if retries < 0 {
+		retries = 0
+	}
+
+	backoff := config.Backoff
+	if backoff <= 0 {
+		backoff = DefaultWebhookBackoff
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &webhook{
+		url:     config.URL,
+		secret:  []byte(config.Secret),
+		retries: retries,
+		backoff: backoff,
+		timeout: timeout,
+		client:  client,
+		log:     log,
+	}
+}
+
+// notify delivers the event in the background, so the build response is not delayed
+func (h *webhook) notify(event WebhookEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		h.log.Error("encoding webhook event", "error", err.Error())
+		return
+	}
+
+	go func() {
+		err := h.deliver(context.Background(), event.Event, payload)
+		if err != nil {
+			h.log.Error("delivering webhook event", "event", event.Event, "error", err.Error())
+		}
+	}()
+}
+
+// deliver posts the payload, retrying with an exponential backoff if it fails
+func (h *webhook) deliver(ctx context.Context, event string, payload []byte) error {
+	backoff := h.backoff
+	var err error
+	for attempt := 0; attempt <= h.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = h.post(ctx, event, payload)
+		if err == nil || !retry {
+			return err
+		}
+		h.log.Debug("retrying webhook delivery", "event", event, "attempt", attempt+1, "error", err.Error())
+	}
+
+	return err
+}
+
+// post sends the payload and returns an error if it fails and whether it can be retried
+func (h *webhook) post(ctx context.Context, event string, payload []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", k6build.UserAgent)
+	req.Header.Set(WebhookEventHeader, event)
+	if len(h.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(h.secret, payload))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return false, nil
+	}
+
+	// client errors other than throttling won't succeed if retried
+	retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+
+	return retry, fmt.Errorf("webhook response: %s", resp.Status)
+}
+
+// SignWebhookPayload returns the signature of the payload for the WebhookSignatureHeader.
+// Receivers can verify the payload by comparing the header with the signature calculated
+// using the shared secret.
+func SignWebhookPayload(secret []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
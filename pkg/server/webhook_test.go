@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/api"
+	"github.com/grafana/k6build/pkg/k6buildtest"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	secret := "secret"
+
+	testCases := []struct {
+		title       string
+		build       *k6buildtest.FakeBuildService
+		failures    int32
+		expectEvent string
+		expectCalls int32
+	}{
+		{
+			title:       "build succeeded",
+			build:       k6buildtest.NewFakeBuildService(k6build.Artifact{ID: "artifact"}),
+			expectEvent: WebhookBuildSucceeded,
+			expectCalls: 1,
+		},
+		{
+			title:       "build failed",
+			build:       k6buildtest.NewFailingBuildService(k6build.ErrBuildFailed),
+			expectEvent: WebhookBuildFailed,
+			expectCalls: 1,
+		},
+		{
+			title:       "retry delivery",
+			build:       k6buildtest.NewFakeBuildService(k6build.Artifact{ID: "artifact"}),
+			failures:    2,
+			expectEvent: WebhookBuildSucceeded,
+			expectCalls: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			calls := atomic.Int32{}
+			events := make(chan WebhookEvent, 1)
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tc.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				payload, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if r.Header.Get(WebhookSignatureHeader) != SignWebhookPayload([]byte(secret), payload) {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				event := WebhookEvent{}
+				if err = json.Unmarshal(payload, &event); err != nil || event.Event != r.Header.Get(WebhookEventHeader) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				events <- event
+			}))
+			defer receiver.Close()
+
+			config := APIServerConfig{
+				BuildService: tc.build,
+				Webhook: WebhookConfig{
+					URL:     receiver.URL,
+					Secret:  secret,
+					Backoff: time.Millisecond,
+				},
+			}
+			apiserver := httptest.NewServer(newAPIServer(t, config))
+			defer apiserver.Close()
+
+			req := []byte(`{"platform": "linux/amd64", "k6": "v0.1.0"}`)
+			resp, err := http.Post(apiserver.URL+"/build", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatalf("making request %v", err)
+			}
+			_ = resp.Body.Close()
+
+			select {
+			case event := <-events:
+				if event.Event != tc.expectEvent {
+					t.Fatalf("expected event %q got %q", tc.expectEvent, event.Event)
+				}
+				if event.Request.Platform != "linux/amd64" {
+					t.Fatalf("expected request in the event got %v", event.Request)
+				}
+				if (event.Response.Error != nil) != (tc.expectEvent == WebhookBuildFailed) {
+					t.Fatalf("unexpected response %v", event.Response)
+				}
+				if event.Response.Error != nil && event.Response.Code != api.CodeBuildFailed {
+					t.Fatalf("expected code %q got %q", api.CodeBuildFailed, event.Response.Code)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for webhook event")
+			}
+
+			if got := calls.Load(); got != tc.expectCalls {
+				t.Fatalf("expected %d calls got %d", tc.expectCalls, got)
+			}
+
+			if builds := tc.build.Calls(); len(builds) != 1 {
+				t.Fatalf("expected 1 build got %d", len(builds))
+			}
+		})
+	}
+}
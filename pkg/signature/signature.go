@@ -0,0 +1,117 @@
+// Package signature implements the signing of artifacts, allowing clients to verify they were
+// built by a trusted build service.
+//
+// Artifacts are signed using ed25519 keys. The signature covers the artifact's ID and checksum,
+// so the signature of a checksum can't be reused for another artifact (e.g. an older version of the binary).
+// Verifying the checksum of the downloaded binary then ensures its integrity.
+//
+// Keys are PEM encoded: private keys in PKCS #8 ("PRIVATE KEY") and public keys in PKIX
+// ("PUBLIC KEY") format, as generated by 'openssl genpkey -algorithm ed25519'.
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	// ErrInvalidKey signals the key is not a valid ed25519 key
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrMissingSignature signals the artifact is not signed
+	ErrMissingSignature = errors.New("artifact is not signed")
+	// ErrInvalidSignature signals the signature doesn't match the artifact
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// message returns the message signed for an artifact
+func message(id string, checksum string) []byte {
+	return []byte(id + "\n" + checksum)
+}
+
+// Sign returns the signature of the artifact with the given id and checksum, encoded in base64
+func Sign(key ed25519.PrivateKey, id string, checksum string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, message(id, checksum)))
+}
+
+// Verify verifies the signature of the artifact with the given id and checksum
+func Verify(key ed25519.PublicKey, id string, checksum string, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("%w (%s)", ErrMissingSignature, id)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	if !ed25519.Verify(key, message(id, checksum), decoded) {
+		return fmt.Errorf("%w (%s)", ErrInvalidSignature, id)
+	}
+
+	return nil
+}
+
+// ParsePrivateKey parses a PEM encoded ed25519 private key
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: not PEM encoded", ErrInvalidKey)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an ed25519 key", ErrInvalidKey)
+	}
+
+	return privateKey, nil
+}
+
+// ParsePublicKey parses a PEM encoded ed25519 public key
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: not PEM encoded", ErrInvalidKey)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an ed25519 key", ErrInvalidKey)
+	}
+
+	return publicKey, nil
+}
+
+// LoadPrivateKey reads a PEM encoded ed25519 private key from a file
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePrivateKey(data)
+}
+
+// LoadPublicKey reads a PEM encoded ed25519 public key from a file
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePublicKey(data)
+}
@@ -0,0 +1,153 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+
+	signature := Sign(private, "artifact", "checksum")
+
+	testCases := []struct {
+		title     string
+		key       ed25519.PublicKey
+		id        string
+		checksum  string
+		signature string
+		expectErr error
+	}{
+		{
+			title:     "valid signature",
+			key:       public,
+			id:        "artifact",
+			checksum:  "checksum",
+			signature: signature,
+			expectErr: nil,
+		},
+		{
+			title:     "different checksum",
+			key:       public,
+			id:        "artifact",
+			checksum:  "tampered",
+			signature: signature,
+			expectErr: ErrInvalidSignature,
+		},
+		{
+			title:     "different artifact",
+			key:       public,
+			id:        "other",
+			checksum:  "checksum",
+			signature: signature,
+			expectErr: ErrInvalidSignature,
+		},
+		{
+			title:     "different key",
+			key:       otherPublic,
+			id:        "artifact",
+			checksum:  "checksum",
+			signature: signature,
+			expectErr: ErrInvalidSignature,
+		},
+		{
+			title:     "malformed signature",
+			key:       public,
+			id:        "artifact",
+			checksum:  "checksum",
+			signature: "not base64!",
+			expectErr: ErrInvalidSignature,
+		},
+		{
+			title:     "missing signature",
+			key:       public,
+			id:        "artifact",
+			checksum:  "checksum",
+			signature: "",
+			expectErr: ErrMissingSignature,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			err := Verify(tc.key, tc.id, tc.checksum, tc.signature)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("encoding key %v", err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("encoding key %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	parsedPrivate, err := ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatalf("parsing private key %v", err)
+	}
+
+	parsedPublic, err := ParsePublicKey(publicPEM)
+	if err != nil {
+		t.Fatalf("parsing public key %v", err)
+	}
+
+	if err = Verify(parsedPublic, "artifact", "checksum", Sign(parsedPrivate, "artifact", "checksum")); err != nil {
+		t.Fatalf("verifying signature %v", err)
+	}
+
+	if _, err = ParsePrivateKey([]byte("not a key")); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected %v got %v", ErrInvalidKey, err)
+	}
+
+	if _, err = ParsePublicKey(privatePEM); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected %v got %v", ErrInvalidKey, err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024) //nolint:gosec
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatalf("encoding key %v", err)
+	}
+
+	_, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaDER}))
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected %v got %v", ErrInvalidKey, err)
+	}
+}
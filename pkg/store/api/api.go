@@ -22,4 +22,6 @@ var (
 type StoreResponse struct {
 	Error  *k6build.WrappedError
 	Object store.Object
+	// References is the number of references to the object after pinning or releasing it
+	References int `json:",omitempty"`
 }
@@ -0,0 +1,437 @@
+// Package azblob implements an object store backed by an Azure Blob Storage container
+package azblob
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+const (
+	// DefaultURLExpiration is the default expiration for the SAS download URLs.
+	// After this time attempts to download the object will fail
+	DefaultURLExpiration = time.Hour * 24
+
+	// MaxDelegationURLExpiration is the maximum expiration of the SAS download URLs signed with a
+	// user delegation key (that is, if the store has no account key), as allowed by Azure
+	MaxDelegationURLExpiration = time.Hour * 24 * 7
+
+	// AccountEnv is the environment variable with the storage account's name, used if the
+	// account name is not specified
+	AccountEnv = "AZURE_STORAGE_ACCOUNT"
+
+	// KeyEnv is the environment variable with the storage account's access key, used if the
+	// account key is not specified
+	KeyEnv = "AZURE_STORAGE_KEY"
+
+	// checksumMetadata is the name of the blob's metadata that holds the checksum
+	checksumMetadata = "checksum"
+)
+
+// ErrUnauthorized is returned when the storage service rejects the credentials
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Config defines the configuration of an Azure Blob Storage object store
+type Config struct {
+	// Name of the blob container
+	Container string
+	// AccountName is the name of the storage account. Defaults to the AccountEnv environment variable
+	AccountName string
+	// AccountKey is the base64 encoded access key of the storage account, used for authorizing the
+	// requests and signing the download URLs. Defaults to the KeyEnv environment variable.
+	// If no key is specified, the requests are authorized with the Credential and the download
+	// URLs are signed with a user delegation key
+	AccountKey string
+	// Credential is the Azure AD (Microsoft Entra ID) credential used if no account key is specified.
+	// Defaults to the DefaultAzureCredential (e.g. environment variables, workload identity or
+	// managed identity). Requires the Storage Blob Data Contributor role for the container and the
+	// Storage Blob Delegator role for the account
+	Credential azcore.TokenCredential
+	// Endpoint of the blob service. Defaults to https://<account>.blob.core.windows.net.
+	// Used for testing with an emulator (e.g. http://127.0.0.1:10000/<account>)
+	Endpoint string
+	// Expiration for the SAS download URLs. Defaults to DefaultURLExpiration.
+	// Cannot exceed MaxDelegationURLExpiration if the store has no account key
+	URLExpiration time.Duration
+	// ChecksumAlgorithm used for calculating the objects' checksum. Defaults to store.ChecksumSHA256.
+	// The checksum is stored as blob metadata
+	ChecksumAlgorithm string
+	// HTTPClient used for accessing the blob service. Defaults to the Azure SDK's client
+	HTTPClient *http.Client
+}
+
+// Store is an ObjectStore backed by an Azure Blob Storage container. The checksum of the objects is
+// kept as blob metadata. Uploads are also validated by the service using their MD5 hash.
+//
+// The objects' URLs are blob URLs with a SAS (shared access signature) valid for the URL
+// expiration, signed with the account key or with a user delegation key obtained using the
+// store's Azure AD credential.
+type Store struct {
+	container         *container.Client
+	containerName     string
+	sharedKey         *container.SharedKeyCredential
+	delegation        *delegationKeys
+	expiration        time.Duration
+	checksumAlgorithm string
+}
+
+// New creates an object store backed by an Azure Blob Storage container
+func New(config Config) (store.ObjectStore, error) {
+	if config.Container == "" {
+		return nil, fmt.Errorf("%w: container name cannot be empty", store.ErrInitializingStore)
+	}
+
+	if _, err := store.NewHash(config.ChecksumAlgorithm); err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+
+	if config.URLExpiration < 0 {
+		return nil, fmt.Errorf("%w: url expiration cannot be negative", store.ErrInitializingStore)
+	}
+
+	account := config.AccountName
+	if account == "" {
+		account = os.Getenv(AccountEnv)
+	}
+	if account == "" {
+		return nil, fmt.Errorf("%w: account name cannot be empty", store.ErrInitializingStore)
+	}
+
+	serviceURL := config.Endpoint
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	serviceURL = strings.TrimSuffix(serviceURL, "/")
+	containerURL := serviceURL + "/" + config.Container
+
+	expiration := config.URLExpiration
+	if expiration == 0 {
+		expiration = DefaultURLExpiration
+	}
+
+	clientOpts := azcore.ClientOptions{
+		Telemetry: policy.TelemetryOptions{ApplicationID: k6build.UserAgent},
+	}
+	if config.HTTPClient != nil {
+		clientOpts.Transport = config.HTTPClient
+	}
+
+	blobStore := &Store{
+		containerName:     config.Container,
+		expiration:        expiration,
+		checksumAlgorithm: config.ChecksumAlgorithm,
+	}
+
+	accountKey := config.AccountKey
+	if accountKey == "" {
+		accountKey = os.Getenv(KeyEnv)
+	}
+
+	var err error
+	if accountKey != "" {
+		blobStore.sharedKey, err = container.NewSharedKeyCredential(account, accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid account key %w", store.ErrInitializingStore, err)
+		}
+
+		blobStore.container, err = container.NewClientWithSharedKeyCredential(
+			containerURL,
+			blobStore.sharedKey,
+			&container.ClientOptions{ClientOptions: clientOpts},
+		)
+		if err != nil {
+			return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+		}
+
+		return blobStore, nil
+	}
+
+	if expiration > MaxDelegationURLExpiration {
+		return nil, fmt.Errorf(
+			"%w: url expiration cannot exceed %s without an account key",
+			store.ErrInitializingStore,
+			MaxDelegationURLExpiration,
+		)
+	}
+
+	// the credential fails when a token is requested if there are no credentials
+	credential := config.Credential
+	if credential == nil {
+		credential, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: clientOpts,
+		})
+		if err != nil {
+			return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+		}
+	}
+
+	blobStore.container, err = container.NewClient(
+		containerURL,
+		credential,
+		&container.ClientOptions{ClientOptions: clientOpts},
+	)
+	if err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+
+	serviceClient, err := service.NewClient(serviceURL, credential, &service.ClientOptions{ClientOptions: clientOpts})
+	if err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+	blobStore.delegation = &delegationKeys{service: serviceClient}
+
+	return blobStore, nil
+}
+
+// Put stores the object and returns the metadata
+// Fails if the object already exists
+func (s *Store) Put(ctx context.Context, id string, content io.Reader) (store.Object, error) {
+	if id == "" {
+		return store.Object{}, fmt.Errorf("%w: id cannot be empty", store.ErrCreatingObject)
+	}
+
+	// spool the content to a temporary file while calculating the checksums, as the blob's
+	// length and MD5 hash must be sent before the content
+	spool, err := os.CreateTemp("", "k6build-azblob-*")
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	hash, _ := store.NewHash(s.checksumAlgorithm)
+	contentMD5 := md5.New() //nolint:gosec
+	size, err := io.Copy(spool, io.TeeReader(content, io.MultiWriter(hash, contentMD5)))
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	checksum := store.FormatChecksum(s.checksumAlgorithm, hash.Sum(nil))
+	contentType := "application/octet-stream"
+	anyETag := azcore.ETagAny
+
+	// the blob is uploaded with a single request, as the condition is not applied when committing
+	// the blocks of a blob uploaded in blocks. The upload fails if the blob exists.
+	resp, err := s.container.NewBlockBlobClient(id).Upload(ctx, spool, &blockblob.UploadOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+		Metadata:    map[string]*string{checksumMetadata: &checksum},
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfNoneMatch: &anyETag},
+		},
+		TransactionalValidation: blob.TransferValidationTypeMD5(contentMD5.Sum(nil)),
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ConditionNotMet) {
+			return store.Object{}, fmt.Errorf("%w: object already exists %q", store.ErrCreatingObject, id)
+		}
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+	}
+
+	downloadURL, err := s.downloadURL(ctx, id)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	createdAt := time.Time{}
+	if resp.LastModified != nil {
+		createdAt = *resp.LastModified
+	}
+
+	return store.Object{
+		ID:        id,
+		Checksum:  checksum,
+		URL:       downloadURL,
+		CreatedAt: createdAt,
+		Size:      size,
+	}, nil
+}
+
+// Get retrieves an objects if exists in the object store or an error otherwise
+func (s *Store) Get(ctx context.Context, id string) (store.Object, error) {
+	props, err := s.container.NewBlobClient(id).GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return store.Object{}, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+		}
+		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, mapError(err))
+	}
+
+	downloadURL, err := s.downloadURL(ctx, id)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	createdAt := time.Time{}
+	switch {
+	case props.CreationTime != nil:
+		createdAt = *props.CreationTime
+	case props.LastModified != nil:
+		createdAt = *props.LastModified
+	}
+
+	size := int64(0)
+	if props.ContentLength != nil {
+		size = *props.ContentLength
+	}
+
+	return store.Object{
+		ID:        id,
+		Checksum:  metadata(props.Metadata, checksumMetadata),
+		URL:       downloadURL,
+		CreatedAt: createdAt,
+		Size:      size,
+	}, nil
+}
+
+// Delete removes an object from the store
+func (s *Store) Delete(ctx context.Context, id string) error {
+	_, err := s.container.NewBlobClient(id).Delete(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+		}
+		// other conflicts (e.g. the blob has a lease) are reported as they are
+		return k6build.NewWrappedError(store.ErrDeletingObject, mapError(err))
+	}
+
+	return nil
+}
+
+// List returns the ids of the objects in the store
+func (s *Store) List(ctx context.Context) ([]string, error) {
+	ids := []string{}
+	pager := s.container.NewListBlobsFlatPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, k6build.NewWrappedError(store.ErrAccessingObject, mapError(err))
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil {
+				ids = append(ids, *item.Name)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// downloadURL returns the blob's URL with a SAS signed with the account key or a user delegation key
+func (s *Store) downloadURL(ctx context.Context, id string) (string, error) {
+	expiry := time.Now().UTC().Add(s.expiration)
+	values := sas.BlobSignatureValues{
+		ExpiryTime:    expiry,
+		Permissions:   (&sas.BlobPermissions{Read: true}).String(),
+		ContainerName: s.containerName,
+		BlobName:      id,
+	}
+
+	var (
+		params sas.QueryParameters
+		err    error
+	)
+	if s.sharedKey != nil {
+		params, err = values.SignWithSharedKey(s.sharedKey)
+	} else {
+		var key *service.UserDelegationCredential
+		key, err = s.delegation.get(ctx, expiry)
+		if err != nil {
+			return "", fmt.Errorf("getting user delegation key %w", mapError(err))
+		}
+		params, err = values.SignWithUserDelegation(key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("signing download url %w", err)
+	}
+
+	return s.container.NewBlobClient(id).URL() + "?" + params.Encode(), nil
+}
+
+// delegationKeys caches the user delegation key used for signing the download URLs
+type delegationKeys struct {
+	service *service.Client
+	mutex   sync.Mutex
+	key     *service.UserDelegationCredential
+	expiry  time.Time
+}
+
+// get returns a user delegation key valid until the given time, requesting a new key if the cached
+// one expires earlier. The keys are requested with the maximum validity allowed.
+func (d *delegationKeys) get(ctx context.Context, until time.Time) (*service.UserDelegationCredential, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.key != nil && !d.expiry.Before(until) {
+		return d.key, nil
+	}
+
+	// allow for clock skew between the store and the service
+	start := time.Now().UTC().Add(-time.Minute).Format(sas.TimeFormat)
+	expiry := time.Now().UTC().Add(MaxDelegationURLExpiration).Truncate(time.Second)
+	expiryValue := expiry.Format(sas.TimeFormat)
+
+	key, err := d.service.GetUserDelegationCredential(ctx, service.KeyInfo{Start: &start, Expiry: &expiryValue}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	d.key = key
+	d.expiry = expiry
+
+	return key, nil
+}
+
+// metadata returns the value of a blob's metadata. The metadata names are case insensitive and
+// are returned by the service as received in the response's headers
+func metadata(values map[string]*string, name string) string {
+	for key, value := range values {
+		if strings.EqualFold(key, name) && value != nil {
+			return *value
+		}
+	}
+
+	return ""
+}
+
+// mapError returns ErrUnauthorized if the credentials were rejected or could not be obtained
+func mapError(err error) error {
+	respErr := &azcore.ResponseError{}
+	if errors.As(err, &respErr) &&
+		(respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	authErr := &azidentity.AuthenticationFailedError{}
+	if errors.As(err, &authErr) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return err
+}
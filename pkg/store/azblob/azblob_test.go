@@ -0,0 +1,548 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build/pkg/store"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+const (
+	testAccount   = "k6build"
+	testContainer = "binaries"
+	testToken     = "access token"
+)
+
+var (
+	testKey           = base64.StdEncoding.EncodeToString([]byte("account key"))
+	testDelegationKey = []byte("delegation key")
+)
+
+type storedBlob struct {
+	content  []byte
+	checksum string
+	created  time.Time
+	leased   bool
+}
+
+// blobService is a minimal implementation of the blob service REST API that keeps the blobs of one
+// container in memory. Requests must be signed with the shared key or, if the service is created
+// without a key, have the test access token. The download URLs must have a valid SAS, signed with
+// the shared key or the user delegation key.
+type blobService struct {
+	mtx   sync.Mutex
+	blobs map[string]storedBlob
+	key   []byte
+	url   string
+}
+
+func newBlobService(t *testing.T, key string) (*blobService, *http.Client) {
+	t.Helper()
+
+	svc := &blobService{
+		blobs: map[string]storedBlob{},
+	}
+	if key != "" {
+		svc.key, _ = base64.StdEncoding.DecodeString(key)
+	}
+
+	// access tokens are only sent over TLS
+	var srv *httptest.Server
+	if key != "" {
+		srv = httptest.NewServer(svc)
+	} else {
+		srv = httptest.NewTLSServer(svc)
+	}
+	t.Cleanup(srv.Close)
+	svc.url = srv.URL + "/" + testAccount
+
+	return svc, srv.Client()
+}
+
+func sign(key []byte, content string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(content))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authorized checks the authorization of the request or the SAS of a download
+func (svc *blobService) authorized(r *http.Request, id string) bool {
+	query := r.URL.Query()
+	if query.Get("sig") != "" {
+		return svc.authorizedSAS(r, id)
+	}
+
+	if svc.key == nil {
+		return r.Header.Get("Authorization") == "Bearer "+testToken
+	}
+
+	headers := []string{}
+	for name := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			headers = append(headers, strings.ToLower(name)+":"+r.Header.Get(name)+"\n")
+		}
+	}
+	sort.Strings(headers)
+
+	params := []string{}
+	for name, values := range query {
+		params = append(params, "\n"+name+":"+strings.Join(values, ","))
+	}
+	sort.Strings(params)
+
+	contentLength := ""
+	if r.ContentLength > 0 {
+		contentLength = fmt.Sprintf("%d", r.ContentLength)
+	}
+
+	stringToSign := r.Method + "\n\n\n" + contentLength + "\n" +
+		r.Header.Get("Content-MD5") + "\n" + r.Header.Get("Content-Type") + "\n\n\n\n" +
+		r.Header.Get("If-None-Match") + "\n\n\n" +
+		strings.Join(headers, "") + "/" + testAccount + r.URL.EscapedPath() + strings.Join(params, "")
+
+	return r.Header.Get("Authorization") == fmt.Sprintf("SharedKey %s:%s", testAccount, sign(svc.key, stringToSign))
+}
+
+// authorizedSAS checks the SAS of a download, signed with the shared key or the user delegation key
+func (svc *blobService) authorizedSAS(r *http.Request, id string) bool {
+	query := r.URL.Query()
+	expiry, err := time.Parse(sas.TimeFormat, query.Get("se"))
+	if err != nil || time.Now().After(expiry) || r.Method != http.MethodGet || query.Get("sp") != "r" {
+		return false
+	}
+
+	if svc.key != nil {
+		resource := fmt.Sprintf("/blob/%s/%s/%s", testAccount, testContainer, id)
+		fields := []string{"r", "", query.Get("se"), resource, "", "", "", query.Get("sv"), "b"}
+		stringToSign := strings.Join(append(fields, make([]string, 7)...), "\n")
+		return query.Get("sig") == sign(svc.key, stringToSign)
+	}
+
+	// the account of a user delegation SAS is taken from the service's host name
+	account := strings.Split(r.Host, ".")[0]
+	resource := fmt.Sprintf("/blob/%s/%s/%s", account, testContainer, id)
+	fields := []string{
+		"r", "", query.Get("se"), resource,
+		query.Get("skoid"), query.Get("sktid"), query.Get("skt"), query.Get("ske"), query.Get("sks"), query.Get("skv"),
+		"", "", "", "", "", query.Get("sv"), "b",
+	}
+	stringToSign := strings.Join(append(fields, make([]string, 7)...), "\n")
+	return query.Get("sig") == sign(testDelegationKey, stringToSign)
+}
+
+func (svc *blobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	svc.mtx.Lock()
+	defer svc.mtx.Unlock()
+
+	containerPath := "/" + testAccount + "/" + testContainer
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, containerPath), "/")
+
+	if !svc.authorized(r, id) {
+		svc.fail(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+
+	if r.URL.Query().Get("comp") == "userdelegationkey" {
+		svc.delegationKey(w)
+		return
+	}
+
+	if r.URL.Path == containerPath {
+		if r.URL.Query().Get("comp") != "list" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		svc.list(w)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		svc.put(w, r, id)
+	case http.MethodHead, http.MethodGet:
+		b, ok := svc.blobs[id]
+		if !ok {
+			svc.fail(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b.content)))
+		w.Header().Set("x-ms-meta-checksum", b.checksum)
+		w.Header().Set("x-ms-creation-time", b.created.Format(http.TimeFormat))
+		_, _ = w.Write(b.content)
+	case http.MethodDelete:
+		b, ok := svc.blobs[id]
+		if !ok {
+			svc.fail(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		if b.leased {
+			svc.fail(w, http.StatusPreconditionFailed, "LeaseIdMissing")
+			return
+		}
+		delete(svc.blobs, id)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (svc *blobService) put(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if _, exists := svc.blobs[id]; exists && r.Header.Get("If-None-Match") == "*" {
+		svc.fail(w, http.StatusConflict, "BlobAlreadyExists")
+		return
+	}
+
+	content, _ := io.ReadAll(r.Body)
+	sum := md5.Sum(content)
+	if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		svc.fail(w, http.StatusBadRequest, "Md5Mismatch")
+		return
+	}
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc.blobs[id] = storedBlob{content: content, checksum: r.Header.Get("x-ms-meta-checksum"), created: created}
+	w.Header().Set("Last-Modified", created.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// fail responds with an error status and the service's error code
+func (svc *blobService) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(status)
+}
+
+func (svc *blobService) delegationKey(w http.ResponseWriter) {
+	now := time.Now().UTC()
+	key := struct {
+		XMLName       xml.Name `xml:"UserDelegationKey"`
+		SignedOid     string   `xml:"SignedOid"`
+		SignedTid     string   `xml:"SignedTid"`
+		SignedStart   string   `xml:"SignedStart"`
+		SignedExpiry  string   `xml:"SignedExpiry"`
+		SignedService string   `xml:"SignedService"`
+		SignedVersion string   `xml:"SignedVersion"`
+		Value         string   `xml:"Value"`
+	}{
+		SignedOid:     "00000000-0000-0000-0000-000000000001",
+		SignedTid:     "00000000-0000-0000-0000-000000000002",
+		SignedStart:   now.Format(sas.TimeFormat),
+		SignedExpiry:  now.Add(MaxDelegationURLExpiration).Format(sas.TimeFormat),
+		SignedService: "b",
+		SignedVersion: sas.Version,
+		Value:         base64.StdEncoding.EncodeToString(testDelegationKey),
+	}
+	_ = xml.NewEncoder(w).Encode(key)
+}
+
+// credential is an azcore.TokenCredential that returns a fixed access token
+type credential string
+
+func (c credential) GetToken(_ context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(c), ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func (svc *blobService) list(w http.ResponseWriter) {
+	type entry struct {
+		Name string `xml:"Name"`
+	}
+	result := struct {
+		XMLName    xml.Name `xml:"EnumerationResults"`
+		Blobs      []entry  `xml:"Blobs>Blob"`
+		NextMarker string   `xml:"NextMarker"`
+	}{}
+	for id := range svc.blobs {
+		result.Blobs = append(result.Blobs, entry{Name: id})
+	}
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func download(t *testing.T, client *http.Client, objectURL string) (int, []byte) {
+	t.Helper()
+
+	resp, err := client.Get(objectURL)
+	if err != nil {
+		t.Fatalf("downloading object %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	content, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, content
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title string
+		key   string
+	}{
+		{
+			title: "shared key",
+			key:   testKey,
+		},
+		{
+			title: "azure ad credential",
+			key:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			svc, client := newBlobService(t, tc.key)
+			objectStore, err := New(Config{
+				Container:     testContainer,
+				AccountName:   testAccount,
+				AccountKey:    tc.key,
+				Credential:    credential(testToken),
+				Endpoint:      svc.url,
+				URLExpiration: time.Hour,
+				HTTPClient:    client,
+			})
+			if err != nil {
+				t.Fatalf("creating store %v", err)
+			}
+
+			content := []byte("k6 binary")
+			checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+
+			stored, err := objectStore.Put(context.TODO(), "prefix/object", bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("storing object %v", err)
+			}
+
+			if stored.Checksum != checksum || stored.Size != int64(len(content)) || stored.CreatedAt.IsZero() {
+				t.Fatalf("unexpected object %v", stored)
+			}
+
+			status, downloaded := download(t, client, stored.URL)
+			if status != http.StatusOK || !bytes.Equal(downloaded, content) {
+				t.Fatalf("unexpected download status %d content %q", status, downloaded)
+			}
+
+			// tampering the SAS invalidates the signature
+			signed, _ := url.Parse(stored.URL)
+			query := signed.Query()
+			query.Set("se", time.Now().Add(time.Hour*48).UTC().Format(sas.TimeFormat))
+			signed.RawQuery = query.Encode()
+			if status, _ = download(t, client, signed.String()); status != http.StatusForbidden {
+				t.Fatalf("expected status %d got %d", http.StatusForbidden, status)
+			}
+
+			got, err := objectStore.Get(context.TODO(), "prefix/object")
+			if err != nil {
+				t.Fatalf("getting object %v", err)
+			}
+
+			if got.Checksum != stored.Checksum || got.Size != stored.Size || !got.CreatedAt.Equal(stored.CreatedAt) {
+				t.Fatalf("expected %v got %v", stored, got)
+			}
+
+			_, err = objectStore.Put(context.TODO(), "prefix/object", bytes.NewReader(content))
+			if !errors.Is(err, store.ErrCreatingObject) {
+				t.Fatalf("expected %v got %v", store.ErrCreatingObject, err)
+			}
+
+			_, err = objectStore.Get(context.TODO(), "missing")
+			if !errors.Is(err, store.ErrObjectNotFound) {
+				t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+			}
+
+			lister, ok := objectStore.(store.ObjectLister)
+			if !ok {
+				t.Fatalf("expected the store to support listing objects")
+			}
+
+			ids, err := lister.List(context.TODO())
+			if err != nil {
+				t.Fatalf("listing objects %v", err)
+			}
+			if len(ids) != 1 || ids[0] != "prefix/object" {
+				t.Fatalf("unexpected objects %v", ids)
+			}
+
+			deleter, ok := objectStore.(store.ObjectDeleter)
+			if !ok {
+				t.Fatalf("expected the store to support deleting objects")
+			}
+
+			if err = deleter.Delete(context.TODO(), "prefix/object"); err != nil {
+				t.Fatalf("deleting object %v", err)
+			}
+
+			err = deleter.Delete(context.TODO(), "prefix/object")
+			if !errors.Is(err, store.ErrObjectNotFound) {
+				t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+			}
+		})
+	}
+}
+
+func TestDeleteLeasedBlob(t *testing.T) {
+	t.Parallel()
+
+	svc, _ := newBlobService(t, testKey)
+	objectStore, err := New(Config{
+		Container:   testContainer,
+		AccountName: testAccount,
+		AccountKey:  testKey,
+		Endpoint:    svc.url,
+	})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	if _, err = objectStore.Put(context.TODO(), "object", bytes.NewReader([]byte("k6 binary"))); err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+
+	svc.mtx.Lock()
+	leased := svc.blobs["object"]
+	leased.leased = true
+	svc.blobs["object"] = leased
+	svc.mtx.Unlock()
+
+	// the conflict is not reported as the object not existing or already existing
+	err = objectStore.(store.ObjectDeleter).Delete(context.TODO(), "object")
+	if !errors.Is(err, store.ErrDeletingObject) || errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected %v got %v", store.ErrDeletingObject, err)
+	}
+	if strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestStoreAuthorization(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		key       string
+		token     string
+		expectErr error
+	}{
+		{
+			title:     "valid key",
+			key:       testKey,
+			expectErr: nil,
+		},
+		{
+			title:     "invalid key",
+			key:       base64.StdEncoding.EncodeToString([]byte("wrong key")),
+			expectErr: ErrUnauthorized,
+		},
+		{
+			title:     "valid token",
+			token:     testToken,
+			expectErr: nil,
+		},
+		{
+			title:     "invalid token",
+			token:     "wrong token",
+			expectErr: ErrUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			serviceKey := testKey
+			if tc.key == "" {
+				serviceKey = ""
+			}
+
+			svc, client := newBlobService(t, serviceKey)
+			objectStore, err := New(Config{
+				Container:   testContainer,
+				AccountName: testAccount,
+				AccountKey:  tc.key,
+				Credential:  credential(tc.token),
+				Endpoint:    svc.url,
+				HTTPClient:  client,
+			})
+			if err != nil {
+				t.Fatalf("creating store %v", err)
+			}
+
+			_, err = objectStore.Put(context.TODO(), "object", bytes.NewReader([]byte("k6 binary")))
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		config Config
+	}{
+		{
+			title:  "missing container",
+			config: Config{AccountName: testAccount},
+		},
+		{
+			title:  "missing account",
+			config: Config{Container: testContainer},
+		},
+		{
+			title:  "invalid account key",
+			config: Config{Container: testContainer, AccountName: testAccount, AccountKey: "not base64!"},
+		},
+		{
+			title:  "invalid checksum algorithm",
+			config: Config{Container: testContainer, AccountName: testAccount, ChecksumAlgorithm: "md5"},
+		},
+		{
+			title: "url expiration exceeds the user delegation key's",
+			config: Config{
+				Container:     testContainer,
+				AccountName:   testAccount,
+				Credential:    credential(testToken),
+				URLExpiration: MaxDelegationURLExpiration + time.Hour,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.config)
+			if !errors.Is(err, store.ErrInitializingStore) {
+				t.Fatalf("expected %v got %v", store.ErrInitializingStore, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+const (
+	// ChecksumSHA256 is the default checksum algorithm
+	ChecksumSHA256 = "sha256"
+	// ChecksumSHA512 uses the sha512 algorithm
+	ChecksumSHA512 = "sha512"
+)
+
+// ErrInvalidChecksumAlgorithm signals the checksum algorithm is not supported
+var ErrInvalidChecksumAlgorithm = errors.New("invalid checksum algorithm")
+
+// NewHash returns a hash for the checksum algorithm. Defaults to ChecksumSHA256
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "", ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumSHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidChecksumAlgorithm, algorithm)
+	}
+}
+
+// FormatChecksum returns the checksum as an hex string.
+// Checksums calculated with an algorithm other than ChecksumSHA256 are prefixed with
+// the algorithm (e.g. sha512:<hex>). Checksums without prefix are sha256.
+func FormatChecksum(algorithm string, sum []byte) string {
+	if algorithm == "" || algorithm == ChecksumSHA256 {
+		return fmt.Sprintf("%x", sum)
+	}
+
+	return fmt.Sprintf("%s:%x", algorithm, sum)
+}
+
+// ParseChecksum returns the algorithm and the hex checksum from a checksum formatted
+// by FormatChecksum. Checksums without prefix are ChecksumSHA256.
+func ParseChecksum(checksum string) (string, string) {
+	algorithm, sum, found := strings.Cut(checksum, ":")
+	if !found {
+		return ChecksumSHA256, checksum
+	}
+	return algorithm, sum
+}
@@ -22,12 +22,15 @@ var ErrInvalidConfig = errors.New("invalid configuration")
 type StoreClientConfig struct {
 	Server     string
 	HTTPClient *http.Client
+	// UserAgent sent in the requests. Defaults to k6build.UserAgent
+	UserAgent string
 }
 
 // StoreClient access blobs in a StoreServer
 type StoreClient struct {
-	server *url.URL
-	client *http.Client
+	server    *url.URL
+	client    *http.Client
+	userAgent string
 }
 
 // NewStoreClient returns a client for an object store server
@@ -41,20 +44,28 @@ func NewStoreClient(config StoreClientConfig) (*StoreClient, error) {
 	if client == nil {
 		client = http.DefaultClient
 	}
+
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = k6build.UserAgent
+	}
+
 	return &StoreClient{
-		server: srvURL,
-		client: client,
+		server:    srvURL,
+		client:    client,
+		userAgent: userAgent,
 	}, nil
 }
 
 // Get retrieves an objects if exists in the store or an error otherwise
 func (c *StoreClient) Get(ctx context.Context, id string) (store.Object, error) {
-	reqURL := *c.server.JoinPath("store", id)
+	reqURL := *c.server.JoinPath("store", url.PathEscape(id))
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(api.ErrInvalidRequest, err)
 	}
 
+	req.Header.Set("User-Agent", c.userAgent)
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
@@ -83,9 +94,11 @@ func (c *StoreClient) Get(ctx context.Context, id string) (store.Object, error)
 	return storeResponse.Object, nil
 }
 
-// Put stores the object and returns the metadata
+// Put stores the object and returns the metadata.
+// The content is streamed to the server as it is read. If its length is not known in advance
+// (e.g. it is not a bytes.Buffer), it is sent using chunked transfer encoding.
 func (c *StoreClient) Put(ctx context.Context, id string, content io.Reader) (store.Object, error) {
-	reqURL := *c.server.JoinPath("store", id)
+	reqURL := *c.server.JoinPath("store", url.PathEscape(id))
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
@@ -97,6 +110,7 @@ func (c *StoreClient) Put(ctx context.Context, id string, content io.Reader) (st
 	}
 
 	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("User-Agent", c.userAgent)
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(api.ErrRequestFailed, err)
@@ -121,6 +135,83 @@ func (c *StoreClient) Put(ctx context.Context, id string, content io.Reader) (st
 	return storeResponse.Object, nil
 }
 
+// Delete removes the object from the store
+func (c *StoreClient) Delete(ctx context.Context, id string) error {
+	reqURL := *c.server.JoinPath("store", id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, reqURL.String(), nil)
+	if err != nil {
+		return k6build.NewWrappedError(api.ErrInvalidRequest, err)
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return k6build.NewWrappedError(api.ErrRequestFailed, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return store.ErrObjectNotFound
+	default:
+		return k6build.NewWrappedError(api.ErrRequestFailed, fmt.Errorf("status %s", resp.Status))
+	}
+}
+
+// Pin adds a reference to the object, preventing it from being evicted from the store.
+// Returns the number of references to the object.
+func (c *StoreClient) Pin(ctx context.Context, id string) (int, error) {
+	return c.updateReferences(ctx, id, "pin")
+}
+
+// Release removes a reference to the object. Returns the number of remaining references.
+func (c *StoreClient) Release(ctx context.Context, id string) (int, error) {
+	return c.updateReferences(ctx, id, "release")
+}
+
+func (c *StoreClient) updateReferences(ctx context.Context, id string, operation string) (int, error) {
+	reqURL := *c.server.JoinPath("store", url.PathEscape(id), operation)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), nil)
+	if err != nil {
+		return 0, k6build.NewWrappedError(api.ErrInvalidRequest, err)
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, k6build.NewWrappedError(api.ErrRequestFailed, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return 0, store.ErrObjectNotFound
+	case http.StatusConflict:
+		return 0, store.ErrObjectNotPinned
+	default:
+		return 0, k6build.NewWrappedError(api.ErrRequestFailed, fmt.Errorf("status %s", resp.Status))
+	}
+
+	storeResponse := api.StoreResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&storeResponse)
+	if err != nil {
+		return 0, k6build.NewWrappedError(api.ErrRequestFailed, err)
+	}
+
+	if storeResponse.Error != nil {
+		return 0, storeResponse.Error
+	}
+
+	return storeResponse.References, nil
+}
+
 // Download returns the content of the object given its url
 func (c *StoreClient) Download(ctx context.Context, object store.Object) (io.ReadCloser, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, object.URL, nil)
@@ -128,6 +219,7 @@ func (c *StoreClient) Download(ctx context.Context, object store.Object) (io.Rea
 		return nil, k6build.NewWrappedError(api.ErrInvalidRequest, err)
 	}
 
+	req.Header.Set("User-Agent", c.userAgent)
 	resp, err := c.client.Do(req) //nolint:bodyclose
 	if err != nil {
 		return nil, k6build.NewWrappedError(api.ErrRequestFailed, err)
@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 
 	"github.com/grafana/k6build"
@@ -148,6 +150,57 @@ func TestStoreClientPut(t *testing.T) {
 	}
 }
 
+func TestStoreClientPutStream(t *testing.T) {
+	t.Parallel()
+
+	const size = 64 << 20
+
+	var (
+		received    int64
+		chunked     bool
+		contentSize int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunked = slices.Contains(r.TransferEncoding, "chunked")
+		contentSize = r.ContentLength
+		received, _ = io.Copy(io.Discard, r.Body)
+
+		w.Header().Add("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.StoreResponse{Object: store.Object{ID: "object", Size: received}})
+	}))
+	defer srv.Close()
+
+	client, err := NewStoreClient(StoreClientConfig{Server: srv.URL})
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	// the content is produced as it is uploaded, so its length is not known in advance
+	reader, writer := io.Pipe()
+	go func() {
+		chunk := bytes.Repeat([]byte{'x'}, 1<<20)
+		for written := 0; written < size; written += len(chunk) {
+			if _, writeErr := writer.Write(chunk); writeErr != nil {
+				return
+			}
+		}
+		_ = writer.Close()
+	}()
+
+	object, err := client.Put(context.TODO(), "object", reader)
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if !chunked || contentSize != -1 {
+		t.Fatalf("expected chunked upload got content length %d", contentSize)
+	}
+
+	if received != size || object.Size != size {
+		t.Fatalf("expected %d bytes got %d", size, received)
+	}
+}
+
 func TestStoreClientDownload(t *testing.T) {
 	t.Parallel()
 
@@ -192,3 +245,107 @@ func TestStoreClientDownload(t *testing.T) {
 		})
 	}
 }
+
+func TestStoreClientDelete(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		status    int
+		resp      *api.StoreResponse
+		expectErr error
+	}{
+		{
+			title:  "normal delete",
+			status: http.StatusNoContent,
+		},
+		{
+			title:     "object not found",
+			status:    http.StatusNotFound,
+			expectErr: store.ErrObjectNotFound,
+		},
+		{
+			title:  "error deleting object",
+			status: http.StatusInternalServerError,
+			resp: &api.StoreResponse{
+				Error: k6build.NewWrappedError(store.ErrDeletingObject, k6build.ErrReasonUnknown),
+			},
+			expectErr: api.ErrRequestFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(handlerMock(tc.status, tc.resp))
+
+			client, err := NewStoreClient(StoreClientConfig{Server: srv.URL})
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			err = client.Delete(context.TODO(), "object")
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestStoreClientPin(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title            string
+		status           int
+		resp             *api.StoreResponse
+		expectErr        error
+		expectReferences int
+	}{
+		{
+			title:            "normal pin",
+			status:           http.StatusOK,
+			resp:             &api.StoreResponse{References: 2},
+			expectReferences: 2,
+		},
+		{
+			title:     "object not found",
+			status:    http.StatusNotFound,
+			expectErr: store.ErrObjectNotFound,
+		},
+		{
+			title:     "object not pinned",
+			status:    http.StatusConflict,
+			expectErr: store.ErrObjectNotPinned,
+		},
+		{
+			title:     "not supported",
+			status:    http.StatusMethodNotAllowed,
+			expectErr: api.ErrRequestFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(handlerMock(tc.status, tc.resp))
+			t.Cleanup(srv.Close)
+
+			client, err := NewStoreClient(StoreClientConfig{Server: srv.URL})
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			references, err := client.Pin(context.TODO(), "object")
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if references != tc.expectReferences {
+				t.Fatalf("expected %d references got %d", tc.expectReferences, references)
+			}
+		})
+	}
+}
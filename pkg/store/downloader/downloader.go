@@ -16,6 +16,25 @@ import (
 	"github.com/grafana/k6build/pkg/util"
 )
 
+// Read returns the content of an object retrieved from the store. If the store implements
+// store.ObjectReader, the content is read from the store. Otherwise, or if the store cannot read
+// the object, it is downloaded from the object's URL.
+func Read(
+	ctx context.Context,
+	client *http.Client,
+	objectStore store.ObjectStore,
+	object store.Object,
+) (io.ReadCloser, error) {
+	if reader, ok := objectStore.(store.ObjectReader); ok {
+		content, err := reader.Read(ctx, object)
+		if !errors.Is(err, store.ErrNotSupported) {
+			return content, err
+		}
+	}
+
+	return Download(ctx, client, object)
+}
+
 // Download returns the content of the object
 func Download(ctx context.Context, client *http.Client, object store.Object) (io.ReadCloser, error) {
 	url, err := url.Parse(object.URL)
@@ -51,6 +70,7 @@ func Download(ctx context.Context, client *http.Client, object store.Object) (io
 		if err != nil {
 			return nil, k6build.NewWrappedError(store.ErrAccessingObject, err)
 		}
+		req.Header.Set("User-Agent", k6build.UserAgent)
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/grafana/k6build/pkg/store"
@@ -122,3 +124,99 @@ func TestDownload(t *testing.T) {
 		})
 	}
 }
+
+// readerStore reads the objects with a mem:// URL
+type readerStore struct {
+	store.ObjectStore
+	objects map[string]string
+}
+
+func (s readerStore) Read(_ context.Context, object store.Object) (io.ReadCloser, error) {
+	id, found := strings.CutPrefix(object.URL, "mem://")
+	if !found {
+		return nil, store.ErrNotSupported
+	}
+
+	content, found := s.objects[id]
+	if !found {
+		return nil, store.ErrObjectNotFound
+	}
+
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	storeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(storeDir, "object"), []byte("downloaded"), 0o600); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	reader := readerStore{objects: map[string]string{"object": "read"}}
+
+	testCases := []struct {
+		title     string
+		store     store.ObjectStore
+		url       string
+		expected  string
+		expectErr error
+	}{
+		{
+			title:    "read from store",
+			store:    reader,
+			url:      "mem://object",
+			expected: "read",
+		},
+		{
+			title:     "object not found in store",
+			store:     reader,
+			url:       "mem://another_object",
+			expectErr: store.ErrObjectNotFound,
+		},
+		{
+			title:    "download url not supported by the store",
+			store:    reader,
+			url:      fileURL(storeDir, "object"),
+			expected: "downloaded",
+		},
+		{
+			title:    "download from store without reader",
+			store:    nil,
+			url:      fileURL(storeDir, "object"),
+			expected: "downloaded",
+		},
+		{
+			title:     "unsupported url without reader",
+			store:     nil,
+			url:       "mem://object",
+			expectErr: store.ErrInvalidURL,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			content, err := Read(context.TODO(), http.DefaultClient, tc.store, store.Object{ID: "object", URL: tc.url})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			defer content.Close() //nolint:errcheck
+
+			data, err := io.ReadAll(content)
+			if err != nil {
+				t.Fatalf("reading content: %v", err)
+			}
+
+			if string(data) != tc.expected {
+				t.Fatalf("expected %q got %q", tc.expected, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Package fallback implements an object store that reads objects from a secondary store
+// when they are not found in the primary store.
+//
+// This is useful when migrating between stores: new objects are written to the new (primary)
+// store while the objects in the old (secondary) store are still served until they age out.
+package fallback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
+)
+
+// Config defines the configuration of a fallback store
+type Config struct {
+	// Primary store. All objects are written to this store
+	Primary store.ObjectStore
+	// Secondary store. Objects not found in the primary store are read from this store
+	Secondary store.ObjectStore
+}
+
+// Store is an ObjectStore that falls back to a secondary store for reads
+type Store struct {
+	primary   store.ObjectStore
+	secondary store.ObjectStore
+}
+
+// New creates a fallback store from a Config
+func New(config Config) (*Store, error) {
+	if config.Primary == nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, errors.New("primary store cannot be nil"))
+	}
+
+	if config.Secondary == nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, errors.New("secondary store cannot be nil"))
+	}
+
+	return &Store{
+		primary:   config.Primary,
+		secondary: config.Secondary,
+	}, nil
+}
+
+// Get retrieves an object from the primary store or from the secondary store if it is not
+// found in the primary. The objects read from the secondary store are marked as Fallback.
+func (s *Store) Get(ctx context.Context, id string) (store.Object, error) {
+	object, err := s.primary.Get(ctx, id)
+	if !errors.Is(err, store.ErrObjectNotFound) {
+		return object, err
+	}
+
+	object, err = s.secondary.Get(ctx, id)
+	if err != nil {
+		return store.Object{}, err
+	}
+
+	object.Fallback = true
+	return object, nil
+}
+
+// Put stores the object in the primary store
+func (s *Store) Put(ctx context.Context, id string, content io.Reader) (store.Object, error) {
+	return s.primary.Put(ctx, id, content)
+}
+
+// Delete removes the object from the primary store or from the secondary store if it is not
+// found in the primary, so stale objects can be removed from either store
+func (s *Store) Delete(ctx context.Context, id string) error {
+	err := deleteObject(ctx, s.primary, id)
+	if !errors.Is(err, store.ErrObjectNotFound) {
+		return err
+	}
+
+	return deleteObject(ctx, s.secondary, id)
+}
+
+// Read returns the content of an object read from the primary store or from the secondary store
+// if the primary cannot read it (see store.ObjectReader)
+func (s *Store) Read(ctx context.Context, object store.Object) (io.ReadCloser, error) {
+	content, err := readObject(ctx, s.primary, object)
+	if !errors.Is(err, store.ErrNotSupported) && !errors.Is(err, store.ErrObjectNotFound) {
+		return content, err
+	}
+
+	return readObject(ctx, s.secondary, object)
+}
+
+func readObject(ctx context.Context, objectStore store.ObjectStore, object store.Object) (io.ReadCloser, error) {
+	reader, ok := objectStore.(store.ObjectReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: reading objects", store.ErrNotSupported)
+	}
+
+	return reader.Read(ctx, object)
+}
+
+func deleteObject(ctx context.Context, objectStore store.ObjectStore, id string) error {
+	deleter, ok := objectStore.(store.ObjectDeleter)
+	if !ok {
+		return fmt.Errorf("%w: deleting objects", store.ErrNotSupported)
+	}
+
+	return deleter.Delete(ctx, id)
+}
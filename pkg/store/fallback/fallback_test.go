@@ -0,0 +1,187 @@
+package fallback
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/downloader"
+	"github.com/grafana/k6build/pkg/store/file"
+)
+
+func setupStore(t *testing.T, objects map[string]string) store.ObjectStore {
+	t.Helper()
+
+	objectStore, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	for id, content := range objects {
+		if _, err = objectStore.Put(context.TODO(), id, bytes.NewBufferString(content)); err != nil {
+			t.Fatalf("storing object %v", err)
+		}
+	}
+
+	return objectStore
+}
+
+func TestFallbackStore(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		id        string
+		content   string
+		fallback  bool
+		expectErr error
+	}{
+		{
+			title:   "object in primary",
+			id:      "both",
+			content: "primary",
+		},
+		{
+			title:    "object in secondary",
+			id:       "secondary",
+			content:  "secondary",
+			fallback: true,
+		},
+		{
+			title:     "object not found",
+			id:        "missing",
+			expectErr: store.ErrObjectNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			fallback, err := New(Config{
+				Primary:   setupStore(t, map[string]string{"both": "primary"}),
+				Secondary: setupStore(t, map[string]string{"both": "secondary", "secondary": "secondary"}),
+			})
+			if err != nil {
+				t.Fatalf("creating store %v", err)
+			}
+
+			object, err := fallback.Get(context.TODO(), tc.id)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			if object.Fallback != tc.fallback {
+				t.Fatalf("expected fallback %t got %t", tc.fallback, object.Fallback)
+			}
+
+			content, err := downloader.Download(context.TODO(), nil, object)
+			if err != nil {
+				t.Fatalf("downloading object %v", err)
+			}
+			defer content.Close() //nolint:errcheck
+
+			data, err := io.ReadAll(content)
+			if err != nil {
+				t.Fatalf("reading object %v", err)
+			}
+
+			if string(data) != tc.content {
+				t.Fatalf("expected %q got %q", tc.content, string(data))
+			}
+		})
+	}
+}
+
+func TestFallbackStoreWrites(t *testing.T) {
+	t.Parallel()
+
+	primary := setupStore(t, nil)
+	secondary := setupStore(t, map[string]string{"old": "old"})
+
+	fallback, err := New(Config{Primary: primary, Secondary: secondary})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	if _, err = fallback.Put(context.TODO(), "new", bytes.NewBufferString("new")); err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+
+	if _, err = primary.Get(context.TODO(), "new"); err != nil {
+		t.Fatalf("expected object in primary store got %v", err)
+	}
+
+	if _, err = secondary.Get(context.TODO(), "new"); !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected object not in secondary store got %v", err)
+	}
+
+	// objects can be deleted from the secondary store
+	if err = fallback.Delete(context.TODO(), "old"); err != nil {
+		t.Fatalf("deleting object %v", err)
+	}
+
+	if _, err = fallback.Get(context.TODO(), "old"); !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected object deleted got %v", err)
+	}
+}
+
+// readerStore reads the content of its objects, as a store whose URLs cannot be downloaded.
+// Objects from other stores are not supported.
+type readerStore struct {
+	store.ObjectStore
+}
+
+func (s readerStore) Read(ctx context.Context, object store.Object) (io.ReadCloser, error) {
+	stored, err := s.ObjectStore.Get(ctx, object.ID)
+	if err != nil || stored.URL != object.URL {
+		return nil, store.ErrNotSupported
+	}
+
+	return downloader.Download(ctx, nil, object)
+}
+
+func TestFallbackStoreRead(t *testing.T) {
+	t.Parallel()
+
+	primary := setupStore(t, map[string]string{"new": "new"})
+	secondary := readerStore{setupStore(t, map[string]string{"old": "old"})}
+
+	fallback, err := New(Config{Primary: primary, Secondary: secondary})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	// objects not read by the primary store are read by the secondary
+	object, err := fallback.Get(context.TODO(), "old")
+	if err != nil {
+		t.Fatalf("getting object %v", err)
+	}
+
+	content, err := fallback.Read(context.TODO(), object)
+	if err != nil {
+		t.Fatalf("reading object %v", err)
+	}
+	data, _ := io.ReadAll(content)
+	_ = content.Close()
+	if string(data) != "old" {
+		t.Fatalf("expected %q got %q", "old", data)
+	}
+
+	// objects neither store can read must be downloaded from their URL
+	object, err = fallback.Get(context.TODO(), "new")
+	if err != nil {
+		t.Fatalf("getting object %v", err)
+	}
+
+	if _, err = fallback.Read(context.TODO(), object); !errors.Is(err, store.ErrNotSupported) {
+		t.Fatalf("expected %v got %v", store.ErrNotSupported, err)
+	}
+}
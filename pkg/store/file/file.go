@@ -2,26 +2,46 @@
 package file
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/grafana/k6build"
 	"github.com/grafana/k6build/pkg/store"
 	"github.com/grafana/k6build/pkg/util"
 )
 
+// ErrObjectTooLarge is returned when storing an object larger than the store's maximum size
+var ErrObjectTooLarge = errors.New("object exceeds the store's maximum size")
+
 // Store a ObjectStore backed by a file system
 type Store struct {
-	dir     string
-	mutexes sync.Map
+	dir               string
+	checksumAlgorithm string
+	maxSize           int64
+	mutexes           sync.Map
+	// tracks the objects' size and recency if the store has a maximum size
+	lru *lru
+}
+
+// Config defines the configuration of a file object store
+type Config struct {
+	// Dir is the directory for storing the objects
+	Dir string
+	// ChecksumAlgorithm used for calculating the objects' checksum. Defaults to store.ChecksumSHA256
+	ChecksumAlgorithm string
+	// MaxSize is the maximum total size of the objects in bytes. When storing an object exceeds
+	// it, the least recently used objects are evicted. If 0, the size of the store is not limited.
+	MaxSize int64
 }
 
 // NewTempFileStore creates a file object store using a temporary file
@@ -31,14 +51,106 @@ func NewTempFileStore() (store.ObjectStore, error) {
 
 // NewFileStore creates an object store backed by a directory
 func NewFileStore(dir string) (store.ObjectStore, error) {
-	err := os.MkdirAll(dir, 0o750)
+	return New(Config{Dir: dir})
+}
+
+// New creates an object store from a Config
+func New(config Config) (store.ObjectStore, error) {
+	if _, err := store.NewHash(config.ChecksumAlgorithm); err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+
+	err := os.MkdirAll(config.Dir, 0o750)
 	if err != nil {
 		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
 	}
 
-	return &Store{
-		dir: dir,
-	}, nil
+	if config.MaxSize < 0 {
+		return nil, k6build.NewWrappedError(
+			store.ErrInitializingStore,
+			fmt.Errorf("invalid maximum size %d", config.MaxSize),
+		)
+	}
+
+	fileStore := &Store{
+		dir:               config.Dir,
+		checksumAlgorithm: config.ChecksumAlgorithm,
+		maxSize:           config.MaxSize,
+	}
+
+	if config.MaxSize > 0 {
+		if err = fileStore.loadLRU(); err != nil {
+			return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+		}
+	}
+
+	return fileStore, nil
+}
+
+// loadLRU tracks the objects already in the store, ordered by their last access time,
+// and evicts the least recently used if the store exceeds its maximum size.
+// The last access time of an object is kept as the modification time of its directory.
+func (f *Store) loadLRU() error {
+	ids, err := f.List(context.Background())
+	if err != nil {
+		return err
+	}
+
+	type objectInfo struct {
+		id       string
+		size     int64
+		accessed time.Time
+		pinned   bool
+	}
+
+	objects := make([]objectInfo, 0, len(ids))
+	for _, id := range ids {
+		objectDir := filepath.Join(f.dir, id)
+		dirInfo, err := os.Stat(objectDir)
+		if err != nil {
+			return err
+		}
+		dataInfo, err := os.Stat(filepath.Join(objectDir, "data"))
+		if err != nil {
+			return err
+		}
+		references, err := f.references(id)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, objectInfo{
+			id:       id,
+			size:     dataInfo.Size(),
+			accessed: dirInfo.ModTime(),
+			pinned:   references > 0,
+		})
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].accessed.Before(objects[j].accessed)
+	})
+
+	f.lru = newLRU(f.maxSize)
+	evicted := []string{}
+	for _, o := range objects {
+		evicted = append(evicted, f.lru.add(o.id, o.size, o.pinned)...)
+	}
+
+	return f.evict(evicted)
+}
+
+// evict removes the objects evicted from the store to keep it within its maximum size
+func (f *Store) evict(ids []string) error {
+	for _, id := range ids {
+		unlock := f.lockObject(id)
+		err := f.removeObject(id)
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Put stores the object and returns the metadata
@@ -48,8 +160,8 @@ func (f *Store) Put(_ context.Context, id string, content io.Reader) (store.Obje
 		return store.Object{}, fmt.Errorf("%w: id cannot be empty", store.ErrCreatingObject)
 	}
 
-	if strings.Contains(id, "/") {
-		return store.Object{}, fmt.Errorf("%w id cannot contain '/'", store.ErrCreatingObject)
+	if !validID(id) {
+		return store.Object{}, fmt.Errorf("%w: invalid id %q", store.ErrCreatingObject, id)
 	}
 
 	// prevent concurrent modification of an object
@@ -74,16 +186,28 @@ func (f *Store) Put(_ context.Context, id string, content io.Reader) (store.Obje
 	}
 	defer objectFile.Close() //nolint:errcheck
 
-	// write content to object file and copy to buffer to calculate checksum
-	// TODO: optimize memory by copying content in blocks
-	buff := bytes.Buffer{}
-	_, err = io.Copy(objectFile, io.TeeReader(content, &buff))
+	// write content to object file and calculate checksum while streaming, so the content
+	// is never fully buffered in memory
+	hash, _ := store.NewHash(f.checksumAlgorithm)
+	if f.lru != nil {
+		// don't write more than needed for detecting the object exceeds the store's size
+		content = io.LimitReader(content, f.maxSize+1)
+	}
+	size, err := io.Copy(objectFile, io.TeeReader(content, hash))
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
 	}
 
-	// calculate checksum
-	checksum := fmt.Sprintf("%x", sha256.Sum256(buff.Bytes()))
+	if f.lru != nil && size > f.maxSize {
+		_ = objectFile.Close()
+		_ = os.RemoveAll(objectDir)
+		return store.Object{}, k6build.NewWrappedError(
+			store.ErrCreatingObject,
+			fmt.Errorf("%w (%d bytes)", ErrObjectTooLarge, f.maxSize),
+		)
+	}
+
+	checksum := store.FormatChecksum(f.checksumAlgorithm, hash.Sum(nil))
 
 	// write metadata
 	err = os.WriteFile(filepath.Join(objectDir, "checksum"), []byte(checksum), 0o644) //nolint:gosec
@@ -91,11 +215,21 @@ func (f *Store) Put(_ context.Context, id string, content io.Reader) (store.Obje
 		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
 	}
 
+	if f.lru != nil {
+		// evicting other objects while holding the lock on this object is safe as
+		// it is not tracked until now, so it is never evicted by another Put
+		if err = f.evict(f.lru.add(id, size, false)); err != nil {
+			return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+		}
+	}
+
 	objectURL, _ := util.URLFromFilePath(objectFile.Name())
 	return store.Object{
-		ID:       id,
-		Checksum: checksum,
-		URL:      objectURL.String(),
+		ID:        id,
+		Checksum:  checksum,
+		URL:       objectURL.String(),
+		CreatedAt: time.Now(),
+		Size:      size,
 	}, nil
 }
 
@@ -117,17 +251,195 @@ func (f *Store) Get(_ context.Context, id string) (store.Object, error) {
 		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
 	}
 
+	dataFile, err := os.Stat(filepath.Join(objectDir, "data"))
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
 	objectURL, err := util.URLFromFilePath(filepath.Join(objectDir, "data"))
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
 	}
+
+	if f.lru != nil {
+		f.lru.touch(id)
+		now := time.Now()
+		_ = os.Chtimes(objectDir, now, now)
+	}
+
 	return store.Object{
-		ID:       id,
-		Checksum: string(checksum),
-		URL:      objectURL.String(),
+		ID:        id,
+		Checksum:  string(checksum),
+		URL:       objectURL.String(),
+		CreatedAt: dataFile.ModTime(),
+		Size:      dataFile.Size(),
 	}, nil
 }
 
+// Delete removes an object from the store
+func (f *Store) Delete(_ context.Context, id string) error {
+	if !validID(id) {
+		return fmt.Errorf("%w: invalid id %q", store.ErrDeletingObject, id)
+	}
+
+	unlock := f.lockObject(id)
+	defer unlock()
+
+	objectDir := filepath.Join(f.dir, id)
+	_, err := os.Stat(objectDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+	}
+
+	if err != nil {
+		return k6build.NewWrappedError(store.ErrDeletingObject, err)
+	}
+
+	err = f.removeObject(id)
+	if err != nil {
+		return k6build.NewWrappedError(store.ErrDeletingObject, err)
+	}
+
+	if f.lru != nil {
+		f.lru.remove(id)
+	}
+
+	return nil
+}
+
+// Pin adds a reference to the object. Objects with references are not evicted when the store
+// exceeds its maximum size. The references are kept in the object's directory.
+func (f *Store) Pin(_ context.Context, id string) (int, error) {
+	return f.updateReferences(id, 1)
+}
+
+// Release removes a reference to the object. Objects without references can be evicted when the
+// store exceeds its maximum size, the next time an object is stored.
+func (f *Store) Release(_ context.Context, id string) (int, error) {
+	return f.updateReferences(id, -1)
+}
+
+// updateReferences adds the delta to the object's references and returns them
+func (f *Store) updateReferences(id string, delta int) (int, error) {
+	if !validID(id) {
+		return 0, fmt.Errorf("%w: invalid id %q", store.ErrAccessingObject, id)
+	}
+
+	unlock := f.lockObject(id)
+	defer unlock()
+
+	_, err := os.Stat(filepath.Join(f.dir, id, "data"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+	}
+	if err != nil {
+		return 0, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	references, err := f.references(id)
+	if err != nil {
+		return 0, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	references += delta
+	if references < 0 {
+		return 0, fmt.Errorf("%w (%s)", store.ErrObjectNotPinned, id)
+	}
+
+	referencesFile := filepath.Join(f.dir, id, "references")
+	if references == 0 {
+		err = os.Remove(referencesFile)
+	} else {
+		err = os.WriteFile(referencesFile, []byte(strconv.Itoa(references)), 0o644) //nolint:gosec
+	}
+	if err != nil {
+		return 0, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	// an object that is no longer tracked is being evicted, and will be removed once
+	// its lock is released
+	if f.lru != nil && !f.lru.pin(id, references > 0) {
+		return 0, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+	}
+
+	return references, nil
+}
+
+// references returns the references to an object. Must be called holding the object's lock,
+// unless the object can't be accessed concurrently (e.g. while loading the store).
+func (f *Store) references(id string) (int, error) {
+	content, err := os.ReadFile(filepath.Join(f.dir, id, "references")) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// removeObject removes the object's directory and the id's prefix directory, if empty.
+// Must be called holding the object's lock.
+func (f *Store) removeObject(id string) error {
+	objectDir := filepath.Join(f.dir, id)
+	err := os.RemoveAll(objectDir)
+	if err != nil {
+		return err
+	}
+
+	// remove the id's prefix directory if it is empty. Fails if it is not.
+	if parent := filepath.Dir(objectDir); parent != filepath.Clean(f.dir) {
+		_ = os.Remove(parent)
+	}
+
+	return nil
+}
+
+// List returns the ids of the objects in the store
+func (f *Store) List(_ context.Context) ([]string, error) {
+	ids := []string{}
+	err := filepath.WalkDir(f.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() || path == f.dir {
+			return nil
+		}
+
+		// directories without a data file are prefixes of the ids (e.g. prefix/id)
+		if _, err = os.Stat(filepath.Join(path, "data")); err != nil {
+			return nil //nolint:nilerr
+		}
+
+		id, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, filepath.ToSlash(id))
+
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	return ids, nil
+}
+
+// validID checks the id is a sequence of non-empty segments separated by '/' (e.g. prefix/id)
+// that cannot reference a directory outside the store
+func validID(id string) bool {
+	for _, segment := range strings.Split(id, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
 // lockObject obtains a mutex used to prevent concurrent builds of the same artifact and
 // returns a function that will unlock the mutex associated to the given id in the object store.
 // The lock is also removed from the map. Subsequent calls will get another lock on the same
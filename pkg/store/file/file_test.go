@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/grafana/k6build/pkg/store"
 	"github.com/grafana/k6build/pkg/util"
@@ -61,6 +63,11 @@ func TestFileStoreStoreObject(t *testing.T) {
 			content:   []byte("new content"),
 			expectErr: store.ErrCreatingObject,
 		},
+		{
+			title:   "store object with prefix",
+			id:      "prefix/object",
+			content: []byte("content"),
+		},
 		{
 			title:   "store empty object",
 			id:      "empty",
@@ -188,3 +195,450 @@ func TestFileStoreGet(t *testing.T) {
 		})
 	}
 }
+
+func TestFileStoreDelete(t *testing.T) {
+	t.Parallel()
+
+	preload := []object{
+		{
+			id:      "object",
+			content: []byte("content"),
+		},
+		{
+			id:      "prefix/object",
+			content: []byte("content"),
+		},
+	}
+
+	testCases := []struct {
+		title     string
+		id        string
+		expectErr error
+	}{
+		{
+			title:     "delete existing object",
+			id:        "object",
+			expectErr: nil,
+		},
+		{
+			title:     "delete existing object with prefix",
+			id:        "prefix/object",
+			expectErr: nil,
+		},
+		{
+			title:     "delete non existing object",
+			id:        "another object",
+			expectErr: store.ErrObjectNotFound,
+		},
+		{
+			title:     "delete invalid id",
+			id:        "../object",
+			expectErr: store.ErrDeletingObject,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			fileStore, err := setupStore(t.TempDir(), preload)
+			if err != nil {
+				t.Fatalf("test setup: %v", err)
+			}
+
+			deleter, _ := fileStore.(store.ObjectDeleter)
+			err = deleter.Delete(context.TODO(), tc.id)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			_, err = fileStore.Get(context.TODO(), tc.id)
+			if !errors.Is(err, store.ErrObjectNotFound) {
+				t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+			}
+		})
+	}
+}
+
+func TestFileStoreChecksumAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		algorithm string
+		expected  string
+		expectErr error
+	}{
+		{
+			title:     "default algorithm",
+			algorithm: "",
+			expected:  "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+		},
+		{
+			title:     "sha256",
+			algorithm: store.ChecksumSHA256,
+			expected:  "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+		},
+		{
+			title:     "sha512",
+			algorithm: store.ChecksumSHA512,
+			expected: "sha512:b2d1d285b5199c85f988d03649c37e44fd3dde01e5d69c50fef90651962f48110e9340b60d" +
+				"49a479c4c0b53f5f07d690686dd87d2481937a512e8b85ee7c617f",
+		},
+		{
+			title:     "invalid algorithm",
+			algorithm: "md5",
+			expectErr: store.ErrInitializingStore,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			fileStore, err := New(Config{Dir: t.TempDir(), ChecksumAlgorithm: tc.algorithm})
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			obj, err := fileStore.Put(context.TODO(), "object", bytes.NewBufferString("content"))
+			if err != nil {
+				t.Fatalf("storing object %v", err)
+			}
+
+			if obj.Checksum != tc.expected {
+				t.Fatalf("expected checksum %s got %s", tc.expected, obj.Checksum)
+			}
+
+			if obj.Size != int64(len("content")) {
+				t.Fatalf("expected size %d got %d", len("content"), obj.Size)
+			}
+
+			obj, err = fileStore.Get(context.TODO(), "object")
+			if err != nil {
+				t.Fatalf("retrieving object %v", err)
+			}
+
+			if obj.Checksum != tc.expected {
+				t.Fatalf("expected checksum %s got %s", tc.expected, obj.Checksum)
+			}
+
+			if obj.Size != int64(len("content")) {
+				t.Fatalf("expected size %d got %d", len("content"), obj.Size)
+			}
+		})
+	}
+}
+
+func TestFileStoreList(t *testing.T) {
+	t.Parallel()
+
+	preload := []object{
+		{id: "object1", content: []byte("content1")},
+		{id: "object2", content: []byte("content2")},
+		{id: "prefix/object3", content: []byte("content3")},
+	}
+
+	objectStore, err := setupStore(t.TempDir(), preload)
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	lister, ok := objectStore.(store.ObjectLister)
+	if !ok {
+		t.Fatalf("store doesn't implement ObjectLister")
+	}
+
+	ids, err := lister.List(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	if len(ids) != len(preload) {
+		t.Fatalf("expected %d objects got %v", len(preload), ids)
+	}
+
+	for i, o := range preload {
+		if ids[i] != o.id {
+			t.Fatalf("expected %q got %q", o.id, ids[i])
+		}
+	}
+}
+
+func TestFileStoreMaxSize(t *testing.T) {
+	t.Parallel()
+
+	// operations on the store: store the object if content is not nil, pin or release it,
+	// otherwise get it
+	type operation struct {
+		id      string
+		content []byte
+		pin     bool
+		release bool
+	}
+
+	tenBytes := []byte("0123456789")
+
+	testCases := []struct {
+		title     string
+		maxSize   int64
+		ops       []operation
+		expectErr error
+		expected  []string
+		missing   []string
+	}{
+		{
+			title:   "within limits",
+			maxSize: 30,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object2", content: tenBytes},
+				{id: "object3", content: tenBytes},
+			},
+			expected: []string{"object1", "object2", "object3"},
+		},
+		{
+			title:   "evict least recently stored",
+			maxSize: 25,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object2", content: tenBytes},
+				{id: "object3", content: tenBytes},
+			},
+			expected: []string{"object2", "object3"},
+			missing:  []string{"object1"},
+		},
+		{
+			title:   "access updates recency",
+			maxSize: 25,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object2", content: tenBytes},
+				{id: "object1"},
+				{id: "object3", content: tenBytes},
+			},
+			expected: []string{"object1", "object3"},
+			missing:  []string{"object2"},
+		},
+		{
+			title:   "evict multiple objects",
+			maxSize: 25,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object2", content: tenBytes},
+				{id: "object3", content: []byte("01234567890123456789")},
+			},
+			expected: []string{"object3"},
+			missing:  []string{"object1", "object2"},
+		},
+		{
+			title:   "object exceeds max size",
+			maxSize: 25,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object2", content: []byte("0123456789012345678901234567890")},
+			},
+			expectErr: ErrObjectTooLarge,
+			expected:  []string{"object1"},
+			missing:   []string{"object2"},
+		},
+		{
+			title:   "pinned objects not evicted",
+			maxSize: 25,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object1", pin: true},
+				{id: "object2", content: tenBytes},
+				{id: "object3", content: tenBytes},
+			},
+			expected: []string{"object1", "object3"},
+			missing:  []string{"object2"},
+		},
+		{
+			title:   "released objects evicted",
+			maxSize: 25,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object1", pin: true},
+				{id: "object1", release: true},
+				{id: "object2", content: tenBytes},
+				{id: "object3", content: tenBytes},
+			},
+			expected: []string{"object2", "object3"},
+			missing:  []string{"object1"},
+		},
+		{
+			title:   "all objects pinned",
+			maxSize: 25,
+			ops: []operation{
+				{id: "object1", content: tenBytes},
+				{id: "object1", pin: true},
+				{id: "object2", content: tenBytes},
+				{id: "object2", pin: true},
+				{id: "object3", content: tenBytes},
+			},
+			expected: []string{"object1", "object2", "object3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			fileStore, err := New(Config{Dir: t.TempDir(), MaxSize: tc.maxSize})
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			pinner, _ := fileStore.(store.ObjectPinner)
+			for _, op := range tc.ops {
+				switch {
+				case op.content != nil:
+					_, err = fileStore.Put(context.TODO(), op.id, bytes.NewBuffer(op.content))
+				case op.pin:
+					_, err = pinner.Pin(context.TODO(), op.id)
+				case op.release:
+					_, err = pinner.Release(context.TODO(), op.id)
+				default:
+					_, err = fileStore.Get(context.TODO(), op.id)
+				}
+				if err != nil {
+					break
+				}
+			}
+
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			for _, id := range tc.expected {
+				if _, err = fileStore.Get(context.TODO(), id); err != nil {
+					t.Fatalf("expected %q in store got %v", id, err)
+				}
+			}
+
+			for _, id := range tc.missing {
+				if _, err = fileStore.Get(context.TODO(), id); !errors.Is(err, store.ErrObjectNotFound) {
+					t.Fatalf("expected %q not in store got %v", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreMaxSizeExistingObjects(t *testing.T) {
+	t.Parallel()
+
+	storeDir := t.TempDir()
+	preload := []object{
+		{id: "object1", content: []byte("0123456789")},
+		{id: "object2", content: []byte("0123456789")},
+		{id: "object3", content: []byte("0123456789")},
+	}
+
+	if _, err := setupStore(storeDir, preload); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	// set the last access time of the objects: object2 is the least recently used
+	accessed := map[string]time.Time{
+		"object1": time.Now().Add(-time.Hour),
+		"object2": time.Now().Add(-2 * time.Hour),
+		"object3": time.Now().Add(-3 * time.Minute),
+	}
+	for id, t0 := range accessed {
+		if err := os.Chtimes(filepath.Join(storeDir, id), t0, t0); err != nil {
+			t.Fatalf("test setup %v", err)
+		}
+	}
+
+	fileStore, err := New(Config{Dir: storeDir, MaxSize: 25})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	if _, err = fileStore.Get(context.TODO(), "object2"); !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected object2 to be evicted got %v", err)
+	}
+
+	// storing a new object evicts the least recently used of the remaining objects
+	if _, err = fileStore.Put(context.TODO(), "object4", bytes.NewBufferString("0123456789")); err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+
+	if _, err = fileStore.Get(context.TODO(), "object1"); !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected object1 to be evicted got %v", err)
+	}
+
+	for _, id := range []string{"object3", "object4"} {
+		if _, err = fileStore.Get(context.TODO(), id); err != nil {
+			t.Fatalf("expected %q in store got %v", id, err)
+		}
+	}
+}
+
+func TestFileStorePin(t *testing.T) {
+	t.Parallel()
+
+	storeDir := t.TempDir()
+	if _, err := setupStore(storeDir, []object{{id: "object", content: []byte("0123456789")}}); err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	fileStore, err := New(Config{Dir: storeDir, MaxSize: 15})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+	pinner, _ := fileStore.(store.ObjectPinner)
+
+	for _, expected := range []int{1, 2} {
+		references, err := pinner.Pin(context.TODO(), "object")
+		if err != nil {
+			t.Fatalf("pinning object %v", err)
+		}
+		if references != expected {
+			t.Fatalf("expected %d references got %d", expected, references)
+		}
+	}
+
+	if _, err = pinner.Pin(context.TODO(), "missing"); !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+	}
+
+	references, err := pinner.Release(context.TODO(), "object")
+	if err != nil || references != 1 {
+		t.Fatalf("expected 1 reference got %d %v", references, err)
+	}
+
+	// the references are kept when the store is reloaded
+	fileStore, err = New(Config{Dir: storeDir, MaxSize: 15})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+	pinner, _ = fileStore.(store.ObjectPinner)
+
+	if _, err = fileStore.Put(context.TODO(), "other", bytes.NewBufferString("0123456789")); err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+
+	if _, err = fileStore.Get(context.TODO(), "object"); err != nil {
+		t.Fatalf("expected pinned object in store got %v", err)
+	}
+
+	references, err = pinner.Release(context.TODO(), "object")
+	if err != nil || references != 0 {
+		t.Fatalf("expected 0 references got %d %v", references, err)
+	}
+
+	if _, err = pinner.Release(context.TODO(), "object"); !errors.Is(err, store.ErrObjectNotPinned) {
+		t.Fatalf("expected %v got %v", store.ErrObjectNotPinned, err)
+	}
+}
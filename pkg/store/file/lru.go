@@ -0,0 +1,106 @@
+package file
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru keeps track of the size of the objects in the store and the order they were accessed,
+// from the most to the least recently used. Pinned objects are never evicted.
+type lru struct {
+	mtx     sync.Mutex
+	maxSize int64
+	size    int64
+	order   *list.List
+	objects map[string]*list.Element
+}
+
+type lruEntry struct {
+	id     string
+	size   int64
+	pinned bool
+}
+
+func newLRU(maxSize int64) *lru {
+	return &lru{
+		maxSize: maxSize,
+		order:   list.New(),
+		objects: map[string]*list.Element{},
+	}
+}
+
+// add adds an object as the most recently used and returns the ids of the least recently used
+// objects that must be evicted to keep the total size within the limit. The evicted objects are
+// no longer tracked.
+func (l *lru) add(id string, size int64, pinned bool) []string {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if element, found := l.objects[id]; found {
+		l.size -= element.Value.(*lruEntry).size //nolint:forcetypeassert
+		l.order.Remove(element)
+	}
+
+	l.objects[id] = l.order.PushFront(&lruEntry{id: id, size: size, pinned: pinned})
+	l.size += size
+
+	return l.trim(id)
+}
+
+// trim removes the least recently used objects that are not pinned until the total size is
+// within the limit and returns their ids. The object just added is never removed, so the size
+// may exceed the limit if the remaining objects are pinned. Must be called holding the lock.
+func (l *lru) trim(added string) []string {
+	evicted := []string{}
+	element := l.order.Back()
+	for l.size > l.maxSize && element != nil {
+		prev := element.Prev()
+		entry := element.Value.(*lruEntry) //nolint:forcetypeassert
+		if !entry.pinned && entry.id != added {
+			l.order.Remove(element)
+			delete(l.objects, entry.id)
+			l.size -= entry.size
+			evicted = append(evicted, entry.id)
+		}
+		element = prev
+	}
+
+	return evicted
+}
+
+// pin sets whether an object is pinned. Returns false if the object is not tracked
+// (e.g. it was evicted)
+func (l *lru) pin(id string, pinned bool) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	element, found := l.objects[id]
+	if !found {
+		return false
+	}
+	element.Value.(*lruEntry).pinned = pinned //nolint:forcetypeassert
+
+	return true
+}
+
+// touch marks an object as the most recently used
+func (l *lru) touch(id string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if element, found := l.objects[id]; found {
+		l.order.MoveToFront(element)
+	}
+}
+
+// remove stops tracking an object
+func (l *lru) remove(id string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if element, found := l.objects[id]; found {
+		l.size -= element.Value.(*lruEntry).size //nolint:forcetypeassert
+		l.order.Remove(element)
+		delete(l.objects, id)
+	}
+}
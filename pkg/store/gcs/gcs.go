@@ -0,0 +1,308 @@
+// Package gcs implements an object store backed by a Google Cloud Storage bucket
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+const (
+	// DefaultURLExpiration is the default expiration for the signed download URLs.
+	// After this time attempts to download the object will fail
+	DefaultURLExpiration = time.Hour * 24
+
+	// MaxURLExpiration is the maximum expiration of the signed download URLs allowed by GCS
+	MaxURLExpiration = time.Hour * 24 * 7
+
+	// checksumMetadata is the key of the object's metadata that holds the checksum
+	checksumMetadata = "checksum"
+)
+
+// ErrUnauthorized is returned when the storage API rejects the credentials
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Config defines the configuration of a GCS object store
+type Config struct {
+	// Name of the GCS bucket
+	Bucket string
+	// Endpoint of the storage API (e.g. http://localhost:4443). Used for testing with an emulator.
+	// If set without a CredentialsFile, the bucket is accessed anonymously and the download URLs
+	// are not signed
+	Endpoint string
+	// CredentialsFile is the path to the JSON key file of the service account used for accessing
+	// the bucket and signing the download URLs. Defaults to the application default credentials
+	// (e.g. the GOOGLE_APPLICATION_CREDENTIALS environment variable or the credentials of the
+	// instance's service account). Download URLs are signed using the IAM signBlob API if the
+	// credentials have no private key
+	CredentialsFile string
+	// Expiration for the signed download URLs. Defaults to DefaultURLExpiration.
+	// Cannot exceed MaxURLExpiration
+	URLExpiration time.Duration
+	// ChecksumAlgorithm used for calculating the objects' checksum. Defaults to store.ChecksumSHA256.
+	// The checksum is stored as object metadata
+	ChecksumAlgorithm string
+}
+
+// Store is an ObjectStore backed by a GCS bucket.
+// The checksum of the objects is kept as object metadata. Uploads are also validated by GCS using
+// their CRC32C checksum.
+//
+// The objects' URLs are V4 signed URLs valid for the URL expiration, or the storage API's download
+// URL if the bucket is accessed anonymously (see Config.Endpoint).
+type Store struct {
+	bucket            *storage.BucketHandle
+	endpoint          *url.URL
+	anonymous         bool
+	expiration        time.Duration
+	checksumAlgorithm string
+}
+
+// New creates an object store backed by a GCS bucket.
+// Fails if there are no credentials for accessing the bucket, unless an endpoint is specified.
+func New(config Config) (store.ObjectStore, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("%w: bucket name cannot be empty", store.ErrInitializingStore)
+	}
+
+	if _, err := store.NewHash(config.ChecksumAlgorithm); err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+
+	if config.URLExpiration < 0 || config.URLExpiration > MaxURLExpiration {
+		return nil, fmt.Errorf(
+			"%w: url expiration must be between 0 and %s",
+			store.ErrInitializingStore,
+			MaxURLExpiration,
+		)
+	}
+
+	expiration := config.URLExpiration
+	if expiration == 0 {
+		expiration = DefaultURLExpiration
+	}
+
+	gcsStore := &Store{
+		expiration:        expiration,
+		checksumAlgorithm: config.ChecksumAlgorithm,
+	}
+
+	opts := []option.ClientOption{option.WithUserAgent(k6build.UserAgent)}
+	if config.Endpoint != "" {
+		endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+		if err != nil {
+			return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+		}
+		gcsStore.endpoint = endpoint
+		opts = append(opts, option.WithEndpoint(endpoint.JoinPath("storage", "v1").String()+"/"))
+	}
+
+	switch {
+	case config.CredentialsFile != "":
+		// fail early if the key file cannot be read, as it is read lazily by the client
+		if _, err := os.Stat(config.CredentialsFile); err != nil {
+			return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+		}
+		opts = append(opts, option.WithCredentialsFile(config.CredentialsFile))
+	case config.Endpoint != "":
+		gcsStore.anonymous = true
+		opts = append(opts, option.WithoutAuthentication())
+	}
+
+	// the client fails if no credentials are found
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+	gcsStore.bucket = client.Bucket(config.Bucket)
+
+	return gcsStore, nil
+}
+
+// Put stores the object and returns the metadata
+// Fails if the object already exists
+func (s *Store) Put(ctx context.Context, id string, content io.Reader) (store.Object, error) {
+	if id == "" {
+		return store.Object{}, fmt.Errorf("%w: id cannot be empty", store.ErrCreatingObject)
+	}
+
+	// spool the content to a temporary file while calculating the checksums, to avoid buffering
+	// the whole object in memory, as the metadata is sent before the content
+	spool, err := os.CreateTemp("", "k6build-gcs-*")
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	hash, _ := store.NewHash(s.checksumAlgorithm)
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	size, err := io.Copy(spool, io.TeeReader(content, io.MultiWriter(hash, crc)))
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	checksum := store.FormatChecksum(s.checksumAlgorithm, hash.Sum(nil))
+
+	// the upload fails if the object exists
+	writer := s.bucket.Object(id).If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+	writer.ContentType = "application/octet-stream"
+	writer.Metadata = map[string]string{checksumMetadata: checksum}
+	writer.CRC32C = crc.Sum32()
+	writer.SendCRC32C = true
+
+	if _, err = io.Copy(writer, spool); err != nil {
+		_ = writer.Close()
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+	}
+
+	if err = writer.Close(); err != nil {
+		if isPreconditionFailed(err) {
+			return store.Object{}, fmt.Errorf("%w: object already exists %q", store.ErrCreatingObject, id)
+		}
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+	}
+
+	downloadURL, err := s.downloadURL(id)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	return store.Object{
+		ID:        id,
+		Checksum:  checksum,
+		URL:       downloadURL,
+		CreatedAt: writer.Attrs().Created,
+		Size:      size,
+	}, nil
+}
+
+// Get retrieves an objects if exists in the object store or an error otherwise
+func (s *Store) Get(ctx context.Context, id string) (store.Object, error) {
+	attrs, err := s.bucket.Object(id).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return store.Object{}, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+		}
+		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, mapError(err))
+	}
+
+	downloadURL, err := s.downloadURL(id)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	return store.Object{
+		ID:        id,
+		Checksum:  attrs.Metadata[checksumMetadata],
+		URL:       downloadURL,
+		CreatedAt: attrs.Created,
+		Size:      attrs.Size,
+	}, nil
+}
+
+// Delete removes an object from the store
+func (s *Store) Delete(ctx context.Context, id string) error {
+	err := s.bucket.Object(id).Delete(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+		}
+		return k6build.NewWrappedError(store.ErrDeletingObject, mapError(err))
+	}
+
+	return nil
+}
+
+// List returns the ids of the objects in the store
+func (s *Store) List(ctx context.Context) ([]string, error) {
+	query := &storage.Query{}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	ids := []string{}
+	objects := s.bucket.Objects(ctx, query)
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, k6build.NewWrappedError(store.ErrAccessingObject, mapError(err))
+		}
+		ids = append(ids, attrs.Name)
+	}
+}
+
+// downloadURL returns the URL for downloading the object: a signed URL or the storage API's
+// download URL if the bucket is accessed anonymously
+func (s *Store) downloadURL(id string) (string, error) {
+	if s.anonymous {
+		objectURL := s.endpoint.JoinPath(
+			"storage", "v1", "b", url.PathEscape(s.bucket.BucketName()), "o", url.PathEscape(id),
+		)
+		return objectURL.String() + "?alt=media", nil
+	}
+
+	opts := &storage.SignedURLOptions{
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(s.expiration),
+		Scheme:  storage.SigningSchemeV4,
+	}
+	if s.endpoint != nil {
+		opts.Hostname = s.endpoint.Host
+		opts.Insecure = s.endpoint.Scheme == "http"
+	}
+
+	signedURL, err := s.bucket.SignedURL(id, opts)
+	if err != nil {
+		return "", fmt.Errorf("signing download url %w", err)
+	}
+
+	return signedURL, nil
+}
+
+// isPreconditionFailed returns true if the error signals a conditional request failed
+// (e.g. the object already exists)
+func isPreconditionFailed(err error) bool {
+	apiErr := &googleapi.Error{}
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// mapError returns ErrUnauthorized if the credentials were rejected
+func mapError(err error) error {
+	apiErr := &googleapi.Error{}
+	if errors.As(err, &apiErr) && (apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	tokenErr := &oauth2.RetrieveError{}
+	if errors.As(err, &tokenErr) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return err
+}
@@ -0,0 +1,486 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6build/pkg/store"
+)
+
+const testBucket = "k6-binaries"
+
+// fakeGCS is a minimal implementation of the storage JSON API that keeps the objects of one
+// bucket in memory. If a key is set, requests must be authorized with the token obtained from
+// its /token endpoint and the download URLs must be signed with the key.
+type fakeGCS struct {
+	mtx      sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+	key      *rsa.PrivateKey
+	token    string
+	url      string
+}
+
+func newFakeGCS(t *testing.T, key *rsa.PrivateKey, token string) *fakeGCS {
+	t.Helper()
+
+	fake := &fakeGCS{
+		objects:  map[string][]byte{},
+		metadata: map[string]map[string]string{},
+		key:      key,
+		token:    token,
+	}
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	fake.url = srv.URL
+
+	return fake
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if r.URL.Path == "/token" {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || f.token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": f.token, "expires_in": 3600})
+		return
+	}
+
+	// signed download urls
+	if id, found := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/"); found {
+		if f.key != nil && !f.validSignature(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		f.download(w, id)
+		return
+	}
+
+	if f.key != nil && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/upload/storage/v1/b/"+testBucket+"/o" && r.Method == http.MethodPost:
+		f.upload(w, r)
+	case r.URL.Path == "/storage/v1/b/"+testBucket+"/o" && r.Method == http.MethodGet:
+		names := []map[string]string{}
+		for name := range f.objects {
+			names = append(names, map[string]string{"name": name})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": names})
+	case strings.HasPrefix(r.URL.Path, "/storage/v1/b/"+testBucket+"/o/"):
+		id := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"+testBucket+"/o/")
+		f.serveObject(w, r, id)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeGCS) upload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("uploadType") != "multipart" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+
+	part, err := reader.NextPart()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	metadata := struct {
+		Name     string            `json:"name"`
+		Metadata map[string]string `json:"metadata"`
+		CRC32C   string            `json:"crc32c"`
+	}{}
+	if err = json.NewDecoder(part).Decode(&metadata); err != nil || metadata.CRC32C == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	part, err = reader.NextPart()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	content, _ := io.ReadAll(part)
+
+	if _, exists := f.objects[metadata.Name]; exists && r.URL.Query().Get("ifGenerationMatch") == "0" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	f.objects[metadata.Name] = content
+	f.metadata[metadata.Name] = metadata.Metadata
+	f.writeResource(w, metadata.Name)
+}
+
+func (f *fakeGCS) serveObject(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := f.objects[id]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("alt") == "media":
+		f.download(w, id)
+	case r.Method == http.MethodGet:
+		f.writeResource(w, id)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, id)
+		delete(f.metadata, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeGCS) writeResource(w http.ResponseWriter, id string) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"name":        id,
+		"size":        fmt.Sprintf("%d", len(f.objects[id])),
+		"timeCreated": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"metadata":    f.metadata[id],
+	})
+}
+
+func (f *fakeGCS) download(w http.ResponseWriter, id string) {
+	content, ok := f.objects[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+// validSignature checks the V4 signature of a download URL
+func (f *fakeGCS) validSignature(r *http.Request) bool {
+	query := r.URL.Query()
+	signature, err := hex.DecodeString(query.Get("X-Goog-Signature"))
+	if err != nil {
+		return false
+	}
+	query.Del("X-Goog-Signature")
+
+	names := []string{}
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := []string{}
+	for _, name := range names {
+		params = append(params, url.QueryEscape(name)+"="+url.QueryEscape(query.Get(name)))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		// the signed host doesn't include the port
+		"host:" + (&url.URL{Host: r.Host}).Hostname() + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+
+	credential := strings.SplitN(query.Get("X-Goog-Credential"), "/", 2)
+	if len(credential) != 2 {
+		return false
+	}
+	stringToSign := strings.Join([]string{
+		query.Get("X-Goog-Algorithm"),
+		query.Get("X-Goog-Date"),
+		credential[1],
+		hex.EncodeToString(hashedRequest[:]),
+	}, "\n")
+	digest := sha256.Sum256([]byte(stringToSign))
+
+	return rsa.VerifyPKCS1v15(&f.key.PublicKey, crypto.SHA256, digest[:], signature) == nil
+}
+
+// writeCredentials writes a service account key file for the key, using the fake's token endpoint
+func writeCredentials(t *testing.T, key *rsa.PrivateKey, tokenURI string) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("encoding key %v", err)
+	}
+
+	content, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "k6build@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err = os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("writing credentials %v", err)
+	}
+
+	return path
+}
+
+func download(t *testing.T, objectURL string) (int, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(objectURL)
+	if err != nil {
+		t.Fatalf("downloading object %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	content, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, content
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeGCS(t, nil, "")
+	objectStore, err := New(Config{Bucket: testBucket, Endpoint: fake.url, CredentialsFile: ""})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	content := []byte("k6 binary")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	stored, err := objectStore.Put(context.TODO(), "prefix/object", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+
+	if stored.Checksum != checksum || stored.Size != int64(len(content)) || stored.CreatedAt.IsZero() {
+		t.Fatalf("unexpected object %v", stored)
+	}
+
+	status, downloaded := download(t, stored.URL)
+	if status != http.StatusOK || !bytes.Equal(downloaded, content) {
+		t.Fatalf("unexpected download status %d content %q", status, downloaded)
+	}
+
+	got, err := objectStore.Get(context.TODO(), "prefix/object")
+	if err != nil {
+		t.Fatalf("getting object %v", err)
+	}
+
+	if got != stored {
+		t.Fatalf("expected %v got %v", stored, got)
+	}
+
+	_, err = objectStore.Put(context.TODO(), "prefix/object", bytes.NewReader(content))
+	if !errors.Is(err, store.ErrCreatingObject) {
+		t.Fatalf("expected %v got %v", store.ErrCreatingObject, err)
+	}
+
+	_, err = objectStore.Get(context.TODO(), "missing")
+	if !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+	}
+
+	lister, ok := objectStore.(store.ObjectLister)
+	if !ok {
+		t.Fatalf("expected the store to support listing objects")
+	}
+
+	ids, err := lister.List(context.TODO())
+	if err != nil {
+		t.Fatalf("listing objects %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "prefix/object" {
+		t.Fatalf("unexpected objects %v", ids)
+	}
+
+	deleter, ok := objectStore.(store.ObjectDeleter)
+	if !ok {
+		t.Fatalf("expected the store to support deleting objects")
+	}
+
+	if err = deleter.Delete(context.TODO(), "prefix/object"); err != nil {
+		t.Fatalf("deleting object %v", err)
+	}
+
+	_, err = objectStore.Get(context.TODO(), "prefix/object")
+	if !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+	}
+
+	err = deleter.Delete(context.TODO(), "prefix/object")
+	if !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+	}
+}
+
+func TestStoreCredentials(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+
+	testCases := []struct {
+		title     string
+		token     string
+		expectErr error
+	}{
+		{
+			title:     "valid credentials",
+			token:     "token",
+			expectErr: nil,
+		},
+		{
+			title:     "token rejected",
+			token:     "",
+			expectErr: ErrUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			fake := newFakeGCS(t, key, tc.token)
+			objectStore, err := New(Config{
+				Bucket:          testBucket,
+				Endpoint:        fake.url,
+				CredentialsFile: writeCredentials(t, key, fake.url+"/token"),
+				URLExpiration:   time.Hour,
+			})
+			if err != nil {
+				t.Fatalf("creating store %v", err)
+			}
+
+			content := []byte("k6 binary")
+			stored, err := objectStore.Put(context.TODO(), "object", bytes.NewReader(content))
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			signed, err := url.Parse(stored.URL)
+			if err != nil {
+				t.Fatalf("parsing url %v", err)
+			}
+			// the expiration is relative to the time the url is signed
+			expires, _ := strconv.Atoi(signed.Query().Get("X-Goog-Expires"))
+			if signed.Path != "/"+testBucket+"/object" || expires < 3500 || expires > 3600 {
+				t.Fatalf("unexpected signed url %q", stored.URL)
+			}
+
+			status, downloaded := download(t, stored.URL)
+			if status != http.StatusOK || !bytes.Equal(downloaded, content) {
+				t.Fatalf("unexpected download status %d content %q", status, downloaded)
+			}
+
+			// tampering the url invalidates the signature
+			query := signed.Query()
+			query.Set("X-Goog-Expires", "604800")
+			signed.RawQuery = query.Encode()
+			if status, _ = download(t, signed.String()); status != http.StatusForbidden {
+				t.Fatalf("expected status %d got %d", http.StatusForbidden, status)
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title  string
+		config Config
+	}{
+		{
+			title:  "missing bucket",
+			config: Config{},
+		},
+		{
+			title:  "invalid url expiration",
+			config: Config{Bucket: testBucket, URLExpiration: MaxURLExpiration + time.Hour},
+		},
+		{
+			title:  "invalid checksum algorithm",
+			config: Config{Bucket: testBucket, ChecksumAlgorithm: "md5"},
+		},
+		{
+			title:  "missing credentials file",
+			config: Config{Bucket: testBucket, CredentialsFile: "/missing/credentials.json"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.config)
+			if !errors.Is(err, store.ErrInitializingStore) {
+				t.Fatalf("expected %v got %v", store.ErrInitializingStore, err)
+			}
+		})
+	}
+}
+
+// TestMissingCredentials checks the store is not created without credentials, unless an
+// endpoint is specified (e.g. an emulator). It is not run in parallel with other tests because
+// it sets the environment.
+//
+//nolint:paralleltest
+func TestMissingCredentials(t *testing.T) {
+	// the application default credentials are read from the environment
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(t.TempDir(), "missing.json"))
+
+	_, err := New(Config{Bucket: testBucket})
+	if !errors.Is(err, store.ErrInitializingStore) {
+		t.Fatalf("expected %v got %v", store.ErrInitializingStore, err)
+	}
+
+	_, err = New(Config{Bucket: testBucket, Endpoint: "http://localhost:4443"})
+	if err != nil {
+		t.Fatalf("unexpected %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package keyprefix implements an object store that resolves the ids of the objects stored under
+// a prefix (e.g. k6-linux-amd64-v0.50.0/<id>) to their keys.
+//
+// This allows downloading the artifacts stored by a builder with the KeyPrefix option using only
+// their ids (e.g. by the download proxy or the store server), as the prefix cannot be derived from
+// the artifact's id.
+package keyprefix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
+)
+
+// Config defines the configuration of a key prefix store
+type Config struct {
+	// Store with the prefixed objects. Must support listing its objects (see store.ObjectLister)
+	Store store.ObjectStore
+}
+
+// Store is an ObjectStore that resolves the ids of prefixed objects to their keys.
+// The keys are resolved by listing the objects in the store and are cached, so the store is
+// listed only when an id is not found (e.g. the artifact was stored after the last listing).
+type Store struct {
+	store  store.ObjectStore
+	lister store.ObjectLister
+	mutex  sync.Mutex
+	// maps the ids to the keys of the objects
+	keys map[string]string
+}
+
+// New creates a key prefix store from a Config
+func New(config Config) (*Store, error) {
+	if config.Store == nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, errors.New("store cannot be nil"))
+	}
+
+	lister, ok := config.Store.(store.ObjectLister)
+	if !ok {
+		return nil, k6build.NewWrappedError(
+			store.ErrInitializingStore,
+			fmt.Errorf("%w: resolving prefixed keys requires listing the objects", store.ErrNotSupported),
+		)
+	}
+
+	return &Store{
+		store:  config.Store,
+		lister: lister,
+		keys:   map[string]string{},
+	}, nil
+}
+
+// Get retrieves an object by its key or, if not found, by its id without the prefix.
+// The object is returned with the id it was requested with.
+func (s *Store) Get(ctx context.Context, id string) (store.Object, error) {
+	object, err := s.store.Get(ctx, id)
+	if !errors.Is(err, store.ErrObjectNotFound) || strings.Contains(id, "/") {
+		return object, err
+	}
+
+	key, err := s.resolve(ctx, id)
+	if err != nil {
+		return store.Object{}, err
+	}
+
+	object, err = s.store.Get(ctx, key)
+	if err != nil {
+		// the object may have been removed since the store was listed
+		if errors.Is(err, store.ErrObjectNotFound) {
+			s.forget(id)
+		}
+		return store.Object{}, err
+	}
+
+	object.ID = id
+	return object, nil
+}
+
+// Put stores the object with the given id as key
+func (s *Store) Put(ctx context.Context, id string, content io.Reader) (store.Object, error) {
+	return s.store.Put(ctx, id, content)
+}
+
+// Delete removes an object by its key or, if not found, by its id without the prefix
+func (s *Store) Delete(ctx context.Context, id string) error {
+	deleter, ok := s.store.(store.ObjectDeleter)
+	if !ok {
+		return fmt.Errorf("%w: deleting objects", store.ErrNotSupported)
+	}
+
+	err := deleter.Delete(ctx, id)
+	if !errors.Is(err, store.ErrObjectNotFound) || strings.Contains(id, "/") {
+		return err
+	}
+
+	key, err := s.resolve(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.forget(id)
+
+	return deleter.Delete(ctx, key)
+}
+
+// Read returns the content of an object if the store supports reading objects (see store.ObjectReader)
+func (s *Store) Read(ctx context.Context, object store.Object) (io.ReadCloser, error) {
+	reader, ok := s.store.(store.ObjectReader)
+	if !ok {
+		return nil, fmt.Errorf("%w: reading objects", store.ErrNotSupported)
+	}
+
+	return reader.Read(ctx, object)
+}
+
+// resolve returns the key of the object with the given id, listing the store if the id is not cached
+func (s *Store) resolve(ctx context.Context, id string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if key, found := s.keys[id]; found {
+		return key, nil
+	}
+
+	keys, err := s.lister.List(ctx)
+	if err != nil {
+		return "", k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	s.keys = map[string]string{}
+	for _, key := range keys {
+		if strings.Contains(key, "/") {
+			s.keys[path.Base(key)] = key
+		}
+	}
+
+	key, found := s.keys[id]
+	if !found {
+		return "", fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+	}
+
+	return key, nil
+}
+
+func (s *Store) forget(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.keys, id)
+}
@@ -0,0 +1,138 @@
+package keyprefix
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/file"
+)
+
+func setupStore(t *testing.T, objects map[string]string) store.ObjectStore {
+	t.Helper()
+
+	objectStore, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	for id, content := range objects {
+		if _, err = objectStore.Put(context.TODO(), id, bytes.NewBufferString(content)); err != nil {
+			t.Fatalf("storing object %v", err)
+		}
+	}
+
+	return objectStore
+}
+
+func TestKeyPrefixStore(t *testing.T) {
+	t.Parallel()
+
+	objects := map[string]string{
+		"k6-linux-amd64-v0.1.0/prefixed": "prefixed",
+		"unprefixed":                     "unprefixed",
+	}
+
+	testCases := []struct {
+		title     string
+		id        string
+		expectErr error
+	}{
+		{
+			title: "prefixed object by id",
+			id:    "prefixed",
+		},
+		{
+			title: "prefixed object by key",
+			id:    "k6-linux-amd64-v0.1.0/prefixed",
+		},
+		{
+			title: "unprefixed object",
+			id:    "unprefixed",
+		},
+		{
+			title:     "object not found",
+			id:        "missing",
+			expectErr: store.ErrObjectNotFound,
+		},
+		{
+			title:     "prefixed object not found",
+			id:        "k6-linux-amd64-v0.1.0/missing",
+			expectErr: store.ErrObjectNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			prefixed, err := New(Config{Store: setupStore(t, objects)})
+			if err != nil {
+				t.Fatalf("creating store %v", err)
+			}
+
+			object, err := prefixed.Get(context.TODO(), tc.id)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			if object.ID != tc.id {
+				t.Fatalf("expected id %q got %q", tc.id, object.ID)
+			}
+		})
+	}
+}
+
+func TestKeyPrefixStoreUpdates(t *testing.T) {
+	t.Parallel()
+
+	objectStore := setupStore(t, map[string]string{"k6-linux-amd64-v0.1.0/first": "first"})
+
+	prefixed, err := New(Config{Store: objectStore})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	if _, err = prefixed.Get(context.TODO(), "first"); err != nil {
+		t.Fatalf("getting object %v", err)
+	}
+
+	// objects stored after the store was listed are resolved
+	if _, err = objectStore.Put(context.TODO(), "k6-linux-amd64-v0.1.0/second", bytes.NewBufferString("second")); err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+
+	if _, err = prefixed.Get(context.TODO(), "second"); err != nil {
+		t.Fatalf("getting object %v", err)
+	}
+
+	// objects can be deleted by id
+	if err = prefixed.Delete(context.TODO(), "first"); err != nil {
+		t.Fatalf("deleting object %v", err)
+	}
+
+	if _, err = objectStore.Get(context.TODO(), "k6-linux-amd64-v0.1.0/first"); !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected object deleted got %v", err)
+	}
+
+	if _, err = prefixed.Get(context.TODO(), "first"); !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected object deleted got %v", err)
+	}
+}
+
+func TestKeyPrefixStoreRequiresLister(t *testing.T) {
+	t.Parallel()
+
+	// hide the store's List method
+	objectStore := struct{ store.ObjectStore }{setupStore(t, nil)}
+
+	if _, err := New(Config{Store: objectStore}); !errors.Is(err, store.ErrNotSupported) {
+		t.Fatalf("expected %v got %v", store.ErrNotSupported, err)
+	}
+}
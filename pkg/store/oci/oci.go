@@ -0,0 +1,329 @@
+// Package oci implements an object store that pushes the objects as OCI artifacts to a registry
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/errcode"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+const (
+	// ArtifactType is the type of the OCI artifacts pushed to the registry
+	ArtifactType = "application/vnd.k6build.artifact.v1"
+
+	layerMediaType = "application/octet-stream"
+)
+
+var (
+	// ErrUnauthorized is returned when the registry rejects the credentials
+	ErrUnauthorized = errors.New("unauthorized")
+
+	tagRe = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+// Config defines the configuration of an OCI object store
+type Config struct {
+	// Registry is the host (and port) of the registry (e.g. registry.example.com:5000)
+	Registry string
+	// Repository where the artifacts are pushed (e.g. k6/binaries)
+	Repository string
+	// PlainHTTP accesses the registry using http instead of https
+	PlainHTTP bool
+	// Username and Password authenticate with the registry, either with basic authentication or
+	// for obtaining a bearer token. If not specified, the registry is accessed anonymously
+	Username string
+	Password string
+	// HTTPClient used for accessing the registry. Defaults to a client that retries failed requests
+	HTTPClient *http.Client
+}
+
+// Store is an ObjectStore that pushes each object to a registry as an OCI artifact with the
+// binary as its only layer, tagged with the object's id ('/' replaced by '_').
+// The object's URL is the artifact's reference (oci://<registry>/<repository>@<digest>),
+// which can be pulled using OCI tooling (e.g. oras pull <registry>/<repository>@<digest>).
+// As the URL cannot be downloaded over http, the store implements store.ObjectReader for
+// reading the objects' content. The checksum of the objects is their sha256 digest in the registry.
+//
+// The registry is accessed using ORAS. Blobs that already exist in the repository (checked by
+// their digest) are not uploaded again.
+type Store struct {
+	repo       *remote.Repository
+	registry   string
+	repository string
+}
+
+// New creates an object store backed by a repository in an OCI registry
+func New(config Config) (store.ObjectStore, error) {
+	if config.Registry == "" {
+		return nil, fmt.Errorf("%w: registry cannot be empty", store.ErrInitializingStore)
+	}
+
+	if config.Repository == "" {
+		return nil, fmt.Errorf("%w: repository cannot be empty", store.ErrInitializingStore)
+	}
+
+	repo, err := remote.NewRepository(config.Registry + "/" + config.Repository)
+	if err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+	repo.PlainHTTP = config.PlainHTTP
+
+	client := config.HTTPClient
+	if client == nil {
+		client = retry.DefaultClient
+	}
+
+	authClient := &auth.Client{
+		Client: client,
+		Cache:  auth.NewCache(),
+	}
+	authClient.SetUserAgent(k6build.UserAgent)
+	if config.Username != "" {
+		authClient.Credential = auth.StaticCredential(
+			repo.Reference.Registry,
+			auth.Credential{Username: config.Username, Password: config.Password},
+		)
+	}
+	repo.Client = authClient
+
+	return &Store{
+		repo:       repo,
+		registry:   config.Registry,
+		repository: config.Repository,
+	}, nil
+}
+
+// objectTag returns the tag of the artifact for an object's id
+func objectTag(id string) (string, error) {
+	tag := strings.ReplaceAll(id, "/", "_")
+	if !tagRe.MatchString(tag) {
+		return "", fmt.Errorf("invalid id %q", id)
+	}
+
+	return tag, nil
+}
+
+// Put pushes the object to the registry and returns its metadata
+// Fails if the object already exists
+func (s *Store) Put(ctx context.Context, id string, content io.Reader) (store.Object, error) {
+	if id == "" {
+		return store.Object{}, fmt.Errorf("%w: id cannot be empty", store.ErrCreatingObject)
+	}
+
+	tag, err := objectTag(id)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	_, err = s.repo.Resolve(ctx, tag)
+	if err == nil {
+		return store.Object{}, fmt.Errorf("%w: object already exists %q", store.ErrCreatingObject, id)
+	}
+	if !errors.Is(err, errdef.ErrNotFound) {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+	}
+
+	// spool the content to a temporary file while calculating its digest, to avoid buffering
+	// the whole object in memory. The blob's digest must be known before uploading it.
+	spool, err := os.CreateTemp("", "k6build-oci-*")
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(spool, io.TeeReader(content, hash))
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	checksum := fmt.Sprintf("%x", hash.Sum(nil))
+	layer := ocispec.Descriptor{
+		MediaType:   layerMediaType,
+		Digest:      digest.NewDigestFromEncoded(digest.SHA256, checksum),
+		Size:        size,
+		Annotations: map[string]string{ocispec.AnnotationTitle: "k6"},
+	}
+
+	exists, err := s.repo.Exists(ctx, layer)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+	}
+	if !exists {
+		if err = s.repo.Push(ctx, layer, spool); err != nil {
+			return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+		}
+	}
+
+	// the artifact's config is the empty descriptor, pushed by ORAS if it doesn't exist
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	manifest, err := oras.PackManifest(ctx, s.repo, oras.PackManifestVersion1_1, ArtifactType, oras.PackManifestOptions{
+		Layers:              []ocispec.Descriptor{layer},
+		ManifestAnnotations: map[string]string{ocispec.AnnotationCreated: createdAt.Format(time.RFC3339)},
+	})
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+	}
+
+	if err = s.repo.Tag(ctx, manifest, tag); err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, mapError(err))
+	}
+
+	return store.Object{
+		ID:        id,
+		Checksum:  checksum,
+		URL:       s.reference(manifest.Digest),
+		CreatedAt: createdAt,
+		Size:      size,
+	}, nil
+}
+
+// Get retrieves the metadata of an object from its artifact's manifest
+func (s *Store) Get(ctx context.Context, id string) (store.Object, error) {
+	tag, err := objectTag(id)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	manifestDesc, manifest, err := s.fetchManifest(ctx, tag)
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return store.Object{}, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+		}
+		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	if len(manifest.Layers) != 1 {
+		return store.Object{}, fmt.Errorf("%w: unexpected artifact %q", store.ErrAccessingObject, id)
+	}
+
+	layer := manifest.Layers[0]
+	if layer.Digest.Algorithm() != digest.SHA256 {
+		return store.Object{}, fmt.Errorf("%w: unsupported digest %q", store.ErrAccessingObject, layer.Digest)
+	}
+
+	// the creation time is informative, ignore it if invalid
+	createdAt, _ := time.Parse(time.RFC3339, manifest.Annotations[ocispec.AnnotationCreated])
+
+	return store.Object{
+		ID:        id,
+		Checksum:  layer.Digest.Encoded(),
+		URL:       s.reference(manifestDesc.Digest),
+		CreatedAt: createdAt,
+		Size:      layer.Size,
+	}, nil
+}
+
+// Read returns the content of an object, fetching the layer of the artifact referenced by the
+// object's URL. Returns store.ErrNotSupported if the URL doesn't reference an artifact in the
+// store's repository.
+func (s *Store) Read(ctx context.Context, object store.Object) (io.ReadCloser, error) {
+	manifestDigest, found := strings.CutPrefix(object.URL, s.reference(""))
+	if !found {
+		return nil, fmt.Errorf("%w: reading object from %q", store.ErrNotSupported, object.URL)
+	}
+
+	_, manifest, err := s.fetchManifest(ctx, manifestDigest)
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return nil, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, object.ID)
+		}
+		return nil, k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	if len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("%w: unexpected artifact %q", store.ErrAccessingObject, object.ID)
+	}
+
+	// the registry may support range requests, in which case the content is seekable
+	content, err := s.repo.Fetch(ctx, manifest.Layers[0])
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return nil, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, object.ID)
+		}
+		return nil, k6build.NewWrappedError(store.ErrAccessingObject, mapError(err))
+	}
+
+	return content, nil
+}
+
+// Delete removes the object's artifact from the registry. The blobs are left for the
+// registry's garbage collection.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	tag, err := objectTag(id)
+	if err != nil {
+		return k6build.NewWrappedError(store.ErrDeletingObject, err)
+	}
+
+	manifest, err := s.repo.Resolve(ctx, tag)
+	if err == nil {
+		err = s.repo.Delete(ctx, manifest)
+	}
+	if err != nil {
+		if errors.Is(err, errdef.ErrNotFound) {
+			return fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+		}
+		return k6build.NewWrappedError(store.ErrDeletingObject, mapError(err))
+	}
+
+	return nil
+}
+
+// reference returns the URL of the artifact with the given manifest digest
+func (s *Store) reference(manifestDigest digest.Digest) string {
+	return fmt.Sprintf("oci://%s/%s@%s", s.registry, s.repository, manifestDigest)
+}
+
+// fetchManifest returns the descriptor and the content of the manifest with the given reference
+// (a tag or a digest)
+func (s *Store) fetchManifest(ctx context.Context, reference string) (ocispec.Descriptor, ocispec.Manifest, error) {
+	desc, content, err := oras.FetchBytes(ctx, s.repo, reference, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return ocispec.Descriptor{}, ocispec.Manifest{}, mapError(err)
+	}
+
+	manifest := ocispec.Manifest{}
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return ocispec.Descriptor{}, ocispec.Manifest{}, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	return desc, manifest, nil
+}
+
+// mapError returns ErrUnauthorized if the registry rejected the credentials
+func mapError(err error) error {
+	respErr := &errcode.ErrorResponse{}
+	if errors.As(err, &respErr) &&
+		(respErr.StatusCode == http.StatusUnauthorized || respErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return err
+}
@@ -0,0 +1,338 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/k6build/pkg/store"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const testRepository = "k6/binaries"
+
+// registry is a minimal OCI registry that keeps the blobs and manifests of one repository
+// in memory. If a token is set, requests must be authorized with a bearer token obtained
+// from its /token endpoint using the given credentials.
+type registry struct {
+	mtx       sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+	token     string
+	username  string
+	password  string
+	url       string
+}
+
+func newRegistry(t *testing.T, token, username, password string) *registry {
+	t.Helper()
+
+	reg := &registry{
+		blobs:     map[string][]byte{},
+		manifests: map[string][]byte{},
+		token:     token,
+		username:  username,
+		password:  password,
+	}
+
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	reg.url = srv.URL
+
+	return reg
+}
+
+func (reg *registry) host() string {
+	u, _ := url.Parse(reg.url)
+	return u.Host
+}
+
+func digestOf(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func (reg *registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if r.URL.Path == "/token" {
+		if reg.username != "" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != reg.username || password != reg.password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": reg.token})
+		return
+	}
+
+	if reg.token != "" && r.Header.Get("Authorization") != "Bearer "+reg.token {
+		w.Header().Set(
+			"WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull,push"`, reg.url, testRepository),
+		)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path, found := strings.CutPrefix(r.URL.Path, "/v2/"+testRepository+"/")
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case path == "blobs/uploads/" && r.Method == http.MethodPost:
+		w.Header().Set("Location", "/v2/"+testRepository+"/blobs/uploads/session?state=1")
+		w.WriteHeader(http.StatusAccepted)
+	case path == "blobs/uploads/session" && r.Method == http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		digest := r.URL.Query().Get("digest")
+		if digest != digestOf(content) || r.URL.Query().Get("state") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.blobs[digest] = content
+		reg.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "blobs/"):
+		digest := strings.TrimPrefix(path, "blobs/")
+		content, ok := reg.blobs[digest]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	case strings.HasPrefix(path, "manifests/"):
+		reg.serveManifest(w, r, strings.TrimPrefix(path, "manifests/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (reg *registry) serveManifest(w http.ResponseWriter, r *http.Request, ref string) {
+	switch r.Method {
+	case http.MethodPut:
+		content, _ := io.ReadAll(r.Body)
+		artifact := ocispec.Manifest{}
+		if err := json.Unmarshal(content, &artifact); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// the blobs must be pushed before the manifest
+		for _, d := range append(artifact.Layers, artifact.Config) {
+			if _, ok := reg.blobs[string(d.Digest)]; !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		reg.manifests[ref] = content
+		reg.manifests[digestOf(content)] = content
+		w.Header().Set("Docker-Content-Digest", digestOf(content))
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		content, ok := reg.manifests[ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+		w.Header().Set("Docker-Content-Digest", digestOf(content))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	case http.MethodDelete:
+		content, ok := reg.manifests[ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for tag, c := range reg.manifests {
+			if bytes.Equal(c, content) {
+				delete(reg.manifests, tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	reg := newRegistry(t, "", "", "")
+	objectStore, err := New(Config{Registry: reg.host(), Repository: testRepository, PlainHTTP: true})
+	if err != nil {
+		t.Fatalf("creating store %v", err)
+	}
+
+	content := []byte("k6 binary")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	stored, err := objectStore.Put(context.TODO(), "prefix/object", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+
+	if stored.Checksum != checksum || stored.Size != int64(len(content)) || stored.CreatedAt.IsZero() {
+		t.Fatalf("unexpected object %v", stored)
+	}
+
+	reference := fmt.Sprintf("oci://%s/%s@sha256:", reg.host(), testRepository)
+	if !strings.HasPrefix(stored.URL, reference) {
+		t.Fatalf("expected reference %q got %q", reference, stored.URL)
+	}
+
+	if _, ok := reg.manifests["prefix_object"]; !ok {
+		t.Fatalf("expected the artifact tagged with the object's id")
+	}
+
+	got, err := objectStore.Get(context.TODO(), "prefix/object")
+	if err != nil {
+		t.Fatalf("getting object %v", err)
+	}
+
+	if got != stored {
+		t.Fatalf("expected %v got %v", stored, got)
+	}
+
+	reader, ok := objectStore.(store.ObjectReader)
+	if !ok {
+		t.Fatalf("expected the store to support reading objects")
+	}
+
+	objectContent, err := reader.Read(context.TODO(), got)
+	if err != nil {
+		t.Fatalf("reading object %v", err)
+	}
+	read, _ := io.ReadAll(objectContent)
+	_ = objectContent.Close()
+	if !bytes.Equal(read, content) {
+		t.Fatalf("expected content %q got %q", content, read)
+	}
+
+	// objects from other stores are not read
+	_, err = reader.Read(context.TODO(), store.Object{ID: "other", URL: "https://example.com/other"})
+	if !errors.Is(err, store.ErrNotSupported) {
+		t.Fatalf("expected %v got %v", store.ErrNotSupported, err)
+	}
+
+	_, err = objectStore.Put(context.TODO(), "prefix/object", bytes.NewReader(content))
+	if !errors.Is(err, store.ErrCreatingObject) {
+		t.Fatalf("expected %v got %v", store.ErrCreatingObject, err)
+	}
+
+	// the content and the config blobs were already uploaded
+	uploads := reg.uploads
+	if _, err = objectStore.Put(context.TODO(), "other", bytes.NewReader(content)); err != nil {
+		t.Fatalf("storing object %v", err)
+	}
+	if reg.uploads != uploads {
+		t.Fatalf("expected existing blobs not to be uploaded")
+	}
+
+	_, err = objectStore.Get(context.TODO(), "missing")
+	if !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+	}
+
+	deleter, ok := objectStore.(store.ObjectDeleter)
+	if !ok {
+		t.Fatalf("expected the store to support deleting objects")
+	}
+
+	if err = deleter.Delete(context.TODO(), "prefix/object"); err != nil {
+		t.Fatalf("deleting object %v", err)
+	}
+
+	_, err = objectStore.Get(context.TODO(), "prefix/object")
+	if !errors.Is(err, store.ErrObjectNotFound) {
+		t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+	}
+
+	_, err = objectStore.Put(context.TODO(), "invalid:id", bytes.NewReader(content))
+	if !errors.Is(err, store.ErrCreatingObject) {
+		t.Fatalf("expected %v got %v", store.ErrCreatingObject, err)
+	}
+}
+
+func TestStoreAuthentication(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title     string
+		username  string
+		password  string
+		expectErr error
+	}{
+		{
+			title:     "valid credentials",
+			username:  "user",
+			password:  "secret",
+			expectErr: nil,
+		},
+		{
+			title:     "invalid credentials",
+			username:  "user",
+			password:  "wrong",
+			expectErr: ErrUnauthorized,
+		},
+		{
+			title:     "no credentials",
+			expectErr: ErrUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			reg := newRegistry(t, "token", "user", "secret")
+			objectStore, err := New(Config{
+				Registry:   reg.host(),
+				Repository: testRepository,
+				PlainHTTP:  true,
+				Username:   tc.username,
+				Password:   tc.password,
+			})
+			if err != nil {
+				t.Fatalf("creating store %v", err)
+			}
+
+			_, err = objectStore.Put(context.TODO(), "object", bytes.NewReader([]byte("k6 binary")))
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			if _, err = objectStore.Get(context.TODO(), "object"); err != nil {
+				t.Fatalf("getting object %v", err)
+			}
+		})
+	}
+}
@@ -2,13 +2,12 @@
 package s3
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -25,11 +24,18 @@ import (
 // TODO: check this default (AWS default is 900 seconds)
 const DefaultURLExpiration = time.Hour * 24
 
+// MaxURLExpiration is the maximum expiration of the presigned download URLs allowed by S3
+const MaxURLExpiration = time.Hour * 24 * 7
+
+// checksumMetadata is the key of the object's metadata that holds the checksum
+const checksumMetadata = "checksum"
+
 // Store a ObjectStore backed by a S3 bucket
 type Store struct {
-	bucket     string
-	client     *s3.Client
-	expiration time.Duration
+	bucket            string
+	client            *s3.Client
+	expiration        time.Duration
+	checksumAlgorithm string
 }
 
 // Config S3 Store configuration
@@ -42,8 +48,12 @@ type Config struct {
 	Endpoint string
 	// AWS Region
 	Region string
-	// Expiration for the presigned download URLs
+	// Expiration for the presigned download URLs. Defaults to DefaultURLExpiration.
+	// Cannot exceed MaxURLExpiration
 	URLExpiration time.Duration
+	// ChecksumAlgorithm used for calculating the objects' checksum. Defaults to store.ChecksumSHA256
+	// S3's native checksum is used for sha256. Other algorithms are stored as object metadata.
+	ChecksumAlgorithm string
 }
 
 // returns the S3 client options
@@ -83,6 +93,18 @@ func New(conf Config) (store.ObjectStore, error) {
 		return nil, fmt.Errorf("%w: bucket name cannot be empty", store.ErrInitializingStore)
 	}
 
+	if _, err := store.NewHash(conf.ChecksumAlgorithm); err != nil {
+		return nil, k6build.NewWrappedError(store.ErrInitializingStore, err)
+	}
+
+	if conf.URLExpiration < 0 || conf.URLExpiration > MaxURLExpiration {
+		return nil, fmt.Errorf(
+			"%w: url expiration must be between 0 and %s",
+			store.ErrInitializingStore,
+			MaxURLExpiration,
+		)
+	}
+
 	client := conf.Client
 	if client == nil {
 		cfg, err := config.LoadDefaultConfig(context.TODO(), conf.awsOpts()...)
@@ -97,9 +119,10 @@ func New(conf Config) (store.ObjectStore, error) {
 		expiration = DefaultURLExpiration
 	}
 	return &Store{
-		client:     client,
-		bucket:     conf.Bucket,
-		expiration: expiration,
+		client:            client,
+		bucket:            conf.Bucket,
+		expiration:        expiration,
+		checksumAlgorithm: conf.ChecksumAlgorithm,
 	}, nil
 }
 
@@ -110,23 +133,43 @@ func (s *Store) Put(ctx context.Context, id string, content io.Reader) (store.Ob
 		return store.Object{}, fmt.Errorf("%w: id cannot be empty", store.ErrCreatingObject)
 	}
 
-	buff, err := io.ReadAll(content)
+	// spool the content to a temporary file while calculating the checksum, to avoid buffering
+	// the whole object in memory. The S3 client needs a seekable body to know its length.
+	spool, err := os.CreateTemp("", "k6build-s3-*")
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
 	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
 
-	checksum := sha256.Sum256(buff)
-	_, err = s.client.PutObject(
-		ctx,
-		&s3.PutObjectInput{
-			Bucket:            aws.String(s.bucket),
-			Key:               aws.String(id),
-			Body:              bytes.NewReader(buff),
-			ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
-			ChecksumSHA256:    aws.String(base64.StdEncoding.EncodeToString(checksum[:])),
-			IfNoneMatch:       aws.String("*"),
-		},
-	)
+	hash, _ := store.NewHash(s.checksumAlgorithm)
+	size, err := io.Copy(spool, io.TeeReader(content, hash))
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
+	}
+
+	checksum := hash.Sum(nil)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(id),
+		Body:        spool,
+		IfNoneMatch: aws.String("*"),
+		Metadata:    map[string]string{checksumMetadata: store.FormatChecksum(s.checksumAlgorithm, checksum)},
+	}
+	// use S3 native checksum validation when supported by the algorithm
+	if s.checksumAlgorithm == "" || s.checksumAlgorithm == store.ChecksumSHA256 {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+		input.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(checksum))
+	}
+
+	_, err = s.client.PutObject(ctx, input)
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(store.ErrCreatingObject, err)
 	}
@@ -137,46 +180,107 @@ func (s *Store) Put(ctx context.Context, id string, content io.Reader) (store.Ob
 	}
 
 	return store.Object{
-		ID:       id,
-		Checksum: fmt.Sprintf("%x", checksum),
-		URL:      url,
+		ID:        id,
+		Checksum:  store.FormatChecksum(s.checksumAlgorithm, checksum),
+		URL:       url,
+		CreatedAt: time.Now(),
+		Size:      size,
 	}, nil
 }
 
 // Get retrieves an objects if exists in the object store or an error otherwise
 func (s *Store) Get(ctx context.Context, id string) (store.Object, error) {
-	obj, err := s.client.GetObjectAttributes(
+	obj, err := s.client.HeadObject(
 		ctx,
-		&s3.GetObjectAttributesInput{
-			Bucket: aws.String(s.bucket),
-			Key:    aws.String(id),
-			ObjectAttributes: []types.ObjectAttributes{
-				types.ObjectAttributesChecksum,
-				types.ObjectAttributesEtag,
-			},
+		&s3.HeadObjectInput{
+			Bucket:       aws.String(s.bucket),
+			Key:          aws.String(id),
+			ChecksumMode: types.ChecksumModeEnabled,
 		},
 	)
 	if err != nil {
-		var bne *types.NoSuchKey
-		if errors.As(err, &bne) {
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
 			return store.Object{}, fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
 		}
 
 		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
 	}
 
+	// objects stored without the checksum metadata have a native sha256 checksum
+	checksum := obj.Metadata[checksumMetadata]
+	if checksum == "" && obj.ChecksumSHA256 != nil {
+		sum, err := base64.StdEncoding.DecodeString(*obj.ChecksumSHA256)
+		if err != nil {
+			return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
+		}
+		checksum = store.FormatChecksum(store.ChecksumSHA256, sum)
+	}
+
 	url, err := s.getDownloadURL(ctx, id)
 	if err != nil {
 		return store.Object{}, k6build.NewWrappedError(store.ErrAccessingObject, err)
 	}
 
 	return store.Object{
-		ID:       id,
-		Checksum: *obj.Checksum.ChecksumSHA256,
-		URL:      url,
+		ID:        id,
+		Checksum:  checksum,
+		URL:       url,
+		CreatedAt: aws.ToTime(obj.LastModified),
+		Size:      aws.ToInt64(obj.ContentLength),
 	}, nil
 }
 
+// Delete removes an object from the store
+func (s *Store) Delete(ctx context.Context, id string) error {
+	// S3 doesn't fail deleting a non-existing object, so we check it exists first
+	_, err := s.client.HeadObject(
+		ctx,
+		&s3.HeadObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(id),
+		},
+	)
+	if err != nil {
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
+			return fmt.Errorf("%w (%s)", store.ErrObjectNotFound, id)
+		}
+
+		return k6build.NewWrappedError(store.ErrDeletingObject, err)
+	}
+
+	_, err = s.client.DeleteObject(
+		ctx,
+		&s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(id),
+		},
+	)
+	if err != nil {
+		return k6build.NewWrappedError(store.ErrDeletingObject, err)
+	}
+
+	return nil
+}
+
+// List returns the ids of the objects in the store
+func (s *Store) List(ctx context.Context) ([]string, error) {
+	ids := []string{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, k6build.NewWrappedError(store.ErrAccessingObject, err)
+		}
+		for _, obj := range page.Contents {
+			ids = append(ids, aws.ToString(obj.Key))
+		}
+	}
+
+	return ids, nil
+}
+
 func (s *Store) getDownloadURL(ctx context.Context, id string) (string, error) {
 	// create a presigned get request to get the download URL
 	request, err := s3.NewPresignClient(s.client).PresignGetObject(
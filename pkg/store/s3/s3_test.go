@@ -273,3 +273,62 @@ func TestGetObject(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteObject(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("Skipping test: localstack test container is failing in darwin and windows")
+	}
+
+	preload := []object{
+		{
+			id:      "existing-object",
+			content: []byte("content"),
+		},
+	}
+
+	s, err := setupStore(preload)
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	testCases := []struct {
+		title     string
+		id        string
+		expectErr error
+	}{
+		{
+			title:     "delete existing object",
+			id:        "existing-object",
+			expectErr: nil,
+		},
+		{
+			title:     "delete non-existing object",
+			id:        "non-existing-object",
+			expectErr: store.ErrObjectNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			deleter, _ := s.(store.ObjectDeleter)
+			err := deleter.Delete(context.TODO(), tc.id)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			// if expected error, don't validate object
+			if tc.expectErr != nil {
+				return
+			}
+
+			_, err = s.Get(context.TODO(), tc.id)
+			if !errors.Is(err, store.ErrObjectNotFound) {
+				t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+			}
+		})
+	}
+}
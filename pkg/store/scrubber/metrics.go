@@ -0,0 +1,54 @@
+package scrubber
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "k6build"
+
+type metrics struct {
+	scrubbedCounter  prometheus.Counter
+	corruptedCounter prometheus.Counter
+	deletedCounter   prometheus.Counter
+	failedCounter    prometheus.Counter
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		scrubbedCounter: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "store_scrubbed_objects_total",
+			Help:      "The total number of objects verified by the store scrubber",
+		}),
+		corruptedCounter: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "store_corrupted_objects_total",
+			Help:      "The total number of objects whose content doesn't match their checksum",
+		}),
+		deletedCounter: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "store_corrupted_objects_deleted_total",
+			Help:      "The total number of corrupted objects deleted by the store scrubber",
+		}),
+		failedCounter: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "store_scrub_failures_total",
+			Help:      "The total number of objects the store scrubber could not verify",
+		}),
+	}
+}
+
+func (m *metrics) register(registerer prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		m.scrubbedCounter,
+		m.corruptedCounter,
+		m.deletedCounter,
+		m.failedCounter,
+	} {
+		if err := registerer.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
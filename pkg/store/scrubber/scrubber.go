@@ -0,0 +1,244 @@
+// Package scrubber implements a background process that verifies the integrity of the objects
+// in a store.
+//
+// The scrubber periodically re-reads the objects, recalculates their checksums and reports the
+// objects whose content doesn't match their checksum. Optionally, corrupted objects are deleted
+// so they are built again on the next request.
+package scrubber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/downloader"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultInterval is the default interval between scrubs
+const DefaultInterval = 24 * time.Hour
+
+var (
+	ErrInitializingScrubber = errors.New("initializing scrubber") //nolint:revive
+	ErrCorruptedObject      = errors.New("corrupted object")      //nolint:revive
+)
+
+// Config defines the configuration of a Scrubber
+type Config struct {
+	// Store to scrub. Must support listing its objects (see store.ObjectLister)
+	Store store.ObjectStore
+	// Interval between scrubs. Defaults to DefaultInterval
+	Interval time.Duration
+	// DeleteCorrupted deletes the corrupted objects. The store must support deleting
+	// objects (see store.ObjectDeleter)
+	DeleteCorrupted bool
+	// HTTPClient used for downloading the objects. Defaults to http.DefaultClient
+	HTTPClient *http.Client
+	Registerer prometheus.Registerer
+	Log        *slog.Logger
+}
+
+// Result summarizes a scrub of the store
+type Result struct {
+	// Scrubbed is the number of objects verified
+	Scrubbed int
+	// Corrupted are the ids of the objects whose content doesn't match their checksum
+	Corrupted []string
+	// Deleted are the ids of the corrupted objects deleted
+	Deleted []string
+	// Failed is the number of objects that could not be verified
+	Failed int
+}
+
+// Scrubber verifies the integrity of the objects in a store
+type Scrubber struct {
+	store           store.ObjectStore
+	lister          store.ObjectLister
+	deleter         store.ObjectDeleter
+	interval        time.Duration
+	deleteCorrupted bool
+	client          *http.Client
+	metrics         *metrics
+	log             *slog.Logger
+}
+
+// New returns a Scrubber from a Config
+func New(config Config) (*Scrubber, error) {
+	if config.Store == nil {
+		return nil, k6build.NewWrappedError(ErrInitializingScrubber, errors.New("store cannot be nil"))
+	}
+
+	lister, ok := config.Store.(store.ObjectLister)
+	if !ok {
+		return nil, k6build.NewWrappedError(
+			ErrInitializingScrubber,
+			fmt.Errorf("%w: store doesn't support listing objects", store.ErrNotSupported),
+		)
+	}
+
+	deleter, ok := config.Store.(store.ObjectDeleter)
+	if config.DeleteCorrupted && !ok {
+		return nil, k6build.NewWrappedError(
+			ErrInitializingScrubber,
+			fmt.Errorf("%w: store doesn't support deleting objects", store.ErrNotSupported),
+		)
+	}
+
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	metrics := newMetrics()
+	if config.Registerer != nil {
+		err := metrics.register(config.Registerer)
+		if err != nil {
+			return nil, k6build.NewWrappedError(ErrInitializingScrubber, err)
+		}
+	}
+
+	log := config.Log
+	if log == nil {
+		log = slog.New(
+			slog.NewTextHandler(
+				io.Discard,
+				&slog.HandlerOptions{},
+			),
+		)
+	}
+
+	return &Scrubber{
+		store:           config.Store,
+		lister:          lister,
+		deleter:         deleter,
+		interval:        interval,
+		deleteCorrupted: config.DeleteCorrupted,
+		client:          client,
+		metrics:         metrics,
+		log:             log,
+	}, nil
+}
+
+// Run scrubs the store every interval until the context is cancelled
+func (s *Scrubber) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := s.Scrub(ctx)
+			if err != nil {
+				s.log.Error("scrubbing store", "error", err.Error())
+				continue
+			}
+
+			s.log.Info(
+				"store scrubbed",
+				"scrubbed", result.Scrubbed,
+				"corrupted", len(result.Corrupted),
+				"deleted", len(result.Deleted),
+				"failed", result.Failed,
+			)
+		}
+	}
+}
+
+// Scrub verifies the checksum of all the objects in the store.
+// Objects that cannot be verified are logged and skipped. Returns an error only if the objects
+// cannot be listed or the context is cancelled.
+func (s *Scrubber) Scrub(ctx context.Context) (Result, error) {
+	result := Result{}
+
+	ids, err := s.lister.List(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		err = s.verify(ctx, id)
+		switch {
+		case err == nil:
+			result.Scrubbed++
+			s.metrics.scrubbedCounter.Inc()
+		case errors.Is(err, store.ErrObjectNotFound):
+			// the object was deleted after listing it
+			continue
+		case errors.Is(err, ErrCorruptedObject):
+			result.Scrubbed++
+			s.metrics.scrubbedCounter.Inc()
+			result.Corrupted = append(result.Corrupted, id)
+			s.metrics.corruptedCounter.Inc()
+			s.log.Warn("corrupted object", "id", id, "error", err.Error())
+
+			if !s.deleteCorrupted {
+				continue
+			}
+
+			err = s.deleter.Delete(ctx, id)
+			if err != nil && !errors.Is(err, store.ErrObjectNotFound) {
+				s.log.Error("deleting corrupted object", "id", id, "error", err.Error())
+				continue
+			}
+			result.Deleted = append(result.Deleted, id)
+			s.metrics.deletedCounter.Inc()
+		default:
+			result.Failed++
+			s.metrics.failedCounter.Inc()
+			s.log.Error("verifying object", "id", id, "error", err.Error())
+		}
+	}
+
+	return result, nil
+}
+
+// verify downloads the object and checks its content matches its checksum
+func (s *Scrubber) verify(ctx context.Context, id string) error {
+	object, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	algorithm, expected := store.ParseChecksum(object.Checksum)
+	hash, err := store.NewHash(algorithm)
+	if err != nil {
+		return k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	content, err := downloader.Read(ctx, s.client, s.store, object)
+	if err != nil {
+		return err
+	}
+	defer content.Close() //nolint:errcheck
+
+	_, err = io.Copy(hash, content)
+	if err != nil {
+		return k6build.NewWrappedError(store.ErrAccessingObject, err)
+	}
+
+	checksum := fmt.Sprintf("%x", hash.Sum(nil))
+	if !strings.EqualFold(checksum, expected) {
+		return fmt.Errorf("%w: expected checksum %s got %s", ErrCorruptedObject, expected, checksum)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package scrubber
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/grafana/k6build/pkg/store"
+	"github.com/grafana/k6build/pkg/store/file"
+)
+
+func TestScrub(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		title           string
+		corrupt         []string
+		deleteCorrupted bool
+		expectCorrupted []string
+		expectDeleted   []string
+	}{
+		{
+			title: "no corrupted objects",
+		},
+		{
+			title:           "corrupted object",
+			corrupt:         []string{"object2"},
+			expectCorrupted: []string{"object2"},
+		},
+		{
+			title:           "delete corrupted object",
+			corrupt:         []string{"object2"},
+			deleteCorrupted: true,
+			expectCorrupted: []string{"object2"},
+			expectDeleted:   []string{"object2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			objectStore, err := file.NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("test setup %v", err)
+			}
+
+			ids := []string{"object1", "object2", "object3"}
+			for _, id := range ids {
+				_, err = objectStore.Put(context.TODO(), id, bytes.NewBufferString("content of "+id))
+				if err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+			}
+
+			for _, id := range tc.corrupt {
+				err = os.WriteFile(filepath.Join(dir, id, "data"), []byte("corrupted"), 0o600)
+				if err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+			}
+
+			scrubber, err := New(Config{Store: objectStore, DeleteCorrupted: tc.deleteCorrupted})
+			if err != nil {
+				t.Fatalf("creating scrubber %v", err)
+			}
+
+			result, err := scrubber.Scrub(context.TODO())
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if result.Scrubbed != len(ids) {
+				t.Fatalf("expected %d objects scrubbed got %d", len(ids), result.Scrubbed)
+			}
+
+			if !slices.Equal(result.Corrupted, tc.expectCorrupted) {
+				t.Fatalf("expected corrupted %v got %v", tc.expectCorrupted, result.Corrupted)
+			}
+
+			if !slices.Equal(result.Deleted, tc.expectDeleted) {
+				t.Fatalf("expected deleted %v got %v", tc.expectDeleted, result.Deleted)
+			}
+
+			for _, id := range tc.expectDeleted {
+				_, err = objectStore.Get(context.TODO(), id)
+				if !errors.Is(err, store.ErrObjectNotFound) {
+					t.Fatalf("expected %v got %v", store.ErrObjectNotFound, err)
+				}
+			}
+		})
+	}
+}
+
+// storeWithoutList is an ObjectStore that doesn't support listing objects
+type storeWithoutList struct {
+	store.ObjectStore
+}
+
+func TestNewUnsupportedStore(t *testing.T) {
+	t.Parallel()
+
+	objectStore, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("test setup %v", err)
+	}
+
+	_, err = New(Config{Store: storeWithoutList{objectStore}})
+	if !errors.Is(err, store.ErrNotSupported) {
+		t.Fatalf("expected %v got %v", store.ErrNotSupported, err)
+	}
+}
@@ -8,8 +8,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/grafana/k6build"
 	"github.com/grafana/k6build/pkg/store"
@@ -17,12 +22,28 @@ import (
 	"github.com/grafana/k6build/pkg/store/downloader"
 )
 
+const (
+	// ArtifactIDPattern matches the ids of the artifacts generated by the builder (sha1 hex hashes),
+	// optionally under the prefix used by the builder's KeyPrefix option (e.g. k6-linux-amd64-v0.50.0/<id>).
+	// It is the default IDPattern.
+	ArtifactIDPattern = "^(k6-[^/]+/)?[0-9a-f]{40}$"
+	// AnyIDPattern can be used as the IDPattern for accepting any id
+	AnyIDPattern = ".+"
+)
+
+var errReadOnly = fmt.Errorf("%w: store is read-only", store.ErrNotSupported)
+
+// quoteEscaper escapes the characters that are not allowed in a quoted-string
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
 // StoreServer implements an http server that handles object store requests
 type StoreServer struct {
-	baseURL *url.URL
-	store   store.ObjectStore
-	log     *slog.Logger
-	client  *http.Client
+	baseURL   *url.URL
+	store     store.ObjectStore
+	log       *slog.Logger
+	client    *http.Client
+	idPattern *regexp.Regexp
+	readOnly  bool
 }
 
 // StoreServerConfig defines the configuration for the APIServer
@@ -31,6 +52,12 @@ type StoreServerConfig struct {
 	Store      store.ObjectStore
 	Log        *slog.Logger
 	HTTPClient *http.Client
+	// IDPattern is a regular expression object ids must match. Ids referencing a parent or empty
+	// path (e.g. "../id") are always rejected. Defaults to ArtifactIDPattern. Use AnyIDPattern
+	// for accepting any id
+	IDPattern string
+	// ReadOnly rejects requests for storing or deleting objects with 405 Method Not Allowed
+	ReadOnly bool
 }
 
 // NewStoreServer returns a StoreServer backed by a file object store
@@ -61,11 +88,24 @@ func NewStoreServer(config StoreServerConfig) (http.Handler, error) {
 	if client == nil {
 		client = http.DefaultClient
 	}
+
+	idPattern := config.IDPattern
+	if idPattern == "" {
+		idPattern = ArtifactIDPattern
+	}
+
+	idRegexp, err := regexp.Compile(idPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id pattern %w", err)
+	}
+
 	storeSrv := &StoreServer{
-		baseURL: baseURL,
-		store:   config.Store,
-		log:     log,
-		client:  client,
+		baseURL:   baseURL,
+		store:     config.Store,
+		log:       log,
+		client:    client,
+		idPattern: idRegexp,
+		readOnly:  config.ReadOnly,
 	}
 
 	handler := http.NewServeMux()
@@ -73,6 +113,9 @@ func NewStoreServer(config StoreServerConfig) (http.Handler, error) {
 	handler.HandleFunc("POST /store/{id}", storeSrv.Store)
 	handler.HandleFunc("GET /store/{id}", storeSrv.Get)
 	handler.HandleFunc("GET /store/{id}/download", storeSrv.Download)
+	handler.HandleFunc("DELETE /store/{id}", storeSrv.Delete)
+	handler.HandleFunc("POST /store/{id}/pin", storeSrv.Pin)
+	handler.HandleFunc("POST /store/{id}/release", storeSrv.Release)
 
 	return handler, nil
 }
@@ -84,9 +127,9 @@ func (s *StoreServer) Get(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 
 	id := r.PathValue("id")
-	if id == "" {
+	if err := s.validateID(id); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, fmt.Errorf("object id is required"))
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
 		s.log.Error(resp.Error.Error())
 		_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
 		return
@@ -109,9 +152,11 @@ func (s *StoreServer) Get(w http.ResponseWriter, r *http.Request) {
 
 	downloadURL := getDownloadURL(s.baseURL, r)
 	resp.Object = store.Object{
-		ID:       id,
-		Checksum: object.Checksum,
-		URL:      downloadURL,
+		ID:        id,
+		Checksum:  object.Checksum,
+		URL:       downloadURL,
+		CreatedAt: object.CreatedAt,
+		Size:      object.Size,
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -132,10 +177,16 @@ func (s *StoreServer) Store(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	if s.readOnly {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		resp.Error = k6build.NewWrappedError(api.ErrObjectStoreAccess, errReadOnly)
+		return
+	}
+
 	id := r.PathValue("id")
-	if id == "" {
+	if err := s.validateID(id); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, fmt.Errorf("object id is required"))
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
 		return
 	}
 
@@ -148,18 +199,158 @@ func (s *StoreServer) Store(w http.ResponseWriter, r *http.Request) {
 
 	downloadURL := getDownloadURL(s.baseURL, r)
 	resp.Object = store.Object{
-		ID:       id,
-		Checksum: object.Checksum,
-		URL:      downloadURL,
+		ID:        id,
+		Checksum:  object.Checksum,
+		URL:       downloadURL,
+		CreatedAt: object.CreatedAt,
+		Size:      object.Size,
 	}
 
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
 }
 
+// Delete removes the object from the store
+func (s *StoreServer) Delete(w http.ResponseWriter, r *http.Request) {
+	resp := api.StoreResponse{}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	// ensure errors are reported and logged
+	defer func() {
+		if resp.Error != nil {
+			s.log.Error(resp.Error.Error())
+			_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+		}
+	}()
+
+	if s.readOnly {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		resp.Error = k6build.NewWrappedError(api.ErrObjectStoreAccess, errReadOnly)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := s.validateID(id); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		return
+	}
+
+	deleter, ok := s.store.(store.ObjectDeleter)
+	if !ok {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		resp.Error = k6build.NewWrappedError(api.ErrObjectStoreAccess, store.ErrNotSupported)
+		return
+	}
+
+	err := deleter.Delete(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrObjectNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		resp.Error = k6build.NewWrappedError(api.ErrObjectStoreAccess, err)
+		return
+	}
+
+	s.log.Info("object deleted", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Pin adds a reference to the object, preventing it from being evicted from the store
+func (s *StoreServer) Pin(w http.ResponseWriter, r *http.Request) {
+	s.updateReferences(w, r, store.ObjectPinner.Pin)
+}
+
+// Release removes a reference to the object. Objects without references can be evicted
+func (s *StoreServer) Release(w http.ResponseWriter, r *http.Request) {
+	s.updateReferences(w, r, store.ObjectPinner.Release)
+}
+
+// updateReferences updates the references to the object and returns the resulting references
+func (s *StoreServer) updateReferences(
+	w http.ResponseWriter,
+	r *http.Request,
+	update func(store.ObjectPinner, context.Context, string) (int, error),
+) {
+	resp := api.StoreResponse{}
+
+	w.Header().Add("Content-Type", "application/json")
+
+	// ensure errors are reported and logged
+	defer func() {
+		if resp.Error != nil {
+			s.log.Error(resp.Error.Error())
+		}
+		_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+	}()
+
+	if s.readOnly {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		resp.Error = k6build.NewWrappedError(api.ErrObjectStoreAccess, errReadOnly)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := s.validateID(id); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		resp.Error = k6build.NewWrappedError(api.ErrInvalidRequest, err)
+		return
+	}
+
+	pinner, ok := s.store.(store.ObjectPinner)
+	if !ok {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		resp.Error = k6build.NewWrappedError(api.ErrObjectStoreAccess, store.ErrNotSupported)
+		return
+	}
+
+	references, err := update(pinner, r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrObjectNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, store.ErrObjectNotPinned):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		resp.Error = k6build.NewWrappedError(api.ErrObjectStoreAccess, err)
+		return
+	}
+
+	s.log.Debug("object references updated", "id", id, "references", references)
+	resp.References = references
+	w.WriteHeader(http.StatusOK)
+}
+
+// validateID checks the object id is not empty, doesn't reference a parent or empty path,
+// and matches the id pattern, if any
+func (s *StoreServer) validateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("object id is required")
+	}
+
+	for _, segment := range strings.Split(id, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid object id %q", id)
+		}
+	}
+
+	if !s.idPattern.MatchString(id) {
+		return fmt.Errorf("invalid object id %q", id)
+	}
+
+	return nil
+}
+
+// getDownloadURL returns the download URL of the object in the request. The object's id is escaped,
+// as it may contain '/' (e.g. prefix/id)
 func getDownloadURL(baseURL *url.URL, r *http.Request) string {
 	if baseURL != nil {
-		return baseURL.JoinPath("store", r.PathValue("id"), "download").String()
+		return baseURL.JoinPath("store", url.PathEscape(r.PathValue("id")), "download").String()
 	}
 
 	scheme := "http"
@@ -167,19 +358,22 @@ func getDownloadURL(baseURL *url.URL, r *http.Request) string {
 		scheme = "https"
 	}
 
-	url := url.URL{
-		Scheme: scheme,
-		Host:   r.Host,
-		Path:   r.URL.JoinPath("download").String(),
-	}
+	downloadURL := r.URL.JoinPath("download")
+	downloadURL.Scheme = scheme
+	downloadURL.Host = r.Host
+	downloadURL.RawQuery = ""
 
-	return url.String()
+	return downloadURL.String()
 }
 
-// Download returns an object's content given its id
+// Download returns an object's content given its id.
+// Range requests (including conditional ranges using If-Range) are supported if the object's
+// content is seekable (e.g. objects stored in the local file system).
+// The content is returned as an attachment named after the object (k6-<id>).
 func (s *StoreServer) Download(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	if id == "" {
+	if err := s.validateID(id); err != nil {
+		s.log.Error(err.Error())
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -194,7 +388,7 @@ func (s *StoreServer) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objectContent, err := downloader.Download(context.Background(), s.client, object) //nolint:contextcheck
+	objectContent, err := downloader.Read(context.Background(), s.client, s.store, object) //nolint:contextcheck
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -203,8 +397,35 @@ func (s *StoreServer) Download(w http.ResponseWriter, r *http.Request) {
 		_ = objectContent.Close()
 	}()
 
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf("%q", object.ID))
+	w.Header().Set("Content-Disposition", contentDisposition(object.ID))
+
+	// serve supporting range requests if possible. A range request with an If-Range header
+	// is served partially only if it matches the object's ETag, otherwise the full content is served
+	if seeker, ok := objectContent.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", object.CreatedAt, seeker)
+		return
+	}
+
+	// the size is unknown for objects of stores that don't report it
+	if object.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Header().Add("Content-Type", "application/octet-stream")
-	w.Header().Add("ETag", object.ID)
 	_, _ = io.Copy(w, objectContent)
 }
+
+// contentDisposition returns the Content-Disposition header for downloading an object as an attachment.
+// The file name is built from the object's id without any prefix (e.g. "k6-<id>") and is sent as a
+// quoted-string, as defined in RFC 6266. Names with non-ASCII characters are encoded as defined in RFC 5987.
+func contentDisposition(id string) string {
+	filename := "k6-" + path.Base(id)
+	for _, c := range filename {
+		if c < ' ' || c > '~' {
+			return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+		}
+	}
+
+	return fmt.Sprintf("attachment; filename=\"%s\"", quoteEscaper.Replace(filename))
+}
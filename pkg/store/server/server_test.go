@@ -5,10 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"runtime"
 	"testing"
 
+	"github.com/grafana/k6build/pkg/store"
 	"github.com/grafana/k6build/pkg/store/api"
 	"github.com/grafana/k6build/pkg/store/file"
 )
@@ -32,7 +36,8 @@ func TestStoreServerGet(t *testing.T) {
 	}
 
 	config := StoreServerConfig{
-		Store: store,
+		Store:     store,
+		IDPattern: AnyIDPattern,
 	}
 	storeSrv, err := NewStoreServer(config)
 	if err != nil {
@@ -93,6 +98,14 @@ func TestStoreServerGet(t *testing.T) {
 			if storeResponse.Object.ID != tc.id {
 				t.Fatalf("expected object id %s got %s", tc.id, storeResponse.Object.ID)
 			}
+
+			if storeResponse.Object.Size != int64(len(objects[tc.id])) {
+				t.Fatalf("expected size %d got %d", len(objects[tc.id]), storeResponse.Object.Size)
+			}
+
+			if storeResponse.Object.CreatedAt.IsZero() {
+				t.Fatalf("expected creation time")
+			}
 		})
 	}
 }
@@ -106,7 +119,8 @@ func TestStoreServerPut(t *testing.T) {
 	}
 
 	config := StoreServerConfig{
-		Store: store,
+		Store:     store,
+		IDPattern: AnyIDPattern,
 	}
 	storeSrv, err := NewStoreServer(config)
 	if err != nil {
@@ -180,7 +194,9 @@ func TestStoreServerDownload(t *testing.T) {
 	}
 
 	objects := map[string][]byte{
-		"object1": []byte("content object 1"),
+		"object1":         []byte("content object 1"),
+		"prefix/object2":  []byte("content object 2"),
+		`prefix/object"3`: []byte("content object 3"),
 	}
 
 	for id, content := range objects {
@@ -191,7 +207,8 @@ func TestStoreServerDownload(t *testing.T) {
 	}
 
 	config := StoreServerConfig{
-		Store: store,
+		Store:     store,
+		IDPattern: AnyIDPattern,
 	}
 	storeSrv, err := NewStoreServer(config)
 	if err != nil {
@@ -201,22 +218,63 @@ func TestStoreServerDownload(t *testing.T) {
 	srv := httptest.NewServer(storeSrv)
 
 	testCases := []struct {
-		title   string
-		id      string
-		status  int
-		content []byte
+		title    string
+		id       string
+		headers  map[string]string
+		status   int
+		content  []byte
+		filename string
 	}{
 		{
-			title:   "return object",
-			id:      "object1",
-			status:  http.StatusOK,
-			content: objects["object1"],
+			title:    "return object",
+			id:       "object1",
+			status:   http.StatusOK,
+			content:  objects["object1"],
+			filename: `"k6-object1"`,
+		},
+		{
+			title:    "return object with a prefixed id",
+			id:       "prefix/object2",
+			status:   http.StatusOK,
+			content:  objects["prefix/object2"],
+			filename: `"k6-object2"`,
+		},
+		{
+			title:    "escape quotes in file name",
+			id:       `prefix/object"3`,
+			status:   http.StatusOK,
+			content:  objects[`prefix/object"3`],
+			filename: `"k6-object\"3"`,
 		},
 		{
 			title:  "object not found",
 			id:     "not_found",
 			status: http.StatusNotFound,
 		},
+		{
+			title:    "return range",
+			id:       "object1",
+			headers:  map[string]string{"Range": "bytes=8-"},
+			status:   http.StatusPartialContent,
+			content:  objects["object1"][8:],
+			filename: `"k6-object1"`,
+		},
+		{
+			title:    "return range if etag matches",
+			id:       "object1",
+			headers:  map[string]string{"Range": "bytes=8-", "If-Range": `"object1"`},
+			status:   http.StatusPartialContent,
+			content:  objects["object1"][8:],
+			filename: `"k6-object1"`,
+		},
+		{
+			title:    "return full object if etag doesn't match",
+			id:       "object1",
+			headers:  map[string]string{"Range": "bytes=8-", "If-Range": `"other"`},
+			status:   http.StatusOK,
+			content:  objects["object1"],
+			filename: `"k6-object1"`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -224,8 +282,16 @@ func TestStoreServerDownload(t *testing.T) {
 		t.Run(tc.title, func(t *testing.T) {
 			t.Parallel()
 
-			url := fmt.Sprintf("%s/store/%s/download", srv.URL, tc.id)
-			resp, err := http.Get(url)
+			reqURL := fmt.Sprintf("%s/store/%s/download", srv.URL, url.PathEscape(tc.id))
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, reqURL, nil)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+			for h, v := range tc.headers {
+				req.Header.Set(h, v)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
 				t.Fatalf("accessing server %v", err)
 			}
@@ -237,10 +303,19 @@ func TestStoreServerDownload(t *testing.T) {
 				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
 			}
 
-			if tc.status != http.StatusOK {
+			if tc.content == nil {
 				return
 			}
 
+			disposition := "attachment; filename=" + tc.filename
+			if resp.Header.Get("Content-Disposition") != disposition {
+				t.Fatalf("expected content disposition %q got %q", disposition, resp.Header.Get("Content-Disposition"))
+			}
+
+			if resp.ContentLength != int64(len(tc.content)) {
+				t.Fatalf("expected content length %d got %d", len(tc.content), resp.ContentLength)
+			}
+
 			content := bytes.Buffer{}
 			_, err = content.ReadFrom(resp.Body)
 			if err != nil {
@@ -248,8 +323,473 @@ func TestStoreServerDownload(t *testing.T) {
 			}
 
 			if !bytes.Equal(content.Bytes(), tc.content) {
-				t.Fatalf("expected got")
+				t.Fatalf("expected %q got %q", tc.content, content.Bytes())
+			}
+		})
+	}
+}
+
+// remoteStore returns objects whose content is downloaded from a URL, which is not seekable
+type remoteStore struct {
+	store.ObjectStore
+	url  string
+	size int64
+}
+
+func (s remoteStore) Get(_ context.Context, id string) (store.Object, error) {
+	return store.Object{ID: id, URL: s.url, Size: s.size}, nil
+}
+
+func TestStoreServerDownloadRemoteContent(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("content object 1")
+	contentSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(contentSrv.Close)
+
+	storeSrv, err := NewStoreServer(StoreServerConfig{
+		Store:     remoteStore{url: contentSrv.URL, size: int64(len(content))},
+		IDPattern: AnyIDPattern,
+	})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+
+	srv := httptest.NewServer(storeSrv)
+	t.Cleanup(srv.Close)
+
+	url := fmt.Sprintf("%s/store/object1/download", srv.URL)
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("creating request %v", err)
+	}
+	// ranges are not supported for content that is not seekable
+	req.Header.Set("Range", "bytes=8-")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("accessing server %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %s got %s", http.StatusText(http.StatusOK), resp.Status)
+	}
+
+	if resp.ContentLength != int64(len(content)) {
+		t.Fatalf("expected content length %d got %d", len(content), resp.ContentLength)
+	}
+
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != `attachment; filename="k6-object1"` {
+		t.Fatalf("expected content disposition got %q", disposition)
+	}
+
+	received, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading content %v", err)
+	}
+
+	if !bytes.Equal(received, content) {
+		t.Fatalf("expected %q got %q", content, received)
+	}
+}
+
+// TestStoreServerPutLargeObject checks the content of an uploaded object is streamed to the store
+// and not buffered in memory. It is not run in parallel with other tests because it measures the
+// memory allocated by the process.
+//
+//nolint:paralleltest
+func TestStoreServerPutLargeObject(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large object test in short mode")
+	}
+
+	const (
+		objectSize  = 256 << 20 // 256MB
+		memoryLimit = 32 << 20  // 32MB
+	)
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	storeSrv, err := NewStoreServer(StoreServerConfig{Store: store, IDPattern: AnyIDPattern})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+
+	srv := httptest.NewServer(storeSrv)
+	defer srv.Close()
+
+	runtime.GC()
+	before := runtime.MemStats{}
+	runtime.ReadMemStats(&before)
+
+	content := io.LimitReader(zeroReader{}, objectSize)
+	resp, err := http.Post(fmt.Sprintf("%s/store/large", srv.URL), "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("accessing server %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %s got %s", http.StatusText(http.StatusOK), resp.Status)
+	}
+
+	after := runtime.MemStats{}
+	runtime.ReadMemStats(&after)
+
+	allocated := after.TotalAlloc - before.TotalAlloc
+	if allocated > memoryLimit {
+		t.Fatalf("expected less than %d bytes allocated got %d", memoryLimit, allocated)
+	}
+}
+
+// zeroReader is an infinite source of zeros
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestStoreServerIDValidation(t *testing.T) {
+	t.Parallel()
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	anyID, err := NewStoreServer(StoreServerConfig{Store: store, IDPattern: AnyIDPattern})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+
+	anyIDSrv := httptest.NewServer(anyID)
+	t.Cleanup(anyIDSrv.Close)
+
+	artifactID, err := NewStoreServer(StoreServerConfig{Store: store})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+
+	artifactIDSrv := httptest.NewServer(artifactID)
+	t.Cleanup(artifactIDSrv.Close)
+
+	testCases := []struct {
+		title  string
+		srv    *httptest.Server
+		id     string
+		status int
+	}{
+		{
+			title:  "any id",
+			srv:    anyIDSrv,
+			id:     "arbitrary-key",
+			status: http.StatusOK,
+		},
+		{
+			title:  "parent path",
+			srv:    anyIDSrv,
+			id:     url.PathEscape("../key"),
+			status: http.StatusBadRequest,
+		},
+		{
+			title:  "valid artifact id",
+			srv:    artifactIDSrv,
+			id:     "5a241ba6ff643075caadbd06d5a326e5e74f6f10",
+			status: http.StatusOK,
+		},
+		{
+			title:  "prefixed artifact id",
+			srv:    artifactIDSrv,
+			id:     url.PathEscape("k6-linux-amd64-v0.50.0/5a241ba6ff643075caadbd06d5a326e5e74f6f10"),
+			status: http.StatusOK,
+		},
+		{
+			title:  "arbitrary key",
+			srv:    artifactIDSrv,
+			id:     "another-key",
+			status: http.StatusBadRequest,
+		},
+		{
+			title:  "hash with uppercase",
+			srv:    artifactIDSrv,
+			id:     "5A241BA6FF643075CAADBD06D5A326E5E74F6F10",
+			status: http.StatusBadRequest,
+		},
+		{
+			title:  "hash too long",
+			srv:    artifactIDSrv,
+			id:     "5a241ba6ff643075caadbd06d5a326e5e74f6f1000",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			url := fmt.Sprintf("%s/store/%s", tc.srv.URL, tc.id)
+			resp, err := http.Post(url, "application/octet-stream", bytes.NewBufferString("content"))
+			if err != nil {
+				t.Fatalf("accessing server %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
 			}
 		})
 	}
 }
+
+func TestStoreServerDelete(t *testing.T) {
+	t.Parallel()
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	if _, err = store.Put(context.TODO(), "object1", bytes.NewBufferString("content object 1")); err != nil {
+		t.Fatalf("test setup: %v", err)
+	}
+
+	storeSrv, err := NewStoreServer(StoreServerConfig{Store: store, IDPattern: AnyIDPattern})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+
+	srv := httptest.NewServer(storeSrv)
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		title  string
+		id     string
+		status int
+	}{
+		{
+			title:  "delete object",
+			id:     "object1",
+			status: http.StatusNoContent,
+		},
+		{
+			title:  "object not found",
+			id:     "not_found",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			url := fmt.Sprintf("%s/store/%s", srv.URL, tc.id)
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodDelete, url, nil)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("accessing server %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+		})
+	}
+}
+
+func TestStoreServerReadOnly(t *testing.T) {
+	t.Parallel()
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	if _, err = store.Put(context.TODO(), "object1", bytes.NewBufferString("content object 1")); err != nil {
+		t.Fatalf("test setup: %v", err)
+	}
+
+	storeSrv, err := NewStoreServer(StoreServerConfig{Store: store, IDPattern: AnyIDPattern, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+
+	srv := httptest.NewServer(storeSrv)
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		title  string
+		method string
+		path   string
+		status int
+	}{
+		{
+			title:  "store object",
+			method: http.MethodPost,
+			path:   "/store/object2",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			title:  "delete object",
+			method: http.MethodDelete,
+			path:   "/store/object1",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			title:  "pin object",
+			method: http.MethodPost,
+			path:   "/store/object1/pin",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			title:  "get object",
+			method: http.MethodGet,
+			path:   "/store/object1",
+			status: http.StatusOK,
+		},
+		{
+			title:  "download object",
+			method: http.MethodGet,
+			path:   "/store/object1/download",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequestWithContext(
+				context.TODO(),
+				tc.method,
+				srv.URL+tc.path,
+				bytes.NewBufferString("content"),
+			)
+			if err != nil {
+				t.Fatalf("creating request %v", err)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("accessing server %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %s got %s", http.StatusText(tc.status), resp.Status)
+			}
+		})
+	}
+}
+
+func TestStoreServerPin(t *testing.T) {
+	t.Parallel()
+
+	store, err := file.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating test file store %v", err)
+	}
+
+	if _, err = store.Put(context.TODO(), "object1", bytes.NewBufferString("content object 1")); err != nil {
+		t.Fatalf("test setup: %v", err)
+	}
+
+	storeSrv, err := NewStoreServer(StoreServerConfig{Store: store, IDPattern: AnyIDPattern})
+	if err != nil {
+		t.Fatalf("creating store server %v", err)
+	}
+
+	srv := httptest.NewServer(storeSrv)
+	t.Cleanup(srv.Close)
+
+	// the operations are applied in order to the same object
+	testCases := []struct {
+		title            string
+		path             string
+		status           int
+		expectReferences int
+	}{
+		{
+			title:            "pin object",
+			path:             "/store/object1/pin",
+			status:           http.StatusOK,
+			expectReferences: 1,
+		},
+		{
+			title:            "pin object again",
+			path:             "/store/object1/pin",
+			status:           http.StatusOK,
+			expectReferences: 2,
+		},
+		{
+			title:            "release object",
+			path:             "/store/object1/release",
+			status:           http.StatusOK,
+			expectReferences: 1,
+		},
+		{
+			title:            "release last reference",
+			path:             "/store/object1/release",
+			status:           http.StatusOK,
+			expectReferences: 0,
+		},
+		{
+			title:  "release object not pinned",
+			path:   "/store/object1/release",
+			status: http.StatusConflict,
+		},
+		{
+			title:  "pin object not found",
+			path:   "/store/not_found/pin",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequestWithContext(context.TODO(), http.MethodPost, srv.URL+tc.path, nil)
+		if err != nil {
+			t.Fatalf("%s: creating request %v", tc.title, err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: accessing server %v", tc.title, err)
+		}
+
+		storeResp := api.StoreResponse{}
+		err = json.NewDecoder(resp.Body).Decode(&storeResp)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: decoding response %v", tc.title, err)
+		}
+
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s: expected %s got %s", tc.title, http.StatusText(tc.status), resp.Status)
+		}
+
+		if storeResp.References != tc.expectReferences {
+			t.Fatalf("%s: expected %d references got %d", tc.title, tc.expectReferences, storeResp.References)
+		}
+	}
+}
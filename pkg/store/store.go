@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 )
 
 var (
@@ -16,16 +17,24 @@ var (
 	ErrInvalidURL        = errors.New("invalid object URL") //nolint:revive
 	ErrObjectNotFound    = errors.New("object not found")   //nolint:revive
 	ErrNotSupported      = errors.New("not supported")      //nolint:revive
-
+	ErrDeletingObject    = errors.New("deleting object")    //nolint:revive
+	ErrObjectNotPinned   = errors.New("object not pinned")  //nolint:revive
 )
 
 // Object represents an object stored in the store
-// TODO: add metadata (e.g creation data, size)
 type Object struct {
-	ID       string
+	ID string
+	// Checksum of the object's content. See FormatChecksum
 	Checksum string
 	// an url for downloading the object's content
 	URL string
+	// time the object was created. Zero if unknown
+	CreatedAt time.Time
+	// size of the object's content in bytes
+	Size int64
+	// Fallback indicates the object was not found in the store and was read from a fallback
+	// store instead (see the fallback package)
+	Fallback bool
 }
 
 func (o Object) String() string {
@@ -33,6 +42,7 @@ func (o Object) String() string {
 	buffer.WriteString(fmt.Sprintf("id: %s", o.ID))
 	buffer.WriteString(fmt.Sprintf(" checksum: %s", o.Checksum))
 	buffer.WriteString(fmt.Sprintf("url: %s", o.URL))
+	buffer.WriteString(fmt.Sprintf(" size: %d", o.Size))
 
 	return buffer.String()
 }
@@ -44,3 +54,37 @@ type ObjectStore interface {
 	// Put stores the object and returns the metadata
 	Put(ctx context.Context, id string, content io.Reader) (Object, error)
 }
+
+// ObjectDeleter is implemented by the object stores that support deleting objects
+type ObjectDeleter interface {
+	// Delete removes an object from the store. Returns ErrObjectNotFound if the object doesn't exist
+	Delete(ctx context.Context, id string) error
+}
+
+// ObjectPinner is implemented by the object stores that support pinning objects. Objects keep a
+// count of references, incremented by each Pin and decremented by each Release. Objects with
+// references are not removed by the store's retention policy (e.g. evicting the least recently
+// used objects), but they can be deleted explicitly.
+type ObjectPinner interface {
+	// Pin adds a reference to an object and returns its references.
+	// Returns ErrObjectNotFound if the object doesn't exist
+	Pin(ctx context.Context, id string) (int, error)
+	// Release removes a reference to an object and returns its remaining references.
+	// Returns ErrObjectNotFound if the object doesn't exist and ErrObjectNotPinned if it has no references
+	Release(ctx context.Context, id string) (int, error)
+}
+
+// ObjectLister is implemented by the object stores that support listing their objects
+type ObjectLister interface {
+	// List returns the ids of the objects in the store
+	List(ctx context.Context) ([]string, error)
+}
+
+// ObjectReader is implemented by the object stores whose objects' URLs cannot be downloaded
+// directly (e.g. references to artifacts in a registry). See downloader.Read.
+type ObjectReader interface {
+	// Read returns the content of an object retrieved from the store. Returns ErrObjectNotFound if
+	// the object doesn't exist and ErrNotSupported if the store cannot read the object (e.g. it was
+	// retrieved from another store)
+	Read(ctx context.Context, object Object) (io.ReadCloser, error)
+}
@@ -94,7 +94,11 @@ func NewTestEnv(cfg TestEnvConfig) (*TestEnv, error) {
 	srvConfig := server.APIServerConfig{
 		BuildService: builder,
 	}
-	buildSrv := httptest.NewServer(server.NewAPIServer(srvConfig))
+	buildAPI, err := server.NewAPIServer(srvConfig)
+	if err != nil {
+		return nil, fmt.Errorf("server setup %w", err)
+	}
+	buildSrv := httptest.NewServer(buildAPI)
 
 	return &TestEnv{
 		buildSrv: buildSrv,
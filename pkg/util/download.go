@@ -2,24 +2,150 @@ package util
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/signature"
+	"github.com/grafana/k6build/pkg/store"
 )
 
 var (
-	ErrDownloadFailed = fmt.Errorf("downloading file failed")    //nolint:revive
-	ErrWritingFile    = fmt.Errorf("opening output file failed") //nolint:revive
+	ErrChecksumMismatch   = fmt.Errorf("checksum mismatch")          //nolint:revive
+	ErrDownloadFailed     = fmt.Errorf("downloading file failed")    //nolint:revive
+	ErrWritingFile        = fmt.Errorf("opening output file failed") //nolint:revive
+	ErrTooManyRedirects   = fmt.Errorf("too many redirects")         //nolint:revive
+	ErrRedirectNotAllowed = fmt.Errorf("redirect not allowed")       //nolint:revive
 )
 
-// Download downloads a file from a URL and saves it to the output file.
+// DownloadOpts defines the options for downloading a file
+type DownloadOpts struct {
+	// UserAgent sent in the request. Defaults to k6build.UserAgent
+	UserAgent string
+	// Checksum expected for the downloaded file (see store.FormatChecksum).
+	// If empty, the checksum is not verified
+	Checksum string
+	// ChecksumRetries is the number of times the download is retried if the checksum
+	// does not match, as it is likely caused by a corrupted or truncated transfer.
+	ChecksumRetries int
+	// FileMode is the permissions of the output file if it is created, before applying the umask.
+	// The permissions of an existing file are not changed. Defaults to DefaultFileMode
+	FileMode os.FileMode
+	// MaxRedirects is the maximum number of redirects followed (e.g. from a proxy to the
+	// object store). If negative, redirects are not followed. Defaults to DefaultMaxRedirects
+	MaxRedirects int
+	// SameHostRedirects only follows redirects to the host of the download URL.
+	// Redirects from https to http are never followed.
+	SameHostRedirects bool
+	// PublicKey used for verifying the Signature of the artifact with the given ArtifactID
+	// and Checksum (see the signature package) before downloading it. As the Checksum is
+	// also verified, this ensures the downloaded binary is the artifact signed by the build service.
+	// If not specified, the signature is not verified
+	PublicKey  ed25519.PublicKey
+	ArtifactID string
+	Signature  string
+}
+
+// DefaultMaxRedirects is the default maximum number of redirects followed by a download
+const DefaultMaxRedirects = 5
+
+// checkRedirect implements the redirect policy of the download options (see http.Client.CheckRedirect)
+func (o DownloadOpts) checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects := o.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, len(via)-1)
+	}
+
+	prev := via[len(via)-1]
+	if prev.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: from %s to %s", ErrRedirectNotAllowed, prev.URL.Scheme, req.URL.Scheme)
+	}
+
+	if o.SameHostRedirects && req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%w: to host %s", ErrRedirectNotAllowed, req.URL.Host)
+	}
+
+	return nil
+}
+
+// DefaultFileMode is the default permissions of the downloaded files, which are
+// expected to be executable binaries
+const DefaultFileMode os.FileMode = 0o755
+
+// Download downloads a file from a URL and saves it to the output file using the default options.
 func Download(ctx context.Context, url string, output string) error {
+	return DownloadWithOpts(ctx, url, output, DownloadOpts{})
+}
+
+// DownloadWithOpts downloads a file from a URL and saves it to the output file.
+// If the output file exists, it is truncated.
+// If a checksum is specified and the downloaded content doesn't match it, the download
+// is retried up to opts.ChecksumRetries times before failing with ErrChecksumMismatch.
+// If a public key is specified, the file is not downloaded unless the signature is valid.
+// Up to DefaultMaxRedirects redirects are followed unless other policy is set in the options.
+func DownloadWithOpts(ctx context.Context, url string, output string, opts DownloadOpts) error {
+	if opts.PublicKey != nil {
+		if opts.Checksum == "" {
+			return fmt.Errorf("%w: checksum is required for verifying the signature", ErrDownloadFailed)
+		}
+		if err := signature.Verify(opts.PublicKey, opts.ArtifactID, opts.Checksum, opts.Signature); err != nil {
+			return fmt.Errorf("%w %w", ErrDownloadFailed, err)
+		}
+	}
+
+	fileMode := opts.FileMode
+	if fileMode == 0 {
+		fileMode = DefaultFileMode
+	}
+
+	outFile, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("%w %w", ErrWritingFile, err)
+	}
+	defer func() {
+		_ = outFile.Close()
+	}()
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			// restart from an empty file
+			if _, err = outFile.Seek(0, io.SeekStart); err == nil {
+				err = outFile.Truncate(0)
+			}
+			if err != nil {
+				return fmt.Errorf("%w %w", ErrWritingFile, err)
+			}
+		}
+
+		err = download(ctx, url, outFile, opts)
+		if !errors.Is(err, ErrChecksumMismatch) || attempt >= opts.ChecksumRetries {
+			return err
+		}
+	}
+}
+
+func download(ctx context.Context, url string, outFile io.Writer, opts DownloadOpts) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return fmt.Errorf("%w %w", ErrDownloadFailed, err)
 	}
-	resp, err := http.DefaultClient.Do(req)
+
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = k6build.UserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	client := &http.Client{CheckRedirect: opts.checkRedirect}
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("%w %w", ErrDownloadFailed, err)
 	}
@@ -31,18 +157,29 @@ func Download(ctx context.Context, url string, output string) error {
 		_ = resp.Body.Close()
 	}()
 
-	outFile, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE, 0o755) //nolint:gosec
+	if opts.Checksum == "" {
+		_, err = io.Copy(outFile, resp.Body)
+		if err != nil {
+			return fmt.Errorf("%w %w", ErrWritingFile, err)
+		}
+		return nil
+	}
+
+	algorithm, expected := store.ParseChecksum(opts.Checksum)
+	hash, err := store.NewHash(algorithm)
 	if err != nil {
-		return fmt.Errorf("%w %w", ErrWritingFile, err)
+		return fmt.Errorf("%w %w", ErrDownloadFailed, err)
 	}
-	defer func() {
-		_ = outFile.Close()
-	}()
 
-	_, err = io.Copy(outFile, resp.Body)
+	_, err = io.Copy(io.MultiWriter(outFile, hash), resp.Body)
 	if err != nil {
 		return fmt.Errorf("%w %w", ErrWritingFile, err)
 	}
 
+	checksum := fmt.Sprintf("%x", hash.Sum(nil))
+	if !strings.EqualFold(checksum, expected) {
+		return fmt.Errorf("%w: expected %s got %s", ErrChecksumMismatch, expected, checksum)
+	}
+
 	return nil
 }
@@ -2,12 +2,22 @@ package util
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"testing/fstest"
+
+	"github.com/grafana/k6build"
+	"github.com/grafana/k6build/pkg/signature"
 )
 
 func TestDownload(t *testing.T) {
@@ -56,3 +66,376 @@ func TestDownload(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte("hello, world\n"))
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		title  string
+		opts   DownloadOpts
+		expect string
+	}{
+		{
+			title:  "default user agent",
+			opts:   DownloadOpts{},
+			expect: k6build.UserAgent,
+		},
+		{
+			title:  "custom user agent",
+			opts:   DownloadOpts{UserAgent: "custom-agent/v1.0.0"},
+			expect: "custom-agent/v1.0.0",
+		},
+	}
+
+	for _, tc := range testCases { //nolint:paralleltest // test cases share the server
+		t.Run(tc.title, func(t *testing.T) {
+			err := DownloadWithOpts(context.TODO(), srv.URL, filepath.Join(t.TempDir(), "file"), tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			if userAgent != tc.expect {
+				t.Fatalf("expected user agent %q got %q", tc.expect, userAgent)
+			}
+		})
+	}
+}
+
+func TestDownloadChecksumRetries(t *testing.T) {
+	t.Parallel()
+
+	const content = "hello, world\n"
+	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+
+	testCases := []struct {
+		title     string
+		corrupted int
+		opts      DownloadOpts
+		expectErr error
+	}{
+		{
+			title:     "valid checksum",
+			corrupted: 0,
+			opts:      DownloadOpts{Checksum: checksum},
+		},
+		{
+			title:     "valid checksum with algorithm",
+			corrupted: 0,
+			opts:      DownloadOpts{Checksum: "sha256:" + checksum},
+		},
+		{
+			title:     "corrupted without retries",
+			corrupted: 1,
+			opts:      DownloadOpts{Checksum: checksum},
+			expectErr: ErrChecksumMismatch,
+		},
+		{
+			title:     "corrupted once with retries",
+			corrupted: 1,
+			opts:      DownloadOpts{Checksum: checksum, ChecksumRetries: 2},
+		},
+		{
+			title:     "corrupted more than retries",
+			corrupted: 3,
+			opts:      DownloadOpts{Checksum: checksum, ChecksumRetries: 2},
+			expectErr: ErrChecksumMismatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			// flaky server that corrupts the first responses
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				requests++
+				if requests <= tc.corrupted {
+					_, _ = w.Write([]byte("corrupted " + content))
+					return
+				}
+				_, _ = w.Write([]byte(content))
+			}))
+			t.Cleanup(srv.Close)
+
+			output := filepath.Join(t.TempDir(), "file")
+			err := DownloadWithOpts(context.TODO(), srv.URL, output, tc.opts)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v, got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			downloaded, err := os.ReadFile(output) //nolint:gosec
+			if err != nil {
+				t.Fatalf("reading output %v", err)
+			}
+
+			if string(downloaded) != content {
+				t.Fatalf("expected %q got %q", content, string(downloaded))
+			}
+		})
+	}
+}
+
+func TestDownloadOutputFile(t *testing.T) {
+	t.Parallel()
+
+	const content = "hello, world\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		title    string
+		existing string
+		opts     DownloadOpts
+		mode     os.FileMode
+	}{
+		{
+			title: "default file mode",
+			opts:  DownloadOpts{},
+			mode:  DefaultFileMode,
+		},
+		{
+			title: "custom file mode",
+			opts:  DownloadOpts{FileMode: 0o600},
+			mode:  0o600,
+		},
+		{
+			title:    "existing larger file",
+			existing: "a previous content larger than the downloaded one\n",
+			opts:     DownloadOpts{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			output := filepath.Join(t.TempDir(), "file")
+			if tc.existing != "" {
+				if err := os.WriteFile(output, []byte(tc.existing), 0o600); err != nil {
+					t.Fatalf("test setup %v", err)
+				}
+			}
+
+			err := DownloadWithOpts(context.TODO(), srv.URL, output, tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+
+			downloaded, err := os.ReadFile(output) //nolint:gosec
+			if err != nil {
+				t.Fatalf("reading output %v", err)
+			}
+
+			if string(downloaded) != content {
+				t.Fatalf("expected %q got %q", content, string(downloaded))
+			}
+
+			if tc.mode == 0 {
+				return
+			}
+
+			info, err := os.Stat(output)
+			if err != nil {
+				t.Fatalf("reading output %v", err)
+			}
+
+			// the umask can only remove permissions
+			if info.Mode().Perm()&^tc.mode != 0 {
+				t.Fatalf("expected mode within %v got %v", tc.mode, info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestDownloadRedirects(t *testing.T) {
+	t.Parallel()
+
+	const content = "hello, world\n"
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(other.Close)
+
+	// /redirect/<n> redirects n times before returning the content. /other redirects to another host
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect/{n}", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.PathValue("n"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if n == 0 {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL, http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		title     string
+		path      string
+		opts      DownloadOpts
+		expectErr error
+	}{
+		{
+			title: "default max redirects",
+			path:  fmt.Sprintf("/redirect/%d", DefaultMaxRedirects),
+		},
+		{
+			title:     "too many redirects",
+			path:      fmt.Sprintf("/redirect/%d", DefaultMaxRedirects+1),
+			expectErr: ErrTooManyRedirects,
+		},
+		{
+			title:     "custom max redirects",
+			path:      "/redirect/2",
+			opts:      DownloadOpts{MaxRedirects: 1},
+			expectErr: ErrTooManyRedirects,
+		},
+		{
+			title:     "redirects disabled",
+			path:      "/redirect/1",
+			opts:      DownloadOpts{MaxRedirects: -1},
+			expectErr: ErrTooManyRedirects,
+		},
+		{
+			title: "redirect to other host",
+			path:  "/other",
+		},
+		{
+			title:     "redirect to other host not allowed",
+			path:      "/other",
+			opts:      DownloadOpts{SameHostRedirects: true},
+			expectErr: ErrRedirectNotAllowed,
+		},
+		{
+			title: "redirect to same host",
+			path:  "/redirect/1",
+			opts:  DownloadOpts{SameHostRedirects: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			output := filepath.Join(t.TempDir(), "file")
+			err := DownloadWithOpts(context.TODO(), srv.URL+tc.path, output, tc.opts)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if tc.expectErr != nil {
+				return
+			}
+
+			downloaded, err := os.ReadFile(output) //nolint:gosec
+			if err != nil {
+				t.Fatalf("reading output %v", err)
+			}
+
+			if string(downloaded) != content {
+				t.Fatalf("expected %q got %q", content, string(downloaded))
+			}
+		})
+	}
+}
+
+func TestDownloadSignature(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("hello, world\n")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key %v", err)
+	}
+
+	testCases := []struct {
+		title          string
+		checksum       string
+		signature      string
+		expectErr      error
+		expectDownload bool
+	}{
+		{
+			title:          "valid signature",
+			checksum:       checksum,
+			signature:      signature.Sign(private, "artifact", checksum),
+			expectErr:      nil,
+			expectDownload: true,
+		},
+		{
+			title:          "signature of other checksum",
+			checksum:       checksum,
+			signature:      signature.Sign(private, "artifact", "other"),
+			expectErr:      signature.ErrInvalidSignature,
+			expectDownload: false,
+		},
+		{
+			title:          "missing signature",
+			checksum:       checksum,
+			signature:      "",
+			expectErr:      signature.ErrMissingSignature,
+			expectDownload: false,
+		},
+		{
+			title:          "missing checksum",
+			checksum:       "",
+			signature:      signature.Sign(private, "artifact", ""),
+			expectErr:      ErrDownloadFailed,
+			expectDownload: false,
+		},
+	}
+
+	// test cases run sequentially, as they check if the server received a request
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			before := requests.Load()
+
+			opts := DownloadOpts{
+				Checksum:   tc.checksum,
+				PublicKey:  public,
+				ArtifactID: "artifact",
+				Signature:  tc.signature,
+			}
+			err := DownloadWithOpts(context.TODO(), srv.URL, filepath.Join(t.TempDir(), "file"), opts)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected %v got %v", tc.expectErr, err)
+			}
+
+			if downloaded := requests.Load() > before; downloaded != tc.expectDownload {
+				t.Fatalf("expected download %t got %t", tc.expectDownload, downloaded)
+			}
+		})
+	}
+}
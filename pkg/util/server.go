@@ -0,0 +1,38 @@
+package util
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// DefaultKeepAliveTimeout is the default time an idle connection is kept open
+const DefaultKeepAliveTimeout = 2 * time.Minute
+
+// HTTPServerOpts defines the options for the http servers
+type HTTPServerOpts struct {
+	// H2C enables HTTP/2 over cleartext connections (h2c) besides HTTP/1.1, so clients can
+	// multiplex requests over a connection without TLS. Intended for internal use.
+	H2C bool
+	// KeepAliveTimeout is the time an idle connection is kept open waiting for the next request.
+	// If 0, keep-alives are disabled and HTTP/1.1 connections are closed after each request.
+	KeepAliveTimeout time.Duration
+}
+
+// NewHTTPServer returns a http server for the handler configured with the options
+func NewHTTPServer(addr string, handler http.Handler, opts HTTPServerOpts) *http.Server {
+	if opts.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: opts.KeepAliveTimeout})
+	}
+
+	srv := &http.Server{ //nolint:gosec
+		Addr:        addr,
+		Handler:     handler,
+		IdleTimeout: opts.KeepAliveTimeout,
+	}
+	srv.SetKeepAlivesEnabled(opts.KeepAliveTimeout > 0)
+
+	return srv
+}
@@ -0,0 +1,102 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func TestHTTPServer(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+
+	testCases := []struct {
+		title           string
+		opts            HTTPServerOpts
+		http2           bool
+		expectErr       bool
+		expectProto     string
+		expectKeepAlive bool
+	}{
+		{
+			title:           "http/1.1 with keep-alive",
+			opts:            HTTPServerOpts{KeepAliveTimeout: DefaultKeepAliveTimeout},
+			expectProto:     "HTTP/1.1",
+			expectKeepAlive: true,
+		},
+		{
+			title:       "keep-alive disabled",
+			opts:        HTTPServerOpts{},
+			expectProto: "HTTP/1.1",
+		},
+		{
+			title:       "h2c",
+			opts:        HTTPServerOpts{H2C: true, KeepAliveTimeout: DefaultKeepAliveTimeout},
+			http2:       true,
+			expectProto: "HTTP/2.0",
+		},
+		{
+			title:     "h2c not enabled",
+			opts:      HTTPServerOpts{KeepAliveTimeout: DefaultKeepAliveTimeout},
+			http2:     true,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewUnstartedServer(nil)
+			srv.Config = NewHTTPServer("", handler, tc.opts)
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			client := srv.Client()
+			if tc.http2 {
+				// HTTP/2 with prior knowledge over a cleartext connection
+				client = &http.Client{
+					Transport: &http2.Transport{
+						AllowHTTP: true,
+						DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+							return (&net.Dialer{}).DialContext(ctx, network, addr)
+						},
+					},
+					Timeout: time.Second,
+				}
+			}
+
+			resp, err := client.Get(srv.URL) //nolint:noctx
+			if tc.expectErr {
+				if err == nil {
+					_ = resp.Body.Close()
+					t.Fatalf("expected error got %s", resp.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected %v", err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if resp.Proto != tc.expectProto {
+				t.Fatalf("expected %s got %s", tc.expectProto, resp.Proto)
+			}
+
+			if !tc.http2 && resp.Close == tc.expectKeepAlive {
+				t.Fatalf("expected keep-alive %t got connection close %t", tc.expectKeepAlive, resp.Close)
+			}
+		})
+	}
+}
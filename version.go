@@ -0,0 +1,9 @@
+package k6build
+
+// Version is the version of k6build. It is set at build time using ldflags
+var Version = "devel" //nolint:gochecknoglobals
+
+// UserAgent is the default User-Agent header used in the requests made by k6build
+// to other services (e.g. build service, object store, catalog).
+// It can be overridden to identify the application embedding k6build
+var UserAgent = "k6build/" + Version //nolint:gochecknoglobals